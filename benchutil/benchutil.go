@@ -0,0 +1,192 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package benchutil measures the throughput of a watcher, in events per
+// second and allocations per event, on the hardware and configuration it
+// runs on.
+//
+// Run measures once, for capacity planning; Benchmark reports the same
+// figures from a testing benchmark:
+//
+//	func BenchmarkWatcher(b *testing.B) {
+//		benchutil.Benchmark(b, benchutil.Config{Op: benchutil.Create})
+//	}
+package benchutil
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/howeyc/fsnotify"
+)
+
+// Op is the file operation generating the load.
+type Op int
+
+const (
+	Create Op = iota // Create a new file for each event
+	Modify           // Write to a different existing file for each event
+)
+
+// Config describes a measurement.
+type Config struct {
+	Op     Op  // Operation generating each event
+	Events int // Number of events to generate (Run only; default 1000)
+
+	// Timeout bounds the wait for the events after the load is generated
+	// (default 10s).
+	Timeout time.Duration
+
+	// NewWatcher creates the watcher to measure, configured as in
+	// production (default fsnotify.NewWatcher).
+	NewWatcher func() (*fsnotify.Watcher, error)
+}
+
+// A Result is the outcome of a measurement. Allocations include those of
+// generating the load, which is done in the same process.
+type Result struct {
+	Events         int           // Events received
+	Duration       time.Duration // Time from the first operation to the last event
+	EventsPerSec   float64
+	AllocsPerEvent float64
+	BytesPerEvent  float64
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%d events in %s: %.0f events/s, %.1f allocs/event, %.0f B/event",
+		r.Events, r.Duration, r.EventsPerSec, r.AllocsPerEvent, r.BytesPerEvent)
+}
+
+// ErrTimeout is returned when not all events arrived before the timeout.
+var ErrTimeout = errors.New("benchutil: timed out waiting for events")
+
+// Run generates cfg.Events events in a temporary directory and measures
+// how fast the watcher delivers them.
+func Run(cfg Config) (Result, error) {
+	if cfg.Events <= 0 {
+		cfg.Events = 1000
+	}
+	return run(cfg, cfg.Events, nil)
+}
+
+// Benchmark generates b.N events and reports events/s and allocs/event
+// as metrics of the benchmark.
+func Benchmark(b *testing.B, cfg Config) {
+	r, err := run(cfg, b.N, b)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(r.EventsPerSec, "events/s")
+	b.ReportMetric(r.AllocsPerEvent, "allocs/event")
+}
+
+func run(cfg Config, n int, b *testing.B) (Result, error) {
+	var r Result
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.NewWatcher == nil {
+		cfg.NewWatcher = fsnotify.NewWatcher
+	}
+	dir, err := ioutil.TempDir("", "fsnotify-benchutil")
+	if err != nil {
+		return r, err
+	}
+	defer os.RemoveAll(dir)
+
+	names := make([]string, n)
+	for i := range names {
+		names[i] = filepath.Join(dir, fmt.Sprintf("f%07d", i))
+		if cfg.Op == Modify {
+			if err := ioutil.WriteFile(names[i], nil, 0666); err != nil {
+				return r, err
+			}
+		}
+	}
+
+	w, err := cfg.NewWatcher()
+	if err != nil {
+		return r, err
+	}
+	defer w.Close()
+	if err := w.Watch(dir); err != nil {
+		return r, err
+	}
+
+	want := make(map[string]bool, n)
+	for _, name := range names {
+		want[name] = true
+	}
+	received := make(chan int)
+	go func() {
+		count := 0
+		for ev := range w.Event {
+			if want[ev.Name] && ((cfg.Op == Create && ev.IsCreate()) || (cfg.Op == Modify && ev.IsModify())) {
+				delete(want, ev.Name)
+				if count++; count == n {
+					break
+				}
+			}
+		}
+		received <- count
+		for range w.Event {
+		}
+	}()
+	go func() {
+		for range w.Error {
+		}
+	}()
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	if b != nil {
+		b.ResetTimer()
+	}
+	start := time.Now()
+	for _, name := range names {
+		if err := touch(cfg.Op, name); err != nil {
+			return r, err
+		}
+	}
+	select {
+	case r.Events = <-received:
+	case <-time.After(cfg.Timeout):
+		return r, ErrTimeout
+	}
+	r.Duration = time.Since(start)
+	if b != nil {
+		b.StopTimer()
+	}
+	runtime.ReadMemStats(&after)
+
+	r.EventsPerSec = float64(r.Events) / r.Duration.Seconds()
+	r.AllocsPerEvent = float64(after.Mallocs-before.Mallocs) / float64(r.Events)
+	r.BytesPerEvent = float64(after.TotalAlloc-before.TotalAlloc) / float64(r.Events)
+	return r, nil
+}
+
+func touch(op Op, name string) error {
+	flags := os.O_WRONLY | os.O_CREATE
+	if op == Modify {
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(name, flags, 0666)
+	if err != nil {
+		return err
+	}
+	if op == Modify {
+		if _, err := f.Write([]byte{'x'}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
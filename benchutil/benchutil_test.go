@@ -0,0 +1,28 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package benchutil
+
+import "testing"
+
+func TestRun(t *testing.T) {
+	for _, op := range []Op{Create, Modify} {
+		r, err := Run(Config{Op: op, Events: 100})
+		if err != nil {
+			t.Fatalf("Run(%d) failed: %s", op, err)
+		}
+		if r.Events != 100 {
+			t.Fatalf("incorrect number of events received (%d vs %d)", r.Events, 100)
+		}
+		t.Log(r)
+	}
+}
+
+func BenchmarkCreate(b *testing.B) {
+	Benchmark(b, Config{Op: Create})
+}
+
+func BenchmarkModify(b *testing.B) {
+	Benchmark(b, Config{Op: Modify})
+}
@@ -0,0 +1,13 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build freebsd openbsd netbsd darwin dragonfly
+
+package main
+
+const limitAdvice = "raise the file descriptor limit with ulimit -n"
+
+func checkLimits() {
+	checkFileLimit(10240, "kqueue uses one file descriptor for every watched file")
+}
@@ -0,0 +1,84 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const limitAdvice = "raise fs.inotify.max_user_watches and fs.inotify.max_user_instances with sysctl, or stop other watching processes"
+
+// inotifyLimits are the inotify sysctls and the values below which
+// watching large trees tends to fail.
+var inotifyLimits = []struct {
+	name string
+	min  int
+}{
+	{"max_user_watches", 65536},
+	{"max_user_instances", 128},
+	{"max_queued_events", 16384},
+}
+
+func checkLimits() {
+	for _, l := range inotifyLimits {
+		path := "/proc/sys/fs/inotify/" + l.name
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			report(warn, "cannot read "+path+": "+err.Error(), "")
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			report(warn, "cannot parse "+path+": "+err.Error(), "")
+			continue
+		}
+		finding := fmt.Sprintf("fs.inotify.%s = %d", l.name, n)
+		if n < l.min {
+			report(warn, finding, fmt.Sprintf("raise it to at least %d: sysctl fs.inotify.%s=%d", l.min, l.name, l.min))
+		} else {
+			report(ok, finding, "")
+		}
+	}
+	checkFileLimit(1024, "each watcher uses one file descriptor")
+}
+
+// Magic numbers of file systems (see statfs(2)), and whether changes made
+// through other machines or the host go unreported.
+var fsMagics = map[int64]struct {
+	name   string
+	remote bool
+}{
+	0xEF53:     {"ext2/3/4", false},
+	0x58465342: {"xfs", false},
+	0x9123683E: {"btrfs", false},
+	0x01021994: {"tmpfs", false},
+	0x794C7630: {"overlayfs", false},
+	0x6969:     {"nfs", true},
+	0xFF534D42: {"cifs", true},
+	0xFE534D42: {"smb2", true},
+	0x517B:     {"smb", true},
+	0x65735546: {"fuse", true},
+	0x01021997: {"9p", true},
+	0x786F4256: {"vboxsf", true},
+	0x00C36400: {"ceph", true},
+}
+
+func fsType(path string) (name string, remote bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", false
+	}
+	fs, found := fsMagics[int64(st.Type)]
+	if !found {
+		return fmt.Sprintf("file system 0x%x", st.Type), false
+	}
+	return fs.name, fs.remote
+}
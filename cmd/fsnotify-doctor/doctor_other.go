@@ -0,0 +1,19 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux,!windows,!freebsd,!openbsd,!netbsd,!dragonfly,!darwin,!solaris
+
+package main
+
+const limitAdvice = ""
+
+// There are no notifications to limit; fsnotify polls every watch.
+func checkLimits() {
+	report(warn, "no file system notifications on this platform", "fsnotify polls every watched path")
+}
+
+// The file system type is not reported here.
+func fsType(path string) (name string, remote bool) {
+	return "", false
+}
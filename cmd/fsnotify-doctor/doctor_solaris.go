@@ -0,0 +1,37 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build solaris
+
+package main
+
+import "syscall"
+
+const limitAdvice = "raise the process.max-port-events resource control with prctl"
+
+func checkLimits() {
+	checkFileLimit(1024, "each watcher uses one file descriptor")
+}
+
+// File systems whose changes made through other machines go unreported.
+var remoteFS = map[string]bool{
+	"nfs":   true,
+	"smbfs": true,
+}
+
+func fsType(path string) (name string, remote bool) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return "", false
+	}
+	var b []byte
+	for _, c := range st.Fstype {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	name = string(b)
+	return name, remoteFS[name]
+}
@@ -0,0 +1,27 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux freebsd openbsd netbsd darwin dragonfly solaris
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// checkFileLimit reports the file descriptor limit, warning below min.
+func checkFileLimit(min uint64, usage string) {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		report(warn, "cannot read the file descriptor limit: "+err.Error(), "")
+		return
+	}
+	finding := fmt.Sprintf("file descriptor limit = %d (hard %d)", uint64(rl.Cur), uint64(rl.Max))
+	if uint64(rl.Cur) < min {
+		report(warn, finding, fmt.Sprintf("%s; raise it with ulimit -n", usage))
+	} else {
+		report(ok, finding, "")
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build windows
+
+package main
+
+import "strings"
+
+const limitAdvice = ""
+
+// Windows has no notification limits beyond the buffer of each watch.
+func checkLimits() {
+	report(ok, "no notification limits on Windows", "")
+}
+
+// Only network shares are told apart, by their UNC paths.
+func fsType(path string) (name string, remote bool) {
+	if strings.HasPrefix(path, `\\`) {
+		return "network share", true
+	}
+	return "", false
+}
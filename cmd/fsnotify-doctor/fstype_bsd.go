@@ -0,0 +1,36 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build freebsd darwin dragonfly
+
+package main
+
+import "syscall"
+
+// File systems whose changes made through other machines go unreported.
+var remoteFS = map[string]bool{
+	"nfs":     true,
+	"smbfs":   true,
+	"afpfs":   true,
+	"webdav":  true,
+	"fusefs":  true,
+	"osxfuse": true,
+	"macfuse": true,
+}
+
+func fsType(path string) (name string, remote bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", false
+	}
+	var b []byte
+	for _, c := range st.Fstypename {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	name = string(b)
+	return name, remoteFS[name]
+}
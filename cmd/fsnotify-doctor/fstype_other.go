@@ -0,0 +1,12 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build openbsd netbsd
+
+package main
+
+// The file system type is not reported here.
+func fsType(path string) (name string, remote bool) {
+	return "", false
+}
@@ -0,0 +1,173 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Fsnotify-doctor inspects the system for conditions that stop file system
+// notifications from working and runs a live self-test.
+//
+// Usage:
+//
+//	fsnotify-doctor [path ...]
+//
+// It reports the notification and file descriptor limits, whether it runs
+// in a container and the file system type of each path, which defaults to
+// the current directory. Each finding is printed as OK, WARN or FAIL; the
+// exit status is 1 if anything failed.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/howeyc/fsnotify"
+)
+
+type level int
+
+const (
+	ok level = iota
+	warn
+	fail
+)
+
+var levelNames = []string{"OK", "WARN", "FAIL"}
+
+var failed bool
+
+// report prints a finding and, unless it is OK, advice on fixing it.
+func report(l level, finding, advice string) {
+	fmt.Printf("%-4s  %s\n", levelNames[l], finding)
+	if l != ok && advice != "" {
+		fmt.Printf("      %s\n", advice)
+	}
+	if l == fail {
+		failed = true
+	}
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: fsnotify-doctor [path ...]\n")
+		flag.PrintDefaults()
+	}
+	timeout := flag.Duration("timeout", 2*time.Second, "how long the self-test waits for an event")
+	flag.Parse()
+	paths := flag.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	checkLimits()
+	checkContainer()
+	for _, path := range paths {
+		checkPath(path)
+	}
+	selfTest(*timeout)
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// checkContainer reports whether the process runs in a container, where
+// events for bind mounted paths changed from the host may not be seen.
+func checkContainer() {
+	if name := containerName(); name != "" {
+		report(warn, "running in a container ("+name+")",
+			"changes made on the host to bind mounted or shared volumes may not be reported inside the container")
+		return
+	}
+	report(ok, "not running in a container", "")
+}
+
+func containerName() string {
+	if _, err := os.Stat("/.dockerenv"); err == nil {
+		return "docker"
+	}
+	if _, err := os.Stat("/run/.containerenv"); err == nil {
+		return "podman"
+	}
+	cgroup, err := ioutil.ReadFile("/proc/1/cgroup")
+	if err != nil {
+		return ""
+	}
+	for _, name := range []string{"kubepods", "docker", "containerd", "lxc"} {
+		if strings.Contains(string(cgroup), name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// checkPath reports the file system of path, warning about file systems
+// whose changes made elsewhere are not reported.
+func checkPath(path string) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	if _, err := os.Stat(abs); err != nil {
+		report(fail, fmt.Sprintf("%s: %s", abs, err), "")
+		return
+	}
+	fstype, remote := fsType(abs)
+	switch {
+	case fstype == "":
+		report(ok, abs+": file system type unknown", "")
+	case remote:
+		report(warn, abs+": on "+fstype,
+			"changes made by other machines or the host are not reported on this file system; poll it instead")
+	default:
+		report(ok, abs+": on "+fstype, "")
+	}
+}
+
+// selfTest watches a fresh directory and checks a create is reported.
+func selfTest(timeout time.Duration) {
+	dir, err := ioutil.TempDir("", "fsnotify-doctor")
+	if err != nil {
+		report(fail, "self-test: creating directory: "+err.Error(), "")
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		report(fail, "self-test: creating watcher: "+err.Error(), limitAdvice)
+		return
+	}
+	defer watcher.Close()
+	if err := watcher.Watch(dir); err != nil {
+		report(fail, "self-test: watching "+dir+": "+err.Error(), limitAdvice)
+		return
+	}
+
+	name := filepath.Join(dir, "probe")
+	start := time.Now()
+	if err := ioutil.WriteFile(name, nil, 0600); err != nil {
+		report(fail, "self-test: creating file: "+err.Error(), "")
+		return
+	}
+	deadline := time.After(timeout)
+	for {
+		select {
+		case ev := <-watcher.Event:
+			if ev.Name == name && ev.IsCreate() {
+				report(ok, fmt.Sprintf("self-test: create reported after %s", time.Since(start)), "")
+				return
+			}
+		case err := <-watcher.Error:
+			report(fail, "self-test: "+err.Error(), "")
+			return
+		case <-deadline:
+			report(fail, fmt.Sprintf("self-test: no create reported within %s", timeout),
+				"notifications do not work for the temporary directory "+os.TempDir())
+			return
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Fsnotifyd owns the file system watches of several processes, so that
+// tools watching the same trees share one set of kernel watches.
+//
+// Usage:
+//
+//	fsnotifyd [-socket path]
+//
+// Programs using fsnotify.NewSharedWatcher connect to it automatically.
+// The socket defaults to fsnotify.DaemonSocket, and is made private to the
+// user as by fsnotify.ListenDaemon.
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+
+	"github.com/howeyc/fsnotify"
+)
+
+func main() {
+	socket := flag.String("socket", fsnotify.DaemonSocket(), "path of the unix socket to listen on")
+	flag.Parse()
+
+	// A socket left behind by a daemon that died prevents listening
+	if conn, err := net.Dial("unix", *socket); err == nil {
+		conn.Close()
+		log.Fatalf("fsnotifyd: a daemon is already listening on %s", *socket)
+	}
+	os.Remove(*socket)
+
+	l, err := fsnotify.ListenDaemon(*socket)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	stopped := make(chan bool)
+	go func() {
+		<-sig
+		close(stopped)
+		l.Close()
+	}()
+
+	log.Printf("fsnotifyd: listening on %s", *socket)
+	if err := fsnotify.ServeDaemon(l); err != nil {
+		select {
+		case <-stopped:
+		default:
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/howeyc/fsnotify"
+)
+
+// TestMain runs the command itself when the test binary is started by
+// TestDaemonDefaultSocket.
+func TestMain(m *testing.M) {
+	if os.Getenv("FSNOTIFYD_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestDaemonDefaultSocket(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skipf("no default daemon socket on %s", runtime.GOOS)
+	}
+	tmp, err := ioutil.TempDir("", "fsnotifyd")
+	if err != nil {
+		t.Fatalf("failed to create test directory: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// Without $XDG_RUNTIME_DIR, as on macOS, the socket is in a directory
+	// of the user in the temporary directory, which does not exist yet
+	env := []string{"FSNOTIFYD_TEST_MAIN=1", "TMPDIR=" + tmp}
+	for _, kv := range os.Environ() {
+		switch strings.SplitN(kv, "=", 2)[0] {
+		case "XDG_RUNTIME_DIR", "FSNOTIFY_SOCKET", "TMPDIR":
+		default:
+			env = append(env, kv)
+		}
+	}
+	dir := filepath.Join(tmp, fmt.Sprintf("fsnotify-%d", os.Getuid()))
+	socket := filepath.Join(dir, "fsnotify.sock")
+
+	var out bytes.Buffer
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = env
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("starting fsnotifyd failed: %s", err)
+	}
+	exited := make(chan bool)
+	var waitErr error
+	go func() {
+		waitErr = cmd.Wait()
+		close(exited)
+	}()
+	defer func() {
+		cmd.Process.Signal(os.Interrupt)
+		select {
+		case <-exited:
+		case <-time.After(5 * time.Second):
+			cmd.Process.Kill()
+			t.Error("fsnotifyd did not exit after an interrupt")
+		}
+	}()
+
+	var s *fsnotify.SharedWatcher
+	for i := 0; i < 100 && s == nil; i++ {
+		select {
+		case <-exited:
+			t.Fatalf("fsnotifyd exited: %v\n%s", waitErr, out.String())
+		case <-time.After(50 * time.Millisecond):
+		}
+		s, err = fsnotify.DialDaemon(socket)
+	}
+	if s == nil {
+		t.Fatalf("connecting to fsnotifyd at %s failed: %s", socket, err)
+	}
+	s.Close()
+
+	for _, tt := range []struct {
+		name string
+		perm os.FileMode
+	}{{dir, 0700}, {socket, 0600}} {
+		fi, err := os.Lstat(tt.name)
+		if err != nil {
+			t.Fatalf("Lstat(%q) failed: %s", tt.name, err)
+		}
+		if perm := fi.Mode().Perm(); perm != tt.perm {
+			t.Errorf("%s has mode %o, expected %o", tt.name, perm, tt.perm)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package conformance runs a standard battery of file system scenarios
+// against a watcher and checks the events it reports.
+//
+// The scenarios pin down the events every backend must report. A backend
+// may report additional events, but the expected ones must appear in order.
+// Where platforms legitimately differ, an expected event accepts more than
+// one operation.
+package conformance
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/howeyc/fsnotify"
+)
+
+// Op is a normalized file system operation.
+type Op uint32
+
+const (
+	Create Op = 1 << iota
+	Modify
+	Delete
+	Rename
+)
+
+var opNames = []string{"CREATE", "MODIFY", "DELETE", "RENAME"}
+
+// String formats op in the form "CREATE|MODIFY|...".
+func (op Op) String() string {
+	var names []string
+	for i, name := range opNames {
+		if op&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// An Event is a normalized event.
+type Event struct {
+	Name string // Path of the file
+	Op   Op     // Operations reported for the file
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%q: %s", e.Name, e.Op)
+}
+
+// A Watcher is a watcher under test. Close must close the Events and
+// Errors channels.
+type Watcher interface {
+	Watch(path string) error
+	Events() <-chan Event
+	Errors() <-chan error
+	Close() error
+}
+
+type adapter struct {
+	w      *fsnotify.Watcher
+	events chan Event
+}
+
+// Adapt returns w as a Watcher, normalizing its events.
+func Adapt(w *fsnotify.Watcher) Watcher {
+	a := &adapter{w: w, events: make(chan Event)}
+	go func() {
+		for ev := range w.Event {
+			a.events <- Normalize(ev)
+		}
+		close(a.events)
+	}()
+	return a
+}
+
+// NewWatcher returns an adapted fsnotify.Watcher for the native backend.
+func NewWatcher() (Watcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return Adapt(w), nil
+}
+
+func (a *adapter) Watch(path string) error { return a.w.Watch(path) }
+func (a *adapter) Events() <-chan Event    { return a.events }
+func (a *adapter) Errors() <-chan error    { return a.w.Error }
+func (a *adapter) Close() error            { return a.w.Close() }
+
+// Normalize returns the normalized form of ev.
+func Normalize(ev *fsnotify.FileEvent) Event {
+	var op Op
+	if ev.IsCreate() {
+		op |= Create
+	}
+	if ev.IsModify() {
+		op |= Modify
+	}
+	if ev.IsDelete() {
+		op |= Delete
+	}
+	if ev.IsRename() {
+		op |= Rename
+	}
+	return Event{Name: filepath.Clean(ev.Name), Op: op}
+}
+
+// A Scenario is a sequence of file system operations and the events it
+// must produce. Names are relative to the watched directory.
+type Scenario struct {
+	Name  string
+	Setup func(dir string) error // Prepares dir before it is watched
+	Run   func(dir string) error // Performs the operations in dir while it is watched
+	Want  []Event                // Expected events, in order; each Op lists the accepted operations
+}
+
+func writeFile(name, data string) error {
+	return ioutil.WriteFile(name, []byte(data), 0666)
+}
+
+func appendFile(name, data string) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func outside(dir string) string {
+	return dir + ".outside"
+}
+
+// Scenarios is the standard battery.
+var Scenarios = []Scenario{
+	{
+		Name: "create",
+		Run:  func(dir string) error { return writeFile(filepath.Join(dir, "file"), "") },
+		Want: []Event{{"file", Create}},
+	},
+	{
+		Name:  "append",
+		Setup: func(dir string) error { return writeFile(filepath.Join(dir, "file"), "data") },
+		Run:   func(dir string) error { return appendFile(filepath.Join(dir, "file"), "more data") },
+		Want:  []Event{{"file", Modify}},
+	},
+	{
+		// The temporary file may be gone before its create is reported, and
+		// Windows reports the new name of a rename rather than a create
+		Name:  "atomic save",
+		Setup: func(dir string) error { return writeFile(filepath.Join(dir, "file"), "data") },
+		Run: func(dir string) error {
+			if err := writeFile(filepath.Join(dir, ".file.tmp"), "new data"); err != nil {
+				return err
+			}
+			return os.Rename(filepath.Join(dir, ".file.tmp"), filepath.Join(dir, "file"))
+		},
+		Want: []Event{{"file", Create | Rename}},
+	},
+	{
+		Name:  "rename in",
+		Setup: func(dir string) error { return writeFile(filepath.Join(outside(dir), "file"), "data") },
+		Run: func(dir string) error {
+			return os.Rename(filepath.Join(outside(dir), "file"), filepath.Join(dir, "file"))
+		},
+		Want: []Event{{"file", Create}},
+	},
+	{
+		// Windows reports moving a file out of the watched directory as a delete
+		Name:  "rename out",
+		Setup: func(dir string) error { return writeFile(filepath.Join(dir, "file"), "data") },
+		Run: func(dir string) error {
+			return os.Rename(filepath.Join(dir, "file"), filepath.Join(outside(dir), "file"))
+		},
+		Want: []Event{{"file", Rename | Delete}},
+	},
+	{
+		Name:  "rmdir",
+		Setup: func(dir string) error { return os.Mkdir(filepath.Join(dir, "sub"), 0755) },
+		Run:   func(dir string) error { return os.Remove(filepath.Join(dir, "sub")) },
+		Want:  []Event{{"sub", Delete}},
+	},
+	{
+		Name:  "chmod",
+		Setup: func(dir string) error { return writeFile(filepath.Join(dir, "file"), "data") },
+		Run:   func(dir string) error { return os.Chmod(filepath.Join(dir, "file"), 0400) },
+		Want:  []Event{{"file", Modify}},
+	},
+	{
+		Name:  "symlink",
+		Setup: func(dir string) error { return writeFile(filepath.Join(dir, "file"), "data") },
+		Run:   func(dir string) error { return os.Symlink(filepath.Join(dir, "file"), filepath.Join(dir, "link")) },
+		Want:  []Event{{"link", Create}},
+	},
+	{
+		Name: "remove symlink",
+		Setup: func(dir string) error {
+			if err := writeFile(filepath.Join(dir, "file"), "data"); err != nil {
+				return err
+			}
+			return os.Symlink(filepath.Join(dir, "file"), filepath.Join(dir, "link"))
+		},
+		Run:  func(dir string) error { return os.Remove(filepath.Join(dir, "link")) },
+		Want: []Event{{"link", Delete}},
+	},
+}
+
+// Timeout is how long Run waits for the expected events of a scenario.
+var Timeout = 2 * time.Second
+
+// Run runs each of the Scenarios as a subtest, with a watcher created by
+// newWatcher watching a fresh directory.
+func Run(t *testing.T, newWatcher func() (Watcher, error)) {
+	RunIn(t, "", newWatcher)
+}
+
+// RunIn is like Run, but creates the directories watched in base, on the
+// file system to test, rather than in the default temporary directory. It
+// returns the results as a capability report (see fsnotify.Capabilities).
+func RunIn(t *testing.T, base string, newWatcher func() (Watcher, error)) *fsnotify.CapabilityReport {
+	report := &fsnotify.CapabilityReport{
+		Version: fsnotify.CapabilityReportVersion,
+		Path:    base,
+		GOOS:    runtime.GOOS,
+	}
+	for _, sc := range Scenarios {
+		sc := sc
+		status := "skip"
+		t.Run(sc.Name, func(t *testing.T) {
+			defer func() {
+				if !t.Skipped() {
+					status = "pass"
+					if t.Failed() {
+						status = "fail"
+					}
+				}
+			}()
+			RunScenarioIn(t, sc, base, newWatcher)
+		})
+		report.Results = append(report.Results, fsnotify.ScenarioResult{Scenario: sc.Name, Status: status})
+	}
+	return report
+}
+
+// RunScenario runs a single scenario.
+func RunScenario(t *testing.T, sc Scenario, newWatcher func() (Watcher, error)) {
+	RunScenarioIn(t, sc, "", newWatcher)
+}
+
+// RunScenarioIn runs a single scenario in a directory created in base (see
+// RunIn).
+func RunScenarioIn(t *testing.T, sc Scenario, base string, newWatcher func() (Watcher, error)) {
+	dir, err := ioutil.TempDir(base, "fsnotify-conformance")
+	if err != nil {
+		t.Fatalf("failed to create test directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(outside(dir), 0755); err != nil {
+		t.Fatalf("failed to create test directory: %s", err)
+	}
+	defer os.RemoveAll(outside(dir))
+
+	if sc.Setup != nil {
+		if err := sc.Setup(dir); err != nil {
+			t.Skipf("setup not supported: %s", err)
+		}
+	}
+
+	w, err := newWatcher()
+	if err != nil {
+		t.Fatalf("creating watcher failed: %s", err)
+	}
+	var (
+		mu   sync.Mutex
+		got  []Event
+		errs []error
+	)
+	eventsDone, errorsDone := make(chan struct{}), make(chan struct{})
+	go func() {
+		for ev := range w.Events() {
+			mu.Lock()
+			got = append(got, ev)
+			mu.Unlock()
+		}
+		close(eventsDone)
+	}()
+	go func() {
+		for err := range w.Errors() {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}
+		close(errorsDone)
+	}()
+	// The errors are reported once the goroutines are done, before the
+	// test returns
+	closed := false
+	stop := func() {
+		if closed {
+			return
+		}
+		closed = true
+		w.Close()
+		<-eventsDone
+		<-errorsDone
+		for _, err := range errs {
+			t.Errorf("error received: %s", err)
+		}
+	}
+	defer stop()
+
+	if err := w.Watch(dir); err != nil {
+		t.Fatalf("watching %q failed: %s", dir, err)
+	}
+
+	if err := sc.Run(dir); err != nil {
+		t.Skipf("operation not supported: %s", err)
+	}
+
+	want := make([]Event, len(sc.Want))
+	for i, ev := range sc.Want {
+		want[i] = Event{Name: filepath.Join(dir, ev.Name), Op: ev.Op}
+	}
+	deadline := time.Now().Add(Timeout)
+	for {
+		mu.Lock()
+		n := matched(got, want)
+		mu.Unlock()
+		if n == len(want) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop()
+
+	if n := matched(got, want); n < len(want) {
+		t.Errorf("missing event %s (want %v, got %v)", want[n], want, got)
+	}
+}
+
+// matched returns how many of the wanted events appear in order in got.
+// An event matches if it reports only operations the wanted one accepts.
+func matched(got, want []Event) int {
+	n := 0
+	for _, ev := range got {
+		if n == len(want) {
+			break
+		}
+		if ev.Name == want[n].Name && ev.Op != 0 && ev.Op&^want[n].Op == 0 {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,28 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package conformance
+
+import "testing"
+
+func TestNativeBackend(t *testing.T) {
+	Run(t, NewWatcher)
+}
+
+func TestMatched(t *testing.T) {
+	want := []Event{{"file", Create | Rename}, {"file", Delete}}
+	for _, tt := range []struct {
+		got []Event
+		n   int
+	}{
+		{[]Event{{"file", Rename}, {"file", Delete}}, 2},
+		{[]Event{{"other", Create}, {"file", Create}, {"file", Modify}, {"file", Delete}}, 2},
+		{[]Event{{"file", Create | Delete}, {"file", Delete}}, 0},
+		{[]Event{{"file", Create}, {"file", Delete | Modify}}, 1},
+	} {
+		if n := matched(tt.got, want); n != tt.n {
+			t.Errorf("matched(%v, %v) = %d, want %d", tt.got, want, n, tt.n)
+		}
+	}
+}
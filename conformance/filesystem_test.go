@@ -0,0 +1,42 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build fsconformance
+
+package conformance
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"testing"
+)
+
+// Run the battery on the file system of a directory, such as a ZFS, btrfs
+// or SMB mount, with
+//
+//	go test -tags fsconformance -run TestFileSystem ./conformance -dir /mnt/zfs/tmp -report zfs.json
+//
+// The report is read by fsnotify.Capabilities.
+var (
+	dirFlag    = flag.String("dir", "", "directory on the file system to test")
+	reportFlag = flag.String("report", "", "file to write the capability report to")
+)
+
+func TestFileSystem(t *testing.T) {
+	if *dirFlag == "" {
+		t.Skip("no directory given with -dir")
+	}
+	report := RunIn(t, *dirFlag, NewWatcher)
+	if *reportFlag == "" {
+		return
+	}
+	data, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		t.Fatalf("encoding capability report failed: %s", err)
+	}
+	if err := ioutil.WriteFile(*reportFlag, append(data, '\n'), 0666); err != nil {
+		t.Fatalf("writing capability report failed: %s", err)
+	}
+}
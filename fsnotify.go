@@ -5,7 +5,14 @@
 // Package fsnotify implements file system notification.
 package fsnotify
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"time"
+)
 
 const (
 	FSN_CREATE = 1
@@ -18,43 +25,79 @@ const (
 
 // Purge events from interal chan to external chan if passes filter
 func (w *Watcher) purgeEvents() {
+	pprof.SetGoroutineLabels(eventsContext)
 	for ev := range w.internalEvent {
-		sendEvent := false
-		w.fsnmut.Lock()
-		fsnFlags := w.fsnFlags[ev.Name]
-		w.fsnmut.Unlock()
-
-		if (fsnFlags&FSN_CREATE == FSN_CREATE) && ev.IsCreate() {
-			sendEvent = true
+		if w.fair.enabled() {
+			// Hand the events over to the fair queue from now on
+			w.fair.start(w, ev, w.internalEvent)
+			for ev, ok := w.fair.next(); ok; ev, ok = w.fair.next() {
+				w.purgeEvent(ev)
+			}
+			break
 		}
+		w.purgeEvent(ev)
+	}
 
-		if (fsnFlags&FSN_MODIFY == FSN_MODIFY) && ev.IsModify() {
-			sendEvent = true
-		}
+	w.drain.flush(w.emit)
+	close(w.Event)
+	w.order.close()
+}
 
-		if (fsnFlags&FSN_DELETE == FSN_DELETE) && ev.IsDelete() {
-			sendEvent = true
-		}
+// purgeEvent delivers an event from the internal chan if it passes the
+// filter.
+func (w *Watcher) purgeEvent(ev *FileEvent) {
+	if ev.err != nil {
+		w.deliverError(ev.err)
+		return
+	}
+	if w.drain.dropping() {
+		return
+	}
+	if ev.stamp.IsZero() {
+		ev.stamp = time.Now()
+	}
 
-		if (fsnFlags&FSN_RENAME == FSN_RENAME) && ev.IsRename() {
-			sendEvent = true
-		}
+	// A file deleted and quickly recreated loses its flags to the
+	// delete before its create is purged; inherit them from the
+	// directory watch then, as readers do
+	w.fsnmut.Lock()
+	fsnFlags, fsnFound := w.fsnFlags[ev.Name]
+	if !fsnFound {
+		fsnFlags = w.fsnFlags[filepath.Dir(ev.Name)]
+	}
+	w.fsnmut.Unlock()
+	w.noteActivity(ev)
+	if ev.overflow {
+		w.loseEvent(ev)
+	}
 
-		if sendEvent {
-			w.Event <- ev
-		}
+	// Retargets of symlinks, overflows and notifications the system does
+	// not report are delivered whatever the flags
+	if ev.matchesFlags(fsnFlags) || ev.retarget != "" || ev.overflow || ev.ops != 0 {
+		w.deliver(ev, w.emit)
+	}
 
-		// If there's no file, then no more events for user
-		// BSD must keep watch for internal use (watches DELETEs to keep track
-		// what files exist for create events)
-		if ev.IsDelete() {
-			w.fsnmut.Lock()
-			delete(w.fsnFlags, ev.Name)
-			w.fsnmut.Unlock()
-		}
+	w.rewatch(ev)
+
+	// If there's no file, then no more events for user
+	// BSD must keep watch for internal use (watches DELETEs to keep track
+	// what files exist for create events)
+	if ev.IsDelete() {
+		w.fsnmut.Lock()
+		delete(w.fsnFlags, ev.Name)
+		delete(w.handlers, ev.Name)
+		w.fsnmut.Unlock()
 	}
+}
 
-	close(w.Event)
+// matchesFlags reports whether the event is one of the notifications
+// selected by flags (FSN_MODIFY etc.)
+func (e *FileEvent) matchesFlags(flags uint32) bool {
+	return (flags&FSN_CREATE == FSN_CREATE && e.IsCreate()) ||
+		(flags&FSN_MODIFY == FSN_MODIFY && e.IsModify()) ||
+		(flags&FSN_DELETE == FSN_DELETE && e.IsDelete()) ||
+		(flags&FSN_RENAME == FSN_RENAME && e.IsRename()) ||
+		flags&e.ops != 0
 }
 
 // Watch a given file path
@@ -64,18 +107,388 @@ func (w *Watcher) Watch(path string) error {
 
 // Watch a given file path for a particular set of notifications (FSN_MODIFY etc.)
 func (w *Watcher) WatchFlags(path string, flags uint32) error {
+	return w.WatchHandler(path, flags, nil)
+}
+
+// WatchHandler watches a given file path for a particular set of
+// notifications and delivers them to h instead of the Event channel.
+// A nil handler delivers to the Event channel.
+func (w *Watcher) WatchHandler(path string, flags uint32, h EventHandler) error {
+	checked, err := w.checkPath(path)
+	if w.pending.wants(checked, err) {
+		return w.pending.add(w, w.pendingName(path), &pendingPath{arg: path, flags: flags, h: h})
+	}
+	if err != nil {
+		return err
+	}
+	return w.addPath(checked, flags, h, w.watch)
+}
+
+// checkPath resolves path in the root of the watcher and validates it
+// against its policy.
+func (w *Watcher) checkPath(path string) (string, error) {
+	path, err := w.rootPath(path)
+	if err != nil {
+		return "", err
+	}
+	if p := w.pathPolicy(); p != nil {
+		if err := p.validate(path); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
+
+// addPath records the flags and handler of a checked path and adds its
+// kernel watch with watch, unless it shares the watch of a duplicate, is
+// polled or is mocked.
+func (w *Watcher) addPath(path string, flags uint32, h EventHandler, watch func(path string) error) error {
+	primary, err := w.dups.add(path)
+	if err != nil {
+		return err
+	}
 	w.fsnmut.Lock()
 	w.fsnFlags[path] = flags
+	w.handlers[path] = h
 	w.fsnmut.Unlock()
-	return w.watch(path)
+	if primary != "" {
+		// A duplicate shares the watch of primary
+		return nil
+	}
+	reserved, err := w.budget.reserveOnce(path, watchCost(path))
+	if err != nil {
+		w.fsnmut.Lock()
+		delete(w.fsnFlags, path)
+		delete(w.handlers, path)
+		w.fsnmut.Unlock()
+		w.dups.remove(path)
+		return err
+	}
+	if w.mock != nil {
+		watch = w.mock.watch
+	} else if w.polls.wanted(path) {
+		watch = w.polls.add
+	}
+	if err := watch(path); err != nil {
+		if reserved {
+			w.budget.release(path)
+		}
+		return err
+	}
+	w.links.snapshot(path)
+	w.contents.snapshot(path)
+	w.moves.snapshot(path)
+	w.scans.snapshot(path)
+	return nil
+}
+
+// WatchHandlerContext is like WatchHandler, but events are delivered with
+// ctx (see FileEvent.Context) and are dropped once ctx is done.
+func (w *Watcher) WatchHandlerContext(ctx context.Context, path string, flags uint32, h EventHandler) error {
+	return w.WatchHandler(path, flags, contextHandler{ctx: ctx, h: h})
+}
+
+// watching reports whether path was added with Watch and not yet removed.
+func (w *Watcher) watching(path string) bool {
+	w.fsnmut.Lock()
+	defer w.fsnmut.Unlock()
+	_, found := w.handlers[path]
+	return found
+}
+
+// watchedPaths returns the paths added with Watch and not yet removed.
+func (w *Watcher) watchedPaths() []string {
+	w.fsnmut.Lock()
+	defer w.fsnmut.Unlock()
+	paths := make([]string, 0, len(w.handlers))
+	for path := range w.handlers {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
 }
 
 // Remove a watch on a file
 func (w *Watcher) RemoveWatch(path string) error {
+	if w.pending.remove(w.pendingName(path)) {
+		return nil
+	}
+	if resolved, err := w.rootPath(path); err == nil {
+		path = resolved
+	} else {
+		// The path may be gone; watches are removed when that is seen, but
+		// the name is still confined
+		path = w.rootPathLexical(path)
+	}
+	return w.removePath(path)
+}
+
+// removePath removes the watch on a path resolved in the root of the
+// watcher.
+func (w *Watcher) removePath(path string) error {
+	w.trees.remove(path)
 	w.fsnmut.Lock()
 	delete(w.fsnFlags, path)
+	delete(w.handlers, path)
+	w.fsnmut.Unlock()
+	shared, promoted := w.dups.remove(path)
+	if shared {
+		return nil
+	}
+	if promoted != "" {
+		w.budget.move(path, promoted)
+	} else {
+		w.budget.release(path)
+	}
+	if err := w.unwatchPath(path); err != nil {
+		return err
+	}
+	if promoted != "" {
+		return w.watchPath(promoted)
+	}
+	return nil
+}
+
+// SetSizeTracking enables reporting the size of files before and after
+// modifications (see FileEvent.SizeChange). Enable it before adding
+// watches so the initial sizes are known.
+func (w *Watcher) SetSizeTracking(enable bool) {
+	w.setSizeTracking(enable)
+}
+
+// SizeChange reports the size of the file before and after a modification.
+// ok is false if size tracking is not enabled or either size is unknown.
+func (e *FileEvent) SizeChange() (before, after int64, ok bool) {
+	return e.prevSize, e.size, e.sized
+}
+
+// SetXattrTracking enables telling changes to the extended attributes of
+// files, such as quarantine flags and security labels, apart from other
+// attribute changes (see FileEvent.IsXattrChange). It is only supported on
+// Linux. Enable it before adding watches so the initial attributes are known.
+func (w *Watcher) SetXattrTracking(enable bool) {
+	w.setXattrTracking(enable)
+}
+
+// SetScanBudget limits the time spent at once rescanning a changed
+// directory for created files, on BSD and OS X where kqueue only reports
+// that the directory changed. A rescan over budget is resumed in between
+// handling further events, so huge directories delay their create events
+// rather than stalling the watcher. Zero removes the limit; the default is
+// 50ms. Linux and Windows report created files directly and never rescan.
+func (w *Watcher) SetScanBudget(budget time.Duration) {
+	w.setScanBudget(budget)
+}
+
+// defaultScanBudget is the default time limit of directory rescans.
+const defaultScanBudget = 50 * time.Millisecond
+
+// IsXattrChange reports whether the event changed the extended attributes
+// of the file. It requires xattr tracking (see SetXattrTracking).
+func (e *FileEvent) IsXattrChange() bool {
+	return e.xattr
+}
+
+// A Change classifies how a file changed, inferred from its state before
+// and after an event.
+type Change int
+
+const (
+	ChangeUnknown Change = iota // Not inferred (size tracking off, or not a modification)
+	Appended                    // The file grew
+	Truncated                   // The file shrank
+	Rewritten                   // The file was written without changing its size
+	ReplacedInode               // A different file took the place of the file, as in an atomic save
+)
+
+var changeNames = []string{"UNKNOWN", "APPENDED", "TRUNCATED", "REWRITTEN", "REPLACED"}
+
+func (c Change) String() string {
+	if c < 0 || int(c) >= len(changeNames) {
+		return fmt.Sprintf("Change(%d)", int(c))
+	}
+	return changeNames[c]
+}
+
+// Change infers the cause of the event from the state of the file before
+// and after it. Growth is reported as Appended without checking that the
+// earlier content is unchanged. It requires size tracking (see
+// SetSizeTracking); replacement is only detected on Linux.
+func (e *FileEvent) Change() Change {
+	switch {
+	case e.replaced:
+		return ReplacedInode
+	case !e.sized:
+		return ChangeUnknown
+	case e.size > e.prevSize:
+		return Appended
+	case e.size < e.prevSize:
+		return Truncated
+	}
+	return Rewritten
+}
+
+// An EventHandler responds to events for a watched path.
+type EventHandler interface {
+	HandleEvent(ev *FileEvent)
+}
+
+// The EventHandlerFunc type is an adapter to allow the use of
+// ordinary functions as event handlers.
+type EventHandlerFunc func(ev *FileEvent)
+
+// HandleEvent calls f(ev).
+func (f EventHandlerFunc) HandleEvent(ev *FileEvent) {
+	f(ev)
+}
+
+// contextHandler attaches a watch's context to its events.
+type contextHandler struct {
+	ctx context.Context
+	h   EventHandler
+}
+
+func (c contextHandler) HandleEvent(ev *FileEvent) {
+	if c.ctx.Err() != nil {
+		return
+	}
+	ev.ctx = c.ctx
+	c.h.HandleEvent(ev)
+}
+
+// Context returns the context of the watch that delivered the event, as
+// passed to WatchHandlerContext. It defaults to context.Background.
+func (e *FileEvent) Context() context.Context {
+	if e.ctx != nil {
+		return e.ctx
+	}
+	return context.Background()
+}
+
+// A Middleware wraps the delivery of events, like http middleware.
+// It may inspect, tag or drop an event before calling next.
+type Middleware func(next EventHandler) EventHandler
+
+// Use adds middleware around the delivery of all events, both to handlers
+// and to the Event channel. Middleware added first runs first.
+func (w *Watcher) Use(mw ...Middleware) {
+	w.fsnmut.Lock()
+	w.middleware = append(w.middleware, mw...)
 	w.fsnmut.Unlock()
-	return w.removeWatch(path)
+}
+
+// deliver passes an event through the middleware to the handler of its
+// watch, or to send if it belongs on the Event channel, unless its name
+// is ignored (see SetIgnoredNames). With hardlink tracking, a modification
+// is also delivered under the other names of the file, with move
+// correlation, a probable move follows the event completing it, and with
+// move-in scans, the contents of a directory follow its create event.
+func (w *Watcher) deliver(ev *FileEvent, send EventHandlerFunc) {
+	if ev.overflow {
+		w.deliverOverflow(ev, send)
+		return
+	}
+	t := w.steps.timer()
+	t.enter(ignoreStep, true)
+	if w.isIgnored(ev.Name) || w.trees.excluded(filepath.Dir(ev.Name)) || w.suppressed.covers(ev.Name) {
+		t.enter(noStep, false)
+		return
+	}
+	// The parts of a composite event are tracked as if each was delivered
+	parts := ev.parts
+	if parts == nil {
+		parts = []*FileEvent{ev}
+	}
+	t.enter(trackStep, true)
+	var moves []*FileEvent
+	for _, part := range parts {
+		if !part.IsDelete() {
+			part.placeholder = isPlaceholder(part.Name)
+		}
+		w.contents.update(part)
+		w.scans.update(part)
+		if move := w.moves.update(part); move != nil {
+			moves = append(moves, move)
+		}
+	}
+	ev.placeholder = parts[len(parts)-1].placeholder
+	t.enter(noStep, false)
+	w.deliverName(ev, send)
+	t.enter(trackStep, false)
+	var links []string
+	for _, part := range parts {
+		links = append(links, w.links.update(part)...)
+	}
+	t.enter(noStep, false)
+	for _, name := range links {
+		link := *ev
+		link.Name = name
+		if link.matchesFlags(w.flagsFor(name)) {
+			w.deliverName(&link, send)
+		}
+	}
+	for _, move := range moves {
+		w.deliverName(move, send)
+	}
+	if ev.IsCreate() {
+		w.scanMovedIn(ev, send)
+	}
+}
+
+// deliverName delivers an event under its own name only.
+func (w *Watcher) deliverName(ev *FileEvent, send EventHandlerFunc) {
+	var h EventHandler = send
+	if handler := w.handlerFor(ev.Name); handler != nil {
+		h = handler
+	}
+	h = recordingHandler{&w.recent, h}
+	t := w.steps.timer()
+	if t != nil {
+		h = t.wrap(handlerStep, h)
+	}
+	w.fsnmut.Lock()
+	middleware := w.middleware
+	w.fsnmut.Unlock()
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+		if t != nil {
+			h = t.wrap(middlewareStep(i, middleware[i]), h)
+		}
+	}
+	h.HandleEvent(ev)
+}
+
+// flagsFor returns the flags of the watch that would produce an event on
+// name: the watch on name itself, otherwise the watch on its directory.
+func (w *Watcher) flagsFor(name string) uint32 {
+	w.fsnmut.Lock()
+	defer w.fsnmut.Unlock()
+	if flags, found := w.fsnFlags[name]; found {
+		return flags
+	}
+	if flags, found := w.fsnFlags[filepath.Dir(name)]; found {
+		return flags
+	}
+	return FSN_ALL
+}
+
+// handlerFor returns the handler for the watch that produced an event on
+// name: the watch on name itself, otherwise the watch on its directory, or
+// for a tree watched in one piece, on its nearest watched ancestor.
+// It returns nil if the event belongs on the Event channel.
+func (w *Watcher) handlerFor(name string) EventHandler {
+	w.fsnmut.Lock()
+	defer w.fsnmut.Unlock()
+	for {
+		if h, found := w.handlers[name]; found {
+			return h
+		}
+		dir := filepath.Dir(name)
+		if dir == name {
+			return nil
+		}
+		name = dir
+	}
 }
 
 // String formats the event e in the form
@@ -103,6 +516,24 @@ func (e *FileEvent) String() string {
 		events += "|" + "ATTRIB"
 	}
 
+	if e.retarget != "" {
+		events += "|" + "RETARGET"
+	}
+
+	if e.movedFrom != "" {
+		events += "|" + "MOVE"
+	}
+
+	if e.overflow {
+		events += "|" + "OVERFLOW"
+	}
+
+	for n := uint(0); n < userOps; n++ {
+		if e.ops&UserOp(n) != 0 {
+			events += fmt.Sprintf("|USER%d", n)
+		}
+	}
+
 	if len(events) > 0 {
 		events = events[1:]
 	}
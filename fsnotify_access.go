@@ -0,0 +1,40 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import "fmt"
+
+// A MACError is returned when a watch is denied although file permissions
+// allow it, most likely by a mandatory access control policy such as
+// SELinux or AppArmor.
+type MACError struct {
+	Op      string // Denied operation, e.g. "inotify_add_watch"
+	Path    string // Path of the watch
+	Module  string // Security module likely at fault ("SELinux", "AppArmor" or empty if unknown)
+	Context string // Security context of the process, if known
+	Err     error  // Underlying error, usually EACCES
+}
+
+func (e *MACError) Error() string {
+	module := e.Module
+	if module == "" {
+		module = "a security module"
+	}
+	msg := fmt.Sprintf("%s %s: %s; permissions allow access, so %s policy probably denied it", e.Op, e.Path, e.Err, module)
+	if e.Context != "" {
+		msg += fmt.Sprintf(" (process context %s)", e.Context)
+	}
+	switch e.Module {
+	case "SELinux":
+		msg += "; check the audit log with ausearch -m avc"
+	case "AppArmor":
+		msg += "; check the kernel log for apparmor=\"DENIED\""
+	}
+	return msg
+}
+
+func (e *MACError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,24 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestMACError(t *testing.T) {
+	err := error(&MACError{Op: "inotify_add_watch", Path: "/srv/data", Module: "SELinux", Context: "system_u:system_r:httpd_t:s0", Err: syscall.EACCES})
+	if !errors.Is(err, syscall.EACCES) {
+		t.Fatal("MACError does not unwrap to its underlying error")
+	}
+	for _, want := range []string{"inotify_add_watch /srv/data", "SELinux", "httpd_t", "ausearch"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An AuditLog persists selected events to an append-only file before they
+// are handled, as a record of changes kept apart from the processing of
+// the application. Each record is synced to disk before the event is
+// passed on, and is chained to the record before it by a hash.
+//
+// What the chain proves depends on what an attacker can get at. Without a
+// key, the hash is a plain SHA-256, which tells accidental damage but can
+// be recomputed by anyone able to write the file. With a key (see
+// OpenAuditLogKey), it is an HMAC-SHA256, which records cannot be changed,
+// removed or inserted without. Either way, records removed from the end
+// leave a valid chain; to tell them, keep the Head of the log outside the
+// file and pass it to VerifyAuditLogKey.
+//
+// Records have the form "<hex chain hash> <RFC 3339 time> <JSON event>",
+// where the event is the portable form of EventRecord and the chain hash is
+// the hash of the chain hash of the previous record (zero for the first)
+// followed by the rest of the record.
+type AuditLog struct {
+	sel  TriggerSet
+	key  []byte     // Key of the HMAC chaining the records (nil for plain SHA-256)
+	mu   sync.Mutex // Protects access to f, head and err.
+	f    *os.File   // Log of records
+	head AuditHead  // The last record
+	err  error      // First error writing a record
+}
+
+// An AuditHead identifies the last record of an audit log. Kept outside
+// the log, it lets VerifyAuditLogKey tell records removed from the end.
+type AuditHead struct {
+	Records int    // Number of records
+	Hash    string // Hex chain hash of the last record (empty if none)
+}
+
+// An AuditChainError reports a record of an audit log that does not
+// follow from the records before it.
+type AuditChainError struct {
+	Name   string // Name of the log file
+	Record int    // Number of the record, from 1
+	Torn   bool   // Set if the record is incomplete, as when a crash cut it short (see RepairAuditLog)
+}
+
+func (e *AuditChainError) Error() string {
+	if e.Torn {
+		return fmt.Sprintf("fsnotify: audit log %s torn at record %d", e.Name, e.Record)
+	}
+	return fmt.Sprintf("fsnotify: audit log %s broken at record %d", e.Name, e.Record)
+}
+
+// OpenAuditLog opens the audit log kept in the file name, creating it if
+// it does not exist, to record the events selected by sel; a nil sel
+// selects all events. The records are chained without a key. An existing
+// log is verified first; if a crash tore its last record, it fails with
+// an *AuditChainError with Torn set.
+func OpenAuditLog(name string, sel TriggerSet) (*AuditLog, error) {
+	return OpenAuditLogKey(name, nil, sel)
+}
+
+// OpenAuditLogKey is like OpenAuditLog, but chains the records with an
+// HMAC-SHA256 keyed with key.
+func OpenAuditLogKey(name string, key []byte, sel TriggerSet) (*AuditLog, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	head, size, err := scanAuditLog(f, name, key, nil)
+	if err == nil && head.torn {
+		err = &AuditChainError{Name: name, Record: head.Records + 1, Torn: true}
+	}
+	if err == nil {
+		_, err = f.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &AuditLog{sel: sel, key: key, f: f, head: head.AuditHead}, nil
+}
+
+// VerifyAuditLog checks the hash chain of the audit log kept in the file
+// name, chained without a key, returning the number of records. A broken
+// or torn log fails with an *AuditChainError.
+func VerifyAuditLog(name string) (records int, err error) {
+	head, err := VerifyAuditLogKey(name, nil, AuditHead{})
+	return head.Records, err
+}
+
+// VerifyAuditLogKey checks the hash chain of the audit log kept in the
+// file name, chained with key (nil for none), returning its head. If
+// anchor is not zero, the log must still contain the record it names,
+// with the same hash. A broken or torn log, or one that lost the anchor,
+// fails with an *AuditChainError.
+func VerifyAuditLogKey(name string, key []byte, anchor AuditHead) (AuditHead, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return AuditHead{}, err
+	}
+	defer f.Close()
+	var found bool
+	head, _, err := scanAuditLog(f, name, key, func(h AuditHead) {
+		if h == anchor {
+			found = true
+		}
+	})
+	if err != nil {
+		return head.AuditHead, err
+	}
+	if head.torn {
+		return head.AuditHead, &AuditChainError{Name: name, Record: head.Records + 1, Torn: true}
+	}
+	if anchor != (AuditHead{}) && !found {
+		return head.AuditHead, &AuditChainError{Name: name, Record: anchor.Records}
+	}
+	return head.AuditHead, nil
+}
+
+// RepairAuditLog drops the record torn by a crash at the end of the audit
+// log kept in the file name, chained with key (nil for none), returning
+// the number of bytes dropped. The records before it must be intact.
+func RepairAuditLog(name string, key []byte) (dropped int64, err error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	_, size, err := scanAuditLog(f, name, key, nil)
+	if err != nil {
+		return 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if err := f.Truncate(size); err != nil {
+		return 0, err
+	}
+	return fi.Size() - size, f.Sync()
+}
+
+// An auditScan is the head of an audit log as read, noting whether it ends
+// in a torn record.
+type auditScan struct {
+	AuditHead
+	torn bool
+}
+
+// scanAuditLog verifies the records read from r, calling each, if not nil,
+// with the head after every record. It returns the head and the size of
+// the whole records.
+func scanAuditLog(r io.Reader, name string, key []byte, each func(AuditHead)) (head auditScan, size int64, err error) {
+	br := bufio.NewReader(r)
+	var last [sha256.Size]byte
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF {
+			// Anything after the last newline is torn
+			head.torn = line != ""
+			return head, size, nil
+		} else if err != nil {
+			return head, size, err
+		}
+		if last, err = nextAuditRecord(last, key, line, name, head.Records+1); err != nil {
+			return head, size, err
+		}
+		head.Records++
+		head.Hash = hex.EncodeToString(last[:])
+		size += int64(len(line))
+		if each != nil {
+			each(head.AuditHead)
+		}
+	}
+}
+
+// nextAuditRecord checks that line, a whole record, follows the chain hash
+// prev, returning its own chain hash.
+func nextAuditRecord(prev [sha256.Size]byte, key []byte, line, name string, record int) ([sha256.Size]byte, error) {
+	fields := strings.SplitN(strings.TrimSuffix(line, "\n"), " ", 2)
+	hash, err := hex.DecodeString(fields[0])
+	if len(fields) != 2 || err != nil || !hmac.Equal(hash, chainAuditRecord(prev, key, fields[1])) {
+		return prev, &AuditChainError{Name: name, Record: record}
+	}
+	var next [sha256.Size]byte
+	copy(next[:], hash)
+	return next, nil
+}
+
+// chainAuditRecord returns the chain hash of a record following prev:
+// an HMAC-SHA256 with key, or a SHA-256 if key is nil.
+func chainAuditRecord(prev [sha256.Size]byte, key []byte, body string) []byte {
+	h := sha256.New()
+	if key != nil {
+		h = hmac.New(sha256.New, key)
+	}
+	h.Write(prev[:])
+	h.Write([]byte(body))
+	return h.Sum(nil)
+}
+
+// Middleware returns middleware recording the selected events before
+// passing them on. Events are passed on even if they cannot be recorded;
+// Err reports the first such failure.
+func (a *AuditLog) Middleware() Middleware {
+	return func(next EventHandler) EventHandler {
+		return EventHandlerFunc(func(ev *FileEvent) {
+			if a.sel == nil || a.sel.Match(ev) {
+				a.record(ev)
+			}
+			next.HandleEvent(ev)
+		})
+	}
+}
+
+// record appends a record of ev and syncs it to disk.
+func (a *AuditLog) record(ev *FileEvent) {
+	data, err := json.Marshal(NewEventRecord(ev))
+	if err != nil {
+		a.fail(err)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		// Appending after a failed write could break the chain
+		return
+	}
+	body := time.Now().UTC().Format(time.RFC3339Nano) + " " + string(data)
+	var last [sha256.Size]byte
+	hex.Decode(last[:], []byte(a.head.Hash))
+	hash := chainAuditRecord(last, a.key, body)
+	if _, err := fmt.Fprintf(a.f, "%x %s\n", hash, body); err != nil {
+		a.err = err
+		return
+	}
+	if err := a.f.Sync(); err != nil {
+		a.err = err
+		return
+	}
+	a.head = AuditHead{Records: a.head.Records + 1, Hash: hex.EncodeToString(hash)}
+}
+
+func (a *AuditLog) fail(err error) {
+	a.mu.Lock()
+	if a.err == nil {
+		a.err = err
+	}
+	a.mu.Unlock()
+}
+
+// Head returns the head of the log after the last record written, to be
+// kept outside the log (see VerifyAuditLogKey).
+func (a *AuditLog) Head() AuditHead {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.head
+}
+
+// Err returns the first error recording an event, after which no more
+// events are recorded.
+func (a *AuditLog) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// Close closes the file of the log.
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.f.Close()
+}
@@ -0,0 +1,138 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+	logFile := filepath.Join(testDir, "audit.log")
+
+	sel, err := ParseTriggers("delete")
+	if err != nil {
+		t.Fatalf("ParseTriggers failed: %s", err)
+	}
+	record := func(events ...*FileEvent) {
+		a, err := OpenAuditLog(logFile, sel)
+		if err != nil {
+			t.Fatalf("OpenAuditLog(%q) failed: %s", logFile, err)
+		}
+		var handled int
+		h := a.Middleware()(EventHandlerFunc(func(ev *FileEvent) { handled++ }))
+		for _, ev := range events {
+			h.HandleEvent(ev)
+		}
+		if handled != len(events) {
+			t.Fatalf("%d events passed on, expected %d", handled, len(events))
+		}
+		if err := a.Err(); err != nil {
+			t.Fatalf("recording events failed: %s", err)
+		}
+		a.Close()
+	}
+	verify := func(want int) {
+		if n, err := VerifyAuditLog(logFile); err != nil || n != want {
+			t.Fatalf("VerifyAuditLog() = %d, %v, expected %d records", n, err, want)
+		}
+	}
+
+	// Only deletes are selected
+	record(newFileEvent("/etc/passwd", FSN_MODIFY), newFileEvent("/etc/shadow", FSN_DELETE))
+	verify(1)
+	record(newFileEvent("/etc/hosts", FSN_DELETE))
+	verify(2)
+
+	// A record torn by a crash is reported, and dropped on repair
+	f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("opening audit log failed: %s", err)
+	}
+	f.WriteString("0123 torn")
+	f.Close()
+	if _, err := VerifyAuditLog(logFile); !isTorn(err, 3) {
+		t.Fatalf("VerifyAuditLog() of a torn log returned %v, expected torn at record 3", err)
+	}
+	if _, err := OpenAuditLog(logFile, sel); !isTorn(err, 3) {
+		t.Fatalf("OpenAuditLog() of a torn log returned %v, expected torn at record 3", err)
+	}
+	if dropped, err := RepairAuditLog(logFile, nil); err != nil || dropped != int64(len("0123 torn")) {
+		t.Fatalf("RepairAuditLog() = %d, %v, expected %d bytes dropped", dropped, err, len("0123 torn"))
+	}
+	record(newFileEvent("/etc/group", FSN_DELETE))
+	verify(3)
+
+	// Tampering breaks the chain at the changed record
+	data, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("reading audit log failed: %s", err)
+	}
+	data = bytes.Replace(data, []byte("/etc/hosts"), []byte("/etc/hostz"), 1)
+	if err := ioutil.WriteFile(logFile, data, 0600); err != nil {
+		t.Fatalf("writing audit log failed: %s", err)
+	}
+	_, err = VerifyAuditLog(logFile)
+	if ce, ok := err.(*AuditChainError); !ok || ce.Record != 2 {
+		t.Fatalf("VerifyAuditLog() of a tampered log returned %v, expected a break at record 2", err)
+	}
+	if _, err := OpenAuditLog(logFile, sel); err == nil {
+		t.Fatal("OpenAuditLog() of a tampered log succeeded")
+	}
+}
+
+func isTorn(err error, record int) bool {
+	ce, ok := err.(*AuditChainError)
+	return ok && ce.Torn && ce.Record == record
+}
+
+func TestAuditLogKey(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+	logFile := filepath.Join(testDir, "audit.log")
+	key := []byte("secret")
+
+	a, err := OpenAuditLogKey(logFile, key, nil)
+	if err != nil {
+		t.Fatalf("OpenAuditLogKey(%q) failed: %s", logFile, err)
+	}
+	h := a.Middleware()(EventHandlerFunc(func(ev *FileEvent) {}))
+	h.HandleEvent(newFileEvent("/etc/passwd", FSN_MODIFY))
+	h.HandleEvent(newFileEvent("/etc/shadow", FSN_MODIFY))
+	anchor := a.Head()
+	a.Close()
+	if anchor.Records != 2 || anchor.Hash == "" {
+		t.Fatalf("Head() = %+v, expected 2 records", anchor)
+	}
+
+	if head, err := VerifyAuditLogKey(logFile, key, anchor); err != nil || head != anchor {
+		t.Fatalf("VerifyAuditLogKey() = %+v, %v, expected %+v", head, err, anchor)
+	}
+	// The chain does not verify without the key
+	if _, err := VerifyAuditLog(logFile); err == nil {
+		t.Fatal("VerifyAuditLog() of a keyed log without the key succeeded")
+	}
+
+	// Records removed from the end are told by the anchor
+	data, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("reading audit log failed: %s", err)
+	}
+	first := data[:bytes.IndexByte(data, '\n')+1]
+	if err := ioutil.WriteFile(logFile, first, 0600); err != nil {
+		t.Fatalf("writing audit log failed: %s", err)
+	}
+	if head, err := VerifyAuditLogKey(logFile, key, AuditHead{}); err != nil || head.Records != 1 {
+		t.Fatalf("VerifyAuditLogKey() = %+v, %v, expected 1 record", head, err)
+	}
+	if _, err := VerifyAuditLogKey(logFile, key, anchor); err == nil {
+		t.Fatal("VerifyAuditLogKey() of a log cut short of its anchor succeeded")
+	}
+}
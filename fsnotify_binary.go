@@ -0,0 +1,165 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The binary encoding of an event is its notifications (FSN_MODIFY etc.)
+// as a uvarint, followed by the length of its name as a uvarint and the
+// name. As in EventRecord, only the notifications are kept.
+
+// eventStreamMagic starts a stream of events written by an EventWriter.
+const eventStreamMagic = "fsn\x01"
+
+// maxInternedNames bounds the names remembered by a stream. Once that many
+// are known, later names are written out in full each time.
+const maxInternedNames = 1 << 16
+
+var errBadEvent = errors.New("fsnotify: malformed binary event")
+
+// MarshalBinary returns the binary encoding of the event.
+func (e *FileEvent) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, 2*binary.MaxVarintLen32+len(e.Name))
+	buf = appendUvarint(buf, uint64(eventFlags(e)))
+	buf = appendUvarint(buf, uint64(len(e.Name)))
+	return append(buf, e.Name...), nil
+}
+
+// UnmarshalBinary sets the event to the one encoded in data.
+func (e *FileEvent) UnmarshalBinary(data []byte) error {
+	flags, n := binary.Uvarint(data)
+	if n <= 0 {
+		return errBadEvent
+	}
+	data = data[n:]
+	size, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) != size {
+		return errBadEvent
+	}
+	*e = *newFileEvent(string(data[n:]), uint32(flags))
+	return nil
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutUvarint(tmp[:], x)]...)
+}
+
+// An EventWriter writes a stream of events in a compact binary encoding,
+// for passing many events between processes. Each name is written in full
+// once; later events refer to it by number.
+type EventWriter struct {
+	w      io.Writer
+	names  map[string]uint64 // Numbers of the names written (key: name)
+	buf    []byte
+	header bool // Set once the stream header is written
+}
+
+// NewEventWriter returns an EventWriter writing to w.
+func NewEventWriter(w io.Writer) *EventWriter {
+	return &EventWriter{w: w, names: make(map[string]uint64)}
+}
+
+// Write writes an event to the stream. Each event is written with a
+// single call to the underlying writer.
+func (ew *EventWriter) Write(ev *FileEvent) error {
+	buf := ew.buf[:0]
+	if !ew.header {
+		buf = append(buf, eventStreamMagic...)
+	}
+	buf = appendUvarint(buf, uint64(eventFlags(ev)))
+	// A reference is the number of a known name plus one, or zero for a
+	// new name written in full
+	if ref, found := ew.names[ev.Name]; found {
+		buf = appendUvarint(buf, ref+1)
+	} else {
+		buf = appendUvarint(buf, 0)
+		buf = appendUvarint(buf, uint64(len(ev.Name)))
+		buf = append(buf, ev.Name...)
+		if len(ew.names) < maxInternedNames {
+			ew.names[ev.Name] = uint64(len(ew.names))
+		}
+	}
+	ew.buf = buf
+	if _, err := ew.w.Write(buf); err != nil {
+		return err
+	}
+	ew.header = true
+	return nil
+}
+
+// An EventReader reads a stream of events written by an EventWriter.
+type EventReader struct {
+	r      *bufio.Reader
+	names  []string // Names read so far, by number
+	header bool     // Set once the stream header is read
+}
+
+// NewEventReader returns an EventReader reading from r.
+func NewEventReader(r io.Reader) *EventReader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &EventReader{r: br}
+}
+
+// Read reads the next event of the stream. It returns io.EOF at the end
+// of the stream.
+func (er *EventReader) Read() (*FileEvent, error) {
+	if !er.header {
+		magic := make([]byte, len(eventStreamMagic))
+		if _, err := io.ReadFull(er.r, magic); err != nil {
+			return nil, err
+		}
+		if string(magic) != eventStreamMagic {
+			return nil, fmt.Errorf("fsnotify: not an event stream (header %q)", magic)
+		}
+		er.header = true
+	}
+	flags, err := binary.ReadUvarint(er.r)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := binary.ReadUvarint(er.r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	var name string
+	if ref > 0 {
+		if ref > uint64(len(er.names)) {
+			return nil, errBadEvent
+		}
+		name = er.names[ref-1]
+	} else {
+		size, err := binary.ReadUvarint(er.r)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(er.r, buf); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		name = string(buf)
+		if len(er.names) < maxInternedNames {
+			er.names = append(er.names, name)
+		}
+	}
+	return newFileEvent(name, uint32(flags)), nil
+}
+
+// unexpectedEOF reports the end of the stream within an event as an error.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestFileEventMarshalBinary(t *testing.T) {
+	ev := newFileEvent("dir/file", FSN_CREATE|FSN_MODIFY)
+	data, err := ev.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshaling %s failed: %s", ev, err)
+	}
+	var got FileEvent
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshaling %s failed: %s", ev, err)
+	}
+	if got.Name != ev.Name || eventFlags(&got) != eventFlags(ev) {
+		t.Fatalf("%s round-tripped as %s", ev, &got)
+	}
+	if err := got.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatalf("unmarshaling a truncated event did not fail")
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	var events []*FileEvent
+	for i := 0; i < 100; i++ {
+		events = append(events, newFileEvent(fmt.Sprintf("dir/file%d", i%10), FSN_MODIFY))
+	}
+	events = append(events, newFileEvent("dir/gone", FSN_DELETE))
+
+	var buf bytes.Buffer
+	ew := NewEventWriter(&buf)
+	for _, ev := range events {
+		if err := ew.Write(ev); err != nil {
+			t.Fatalf("writing %s failed: %s", ev, err)
+		}
+	}
+	// Repeated names are interned: 100 events cost little more than the
+	// 10 names
+	if buf.Len() > 10*len("dir/fileN")+3*len(events)+20 {
+		t.Errorf("stream of %d events takes %d bytes", len(events), buf.Len())
+	}
+
+	er := NewEventReader(&buf)
+	for _, want := range events {
+		got, err := er.Read()
+		if err != nil {
+			t.Fatalf("reading %s failed: %s", want, err)
+		}
+		if got.Name != want.Name || eventFlags(got) != eventFlags(want) {
+			t.Fatalf("read %s, want %s", got, want)
+		}
+	}
+	if _, err := er.Read(); err != io.EOF {
+		t.Fatalf("reading past the end returned %v, want EOF", err)
+	}
+
+	if _, err := NewEventReader(bytes.NewReader([]byte("json"))).Read(); err == nil {
+		t.Fatalf("reading a stream without a header did not fail")
+	}
+}
+
+func BenchmarkEventStream(b *testing.B) {
+	ew := NewEventWriter(ioutil.Discard)
+	events := make([]*FileEvent, 1000)
+	for i := range events {
+		events[i] = newFileEvent(fmt.Sprintf("/var/lib/data/shard%d/segment", i%50), FSN_MODIFY)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ew.Write(events[i%len(events)])
+	}
+}
+
+func BenchmarkEventJSON(b *testing.B) {
+	events := make([]*FileEvent, 1000)
+	for i := range events {
+		events[i] = newFileEvent(fmt.Sprintf("/var/lib/data/shard%d/segment", i%50), FSN_MODIFY)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		MarshalEvent(events[i%len(events)])
+	}
+}
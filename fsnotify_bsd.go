@@ -7,13 +7,15 @@
 package fsnotify
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
 	"syscall"
+	"time"
 )
 
 const (
@@ -27,23 +29,46 @@ const (
 	sys_NOTE_REVOKE = 0x0040 /* vnode access was revoked */
 
 	// Watch all events
-	sys_NOTE_ALLEVENTS = sys_NOTE_DELETE | sys_NOTE_WRITE | sys_NOTE_ATTRIB | sys_NOTE_RENAME
+	sys_NOTE_ALLEVENTS = sys_NOTE_DELETE | sys_NOTE_WRITE | sys_NOTE_ATTRIB | sys_NOTE_RENAME | sys_NOTE_REVOKE
 
 	// Block for 100 ms on each call to kevent
 	keventWaitTime = 100e6
 )
 
 type FileEvent struct {
-	mask   uint32 // Mask of events
-	Name   string // File name (optional)
-	create bool   // set by fsnotify package if found new file
+	mask        uint32          // Mask of events
+	Name        string          // File name (optional)
+	create      bool            // set by fsnotify package if found new file
+	prevSize    int64           // Size of the file before a modification
+	size        int64           // Size of the file after a modification
+	sized       bool            // Set if prevSize and size are known
+	replaced    bool            // Set if a different file took the place of the file (not tracked on BSD)
+	xattr       bool            // Set if the extended attributes of the file changed (not tracked on BSD)
+	delta       *ContentDelta   // Content before and after a modification (see SetContentTracking)
+	retarget    string          // New target of a watched symlink (see WatchSymlink)
+	movedFrom   string          // Source of a probable move (see SetMoveCorrelation)
+	overflow    bool            // Set on events reporting that events were dropped (see IsOverflow)
+	rescan      []string        // Watched paths affected by an overflow (see RescanRoots)
+	locked      bool            // Set if the file was still locked when delivered (see LockWait)
+	placeholder bool            // Set if the file was a cloud placeholder when delivered (see IsPlaceholder)
+	dir         bool            // Set if the event refers to a directory (see IsDir)
+	stamp       time.Time       // When the event was observed (see Time)
+	proc        *Process        // Process that caused the event (see SetProcessTracking)
+	move        MoveDirection   // Direction of a paired rename (see SetRenamePairing)
+	ops         uint32          // Notifications the system does not report (see FSN_USER)
+	parts       []*FileEvent    // Events combined by the event (see Parts)
+	err         error           // Error queued in order with the events (see Ordered)
+	ctx         context.Context // Context of the watch that delivered the event
 }
 
 // IsCreate reports whether the FileEvent was triggered by a creation
 func (e *FileEvent) IsCreate() bool { return e.create }
 
 // IsDelete reports whether the FileEvent was triggered by a delete
-func (e *FileEvent) IsDelete() bool { return (e.mask & sys_NOTE_DELETE) == sys_NOTE_DELETE }
+// or by access being revoked (eg. the volume was unmounted)
+func (e *FileEvent) IsDelete() bool {
+	return (e.mask&sys_NOTE_DELETE) == sys_NOTE_DELETE || (e.mask&sys_NOTE_REVOKE) == sys_NOTE_REVOKE
+}
 
 // IsModify reports whether the FileEvent was triggered by a file modification
 func (e *FileEvent) IsModify() bool {
@@ -53,32 +78,115 @@ func (e *FileEvent) IsModify() bool {
 // IsRename reports whether the FileEvent was triggered by a change name
 func (e *FileEvent) IsRename() bool { return (e.mask & sys_NOTE_RENAME) == sys_NOTE_RENAME }
 
+// movedTo reports whether the event names the file of a rename under its
+// new name; kqueue only reports the old name.
+func (e *FileEvent) movedTo() bool { return false }
+
 // IsAttrib reports whether the FileEvent was triggered by a change in the file metadata.
 func (e *FileEvent) IsAttrib() bool {
 	return (e.mask & sys_NOTE_ATTRIB) == sys_NOTE_ATTRIB
 }
 
+// isWrite reports whether the FileEvent was triggered by a change of the
+// file content, rather than its metadata.
+func (e *FileEvent) isWrite() bool { return e.mask&sys_NOTE_WRITE == sys_NOTE_WRITE }
+
+// RawMask returns the kqueue fflags of the event (NOTE_WRITE etc.), for
+// the cases the predicates do not cover. Creates are found by rescanning
+// directories and have none.
+func (e *FileEvent) RawMask() uint32 { return e.mask }
+
+// Cookie returns zero; kqueue does not associate the halves of a rename.
+func (e *FileEvent) Cookie() uint32 { return 0 }
+
+// newFileEvent returns a synthetic event for name, as if it had been
+// triggered by the given notifications (FSN_CREATE etc.)
+func newFileEvent(name string, flags uint32) *FileEvent {
+	e := &FileEvent{Name: name, create: flags&FSN_CREATE == FSN_CREATE}
+	if flags&FSN_MODIFY == FSN_MODIFY {
+		e.mask |= sys_NOTE_WRITE
+	}
+	if flags&FSN_DELETE == FSN_DELETE {
+		e.mask |= sys_NOTE_DELETE
+	}
+	if flags&FSN_RENAME == FSN_RENAME {
+		e.mask |= sys_NOTE_RENAME
+	}
+	return e
+}
+
 type Watcher struct {
-	mu              sync.Mutex          // Mutex for the Watcher itself.
-	kq              int                 // File descriptor (as returned by the kqueue() syscall)
-	watches         map[string]int      // Map of watched file descriptors (key: path)
-	wmut            sync.Mutex          // Protects access to watches.
-	fsnFlags        map[string]uint32   // Map of watched files to flags used for filter
-	fsnmut          sync.Mutex          // Protects access to fsnFlags.
-	enFlags         map[string]uint32   // Map of watched files to evfilt note flags used in kqueue
-	enmut           sync.Mutex          // Protects access to enFlags.
-	paths           map[int]string      // Map of watched paths (key: watch descriptor)
-	finfo           map[int]os.FileInfo // Map of file information (isDir, isReg; key: watch descriptor)
-	pmut            sync.Mutex          // Protects access to paths and finfo.
-	fileExists      map[string]bool     // Keep track of if we know this file exists (to stop duplicate create events)
-	femut           sync.Mutex          // Protects access to fileExists.
-	externalWatches map[string]bool     // Map of watches added by user of the library.
-	ewmut           sync.Mutex          // Protects access to externalWatches.
-	Error           chan error          // Errors are sent on this channel
-	internalEvent   chan *FileEvent     // Events are queued on this channel
-	Event           chan *FileEvent     // Events are returned on this channel
-	done            chan bool           // Channel for sending a "quit message" to the reader goroutine
-	isClosed        bool                // Set to true when Close() is first called
+	mu              sync.Mutex              // Mutex for the Watcher itself.
+	kq              int                     // File descriptor (as returned by the kqueue() syscall)
+	watches         map[string]int          // Map of watched file descriptors (key: path)
+	wmut            sync.Mutex              // Protects access to watches.
+	fsnFlags        map[string]uint32       // Map of watched files to flags used for filter
+	handlers        map[string]EventHandler // Map of watched files to event handlers (nil for the Event channel)
+	middleware      []Middleware            // Middleware wrapping event delivery (see Use)
+	policy          *PathPolicy             // Policy validating watched paths (see SetPathPolicy)
+	root            string                  // Base directory watched paths are resolved in (see SetRoot)
+	rootBeneath     bool                    // Set if paths leading out of root are rejected (see SetRootBeneath)
+	broker          *Broker                 // Broker of the Event channel (see Fanout)
+	ignored         []string                // Base names of files to ignore (see SetIgnoredNames)
+	treeDepth       int                     // Levels of directories watched below trees (see SetTreeDepth)
+	links           linkTable               // Known files, for events on hard links (see SetHardlinkTracking)
+	contents        contentCache            // Cached contents of small files (see SetContentTracking)
+	recent          recentBuffer            // Recently delivered events (see SetRecent)
+	dups            dupTable                // Identities of watched paths (see SetDuplicatePolicy)
+	symlinks        symlinkTable            // Watched symlinks (see WatchSymlink)
+	pending         pendingTable            // Watches of paths that do not exist yet (see SetPendingWatches)
+	order           orderTable              // Ordered stream of events and errors (see Ordered)
+	coop            coopQueue               // Events between calls of Poll (see NewCooperativeWatcher)
+	moves           moveTable               // Known files, to pair cross-device moves (see SetMoveCorrelation)
+	scans           scanTable               // Known files, to rescan after sleep (see SetResumeRescan)
+	trees           treeTable               // Roots of tree watches, to extend to directories moved in (see SetMoveInScan)
+	polls           pollTable               // Paths watched by polling (see SetPolling)
+	drain           drainState              // Events in flight on Close (see SetDrainOnClose)
+	activity        activityTable           // Watched paths of the latest events (see RescanRoots)
+	fair            fairQueue               // Events queued per watch root (see SetFairness)
+	consistency     consistencyTable        // Watched paths with lost events (see SetConsistencyTracking)
+	steps           stepTable               // Time spent in the steps of delivery (see SetStepTiming)
+	suppressed      suppressTable           // Paths the application is changing (see IgnorePath)
+	mock            *mockBackend            // Recorded watches of a MockWatcher (nil otherwise)
+	budget          budgetTable             // Resources of the watches (see SetBudget)
+	fsnmut          sync.Mutex              // Protects access to fsnFlags, handlers, middleware, policy, root, broker, ignored and treeDepth.
+	enFlags         map[string]uint32       // Map of watched files to evfilt note flags used in kqueue
+	enmut           sync.Mutex              // Protects access to enFlags.
+	paths           map[int]string          // Map of watched paths (key: watch descriptor)
+	finfo           map[int]os.FileInfo     // Map of file information (isDir, isReg; key: watch descriptor)
+	pmut            sync.Mutex              // Protects access to paths and finfo.
+	fileExists      map[string]bool         // Keep track of if we know this file exists (to stop duplicate create events)
+	femut           sync.Mutex              // Protects access to fileExists.
+	externalWatches map[string]bool         // Map of watches added by user of the library.
+	ewmut           sync.Mutex              // Protects access to externalWatches.
+	Error           chan error              // Errors are sent on this channel
+	internalEvent   chan *FileEvent         // Events are queued on this channel
+	Event           chan *FileEvent         // Events are returned on this channel
+	done            chan bool               // Channel for sending a "quit message" to the reader goroutine
+	isClosed        bool                    // Set to true when Close() is first called
+	trackSizes      bool                    // Set to true to report sizes before and after modifications
+	scanBudget      time.Duration           // Time a directory rescan may take at once (see SetScanBudget)
+	rescans         map[string]*dirScan     // Directory rescans in progress, used by the reader goroutine only (key: path)
+}
+
+// A dirScan is a directory rescan in progress.
+type dirScan struct {
+	f     *os.File // Directory, read up to the entries scanned
+	again bool     // Set when the directory changed again during the scan
+}
+
+// dirScanPage is the number of directory entries read at a time, so that
+// huge directories are never held in memory at once.
+const dirScanPage = 512
+
+// kqueueWatchCost estimates the kernel memory of a file descriptor watched
+// with kqueue, with its open file and knote.
+const kqueueWatchCost = 512
+
+// watchCost estimates the resources of watching path (see SetBudget): a
+// file descriptor for it and, for a directory, for each of its files.
+func watchCost(path string) budgetCost {
+	return budgetCost{memory: int64(1+countEntries(path)) * kqueueWatchCost}
 }
 
 // NewWatcher creates and returns a new kevent instance using kqueue(2)
@@ -91,6 +199,7 @@ func NewWatcher() (*Watcher, error) {
 		kq:              fd,
 		watches:         make(map[string]int),
 		fsnFlags:        make(map[string]uint32),
+		handlers:        make(map[string]EventHandler),
 		enFlags:         make(map[string]uint32),
 		paths:           make(map[int]string),
 		finfo:           make(map[int]os.FileInfo),
@@ -100,6 +209,8 @@ func NewWatcher() (*Watcher, error) {
 		Event:           make(chan *FileEvent),
 		Error:           make(chan error),
 		done:            make(chan bool, 1),
+		scanBudget:      defaultScanBudget,
+		rescans:         make(map[string]*dirScan),
 	}
 
 	go w.readEvents()
@@ -118,6 +229,11 @@ func (w *Watcher) Close() error {
 	}
 	w.isClosed = true
 	w.mu.Unlock()
+	w.drain.close()
+	w.symlinks.close()
+	w.pending.close()
+	w.scans.close()
+	w.polls.close()
 
 	// Send "quit" message to the reader goroutine
 	w.done <- true
@@ -234,6 +350,10 @@ func (w *Watcher) watch(path string) error {
 	return w.addWatch(path, sys_NOTE_ALLEVENTS)
 }
 
+func (w *Watcher) watchTree(path string, skip []string, depth int, h EventHandler, progress func(dirs int)) error {
+	return w.watchTreeWalk(path, skip, depth, h, progress)
+}
+
 // RemoveWatch removes path from the watched file set.
 func (w *Watcher) removeWatch(path string) error {
 	w.wmut.Lock()
@@ -315,9 +435,18 @@ func (w *Watcher) readEvents() {
 
 		// If "done" message is received
 		if done {
+			// Finish the rescans in progress unless dropping what is
+			// in flight
+			for dirPath, scan := range w.rescans {
+				if !w.drain.dropping() {
+					w.rescanDirectory(dirPath, scan, 0)
+				} else {
+					scan.f.Close()
+				}
+			}
 			errno := syscall.Close(w.kq)
 			if errno != nil {
-				w.Error <- os.NewSyscallError("close", errno)
+				w.sendError(os.NewSyscallError("close", errno))
 			}
 			close(w.internalEvent)
 			close(w.Error)
@@ -326,12 +455,19 @@ func (w *Watcher) readEvents() {
 
 		// Get new events
 		if len(events) == 0 {
+			// Resume rescans over budget, not waiting for events while
+			// any remain
+			if w.continueScans() {
+				*twait = syscall.Timespec{}
+			} else {
+				*twait = syscall.NsecToTimespec(keventWaitTime)
+			}
 			n, errno = syscall.Kevent(w.kq, nil, eventbuf[:], twait)
 
 			// EINTR is okay, basically the syscall was interrupted before
 			// timeout expired.
 			if errno != nil && errno != syscall.EINTR {
-				w.Error <- os.NewSyscallError("kevent", errno)
+				w.sendError(os.NewSyscallError("kevent", errno))
 				continue
 			}
 
@@ -343,13 +479,14 @@ func (w *Watcher) readEvents() {
 
 		// Flush the events we received to the events channel
 		for len(events) > 0 {
-			fileEvent := new(FileEvent)
+			fileEvent := &FileEvent{stamp: time.Now()}
 			watchEvent := &events[0]
 			fileEvent.mask = uint32(watchEvent.Fflags)
 			w.pmut.Lock()
 			fileEvent.Name = w.paths[int(watchEvent.Ident)]
 			fileInfo := w.finfo[int(watchEvent.Ident)]
 			w.pmut.Unlock()
+			fileEvent.dir = fileInfo != nil && fileInfo.IsDir()
 			if fileInfo != nil && fileInfo.IsDir() && !fileEvent.IsDelete() {
 				// Double check to make sure the directory exist. This can happen when
 				// we do a rm -fr on a recursively watched folders and we receive a
@@ -361,6 +498,10 @@ func (w *Watcher) readEvents() {
 				}
 			}
 
+			if fileInfo != nil && !fileInfo.IsDir() && fileEvent.IsModify() && !fileEvent.IsDelete() {
+				w.updateSize(fileEvent, int(watchEvent.Ident), fileInfo)
+			}
+
 			if fileInfo != nil && fileInfo.IsDir() && fileEvent.IsModify() && !fileEvent.IsDelete() {
 				w.sendDirectoryChangeEvents(fileEvent.Name)
 			} else {
@@ -404,54 +545,109 @@ func (w *Watcher) readEvents() {
 	}
 }
 
-func (w *Watcher) watchDirectoryFiles(dirPath string) error {
-	// Get all files
-	files, err := ioutil.ReadDir(dirPath)
+func (w *Watcher) setSizeTracking(enable bool) {
+	w.mu.Lock()
+	w.trackSizes = enable
+	w.mu.Unlock()
+}
+
+// Xattr tracking is not supported on BSD, as the syscall package offers
+// no access to extended attributes there.
+func (w *Watcher) setXattrTracking(enable bool) {}
+
+// updateSize fills in the size of a modified file before and after the
+// event, using the file information recorded for its watch descriptor
+// as the previous state.
+func (w *Watcher) updateSize(fileEvent *FileEvent, watchfd int, prev os.FileInfo) {
+	w.mu.Lock()
+	trackSizes := w.trackSizes
+	w.mu.Unlock()
+	if !trackSizes {
+		return
+	}
+	// Stat rather than Lstat, as addWatch records the target of symlinks
+	fi, err := os.Stat(fileEvent.Name)
 	if err != nil {
-		return err
+		return
 	}
+	fileEvent.prevSize = prev.Size()
+	fileEvent.size = fi.Size()
+	fileEvent.sized = true
+	w.pmut.Lock()
+	if _, found := w.finfo[watchfd]; found {
+		w.finfo[watchfd] = fi
+	}
+	w.pmut.Unlock()
+}
 
-	// Search for new files
-	for _, fileInfo := range files {
-		filePath := filepath.Join(dirPath, fileInfo.Name())
-
-		// Inherit fsnFlags from parent directory
-		w.fsnmut.Lock()
-		if flags, found := w.fsnFlags[dirPath]; found {
-			w.fsnFlags[filePath] = flags
-		} else {
-			w.fsnFlags[filePath] = FSN_ALL
-		}
-		w.fsnmut.Unlock()
+func (w *Watcher) setScanBudget(budget time.Duration) {
+	w.mu.Lock()
+	w.scanBudget = budget
+	w.mu.Unlock()
+}
 
-		if fileInfo.IsDir() == false {
-			// Watch file to mimic linux fsnotify
-			e := w.addWatch(filePath, sys_NOTE_ALLEVENTS)
-			if e != nil {
-				return e
-			}
-		} else {
-			// If the user is currently watching directory
-			// we want to preserve the flags used
-			w.enmut.Lock()
-			currFlags, found := w.enFlags[filePath]
-			w.enmut.Unlock()
-			var newFlags uint32 = sys_NOTE_DELETE
-			if found {
-				newFlags |= currFlags
-			}
+func (w *Watcher) watchDirectoryFiles(dirPath string) error {
+	f, err := os.Open(dirPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
 
-			// Linux gives deletes if not explicitly watching
-			e := w.addWatch(filePath, newFlags)
-			if e != nil {
+	// Read the files a page at a time
+	for {
+		files, err := f.Readdir(dirScanPage)
+		for _, fileInfo := range files {
+			if e := w.watchDirectoryFile(dirPath, fileInfo); e != nil {
 				return e
 			}
 		}
-		w.femut.Lock()
-		w.fileExists[filePath] = true
-		w.femut.Unlock()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// watchDirectoryFile watches a file found in a watched directory.
+func (w *Watcher) watchDirectoryFile(dirPath string, fileInfo os.FileInfo) error {
+	filePath := filepath.Join(dirPath, fileInfo.Name())
+
+	// Inherit fsnFlags from parent directory
+	w.fsnmut.Lock()
+	if flags, found := w.fsnFlags[dirPath]; found {
+		w.fsnFlags[filePath] = flags
+	} else {
+		w.fsnFlags[filePath] = FSN_ALL
 	}
+	w.fsnmut.Unlock()
 
+	if fileInfo.IsDir() == false {
+		// Watch file to mimic linux fsnotify
+		e := w.addWatch(filePath, sys_NOTE_ALLEVENTS)
+		if e != nil {
+			return e
+		}
+	} else {
+		// If the user is currently watching directory
+		// we want to preserve the flags used
+		w.enmut.Lock()
+		currFlags, found := w.enFlags[filePath]
+		w.enmut.Unlock()
+		var newFlags uint32 = sys_NOTE_DELETE
+		if found {
+			newFlags |= currFlags
+		}
+
+		// Linux gives deletes if not explicitly watching
+		e := w.addWatch(filePath, newFlags)
+		if e != nil {
+			return e
+		}
+	}
+	w.femut.Lock()
+	w.fileExists[filePath] = true
+	w.femut.Unlock()
 	return nil
 }
 
@@ -459,38 +655,91 @@ func (w *Watcher) watchDirectoryFiles(dirPath string) error {
 // and sends them over the event channel. This functionality is to have
 // the BSD version of fsnotify match linux fsnotify which provides a
 // create event for files created in a watched directory.
+//
+// The search runs for at most the scan budget at a time; the reader
+// goroutine resumes it between reading events (see continueScans).
 func (w *Watcher) sendDirectoryChangeEvents(dirPath string) {
-	// Get all files
-	files, err := ioutil.ReadDir(dirPath)
+	if scan, found := w.rescans[dirPath]; found {
+		// Files may have been created behind the scan
+		scan.again = true
+		return
+	}
+	f, err := os.Open(dirPath)
 	if err != nil {
-		w.Error <- err
+		w.sendError(err)
+		return
 	}
+	scan := &dirScan{f: f}
+	w.rescans[dirPath] = scan
+	w.mu.Lock()
+	budget := w.scanBudget
+	w.mu.Unlock()
+	w.rescanDirectory(dirPath, scan, budget)
+}
 
-	// Search for new files
-	for _, fileInfo := range files {
-		filePath := filepath.Join(dirPath, fileInfo.Name())
-		w.femut.Lock()
-		_, doesExist := w.fileExists[filePath]
-		w.femut.Unlock()
-		if !doesExist {
-			// Inherit fsnFlags from parent directory
-			w.fsnmut.Lock()
-			if flags, found := w.fsnFlags[dirPath]; found {
-				w.fsnFlags[filePath] = flags
-			} else {
-				w.fsnFlags[filePath] = FSN_ALL
+// continueScans resumes the directory rescans in progress, and reports
+// whether any remain.
+func (w *Watcher) continueScans() bool {
+	if len(w.rescans) == 0 {
+		return false
+	}
+	w.mu.Lock()
+	budget := w.scanBudget
+	w.mu.Unlock()
+	for dirPath, scan := range w.rescans {
+		w.rescanDirectory(dirPath, scan, budget)
+	}
+	return len(w.rescans) > 0
+}
+
+// rescanDirectory sends create events for the new files of a directory
+// until the scan is done or over budget, reading at least one page.
+func (w *Watcher) rescanDirectory(dirPath string, scan *dirScan, budget time.Duration) {
+	start := time.Now()
+	for budget <= 0 || time.Since(start) < budget {
+		files, err := scan.f.Readdir(dirScanPage)
+
+		// Search for new files
+		for _, fileInfo := range files {
+			filePath := filepath.Join(dirPath, fileInfo.Name())
+			w.femut.Lock()
+			_, doesExist := w.fileExists[filePath]
+			w.femut.Unlock()
+			if !doesExist {
+				// Inherit fsnFlags from parent directory
+				w.fsnmut.Lock()
+				if flags, found := w.fsnFlags[dirPath]; found {
+					w.fsnFlags[filePath] = flags
+				} else {
+					w.fsnFlags[filePath] = FSN_ALL
+				}
+				w.fsnmut.Unlock()
+
+				// Send create event
+				fileEvent := new(FileEvent)
+				fileEvent.Name = filePath
+				fileEvent.create = true
+				fileEvent.dir = fileInfo.IsDir()
+				w.internalEvent <- fileEvent
 			}
-			w.fsnmut.Unlock()
+			w.watchDirectoryFile(dirPath, fileInfo)
+		}
 
-			// Send create event
-			fileEvent := new(FileEvent)
-			fileEvent.Name = filePath
-			fileEvent.create = true
-			w.internalEvent <- fileEvent
+		if err != nil {
+			if err != io.EOF {
+				w.sendError(err)
+			}
+			scan.f.Close()
+			delete(w.rescans, dirPath)
+			if scan.again {
+				w.sendDirectoryChangeEvents(dirPath)
+			}
+			return
 		}
-		w.femut.Lock()
-		w.fileExists[filePath] = true
-		w.femut.Unlock()
 	}
-	w.watchDirectoryFiles(dirPath)
+}
+
+// Paths are resolved in a root by resolveInRoot only.
+func resolveInRootKernel(root, path string, beneath bool) (string, error) {
+	return "", errNoKernelResolve
 }
@@ -0,0 +1,81 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build freebsd openbsd netbsd dragonfly darwin
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestKqueueNoteFlags(t *testing.T) {
+	flags := []struct {
+		name      string
+		ours, sys uint32
+	}{
+		{"NOTE_DELETE", sys_NOTE_DELETE, syscall.NOTE_DELETE},
+		{"NOTE_WRITE", sys_NOTE_WRITE, syscall.NOTE_WRITE},
+		{"NOTE_EXTEND", sys_NOTE_EXTEND, syscall.NOTE_EXTEND},
+		{"NOTE_ATTRIB", sys_NOTE_ATTRIB, syscall.NOTE_ATTRIB},
+		{"NOTE_LINK", sys_NOTE_LINK, syscall.NOTE_LINK},
+		{"NOTE_RENAME", sys_NOTE_RENAME, syscall.NOTE_RENAME},
+		{"NOTE_REVOKE", sys_NOTE_REVOKE, syscall.NOTE_REVOKE},
+	}
+	for _, f := range flags {
+		if f.ours != f.sys {
+			t.Errorf("%s is %#x, the system has %#x", f.name, f.ours, f.sys)
+		}
+	}
+}
+
+// TestKqueueKeventLayout reads a vnode event back from the kernel, as the
+// width of the fields of Kevent_t differs between the BSDs (the Ident of
+// DragonFly and 64-bit FreeBSD is 64-bit, that of 32-bit NetBSD 32-bit).
+func TestKqueueKeventLayout(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	testFile := filepath.Join(testDir, "TestKqueueKeventLayout.testfile")
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	kq, err := syscall.Kqueue()
+	if err != nil {
+		t.Fatalf("kqueue failed: %s", err)
+	}
+	defer syscall.Close(kq)
+	fd, err := syscall.Open(testFile, open_FLAGS, 0)
+	if err != nil {
+		t.Fatalf("opening test file failed: %s", err)
+	}
+	defer syscall.Close(fd)
+
+	var kbuf [1]syscall.Kevent_t
+	syscall.SetKevent(&kbuf[0], fd, syscall.EVFILT_VNODE, syscall.EV_ADD|syscall.EV_CLEAR)
+	kbuf[0].Fflags = sys_NOTE_ALLEVENTS
+	if _, err := syscall.Kevent(kq, kbuf[:], nil, nil); err != nil {
+		t.Fatalf("registering the kevent failed: %s", err)
+	}
+	if err := ioutil.WriteFile(testFile, []byte("data"), 0666); err != nil {
+		t.Fatalf("writing test file failed: %s", err)
+	}
+
+	timeout := syscall.NsecToTimespec(keventWaitTime * 10)
+	n, err := syscall.Kevent(kq, nil, kbuf[:], &timeout)
+	if err != nil || n != 1 {
+		t.Fatalf("kevent returned %d events (%v), expected 1", n, err)
+	}
+	ev := kbuf[0]
+	if int(ev.Ident) != fd || ev.Filter != syscall.EVFILT_VNODE {
+		t.Fatalf("kevent is for ident %d and filter %d, expected %d and %d", ev.Ident, ev.Filter, fd, syscall.EVFILT_VNODE)
+	}
+	if fileEvent := (&FileEvent{mask: uint32(ev.Fflags)}); !fileEvent.IsModify() {
+		t.Fatalf("kevent flags are %#x, expected a write", ev.Fflags)
+	}
+}
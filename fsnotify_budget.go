@@ -0,0 +1,150 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// A Budget limits the resources a watcher spends on its watches. Zero
+// fields are unlimited.
+type Budget struct {
+	// MaxGoroutines limits the goroutines started for watches, such as the
+	// reader of each fanotify mount (see WatchMount) or change journal (see
+	// WatchJournal). The goroutines every watcher runs are not counted.
+	MaxGoroutines int
+	// MaxMemory limits the estimated memory, in bytes, held for watches
+	// by the watcher and the kernel: the inotify watches on Linux, a file
+	// descriptor for each file and directory on BSD, and the buffer of each
+	// directory on Windows.
+	MaxMemory int64
+}
+
+// A BudgetError is returned when a watch would exceed the budget of the
+// watcher (see SetBudget). The watch is not added; other watches are not
+// affected.
+type BudgetError struct {
+	Path     string // Path whose watch was refused
+	Resource string // "goroutines" or "memory"
+	Limit    int64  // Limit of the resource
+	Need     int64  // Usage with the watch
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("fsnotify: watching %s would exceed the %s budget (%d, limit %d)", e.Path, e.Resource, e.Need, e.Limit)
+}
+
+// SetBudget limits the resources spent on watches added from now on.
+// Watches already added are counted but kept, even beyond the limits.
+func (w *Watcher) SetBudget(b Budget) {
+	w.budget.mu.Lock()
+	w.budget.limit = b
+	w.budget.mu.Unlock()
+}
+
+// BudgetUsage returns the resources spent on the current watches.
+func (w *Watcher) BudgetUsage() Budget {
+	w.budget.mu.Lock()
+	defer w.budget.mu.Unlock()
+	return Budget{MaxGoroutines: w.budget.used.goroutines, MaxMemory: w.budget.used.memory}
+}
+
+// A budgetCost is the resources held by a watch.
+type budgetCost struct {
+	goroutines int
+	memory     int64
+}
+
+// budgetTable accounts for the resources of the watches of a watcher.
+type budgetTable struct {
+	mu       sync.Mutex            // Protects access to the fields below.
+	limit    Budget                // Limits (see SetBudget)
+	used     budgetCost            // Resources of all watches
+	reserved map[string]budgetCost // Resources of each watch (key: path)
+}
+
+// reserve adds c to the resources of the watch of path, failing if that
+// exceeds the budget.
+func (b *budgetTable) reserve(path string, c budgetCost) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	need := budgetCost{b.used.goroutines + c.goroutines, b.used.memory + c.memory}
+	if max := b.limit.MaxGoroutines; max > 0 && c.goroutines > 0 && need.goroutines > max {
+		return &BudgetError{Path: path, Resource: "goroutines", Limit: int64(max), Need: int64(need.goroutines)}
+	}
+	if max := b.limit.MaxMemory; max > 0 && c.memory > 0 && need.memory > max {
+		return &BudgetError{Path: path, Resource: "memory", Limit: max, Need: need.memory}
+	}
+	if b.reserved == nil {
+		b.reserved = make(map[string]budgetCost)
+	}
+	r := b.reserved[path]
+	b.reserved[path] = budgetCost{r.goroutines + c.goroutines, r.memory + c.memory}
+	b.used = need
+	return nil
+}
+
+// reserveOnce reserves c for the watch of path, unless path already holds
+// resources, as when it is watched again with other flags. It reports
+// whether c was reserved.
+func (b *budgetTable) reserveOnce(path string, c budgetCost) (bool, error) {
+	b.mu.Lock()
+	_, found := b.reserved[path]
+	b.mu.Unlock()
+	if found {
+		return false, nil
+	}
+	return true, b.reserve(path, c)
+}
+
+// release frees the resources of the watch of path.
+func (b *budgetTable) release(path string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r, found := b.reserved[path]
+	if !found {
+		return
+	}
+	delete(b.reserved, path)
+	b.used.goroutines -= r.goroutines
+	b.used.memory -= r.memory
+}
+
+// move transfers the resources of the watch of path to the watch of to,
+// which took its place.
+func (b *budgetTable) move(path, to string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r, found := b.reserved[path]
+	if !found {
+		return
+	}
+	delete(b.reserved, path)
+	b.reserved[to] = r
+}
+
+// countPage is the number of directory entries countEntries reads at a
+// time, so that huge directories are never held in memory at once.
+const countPage = 512
+
+// countEntries returns the number of entries of the directory path, or zero
+// if it is not a directory.
+func countEntries(path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	n := 0
+	for {
+		names, err := f.Readdirnames(countPage)
+		n += len(names)
+		if err != nil {
+			return n
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFsnotifyBudget(t *testing.T) {
+	// Create directories to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+	otherDir := tempMkdir(t)
+	defer os.RemoveAll(otherDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	// Room for the first directory only
+	cost := watchCost(testDir).memory
+	watcher.SetBudget(Budget{MaxMemory: cost})
+	addWatch(t, watcher, testDir)
+	if used := watcher.BudgetUsage(); used.MaxMemory != cost {
+		t.Fatalf("memory used by one watch: %d, expected %d", used.MaxMemory, cost)
+	}
+
+	err := watcher.Watch(otherDir)
+	if be, ok := err.(*BudgetError); !ok || be.Resource != "memory" || be.Path != otherDir {
+		t.Fatalf("watching beyond the budget returned %v, expected a memory BudgetError", err)
+	}
+	if paths := watcher.watchedPaths(); len(paths) != 1 || paths[0] != testDir {
+		t.Fatalf("watched paths after a refused watch: %q, expected %q", paths, testDir)
+	}
+
+	// Removing a watch frees its resources
+	if err := watcher.RemoveWatch(testDir); err != nil {
+		t.Fatalf("removing watch failed: %s", err)
+	}
+	if used := watcher.BudgetUsage(); used.MaxMemory != 0 {
+		t.Fatalf("memory used after removing the watch: %d, expected 0", used.MaxMemory)
+	}
+	addWatch(t, watcher, otherDir)
+}
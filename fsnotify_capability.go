@@ -0,0 +1,55 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// CapabilityReportVersion is the version of capability reports (see
+// CapabilityReport).
+const CapabilityReportVersion = 1
+
+// A CapabilityReport records how a watcher fared in the scenarios of the
+// conformance battery (package conformance) on a file system, such as a
+// network or FUSE mount whose behavior is not known in advance. It is
+// written as JSON by the conformance runner and read by Capabilities.
+type CapabilityReport struct {
+	Version int              `json:"version"` // CapabilityReportVersion
+	Path    string           `json:"path"`    // Directory the scenarios ran in
+	GOOS    string           `json:"goos"`    // Platform the scenarios ran on
+	Results []ScenarioResult `json:"results"` // Results of the scenarios, in battery order
+}
+
+// A ScenarioResult is the outcome of a single scenario.
+type ScenarioResult struct {
+	Scenario string `json:"scenario"` // Name of the scenario, such as "rename out"
+	Status   string `json:"status"`   // "pass", "fail" or "skip" if the file system does not support its operations
+}
+
+// Capabilities reads a capability report and returns whether each of its
+// scenarios passed (key: scenario name). Scenarios skipped are left out.
+func Capabilities(report io.Reader) (map[string]bool, error) {
+	var r CapabilityReport
+	if err := json.NewDecoder(report).Decode(&r); err != nil {
+		return nil, err
+	}
+	if r.Version != CapabilityReportVersion {
+		return nil, fmt.Errorf("fsnotify: unsupported capability report version %d", r.Version)
+	}
+	caps := make(map[string]bool)
+	for _, res := range r.Results {
+		switch res.Status {
+		case "pass", "fail":
+			caps[res.Scenario] = res.Status == "pass"
+		case "skip":
+		default:
+			return nil, fmt.Errorf("fsnotify: unknown status %q of scenario %q", res.Status, res.Scenario)
+		}
+	}
+	return caps, nil
+}
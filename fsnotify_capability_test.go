@@ -0,0 +1,36 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCapabilities(t *testing.T) {
+	report := `{"version": 1, "path": "/mnt/smb", "goos": "linux", "results": [
+		{"scenario": "create", "status": "pass"},
+		{"scenario": "rename out", "status": "fail"},
+		{"scenario": "symlink", "status": "skip"}
+	]}`
+	caps, err := Capabilities(strings.NewReader(report))
+	if err != nil {
+		t.Fatalf("Capabilities() failed: %s", err)
+	}
+	if want := map[string]bool{"create": true, "rename out": false}; !reflect.DeepEqual(caps, want) {
+		t.Fatalf("Capabilities() = %v, want %v", caps, want)
+	}
+
+	for _, bad := range []string{
+		`{"version": 2, "results": []}`,
+		`{"version": 1, "results": [{"scenario": "create", "status": "flaky"}]}`,
+		`not json`,
+	} {
+		if _, err := Capabilities(strings.NewReader(bad)); err == nil {
+			t.Errorf("Capabilities(%q) succeeded", bad)
+		}
+	}
+}
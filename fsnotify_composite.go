@@ -0,0 +1,33 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+// SetCompositeEvents delivers the two halves of each rename paired by
+// SetRenamePairing as one event: the create event for the new name, whose
+// Parts are the rename event for the old name and that create event. A
+// consumer may act on the move it reports (see FileEvent.Move), or inspect
+// the events it combines, and OldPath and NewPath report both names. If
+// the flags of the watch drop one of the halves, the other is delivered
+// alone. On Windows, which reports the halves of a rename together, they
+// are combined without SetRenamePairing.
+//
+// The modify event DeleteGrace delivers for a file deleted and created
+// again always reports the delete and create events as its parts.
+func (w *Watcher) SetCompositeEvents(enable bool) {
+	w.setCompositeRenames(enable)
+}
+
+// Parts returns the events the event combines, in the order they occurred,
+// or nil if it reports a single event (see SetCompositeEvents).
+func (e *FileEvent) Parts() []*FileEvent {
+	return e.parts
+}
+
+// compose returns an event like last that combines parts.
+func compose(last *FileEvent, parts ...*FileEvent) *FileEvent {
+	ev := *last
+	ev.parts = parts
+	return &ev
+}
@@ -0,0 +1,129 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A ConfigMapWatcher watches a directory updated through an atomic symlink
+// swap, like Kubernetes ConfigMap and Secret volumes.
+//
+// Such a directory holds the data in a timestamped "..<timestamp>"
+// directory, a "..data" symlink pointing to it, and a symlink per file
+// pointing into "..data". An update writes a new timestamped directory and
+// renames a new symlink over "..data". Rather than the events for this
+// swap, a ConfigMapWatcher sends a single modify event for each file whose
+// content changed. Events for the hidden ".." entries are not sent.
+type ConfigMapWatcher struct {
+	Event  chan *FileEvent              // Events for the files are returned on this channel
+	Error  chan error                   // Errors are sent on this channel
+	dir    string                       // Path of the watched directory
+	w      *Watcher                     // Watcher for the directory
+	mu     sync.Mutex                   // Protects access to hashes.
+	hashes map[string][sha256.Size]byte // Content hashes of the files (key: path)
+}
+
+// WatchConfigMap watches the files of the atomically updated directory dir.
+func WatchConfigMap(dir string) (*ConfigMapWatcher, error) {
+	w, err := NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	c := &ConfigMapWatcher{
+		Event:  make(chan *FileEvent),
+		Error:  make(chan error),
+		dir:    filepath.Clean(dir),
+		w:      w,
+		hashes: make(map[string][sha256.Size]byte),
+	}
+	c.changedFiles()
+	if err := w.Watch(c.dir); err != nil {
+		w.Close()
+		return nil, err
+	}
+	go c.readEvents()
+	return c, nil
+}
+
+// Close stops watching the directory.
+func (c *ConfigMapWatcher) Close() error {
+	return c.w.Close()
+}
+
+// isDataEntry reports whether name is one of the ".." entries managed by
+// the atomic writer.
+func isDataEntry(name string) bool {
+	return strings.HasPrefix(filepath.Base(name), "..")
+}
+
+// changedFiles hashes the content of the files in the directory and
+// returns those that changed since the last call.
+func (c *ConfigMapWatcher) changedFiles() []string {
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var changed []string
+	for _, fi := range files {
+		path := filepath.Join(c.dir, fi.Name())
+		if isDataEntry(path) {
+			continue
+		}
+		// ReadFile follows the symlink into the current data directory
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		hash := sha256.Sum256(data)
+		if prev, found := c.hashes[path]; found && prev != hash {
+			changed = append(changed, path)
+		}
+		c.hashes[path] = hash
+	}
+	return changed
+}
+
+// readEvents forwards events for the files and turns swaps of the data
+// directory into modify events.
+func (c *ConfigMapWatcher) readEvents() {
+	events, errs := c.w.Event, c.w.Error
+	for events != nil || errs != nil {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if !isDataEntry(ev.Name) {
+				if ev.IsDelete() {
+					c.mu.Lock()
+					delete(c.hashes, filepath.Clean(ev.Name))
+					c.mu.Unlock()
+				}
+				c.Event <- ev
+				continue
+			}
+			for _, path := range c.changedFiles() {
+				c.Event <- newFileEvent(path, FSN_MODIFY)
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			c.Error <- err
+		}
+	}
+	close(c.Event)
+	close(c.Error)
+}
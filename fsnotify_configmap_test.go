@@ -0,0 +1,94 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build freebsd openbsd netbsd darwin linux
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeConfigMap writes a data directory for the files and points the
+// "..data" symlink of dir to it, the way the Kubernetes atomic writer does.
+func writeConfigMap(t *testing.T, dir, timestamp string, files map[string]string) {
+	dataDir := filepath.Join(dir, timestamp)
+	if err := os.Mkdir(dataDir, 0755); err != nil {
+		t.Fatalf("creating data directory failed: %s", err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dataDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("writing data file failed: %s", err)
+		}
+	}
+	tmpLink := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(timestamp, tmpLink); err != nil {
+		t.Fatalf("creating data symlink failed: %s", err)
+	}
+	if err := os.Rename(tmpLink, filepath.Join(dir, "..data")); err != nil {
+		t.Fatalf("swapping data symlink failed: %s", err)
+	}
+	for name := range files {
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); err == nil {
+			continue
+		}
+		if err := os.Symlink(filepath.Join("..data", name), link); err != nil {
+			t.Fatalf("creating file symlink failed: %s", err)
+		}
+	}
+}
+
+func TestFsnotifyWatchConfigMap(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	writeConfigMap(t, testDir, "..2014_01_01_00_00_00.1", map[string]string{"a.conf": "a", "b.conf": "b"})
+
+	watcher, err := WatchConfigMap(testDir)
+	if err != nil {
+		t.Fatalf("WatchConfigMap(%q) failed: %s", testDir, err)
+	}
+	defer watcher.Close()
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	testFileA := filepath.Join(testDir, "a.conf")
+	var modifyReceived, otherReceived counter
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			if event.Name == testFileA && event.IsModify() {
+				modifyReceived.increment()
+			} else {
+				otherReceived.increment()
+			}
+		}
+	}()
+
+	// Update a.conf only, and remove the old data directory
+	writeConfigMap(t, testDir, "..2014_01_01_00_00_00.2", map[string]string{"a.conf": "new a", "b.conf": "b"})
+	if err := os.RemoveAll(filepath.Join(testDir, "..2014_01_01_00_00_00.1")); err != nil {
+		t.Fatalf("removing old data directory failed: %s", err)
+	}
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if modifyReceived.value() != 1 {
+		t.Fatalf("incorrect number of modify events received after 500 ms (%d vs %d)", modifyReceived.value(), 1)
+	}
+	if otherReceived.value() != 0 {
+		t.Fatalf("received %d unexpected events for the data swap", otherReceived.value())
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"sync"
+	"time"
+)
+
+// SetConsistencyTracking tracks whether the events delivered reflect every
+// change below the watched paths (see ConsistentSince). Events are lost
+// when the queue of the kernel or of a change journal overflows, when the
+// queue of a watch root is full (see SetFairness) and when a consumer of
+// the Broker falls behind (see Fanout); each is recorded for the watched
+// paths it affects.
+//
+// If resume rescans are enabled (see SetResumeRescan), the affected paths
+// are rescanned as soon as events are lost, delivering events for the
+// changes missed, which recovers consistency. Otherwise it is only
+// recovered by calling Rescan.
+func (w *Watcher) SetConsistencyTracking(enable bool) {
+	w.consistency.mu.Lock()
+	defer w.consistency.mu.Unlock()
+	w.consistency.enabled = enable
+	w.consistency.lost = nil
+	w.consistency.since = time.Now()
+}
+
+// ConsistentSince returns the time since which the events delivered
+// reflect every change below the watched paths: when consistency tracking
+// was enabled, or when the latest rescan recovering lost events started.
+// It returns the zero time while lost events are not yet recovered, and if
+// consistency tracking is disabled.
+func (w *Watcher) ConsistentSince() time.Time {
+	w.consistency.mu.Lock()
+	defer w.consistency.mu.Unlock()
+	if !w.consistency.enabled || len(w.consistency.lost) > 0 {
+		return time.Time{}
+	}
+	return w.consistency.since
+}
+
+// A consistencyTable records the watched paths whose events were lost.
+type consistencyTable struct {
+	mu      sync.Mutex      // Protects access to the fields below.
+	enabled bool            // Set if consistency is tracked (see SetConsistencyTracking)
+	since   time.Time       // Start of the latest consistent period
+	lost    map[string]bool // Watched paths with events lost and not yet rescanned
+}
+
+// lose records that events were lost for the watched paths roots, and
+// requests their rescan.
+func (t *consistencyTable) lose(w *Watcher, roots []string) {
+	t.mu.Lock()
+	if !t.enabled {
+		t.mu.Unlock()
+		return
+	}
+	if t.lost == nil {
+		t.lost = make(map[string]bool)
+	}
+	for _, root := range roots {
+		t.lost[root] = true
+	}
+	t.mu.Unlock()
+	w.scans.rescanLost(roots)
+}
+
+// loseEvent records that ev was lost.
+func (w *Watcher) loseEvent(ev *FileEvent) {
+	if ev.overflow {
+		w.consistency.lose(w, ev.rescan)
+	} else if root, found := w.rootOf(ev.Name); found {
+		w.consistency.lose(w, []string{root})
+	} else {
+		w.consistency.lose(w, w.watchedPaths())
+	}
+}
+
+// recover records that the watched paths roots were rescanned, starting
+// at start.
+func (t *consistencyTable) recover(roots []string, start time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.enabled || len(t.lost) == 0 {
+		return
+	}
+	for _, root := range roots {
+		delete(t.lost, root)
+	}
+	if len(t.lost) == 0 {
+		t.since = start
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/howeyc/fsnotify/fsnotifytest"
+)
+
+func TestFsnotifyConsistencyLost(t *testing.T) {
+	if !nativeEvents || nativeTrees {
+		t.Skip("events of the system are not queued")
+	}
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetConsistencyTracking(true)
+	watcher.SetFairness(10)
+	addWatch(t, watcher, testDir)
+	if watcher.ConsistentSince().IsZero() {
+		t.Fatal("watcher not consistent before any event")
+	}
+
+	// Overflow the queue of the directory while events are not received
+	fsnotifytest.MakeBurst(t, testDir, 50)
+	time.Sleep(200 * time.Millisecond)
+	go func() {
+		for range watcher.Event {
+		}
+	}()
+	time.Sleep(200 * time.Millisecond)
+	if since := watcher.ConsistentSince(); !since.IsZero() {
+		t.Fatalf("watcher consistent since %s after an overflow", since)
+	}
+}
+
+func TestFsnotifyConsistencyRescan(t *testing.T) {
+	if !nativeEvents || nativeTrees {
+		t.Skip("events of the system are not queued")
+	}
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetResumeRescan(time.Hour)
+	watcher.SetConsistencyTracking(true)
+	watcher.SetFairness(10)
+	addWatch(t, watcher, testDir)
+	enabled := watcher.ConsistentSince()
+
+	fsnotifytest.MakeBurst(t, testDir, 50)
+	time.Sleep(200 * time.Millisecond)
+	created := make(map[string]bool)
+	var mu sync.Mutex
+	go func() {
+		for event := range watcher.Event {
+			if event.IsCreate() {
+				mu.Lock()
+				created[event.Name] = true
+				mu.Unlock()
+			}
+		}
+	}()
+
+	// The rescan delivers the creates replaced by the overflow
+	time.Sleep(500 * time.Millisecond)
+	if since := watcher.ConsistentSince(); !since.After(enabled) {
+		t.Fatalf("watcher consistent since %s after the rescan, expected after %s", since, enabled)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if name := filepath.Join(testDir, "burst00005"); !created[name] {
+		t.Fatalf("no create event received for %s", name)
+	}
+}
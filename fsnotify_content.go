@@ -0,0 +1,356 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SetContentTracking enables delivering the content of files of at most
+// maxSize bytes before and after each modification (see
+// FileEvent.ContentDelta), from a copy cached when the file was last seen.
+// A maxSize of zero disables it. Enable it before adding watches so the
+// initial contents are known.
+//
+// The cache holds at most DefaultContentCacheSize bytes in all (see
+// SetContentCacheSize); the files used least recently are dropped beyond
+// it, and their next modification is delivered without a ContentDelta.
+func (w *Watcher) SetContentTracking(maxSize int64) {
+	w.contents.setMaxSize(maxSize)
+}
+
+// DefaultContentCacheSize is the number of bytes of file contents cached
+// by a Watcher with content tracking unless set by SetContentCacheSize.
+const DefaultContentCacheSize = 64 << 20
+
+// SetContentCacheSize sets the number of bytes of file contents cached in
+// all for content tracking, dropping the files used least recently beyond
+// it. A size of zero restores DefaultContentCacheSize.
+func (w *Watcher) SetContentCacheSize(size int64) {
+	w.contents.setCacheSize(size)
+}
+
+// A ContentDelta is the content of a file before and after a modification.
+type ContentDelta struct {
+	Name string // Name of the file
+	Old  []byte // Content before the modification
+	New  []byte // Content after the modification
+}
+
+// ContentDelta returns the content of the file before and after a
+// modification, or nil if content tracking is not enabled, the event is
+// not a modification, or either content is unknown or too large.
+func (e *FileEvent) ContentDelta() *ContentDelta {
+	return e.delta
+}
+
+// Diff returns the change of the content as a unified diff, with three
+// lines of context. It is empty if the content did not change. Changes
+// spanning thousands of lines are shown replaced as a whole rather than
+// matched line by line.
+func (d *ContentDelta) Diff() string {
+	return unifiedDiff(d.Name, splitLines(d.Old), splitLines(d.New))
+}
+
+// A contentCache keeps copies of small watched files, up to a total size.
+type contentCache struct {
+	mu        sync.Mutex               // Protects access to the fields below.
+	maxSize   int64                    // Largest file cached (zero when disabled)
+	cacheSize int64                    // Most bytes cached in all (zero for DefaultContentCacheSize)
+	size      int64                    // Bytes cached in all
+	files     map[string]*list.Element // Map of cached contents in lru (key: path)
+	lru       list.List                // List of *contentEntry, most recently used first
+}
+
+// A contentEntry is the cached content of a file.
+type contentEntry struct {
+	name string
+	data []byte
+}
+
+func (c *contentCache) setMaxSize(maxSize int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxSize = maxSize
+	if maxSize <= 0 {
+		c.files, c.size = nil, 0
+		c.lru.Init()
+	} else if c.files == nil {
+		c.files = make(map[string]*list.Element)
+	}
+}
+
+func (c *contentCache) setCacheSize(size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cacheSize = size
+	c.evictLocked()
+}
+
+// evictLocked drops the files used least recently until the cache fits
+// its size. c.mu must be held.
+func (c *contentCache) evictLocked() {
+	limit := c.cacheSize
+	if limit <= 0 {
+		limit = DefaultContentCacheSize
+	}
+	for c.size > limit {
+		c.removeLocked(c.lru.Back().Value.(*contentEntry).name)
+	}
+}
+
+// removeLocked drops the content cached for name, if any. c.mu must be
+// held.
+func (c *contentCache) removeLocked(name string) {
+	if e, found := c.files[name]; found {
+		c.size -= int64(len(e.Value.(*contentEntry).data))
+		c.lru.Remove(e)
+		delete(c.files, name)
+	}
+}
+
+// snapshot caches a newly watched file, or the files in a newly watched
+// directory.
+func (c *contentCache) snapshot(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.files == nil {
+		return
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if !fi.IsDir() {
+		c.cacheLocked(path, fi)
+		return
+	}
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return
+	}
+	for _, fi := range files {
+		c.cacheLocked(filepath.Join(path, fi.Name()), fi)
+	}
+}
+
+// cacheLocked caches the content of a regular file that is small enough
+// and not a placeholder, returning it. c.mu must be held.
+func (c *contentCache) cacheLocked(name string, fi os.FileInfo) ([]byte, bool) {
+	c.removeLocked(name)
+	if !fi.Mode().IsRegular() || fi.Size() > c.maxSize || isPlaceholder(name) {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil || int64(len(data)) > c.maxSize {
+		return nil, false
+	}
+	c.files[name] = c.lru.PushFront(&contentEntry{name, data})
+	c.size += int64(len(data))
+	c.evictLocked()
+	return data, true
+}
+
+// update caches the file an event refers to and, for modifications,
+// attaches the content before and after the event.
+func (c *contentCache) update(ev *FileEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.files == nil {
+		return
+	}
+	if ev.IsDelete() || ev.IsRename() {
+		c.removeLocked(ev.Name)
+		return
+	}
+	fi, err := os.Stat(ev.Name)
+	if err != nil {
+		return
+	}
+	var old []byte
+	e, found := c.files[ev.Name]
+	if found {
+		old = e.Value.(*contentEntry).data
+	}
+	data, ok := c.cacheLocked(ev.Name, fi)
+	if found && ok && ev.IsModify() {
+		ev.delta = &ContentDelta{Name: ev.Name, Old: old, New: data}
+	}
+}
+
+// splitLines splits data after each newline.
+func splitLines(data []byte) []string {
+	var lines []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			lines = append(lines, string(data))
+			break
+		}
+		lines = append(lines, string(data[:i+1]))
+		data = data[i+1:]
+	}
+	return lines
+}
+
+// A diffLine is a line of a diff: ' ' for context, '-' for a removed line
+// and '+' for an added one.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// diffMaxCells bounds the table diffLines matches lines with, of one
+// cell per pair of lines, so that diffing large files does not use up
+// memory.
+const diffMaxCells = 1 << 20
+
+// diffLines returns the edit script turning a into b, from their longest
+// common subsequence. Beyond diffMaxCells, the lines between those common
+// to both ends are replaced as a whole.
+func diffLines(a, b []string) []diffLine {
+	var lines []diffLine
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		lines = append(lines, diffLine{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	n := 0
+	for n < len(a) && n < len(b) && a[len(a)-1-n] == b[len(b)-1-n] {
+		n++
+	}
+	suffix := a[len(a)-n:]
+	a, b = a[:len(a)-n], b[:len(b)-n]
+
+	if int64(len(a)+1)*int64(len(b)+1) > diffMaxCells {
+		for _, l := range a {
+			lines = append(lines, diffLine{'-', l})
+		}
+		for _, l := range b {
+			lines = append(lines, diffLine{'+', l})
+		}
+	} else {
+		lines = append(lines, lcsLines(a, b)...)
+	}
+	for _, l := range suffix {
+		lines = append(lines, diffLine{' ', l})
+	}
+	return lines
+}
+
+// lcsLines returns the edit script turning a into b, from their longest
+// common subsequence.
+func lcsLines(a, b []string) []diffLine {
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	return lines
+}
+
+const diffContext = 3
+
+func unifiedDiff(name string, a, b []string) string {
+	lines := diffLines(a, b)
+	var out strings.Builder
+	for start := 0; start < len(lines); {
+		// Find the next change and the end of its hunk, which takes in
+		// changes separated by at most twice the context
+		first := start
+		for first < len(lines) && lines[first].op == ' ' {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		last := first
+		for k := first; k < len(lines) && k <= last+2*diffContext; k++ {
+			if lines[k].op != ' ' {
+				last = k
+			}
+		}
+		from := first - diffContext
+		if from < start {
+			from = start
+		}
+		to := last + diffContext + 1
+		if to > len(lines) {
+			to = len(lines)
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", filepath.ToSlash(name), filepath.ToSlash(name))
+		}
+		aStart, bStart := 1, 1
+		for _, l := range lines[:from] {
+			if l.op != '+' {
+				aStart++
+			}
+			if l.op != '-' {
+				bStart++
+			}
+		}
+		aCount, bCount := 0, 0
+		for _, l := range lines[from:to] {
+			if l.op != '+' {
+				aCount++
+			}
+			if l.op != '-' {
+				bCount++
+			}
+		}
+		// An empty range starts at the line before it
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+		for _, l := range lines[from:to] {
+			out.WriteByte(l.op)
+			out.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = to
+	}
+	return out.String()
+}
@@ -0,0 +1,146 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var diffTests = []struct {
+	old, new string
+	diff     string
+}{
+	{"a\nb\nc\n", "a\nb\nc\n", ""},
+	{"a\nb\nc\n", "a\nB\nc\n", "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+	{"", "a\n", "--- a/f\n+++ b/f\n@@ -0,0 +1,1 @@\n+a\n"},
+	{"a\n", "a", "--- a/f\n+++ b/f\n@@ -1,1 +1,1 @@\n-a\n+a\n\\ No newline at end of file\n"},
+	{
+		"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+		"0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+		"--- a/f\n+++ b/f\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -7,4 +8,3 @@\n 7\n 8\n 9\n-10\n",
+	},
+}
+
+func TestContentDeltaDiff(t *testing.T) {
+	for _, tt := range diffTests {
+		d := &ContentDelta{Name: "f", Old: []byte(tt.old), New: []byte(tt.new)}
+		if diff := d.Diff(); diff != tt.diff {
+			t.Errorf("diff of %q and %q:\n%s\nwant:\n%s", tt.old, tt.new, diff, tt.diff)
+		}
+	}
+}
+
+func TestContentDeltaDiffLarge(t *testing.T) {
+	var old, new strings.Builder
+	old.WriteString("first\n")
+	new.WriteString("first\n")
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&old, "old %d\n", i)
+		fmt.Fprintf(&new, "new %d\n", i)
+	}
+	old.WriteString("last\n")
+	new.WriteString("last\n")
+
+	// Too many lines to match; those in between the common ends are replaced
+	d := &ContentDelta{Name: "f", Old: []byte(old.String()), New: []byte(new.String())}
+	diff := d.Diff()
+	if hunk := "@@ -1,2002 +1,2002 @@\n first\n-old 0\n"; !strings.HasPrefix(diff, "--- a/f\n+++ b/f\n"+hunk) {
+		t.Fatalf("diff of large content does not start with %q:\n%.200s", hunk, diff)
+	}
+	if !strings.HasSuffix(diff, "+new 1999\n last\n") {
+		t.Fatalf("diff of large content does not end with the last line:\n%s", diff[len(diff)-100:])
+	}
+}
+
+func TestFsnotifyContentDelta(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	testFile := filepath.Join(testDir, "TestFsnotifyContentDelta.testfile")
+	if err := ioutil.WriteFile(testFile, []byte("a\nb\n"), 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetContentTracking(1024)
+
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	deltas := make(chan *ContentDelta, 10)
+	go func() {
+		for event := range watcher.Event {
+			if d := event.ContentDelta(); d != nil {
+				deltas <- d
+			}
+		}
+	}()
+
+	addWatch(t, watcher, testDir)
+
+	f, err := os.OpenFile(testFile, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("reopening test file failed: %s", err)
+	}
+	f.WriteString("c\n")
+	f.Close()
+
+	select {
+	case d := <-deltas:
+		if string(d.Old) != "a\nb\n" || string(d.New) != "a\nb\nc\n" {
+			t.Fatalf("incorrect content delta (%q -> %q vs %q -> %q)", d.Old, d.New, "a\nb\n", "a\nb\nc\n")
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("fsnotify modify events with content have not received after 500 ms")
+	}
+}
+
+func TestContentCacheSize(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	var names []string
+	for _, name := range []string{"a", "b", "c"} {
+		name = filepath.Join(testDir, name)
+		if err := ioutil.WriteFile(name, []byte("data"), 0666); err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+		names = append(names, name)
+	}
+
+	var c contentCache
+	c.setMaxSize(1024)
+	c.setCacheSize(10)
+	for _, name := range names {
+		c.snapshot(name)
+	}
+	if c.size > 10 || len(c.files) != 2 {
+		t.Fatalf("cache holds %d files of %d bytes, expected 2 of at most 10", len(c.files), c.size)
+	}
+	if _, found := c.files[names[0]]; found {
+		t.Fatalf("least recently used %s was not evicted", names[0])
+	}
+
+	// A modification counts as a use
+	c.update(NewEvent(names[1], FSN_MODIFY))
+	c.snapshot(names[0])
+	if _, found := c.files[names[1]]; !found {
+		t.Fatalf("recently used %s was evicted", names[1])
+	}
+	if _, found := c.files[names[2]]; found {
+		t.Fatalf("least recently used %s was not evicted", names[2])
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrNoCooperative is returned by NewCooperativeWatcher on platforms whose
+// backend needs a goroutine of its own: all but Linux.
+var ErrNoCooperative = errors.New("fsnotify: cooperative watchers not supported")
+
+// NewCooperativeWatcher creates and returns a watcher that starts no
+// goroutines to read and deliver events, for embedders that must control
+// scheduling, such as deterministic simulators. Events are read and
+// delivered by Poll, on the goroutine of its caller, rather than sent on
+// the Event and Error channels, which stay unused.
+//
+// Features that wait on goroutines of their own, such as pending watches,
+// polling and resume rescans, still start them when enabled; their events
+// are picked up by the next Poll. SetFairness has no effect, as Poll
+// delivers events in the order they are read.
+func NewCooperativeWatcher() (*Watcher, error) {
+	return newCooperativeWatcher()
+}
+
+// Poll reads the events the system queued for a cooperative watcher (see
+// NewCooperativeWatcher) and delivers them, without waiting for more.
+// Handlers and middleware run before it returns; the events and errors
+// that would be sent on the Event and Error channels are returned in the
+// order they occurred. Once ctx is done, the events not delivered yet are
+// left for the next call, and ctx.Err() is returned with the notices so
+// far.
+func (w *Watcher) Poll(ctx context.Context) ([]Notice, error) {
+	if !w.coop.enabled {
+		return nil, errors.New("fsnotify: Poll of a watcher not created by NewCooperativeWatcher")
+	}
+	if err := w.readQueued(); err != nil {
+		return nil, err
+	}
+	for ctx.Err() == nil {
+		ev := w.coop.pop()
+		if ev == nil {
+			select {
+			case ev = <-w.internalEvent:
+			default:
+			}
+		}
+		if ev == nil {
+			break
+		}
+		w.purgeEvent(ev)
+	}
+	return w.coop.take(), ctx.Err()
+}
+
+// A coopQueue holds the events of a cooperative watcher between calls of
+// Poll.
+type coopQueue struct {
+	enabled bool         // Set for cooperative watchers, when created
+	mu      sync.Mutex   // Protects access to the fields below.
+	events  []*FileEvent // Events read, to be delivered
+	notices []Notice     // Events and errors delivered, to be returned
+}
+
+func (q *coopQueue) push(ev *FileEvent) {
+	q.mu.Lock()
+	q.events = append(q.events, ev)
+	q.mu.Unlock()
+}
+
+// pop returns the next event to deliver, or nil if there is none.
+func (q *coopQueue) pop() *FileEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.events) == 0 {
+		return nil
+	}
+	ev := q.events[0]
+	q.events = q.events[1:]
+	return ev
+}
+
+func (q *coopQueue) deliver(n Notice) {
+	q.mu.Lock()
+	q.notices = append(q.notices, n)
+	q.mu.Unlock()
+}
+
+// take returns the notices delivered since the last call.
+func (q *coopQueue) take() []Notice {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	notices := q.notices
+	q.notices = nil
+	return notices
+}
+
+// queue queues ev for delivery: on the internal chan or, for a cooperative
+// watcher reading on the goroutine delivering, until Poll delivers it.
+func (w *Watcher) queue(ev *FileEvent) {
+	if w.coop.enabled {
+		w.coop.push(ev)
+		return
+	}
+	w.internalEvent <- ev
+}
+
+// queueStop queues ev like queue, unless stop is closed first, and reports
+// whether ev was queued. It is for the goroutines of features that stop
+// before the watcher closes its internal chan, which a cooperative watcher
+// reads only in Poll.
+func (w *Watcher) queueStop(ev *FileEvent, stop chan bool) bool {
+	if w.coop.enabled {
+		w.coop.push(ev)
+		return true
+	}
+	select {
+	case w.internalEvent <- ev:
+		return true
+	case <-stop:
+		return false
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package fsnotify
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func newCooperativeWatcher() (*Watcher, error) {
+	w, err := newInotify()
+	if err != nil {
+		return nil, err
+	}
+	w.coop.enabled = true
+	return w, nil
+}
+
+// readQueued reads the events queued on the inotify instance, if any,
+// without blocking, and queues them for Poll.
+func (w *Watcher) readQueued() error {
+	w.mu.Lock()
+	closed := w.isClosed
+	w.mu.Unlock()
+	if closed {
+		return errors.New("inotify instance already closed")
+	}
+	queued := w.queuedBytes()
+	if queued == 0 {
+		return nil
+	}
+	buf := make([]byte, queued)
+	n, errno := syscall.Read(w.fd, buf)
+	if n < 0 {
+		w.sendError(os.NewSyscallError("read", errno))
+		return nil
+	}
+	if n < syscall.SizeofInotifyEvent {
+		w.sendError(errors.New("inotify: short read in readQueued()"))
+		return nil
+	}
+	w.sendEvents(buf[:n])
+	return nil
+}
@@ -0,0 +1,15 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package fsnotify
+
+// The other backends read events on goroutines of their own: kqueue and
+// event ports wait in the kernel, Windows on its I/O thread.
+func newCooperativeWatcher() (*Watcher, error) {
+	return nil, ErrNoCooperative
+}
+
+func (w *Watcher) readQueued() error { return nil }
@@ -0,0 +1,614 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The daemon owns the kernel watches for several processes, so that tools
+// watching the same trees do not each use up the watch limits. Clients talk
+// to it over a unix socket with a line protocol. A client sends
+//
+//	WATCH "<path>"
+//	SUBSCRIBE "<path>" "<triggers>"
+//	REMOVE "<path>"
+//
+// where SUBSCRIBE is WATCH with the events of the client filtered by
+// triggers in the syntax of ParseTriggers. The daemon answers each request
+// with OK or ERR "<message>". In between it sends the events and errors of
+// the watches of the client:
+//
+//	EVENT <flags> "<name>"
+//	ERROR "<message>"
+//
+// where flags are the notifications of the event (FSN_MODIFY etc.) and
+// strings are quoted in Go syntax.
+//
+// The daemon serves only its own user: its socket is readable and writable
+// by its owner alone, and where the system tells the user of the peer of a
+// unix socket (Linux, the BSDs and macOS), connections of other users are
+// refused. Clients likewise refuse a socket or daemon of another user.
+
+// ErrDaemonDropped is reported to a client that did not keep up with its
+// events, some of which were dropped.
+var ErrDaemonDropped = errors.New("fsnotify: daemon dropped events")
+
+// errNoPeerCred is returned by peerUID where the user of the peer of a
+// unix socket is not known.
+var errNoPeerCred = errors.New("fsnotify: peer credentials not supported")
+
+// DaemonSocket returns the path of the daemon socket: $FSNOTIFY_SOCKET if
+// set, otherwise fsnotify.sock in $XDG_RUNTIME_DIR, or in a directory of
+// the user in the temporary directory, which ListenDaemon creates private
+// to the user.
+func DaemonSocket() string {
+	if path := os.Getenv("FSNOTIFY_SOCKET"); path != "" {
+		return path
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "fsnotify.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("fsnotify-%d", os.Getuid()), "fsnotify.sock")
+}
+
+// checkPeer returns an error if the process at the other end of a unix
+// socket connection runs as another user. Where that is not known, it
+// returns nil and the permissions of the socket are relied on.
+func checkPeer(conn net.Conn) error {
+	uid, err := peerUID(conn)
+	if err == errNoPeerCred {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if uid != os.Geteuid() {
+		return fmt.Errorf("fsnotify: peer of daemon socket runs as user %d", uid)
+	}
+	return nil
+}
+
+// eventFlags returns the notifications of an event (FSN_MODIFY etc.)
+func eventFlags(ev *FileEvent) uint32 {
+	var flags uint32
+	for _, flag := range []uint32{FSN_CREATE, FSN_MODIFY, FSN_DELETE, FSN_RENAME} {
+		if ev.matchesFlags(flag) {
+			flags |= flag
+		}
+	}
+	return flags
+}
+
+// daemonBuffer is the number of lines queued for a client before its
+// events are dropped.
+const daemonBuffer = 1024
+
+// A daemon shares one Watcher between its clients.
+type daemon struct {
+	w       *Watcher
+	mu      sync.Mutex                            // Protects access to clients.
+	clients map[string]map[*daemonConn]TriggerSet // Map of watched paths to their clients and filters (nil for all events)
+	done    chan bool                             // Closed when the watcher is closed
+}
+
+// A daemonConn is the connection of a client to the daemon.
+type daemonConn struct {
+	conn    net.Conn
+	out     chan string // Lines to write to the client
+	mu      sync.Mutex  // Protects access to dropped and closed.
+	dropped bool        // Set when lines were dropped since the last write
+	closed  bool
+}
+
+// ServeDaemon serves clients on l with a Watcher shared between them,
+// until l is closed. Clients of other users are refused where they are
+// known (see the daemon protocol above); l should be a unix socket that
+// only the user can connect to.
+func ServeDaemon(l net.Listener) error {
+	w, err := NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return serveDaemon(w, l)
+}
+
+// ListenDaemon listens on a unix socket at path for ServeDaemon. If the
+// directory of path does not exist, it is created accessible to the user
+// only; if it exists, it must be a directory, not a symlink, owned by the
+// user and accessible to the user only, so that no other user can remove
+// or replace the socket. The socket is made readable and writable by the
+// user only.
+func ListenDaemon(path string) (net.Listener, error) {
+	dir := filepath.Dir(path)
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	if err := checkPrivateDir(dir); err != nil {
+		return nil, err
+	}
+	// No other user can reach the socket in dir before it is restricted
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// checkPrivateDir returns an error unless dir is a directory owned by the
+// user and accessible to the user only. Where the owner of files is not
+// known, it only checks that dir is a directory.
+func checkPrivateDir(dir string) error {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("fsnotify: daemon socket directory %s is not a directory", dir)
+	}
+	uid, ok := fileOwner(fi)
+	if !ok {
+		return nil
+	}
+	if uid != os.Geteuid() {
+		return fmt.Errorf("fsnotify: daemon socket directory %s is owned by user %d", dir, uid)
+	}
+	if perm := fi.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("fsnotify: daemon socket directory %s is accessible to other users (mode %o)", dir, perm)
+	}
+	return nil
+}
+
+// ServeSocket serves the daemon protocol (see ServeDaemon) with w on a
+// unix socket at path, as made by ListenDaemon, for tools written in other
+// languages to use w as their engine. It takes over the Event and Error
+// channels of w, and returns nil once w is closed.
+func (w *Watcher) ServeSocket(path string) error {
+	l, err := ListenDaemon(path)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return serveDaemon(w, l)
+}
+
+// serveDaemon serves clients on l with w until l or w is closed.
+func serveDaemon(w *Watcher, l net.Listener) error {
+	d := &daemon{w: w, clients: make(map[string]map[*daemonConn]TriggerSet), done: make(chan bool)}
+	go d.readEvents()
+	go d.closeListener(l)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-d.done:
+				return nil
+			default:
+			}
+			return err
+		}
+		if checkPeer(conn) != nil {
+			conn.Close()
+			continue
+		}
+		c := &daemonConn{conn: conn, out: make(chan string, daemonBuffer)}
+		go c.writeLines()
+		go d.serve(c)
+	}
+}
+
+// closeListener closes l once the watcher of d is closed.
+func (d *daemon) closeListener(l net.Listener) {
+	<-d.done
+	l.Close()
+}
+
+func (d *daemon) readEvents() {
+	defer close(d.done)
+	events, errs := d.w.Event, d.w.Error
+	for events != nil || errs != nil {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			line := fmt.Sprintf("EVENT %d %s", eventFlags(ev), strconv.Quote(ev.Name))
+			d.mu.Lock()
+			for c, filter := range d.clients[ev.Name] {
+				if filter == nil || filter.Match(ev) {
+					c.send(line)
+				}
+			}
+			if dir := filepath.Dir(ev.Name); dir != ev.Name {
+				for c, filter := range d.clients[dir] {
+					if _, found := d.clients[ev.Name][c]; !found && (filter == nil || filter.Match(ev)) {
+						c.send(line)
+					}
+				}
+			}
+			d.mu.Unlock()
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			line := "ERROR " + strconv.Quote(err.Error())
+			d.mu.Lock()
+			for _, clients := range d.clients {
+				for c := range clients {
+					c.send(line)
+				}
+			}
+			d.mu.Unlock()
+		}
+	}
+}
+
+// serve handles the requests of a client until it disconnects.
+func (d *daemon) serve(c *daemonConn) {
+	scanner := bufio.NewScanner(c.conn)
+	for scanner.Scan() {
+		op, arg := scanner.Text(), ""
+		if i := strings.IndexByte(op, ' '); i >= 0 {
+			op, arg = op[:i], op[i+1:]
+		}
+		var filter TriggerSet
+		var err error
+		if op == "SUBSCRIBE" {
+			arg, filter, err = parseSubscribe(arg)
+		}
+		var path string
+		if err == nil {
+			path, err = strconv.Unquote(arg)
+		}
+		if err == nil {
+			switch op {
+			case "WATCH", "SUBSCRIBE":
+				err = d.watch(c, filepath.Clean(path), filter)
+			case "REMOVE":
+				err = d.removeWatch(c, filepath.Clean(path))
+			default:
+				err = fmt.Errorf("unknown request %q", op)
+			}
+		}
+		if err != nil {
+			c.send("ERR " + strconv.Quote(err.Error()))
+		} else {
+			c.send("OK")
+		}
+	}
+	d.mu.Lock()
+	for path := range d.clients {
+		d.removeLocked(c, path)
+	}
+	d.mu.Unlock()
+	c.close()
+}
+
+// parseSubscribe splits the arguments of SUBSCRIBE into the quoted path
+// and the triggers that follow it.
+func parseSubscribe(arg string) (string, TriggerSet, error) {
+	// Find the closing quote of the path, skipping escaped characters
+	end := -1
+	for i := 1; i < len(arg) && arg[0] == '"'; i++ {
+		if arg[i] == '\\' {
+			i++
+		} else if arg[i] == '"' {
+			end = i
+			break
+		}
+	}
+	if end < 0 || end+1 >= len(arg) || arg[end+1] != ' ' {
+		return "", nil, errors.New("SUBSCRIBE needs a path and triggers")
+	}
+	triggers, err := strconv.Unquote(arg[end+2:])
+	if err != nil {
+		return "", nil, err
+	}
+	filter, err := ParseTriggers(triggers)
+	if err != nil {
+		return "", nil, err
+	}
+	return arg[:end+1], filter, nil
+}
+
+func (d *daemon) watch(c *daemonConn, path string, filter TriggerSet) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if clients, found := d.clients[path]; found {
+		clients[c] = filter
+		return nil
+	}
+	if err := d.w.Watch(path); err != nil {
+		return err
+	}
+	d.clients[path] = map[*daemonConn]TriggerSet{c: filter}
+	return nil
+}
+
+func (d *daemon) removeWatch(c *daemonConn, path string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, found := d.clients[path][c]; !found {
+		return fmt.Errorf("can't remove non-existent watch for: %s", path)
+	}
+	return d.removeLocked(c, path)
+}
+
+// removeLocked removes the client from the watch of path, removing the
+// watch once it has no clients left. d.mu must be held.
+func (d *daemon) removeLocked(c *daemonConn, path string) error {
+	clients := d.clients[path]
+	if _, found := clients[c]; !found {
+		return nil
+	}
+	delete(clients, c)
+	if len(clients) > 0 {
+		return nil
+	}
+	delete(d.clients, path)
+	return d.w.RemoveWatch(path)
+}
+
+// send queues a line for the client, dropping it if the client is behind.
+func (c *daemonConn) send(line string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.out <- line:
+	default:
+		c.dropped = true
+	}
+}
+
+func (c *daemonConn) writeLines() {
+	w := bufio.NewWriter(c.conn)
+	for line := range c.out {
+		c.mu.Lock()
+		dropped := c.dropped
+		c.dropped = false
+		c.mu.Unlock()
+		if dropped {
+			fmt.Fprintf(w, "ERROR %s\n", strconv.Quote(ErrDaemonDropped.Error()))
+		}
+		w.WriteString(line)
+		w.WriteByte('\n')
+		if len(c.out) == 0 && w.Flush() != nil {
+			break
+		}
+	}
+	c.conn.Close()
+}
+
+func (c *daemonConn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.out)
+	}
+}
+
+// A SharedWatcher watches through the daemon if one is running, and
+// otherwise through a Watcher of its own. Either way it is used like a
+// Watcher.
+type SharedWatcher struct {
+	Event chan *FileEvent
+	Error chan error
+	w     *Watcher   // Watcher used when no daemon is running
+	conn  net.Conn   // Connection to the daemon
+	reqmu sync.Mutex // Serializes requests to the daemon.
+	reply chan error // Replies of the daemon to requests
+	done  chan bool  // Closed when the connection to the daemon is closed
+	once  sync.Once
+
+	// Events and errors read from the daemon are queued for deliver, so
+	// that a reply is never held up behind an event nobody reads yet.
+	queue   chan interface{}
+	mu      sync.Mutex // Protects access to dropped.
+	dropped bool       // Set when events were dropped since the last delivery
+	closed  chan bool  // Closed by Close
+}
+
+// NewSharedWatcher connects to the daemon at DaemonSocket, falling back to
+// NewWatcher if no daemon is running.
+func NewSharedWatcher() (*SharedWatcher, error) {
+	s, err := DialDaemon(DaemonSocket())
+	if err == nil {
+		return s, nil
+	}
+	w, err := NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &SharedWatcher{Event: w.Event, Error: w.Error, w: w}, nil
+}
+
+// DialDaemon connects to the daemon listening on the unix socket path. It
+// refuses a socket owned by, or a daemon running as, another user.
+func DialDaemon(path string) (*SharedWatcher, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if uid, ok := fileOwner(fi); ok && uid != os.Geteuid() {
+		return nil, fmt.Errorf("fsnotify: daemon socket %s is owned by user %d", path, uid)
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPeer(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s := &SharedWatcher{
+		Event:  make(chan *FileEvent),
+		Error:  make(chan error),
+		conn:   conn,
+		reply:  make(chan error, 1),
+		done:   make(chan bool),
+		queue:  make(chan interface{}, daemonBuffer),
+		closed: make(chan bool),
+	}
+	go s.readLines()
+	go s.deliver()
+	return s, nil
+}
+
+// Daemon reports whether s watches through the daemon.
+func (s *SharedWatcher) Daemon() bool {
+	return s.w == nil
+}
+
+// Watch a given file path
+func (s *SharedWatcher) Watch(path string) error {
+	if s.w != nil {
+		return s.w.Watch(path)
+	}
+	return s.request("WATCH", path)
+}
+
+// Remove a watch on a file
+func (s *SharedWatcher) RemoveWatch(path string) error {
+	if s.w != nil {
+		return s.w.RemoveWatch(path)
+	}
+	return s.request("REMOVE", path)
+}
+
+// Close removes all watches and closes the Event channel.
+func (s *SharedWatcher) Close() error {
+	if s.w != nil {
+		return s.w.Close()
+	}
+	var err error
+	s.once.Do(func() {
+		close(s.closed)
+		err = s.conn.Close()
+	})
+	return err
+}
+
+func (s *SharedWatcher) request(op, path string) error {
+	// Paths are resolved by the daemon, in its own working directory
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	s.reqmu.Lock()
+	defer s.reqmu.Unlock()
+	if _, err := fmt.Fprintf(s.conn, "%s %s\n", op, strconv.Quote(path)); err != nil {
+		return err
+	}
+	select {
+	case err := <-s.reply:
+		return err
+	case <-s.done:
+		return errors.New("fsnotify: daemon connection closed")
+	}
+}
+
+func (s *SharedWatcher) readLines() {
+	defer close(s.queue)
+	defer close(s.done)
+	scanner := bufio.NewScanner(s.conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "OK":
+			s.reply <- nil
+		case strings.HasPrefix(line, "ERR "):
+			s.reply <- errors.New(unquote(line[len("ERR "):]))
+		case strings.HasPrefix(line, "ERROR "):
+			msg := unquote(line[len("ERROR "):])
+			if msg == ErrDaemonDropped.Error() {
+				s.enqueue(ErrDaemonDropped)
+			} else {
+				s.enqueue(errors.New(msg))
+			}
+		case strings.HasPrefix(line, "EVENT "):
+			fields := strings.SplitN(line, " ", 3)
+			if len(fields) != 3 {
+				continue
+			}
+			flags, err := strconv.ParseUint(fields[1], 10, 32)
+			if err != nil {
+				continue
+			}
+			s.enqueue(newFileEvent(unquote(fields[2]), uint32(flags)))
+		}
+	}
+}
+
+// enqueue queues an event or error for delivery, dropping it if the client
+// is behind.
+func (s *SharedWatcher) enqueue(item interface{}) {
+	select {
+	case s.queue <- item:
+	default:
+		s.mu.Lock()
+		s.dropped = true
+		s.mu.Unlock()
+	}
+}
+
+// deliver sends the queued events and errors on the Event and Error
+// channels, until the connection or s is closed.
+func (s *SharedWatcher) deliver() {
+	defer close(s.Event)
+	defer close(s.Error)
+	for item := range s.queue {
+		s.mu.Lock()
+		dropped := s.dropped
+		s.dropped = false
+		s.mu.Unlock()
+		if dropped {
+			select {
+			case s.Error <- ErrDaemonDropped:
+			case <-s.closed:
+				return
+			}
+		}
+		switch item := item.(type) {
+		case *FileEvent:
+			select {
+			case s.Event <- item:
+			case <-s.closed:
+				return
+			}
+		case error:
+			select {
+			case s.Error <- item:
+			case <-s.closed:
+				return
+			}
+		}
+	}
+}
+
+func unquote(s string) string {
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return s
+}
@@ -0,0 +1,261 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDaemonSharedWatch(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+	socketDir := tempMkdir(t)
+	defer os.RemoveAll(socketDir)
+
+	l, err := net.Listen("unix", filepath.Join(socketDir, "fsnotify.sock"))
+	if err != nil {
+		t.Skipf("unix sockets not supported: %s", err)
+	}
+	defer l.Close()
+	go ServeDaemon(l)
+
+	testFile := filepath.Join(testDir, "TestDaemonSharedWatch.testfile")
+	var received [2]counter
+	for i := range received {
+		s, err := DialDaemon(l.Addr().String())
+		if err != nil {
+			t.Fatalf("connecting to daemon failed: %s", err)
+		}
+		defer s.Close()
+		if !s.Daemon() {
+			t.Fatal("watcher connected to the daemon does not report it")
+		}
+		go func() {
+			for err := range s.Error {
+				t.Errorf("error received: %s", err)
+			}
+		}()
+		created := &received[i]
+		go func() {
+			for event := range s.Event {
+				if event.Name == testFile && event.IsCreate() {
+					created.increment()
+				}
+			}
+		}()
+		if err := s.Watch(testDir); err != nil {
+			t.Fatalf("watching %q through the daemon failed: %s", testDir, err)
+		}
+	}
+
+	f, err := os.OpenFile(testFile, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	f.Close()
+
+	time.Sleep(500 * time.Millisecond)
+	for i := range received {
+		if received[i].value() != 1 {
+			t.Fatalf("incorrect number of create events received by client %d after 500 ms (%d vs %d)", i, received[i].value(), 1)
+		}
+	}
+}
+
+func TestSharedWatcherFallback(t *testing.T) {
+	socketDir := tempMkdir(t)
+	defer os.RemoveAll(socketDir)
+
+	defer os.Setenv("FSNOTIFY_SOCKET", os.Getenv("FSNOTIFY_SOCKET"))
+	os.Setenv("FSNOTIFY_SOCKET", filepath.Join(socketDir, "missing.sock"))
+
+	s, err := NewSharedWatcher()
+	if err != nil {
+		t.Fatalf("NewSharedWatcher() failed: %s", err)
+	}
+	defer s.Close()
+	if s.Daemon() {
+		t.Fatal("watcher reports the daemon although none is running")
+	}
+}
+
+func TestWatcherServeSocket(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+	socketDir := tempMkdir(t)
+	defer os.RemoveAll(socketDir)
+
+	watcher := newWatcher(t)
+	socket := filepath.Join(socketDir, "fsnotify.sock")
+	served := make(chan error, 1)
+	go func() { served <- watcher.ServeSocket(socket) }()
+
+	var conn net.Conn
+	var err error
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("unix", socket); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Skipf("unix sockets not supported: %s", err)
+	}
+	defer conn.Close()
+	lines := bufio.NewReader(conn)
+	readLine := func() string {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		line, err := lines.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading from socket failed: %s", err)
+		}
+		return strings.TrimSuffix(line, "\n")
+	}
+
+	fmt.Fprintf(conn, "SUBSCRIBE %q %q\n", testDir, "create:*.txt")
+	if line := readLine(); line != "OK" {
+		t.Fatalf("subscribing to %q failed: %s", testDir, line)
+	}
+	fmt.Fprintf(conn, "SUBSCRIBE %q %q\n", testDir, "bogus")
+	if line := readLine(); !strings.HasPrefix(line, "ERR ") {
+		t.Fatalf("subscribing with malformed triggers was accepted: %s", line)
+	}
+	fmt.Fprintf(conn, "SUBSCRIBE %q %q\n", testDir, "")
+	if line := readLine(); !strings.HasPrefix(line, "ERR ") {
+		t.Fatalf("subscribing without triggers was accepted: %s", line)
+	}
+
+	for _, name := range []string{"skipped.log", "matched.txt"} {
+		f, err := os.Create(filepath.Join(testDir, name))
+		if err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+		f.Close()
+	}
+	want := fmt.Sprintf("EVENT %d %q", FSN_CREATE, filepath.Join(testDir, "matched.txt"))
+	if line := readLine(); line != want {
+		t.Fatalf("event received from socket is %s, expected %s", line, want)
+	}
+
+	watcher.Close()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("serving socket failed: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ServeSocket did not return after the watcher was closed")
+	}
+}
+
+func TestListenDaemonDir(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skipf("file owners not known on %s", runtime.GOOS)
+	}
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	private := filepath.Join(testDir, "private")
+	l, err := ListenDaemon(filepath.Join(private, "fsnotify.sock"))
+	if err != nil {
+		t.Skipf("unix sockets not supported: %s", err)
+	}
+	l.Close()
+
+	// A directory other users can enter, or a symlink to a private one,
+	// is refused
+	shared := filepath.Join(testDir, "shared")
+	if err := os.Mkdir(shared, 0755); err != nil {
+		t.Fatalf("creating directory failed: %s", err)
+	}
+	if err := os.Chmod(shared, 0755); err != nil {
+		t.Fatalf("chmod failed: %s", err)
+	}
+	link := filepath.Join(testDir, "link")
+	if err := os.Symlink(private, link); err != nil {
+		t.Fatalf("creating symlink failed: %s", err)
+	}
+	for _, dir := range []string{shared, link} {
+		if l, err := ListenDaemon(filepath.Join(dir, "fsnotify.sock")); err == nil {
+			l.Close()
+			t.Errorf("listening in %s succeeded", dir)
+		}
+	}
+}
+
+func TestSharedWatcherUnreadEvents(t *testing.T) {
+	// Create directories to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+	otherDir := tempMkdir(t)
+	defer os.RemoveAll(otherDir)
+	socketDir := tempMkdir(t)
+	defer os.RemoveAll(socketDir)
+
+	l, err := net.Listen("unix", filepath.Join(socketDir, "fsnotify.sock"))
+	if err != nil {
+		t.Skipf("unix sockets not supported: %s", err)
+	}
+	defer l.Close()
+	go ServeDaemon(l)
+
+	s, err := DialDaemon(l.Addr().String())
+	if err != nil {
+		t.Fatalf("connecting to daemon failed: %s", err)
+	}
+	defer s.Close()
+	if err := s.Watch(testDir); err != nil {
+		t.Fatalf("watching %q through the daemon failed: %s", testDir, err)
+	}
+	testFile := filepath.Join(testDir, "TestSharedWatcherUnreadEvents.testfile")
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// Nobody reads the event of the test file yet; requests still get replies
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd() failed: %s", err)
+	}
+	rel, err := filepath.Rel(cwd, otherDir)
+	if err != nil {
+		t.Skipf("no relative path to %q: %s", otherDir, err)
+	}
+	watched := make(chan error, 1)
+	go func() { watched <- s.Watch(rel) }()
+	select {
+	case err := <-watched:
+		if err != nil {
+			t.Fatalf("watching %q through the daemon failed: %s", rel, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("request blocked behind an unread event")
+	}
+
+	select {
+	case ev := <-s.Event:
+		if ev.Name != testFile {
+			t.Fatalf("event for %q, want %q", ev.Name, testFile)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued event not delivered")
+	}
+	// The relative path was resolved by the client
+	if err := s.RemoveWatch(otherDir); err != nil {
+		t.Fatalf("removing watch of %q failed: %s", otherDir, err)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin
+
+package fsnotify
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFsnotifyUnmountVolume(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping disk image test in short mode.")
+	}
+	if _, err := exec.LookPath("hdiutil"); err != nil {
+		t.Skip("hdiutil not available.")
+	}
+
+	// Create and attach a small disk image to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	image := filepath.Join(testDir, "fsnotify.dmg")
+	mountPoint := filepath.Join(testDir, "mnt")
+	if out, err := exec.Command("hdiutil", "create", "-size", "1m", "-fs", "HFS+", "-volname", "fsnotify", image).CombinedOutput(); err != nil {
+		t.Fatalf("creating disk image failed: %s: %s", err, out)
+	}
+	if out, err := exec.Command("hdiutil", "attach", "-nobrowse", "-mountpoint", mountPoint, image).CombinedOutput(); err != nil {
+		t.Fatalf("attaching disk image failed: %s: %s", err, out)
+	}
+	attached := true
+	defer func() {
+		if attached {
+			exec.Command("hdiutil", "detach", "-force", mountPoint).Run()
+		}
+	}()
+
+	testFile := filepath.Join(mountPoint, "TestFsnotifyUnmountVolume.testfile")
+	f, err := os.OpenFile(testFile, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	f.Close()
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Logf("error received: %s", err)
+		}
+	}()
+
+	var deleteReceived counter
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			if event.Name == filepath.Clean(testFile) && event.IsDelete() {
+				deleteReceived.increment()
+			}
+		}
+	}()
+
+	addWatch(t, watcher, mountPoint)
+	addWatch(t, watcher, testFile)
+
+	// Watching must not keep the volume busy
+	if out, err := exec.Command("hdiutil", "detach", mountPoint).CombinedOutput(); err != nil {
+		t.Fatalf("detaching watched disk image failed: %s: %s", err, out)
+	}
+	attached = false
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if deleteReceived.value() == 0 {
+		t.Fatal("fsnotify delete events have not been received after unmount")
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A DedupKey identifies the content of a file.
+type DedupKey struct {
+	Size int64             // Size of the file
+	Hash [sha256.Size]byte // SHA-256 of the content of the file
+}
+
+// A DedupStore records the content last processed for each path, so that
+// unchanged files are not processed again, even across restarts.
+// It can be backed by any durable key-value store.
+type DedupStore interface {
+	// Get returns the key last recorded for path.
+	Get(path string) (key DedupKey, found bool, err error)
+	// Put records key as processed for path.
+	Put(path string, key DedupKey) error
+}
+
+// FileDedupKey computes the key for the current content of the file at path.
+func FileDedupKey(path string) (DedupKey, error) {
+	var key DedupKey
+	f, err := os.Open(path)
+	if err != nil {
+		return key, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return key, err
+	}
+	key.Size = n
+	copy(key.Hash[:], h.Sum(nil))
+	return key, nil
+}
+
+// Changed reports whether the file at path differs from the content last
+// recorded for it in store. The returned key should be recorded with Put
+// once the file has been processed.
+func Changed(store DedupStore, path string) (changed bool, key DedupKey, err error) {
+	key, err = FileDedupKey(path)
+	if err != nil {
+		return false, key, err
+	}
+	prev, found, err := store.Get(path)
+	if err != nil {
+		return false, key, err
+	}
+	return !found || prev != key, key, nil
+}
+
+// IdentityDedupStore returns a DedupStore recording keys in store under
+// the identity of each file, its device and inode number, rather than its
+// path, where the system provides one. A file reached through several
+// paths, as through bind mounts, several mounts of one file system or hard
+// links, is then processed once, also by the Watchers of different mounts
+// sharing store. Files without an identity, such as those gone, are
+// recorded by path.
+//
+// A file replaced by another, as editors save files, takes a new identity,
+// leaving the record of the old one behind in store.
+func IdentityDedupStore(store DedupStore) DedupStore {
+	return identityDedupStore{store}
+}
+
+type identityDedupStore struct {
+	store DedupStore
+}
+
+func (s identityDedupStore) Get(path string) (DedupKey, bool, error) {
+	return s.store.Get(dedupIdentity(path))
+}
+
+func (s identityDedupStore) Put(path string, key DedupKey) error {
+	return s.store.Put(dedupIdentity(path), key)
+}
+
+// dedupIdentity returns the name under which an identity store records the
+// file at path: its device and inode number in a form no path takes, or
+// path itself if the file has no identity.
+func dedupIdentity(path string) string {
+	dev, ino, ok := fileIdentity(path)
+	if !ok {
+		return path
+	}
+	return fmt.Sprintf("\x00%d:%d", dev, ino)
+}
+
+// A FileDedupStore is a DedupStore kept in an append-only file, which is
+// synced to disk on every Put. It is safe for concurrent use, so the
+// Watchers of several mounts can share one store. Records replaced by
+// later ones are dropped by rewriting the file when the store is opened,
+// and once they outnumber the current ones (see dedupCompactMin).
+type FileDedupStore struct {
+	mu      sync.Mutex          // Protects access to f, keys and records.
+	name    string              // Name of the file
+	f       *os.File            // Log of recorded keys (nil if reopening it failed)
+	keys    map[string]DedupKey // Map of recorded keys (key: path)
+	records int                 // Number of records in f, current or not
+}
+
+// dedupCompactMin is the number of stale records a FileDedupStore keeps
+// at least before it is compacted while open.
+const dedupCompactMin = 1024
+
+// OpenFileDedupStore opens the store kept in the file name, creating it
+// if it does not exist.
+func OpenFileDedupStore(name string) (*FileDedupStore, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileDedupStore{name: name, f: f, keys: make(map[string]DedupKey)}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// A torn record from a crash can only be the last one, and is
+		// dropped by compact along with the stale ones
+		s.records++
+		path, key, err := parseDedupRecord(scanner.Text())
+		if err != nil {
+			continue
+		}
+		s.keys[path] = key
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	// A record cut short of its newline would run into the next one
+	var torn bool
+	if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+		var last [1]byte
+		if _, err := f.ReadAt(last[:], fi.Size()-1); err == nil && last[0] != '\n' {
+			torn = true
+		}
+	}
+	if torn || s.records > len(s.keys) {
+		if err := s.compact(); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// compact rewrites the file of the store with the current records only,
+// replacing it atomically. If that fails, the old file is kept. s.mu must
+// be held, or s not yet shared.
+func (s *FileDedupStore) compact() error {
+	tmp := s.name + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(s.keys))
+	for path := range s.keys {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	w := bufio.NewWriter(f)
+	for _, path := range paths {
+		w.WriteString(dedupRecord(path, s.keys[path]))
+	}
+	err = w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// Open the new file before it replaces the old one, which stays open
+	// until then
+	f, err = os.OpenFile(tmp, os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if os.Rename(tmp, s.name) == nil {
+		s.f.Close()
+		s.f = f
+		s.records = len(s.keys)
+		return nil
+	}
+	// Windows cannot replace or rename a file that is open
+	f.Close()
+	s.f.Close()
+	err = os.Rename(tmp, s.name)
+	if err != nil {
+		os.Remove(tmp)
+	}
+	if ferr := s.reopen(); ferr != nil {
+		return ferr
+	}
+	if err == nil {
+		s.records = len(s.keys)
+	}
+	return err
+}
+
+// reopen opens the file of the store again after compact closed it. If
+// that fails, s.f is left nil for Put to try again. s.mu must be held.
+func (s *FileDedupStore) reopen() error {
+	f, err := os.OpenFile(s.name, os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		s.f = nil
+		return err
+	}
+	s.f = f
+	return nil
+}
+
+func dedupRecord(path string, key DedupKey) string {
+	return fmt.Sprintf("%d %x %s\n", key.Size, key.Hash, strconv.Quote(path))
+}
+
+// Records have the form "<size> <hex hash> <quoted path>".
+func parseDedupRecord(line string) (string, DedupKey, error) {
+	var key DedupKey
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) != 3 {
+		return "", key, errors.New("malformed dedup record")
+	}
+	size, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return "", key, err
+	}
+	hash, err := hex.DecodeString(fields[1])
+	if err != nil || len(hash) != sha256.Size {
+		return "", key, errors.New("malformed dedup record hash")
+	}
+	path, err := strconv.Unquote(fields[2])
+	if err != nil {
+		return "", key, err
+	}
+	key.Size = size
+	copy(key.Hash[:], hash)
+	return path, key, nil
+}
+
+// Get returns the key last recorded for path.
+func (s *FileDedupStore) Get(path string) (DedupKey, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, found := s.keys[path]
+	return key, found, nil
+}
+
+// Put records key as processed for path.
+func (s *FileDedupStore) Put(path string, key DedupKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if prev, found := s.keys[path]; found && prev == key {
+		return nil
+	}
+	if s.f == nil {
+		if err := s.reopen(); err != nil {
+			return err
+		}
+	}
+	if _, err := s.f.WriteString(dedupRecord(path, key)); err != nil {
+		return err
+	}
+	if err := s.f.Sync(); err != nil {
+		return err
+	}
+	s.keys[path] = key
+	s.records++
+	if stale := s.records - len(s.keys); stale >= dedupCompactMin && stale > len(s.keys) {
+		// The record is durable either way; a failed compaction leaves
+		// the log as it was, to be compacted later
+		s.compact()
+	}
+	return nil
+}
+
+// Close closes the file of the store.
+func (s *FileDedupStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	return s.f.Close()
+}
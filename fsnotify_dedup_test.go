@@ -0,0 +1,198 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileDedupStore(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	testFile := filepath.Join(testDir, "TestFileDedupStore.testfile")
+	storeFile := filepath.Join(testDir, "dedup")
+	if err := ioutil.WriteFile(testFile, []byte("data"), 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+
+	store, err := OpenFileDedupStore(storeFile)
+	if err != nil {
+		t.Fatalf("OpenFileDedupStore(%q) failed: %s", storeFile, err)
+	}
+	changed, key, err := Changed(store, testFile)
+	if err != nil {
+		t.Fatalf("Changed(%q) failed: %s", testFile, err)
+	}
+	if !changed {
+		t.Fatal("new file was not reported as changed")
+	}
+	if err := store.Put(testFile, key); err != nil {
+		t.Fatalf("Put(%q) failed: %s", testFile, err)
+	}
+	store.Close()
+
+	// The processed content is remembered across restarts
+	store, err = OpenFileDedupStore(storeFile)
+	if err != nil {
+		t.Fatalf("OpenFileDedupStore(%q) failed: %s", storeFile, err)
+	}
+	defer store.Close()
+	if changed, _, _ := Changed(store, testFile); changed {
+		t.Fatal("unchanged file was reported as changed after reopening the store")
+	}
+
+	// Rewriting the same content does not count as a change
+	if err := ioutil.WriteFile(testFile, []byte("data"), 0666); err != nil {
+		t.Fatalf("writing test file failed: %s", err)
+	}
+	if changed, _, _ := Changed(store, testFile); changed {
+		t.Fatal("file rewritten with the same content was reported as changed")
+	}
+
+	if err := ioutil.WriteFile(testFile, []byte("more data"), 0666); err != nil {
+		t.Fatalf("writing test file failed: %s", err)
+	}
+	if changed, _, _ := Changed(store, testFile); !changed {
+		t.Fatal("modified file was not reported as changed")
+	}
+}
+
+func TestFileDedupStoreCompact(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+	storeFile := filepath.Join(testDir, "dedup")
+
+	store, err := OpenFileDedupStore(storeFile)
+	if err != nil {
+		t.Fatalf("OpenFileDedupStore(%q) failed: %s", storeFile, err)
+	}
+	for i := int64(0); i < 3; i++ {
+		for _, path := range []string{"/a", "/b"} {
+			if err := store.Put(path, DedupKey{Size: i}); err != nil {
+				t.Fatalf("Put(%q) failed: %s", path, err)
+			}
+		}
+	}
+	store.Close()
+
+	// A record torn by a crash, cut short of its newline
+	f, err := os.OpenFile(storeFile, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("opening store failed: %s", err)
+	}
+	f.WriteString(dedupRecord("/c", DedupKey{Size: 1})[:10])
+	f.Close()
+
+	// The stale and torn records are dropped when the store is opened
+	store, err = OpenFileDedupStore(storeFile)
+	if err != nil {
+		t.Fatalf("OpenFileDedupStore(%q) failed: %s", storeFile, err)
+	}
+	data, err := ioutil.ReadFile(storeFile)
+	if err != nil {
+		t.Fatalf("reading store failed: %s", err)
+	}
+	if n := bytes.Count(data, []byte("\n")); n != 2 || data[len(data)-1] != '\n' {
+		t.Fatalf("store holds %d records after compaction, expected 2:\n%s", n, data)
+	}
+	if err := store.Put("/c", DedupKey{Size: 1}); err != nil {
+		t.Fatalf("Put(%q) failed: %s", "/c", err)
+	}
+	store.Close()
+
+	store, err = OpenFileDedupStore(storeFile)
+	if err != nil {
+		t.Fatalf("OpenFileDedupStore(%q) failed: %s", storeFile, err)
+	}
+	defer store.Close()
+	for path, want := range map[string]int64{"/a": 2, "/b": 2, "/c": 1} {
+		if key, found, _ := store.Get(path); !found || key.Size != want {
+			t.Fatalf("Get(%q) = %v, %v, expected size %d", path, key, found, want)
+		}
+	}
+}
+
+func TestFileDedupStoreCompactFailure(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+	storeFile := filepath.Join(testDir, "dedup")
+
+	store, err := OpenFileDedupStore(storeFile)
+	if err != nil {
+		t.Fatalf("OpenFileDedupStore(%q) failed: %s", storeFile, err)
+	}
+	if err := store.Put("/a", DedupKey{Size: 1}); err != nil {
+		t.Fatalf("Put(%q) failed: %s", "/a", err)
+	}
+
+	// A directory in the way of the new file makes compaction fail
+	if err := os.Mkdir(storeFile+".tmp", 0700); err != nil {
+		t.Fatalf("creating directory failed: %s", err)
+	}
+	store.mu.Lock()
+	err = store.compact()
+	store.mu.Unlock()
+	if err == nil {
+		t.Fatal("compaction succeeded with a directory in the way")
+	}
+
+	// The old file is still in use
+	if err := store.Put("/b", DedupKey{Size: 2}); err != nil {
+		t.Fatalf("Put(%q) after a failed compaction failed: %s", "/b", err)
+	}
+	store.Close()
+	store, err = OpenFileDedupStore(storeFile)
+	if err != nil {
+		t.Fatalf("OpenFileDedupStore(%q) failed: %s", storeFile, err)
+	}
+	defer store.Close()
+	for path, want := range map[string]int64{"/a": 1, "/b": 2} {
+		if key, found, _ := store.Get(path); !found || key.Size != want {
+			t.Fatalf("Get(%q) = %v, %v, expected size %d", path, key, found, want)
+		}
+	}
+}
+
+func TestIdentityDedupStore(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	first := filepath.Join(testDir, "TestIdentityDedupStore.first")
+	second := filepath.Join(testDir, "TestIdentityDedupStore.second")
+	if err := ioutil.WriteFile(first, []byte("data"), 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	if err := os.Link(first, second); err != nil {
+		t.Skipf("hard links not supported: %s", err)
+	}
+
+	fileStore, err := OpenFileDedupStore(filepath.Join(testDir, "dedup"))
+	if err != nil {
+		t.Fatalf("OpenFileDedupStore failed: %s", err)
+	}
+	defer fileStore.Close()
+	store := IdentityDedupStore(fileStore)
+	changed, key, err := Changed(store, first)
+	if err != nil || !changed {
+		t.Fatalf("Changed(%q) = %v, %v, expected a change", first, changed, err)
+	}
+	if err := store.Put(first, key); err != nil {
+		t.Fatalf("Put(%q) failed: %s", first, err)
+	}
+
+	// The same file under another name is not processed again
+	if changed, _, err := Changed(store, second); err != nil || changed {
+		t.Fatalf("Changed(%q) = %v, %v, expected no change for another link", second, changed, err)
+	}
+	// A path-keyed store does not tell them apart
+	if changed, _, _ := Changed(fileStore, second); !changed {
+		t.Fatalf("path-keyed Changed(%q) reported no change", second)
+	}
+}
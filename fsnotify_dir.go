@@ -0,0 +1,19 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+// IsDir reports whether the event refers to a directory, as the system
+// knew it when reporting the event. Unlike a stat of the name by the
+// handler, it holds for directories deleted or renamed meanwhile.
+//
+// Linux reports it with each event, kqueue and Solaris know the file types
+// of the watched files, and change journals record them. Windows does not
+// report it: entries of watched directories are looked up as the event is
+// read, so that those removed or renamed away are reported as files.
+// Events injected or decoded from their portable forms carry no file type
+// and report false.
+func (e *FileEvent) IsDir() bool {
+	return e.dir
+}
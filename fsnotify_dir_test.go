@@ -0,0 +1,56 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFsnotifyIsDir(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	addWatch(t, watcher, testDir)
+
+	testSubDir := filepath.Join(testDir, "sub")
+	testFile := filepath.Join(testDir, "TestFsnotifyIsDir.testfile")
+	if err := os.Mkdir(testSubDir, 0777); err != nil {
+		t.Fatalf("failed to create test sub-directory: %s", err)
+	}
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+
+	var sawDir, sawFile bool
+	timeout := time.After(5 * time.Second)
+	for !sawDir || !sawFile {
+		select {
+		case ev := <-watcher.Event:
+			if !ev.IsCreate() {
+				continue
+			}
+			switch ev.Name {
+			case testSubDir:
+				if !ev.IsDir() {
+					t.Fatalf("%s not reported as a directory", ev)
+				}
+				sawDir = true
+			case testFile:
+				if ev.IsDir() {
+					t.Fatalf("%s reported as a directory", ev)
+				}
+				sawFile = true
+			}
+		case <-timeout:
+			t.Fatal("no create events received")
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"errors"
+	"sync"
+)
+
+// errWatcherClosed is returned by the methods sending events, such as
+// Rescan, after Close.
+var errWatcherClosed = errors.New("fsnotify: watcher already closed")
+
+// SetDrainOnClose sets what Close does with the events already read from
+// the kernel. By default they are delivered, to handlers and the Event
+// channel, before the Event channel is closed, so that the last changes
+// before shutdown are not lost. With drain false they are dropped, and the
+// Event channel closes as soon as possible.
+//
+// Either way Close stops reading new events from the kernel, and may be
+// called more than once.
+func (w *Watcher) SetDrainOnClose(drain bool) {
+	w.drain.mu.Lock()
+	w.drain.skip = !drain
+	w.drain.mu.Unlock()
+}
+
+// drainState tracks the events in flight when the watcher is closed.
+type drainState struct {
+	mu      sync.Mutex     // Protects access to skip, closing, held and stop.
+	skip    bool           // Set to drop the events in flight rather than deliver them
+	closing bool           // Set once Close is called
+	held    []*FileEvent   // Events stopped on their way to the Event channel by Close
+	stop    chan bool      // Closed once Close is called, to stop the senders
+	senders sync.WaitGroup // Senders of events from outside the watcher (see enter)
+}
+
+// close records that Close was called, and waits for the senders of events
+// from outside the watcher to stop.
+func (d *drainState) close() {
+	d.mu.Lock()
+	if !d.closing {
+		d.closing = true
+		if d.stop == nil {
+			d.stop = make(chan bool)
+		}
+		close(d.stop)
+	}
+	d.mu.Unlock()
+	d.senders.Wait()
+}
+
+// enter registers a sender of events on the internal event channel from
+// outside the goroutines of the watcher, such as Emit. The sender selects
+// on stop along with each send and calls exit when done. enter returns
+// errWatcherClosed once Close was called.
+func (d *drainState) enter() (stop chan bool, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closing {
+		return nil, errWatcherClosed
+	}
+	if d.stop == nil {
+		d.stop = make(chan bool)
+	}
+	d.senders.Add(1)
+	return d.stop, nil
+}
+
+// exit records that a sender registered by enter is done.
+func (d *drainState) exit() {
+	d.senders.Done()
+}
+
+// dropping reports whether events in flight are to be dropped.
+func (d *drainState) dropping() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.closing && d.skip
+}
+
+// hold keeps an event that could not be sent as Close was called, to be
+// sent by flush.
+func (d *drainState) hold(ev *FileEvent) {
+	d.mu.Lock()
+	if !d.skip {
+		d.held = append(d.held, ev)
+	}
+	d.mu.Unlock()
+}
+
+// flush sends the held events; the Event channel is closed after.
+func (d *drainState) flush(send func(ev *FileEvent)) {
+	d.mu.Lock()
+	held := d.held
+	d.held = nil
+	d.mu.Unlock()
+	for _, ev := range held {
+		send(ev)
+	}
+}
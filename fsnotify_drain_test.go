@@ -0,0 +1,105 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcherCloseDrainsHandlers(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	go func() {
+		for err := range watcher.Error {
+			t.Errorf("error received: %s", err)
+		}
+	}()
+
+	var handled counter
+	h := EventHandlerFunc(func(ev *FileEvent) {
+		// Keep events in flight until Close
+		time.Sleep(time.Millisecond)
+		if ev.IsCreate() {
+			handled.increment()
+		}
+	})
+	if err := watcher.WatchHandler(testDir, FSN_CREATE, h); err != nil {
+		t.Fatalf("watcher.WatchHandler(%q) failed: %s", testDir, err)
+	}
+
+	const files = 100
+	for i := 0; i < files; i++ {
+		if err := ioutil.WriteFile(filepath.Join(testDir, fmt.Sprintf("file%d.testfile", i)), nil, 0666); err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+	}
+	watcher.Close()
+	watcher.Close()
+
+	// Every create reaches the handler, none the Event channel
+	done := time.After(2 * time.Second)
+	for {
+		select {
+		case ev, ok := <-watcher.Event:
+			if !ok {
+				if hv := handled.value(); hv != files {
+					t.Fatalf("incorrect number of create events handled after Close (%d vs %d)", hv, files)
+				}
+				return
+			}
+			t.Fatalf("event for a handler sent on the Event channel: %s", ev)
+		case <-done:
+			t.Fatal("Event channel not closed 2 seconds after Close")
+		}
+	}
+}
+
+func TestWatcherCloseWithoutDrain(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	watcher.SetDrainOnClose(false)
+	go func() {
+		for range watcher.Error {
+		}
+	}()
+	addWatch(t, watcher, testDir)
+
+	const files = 100
+	for i := 0; i < files; i++ {
+		if err := ioutil.WriteFile(filepath.Join(testDir, fmt.Sprintf("file%d.testfile", i)), nil, 0666); err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+	}
+	watcher.Close()
+
+	// At most the event being sent when Close was called is delivered
+	var received int
+	done := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-watcher.Event:
+			if !ok {
+				if received > 1 {
+					t.Fatalf("%d events delivered after Close without draining", received)
+				}
+				return
+			}
+			received++
+		case <-done:
+			t.Fatal("Event channel not closed 2 seconds after Close")
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// A DuplicatePolicy selects how a Watcher treats a path that is the same
+// file or directory as a path already watched, as seen through a bind
+// mount or a symlinked root.
+type DuplicatePolicy int
+
+const (
+	AllowDuplicates  DuplicatePolicy = iota // Watch each path (the default)
+	RefuseDuplicates                        // Refuse a duplicate with a *DuplicateRootError
+	DedupDuplicates                         // Deliver each change once, under the path watched first
+)
+
+// A DuplicateRootError is returned when watching a path that is the same
+// file as a watched path under RefuseDuplicates.
+type DuplicateRootError struct {
+	Path     string // Path being watched
+	Existing string // Watched path of the same file
+}
+
+func (e *DuplicateRootError) Error() string {
+	return fmt.Sprintf("fsnotify: %s is the same file as the watched %s", e.Path, e.Existing)
+}
+
+// SetDuplicatePolicy selects how later watches of paths that are the same
+// file as a watched path are treated. Under DedupDuplicates a duplicate
+// shares the watch of the path watched first, and its events are delivered
+// under that path and to its handler; if that path is removed, the next
+// duplicate takes over.
+func (w *Watcher) SetDuplicatePolicy(p DuplicatePolicy) {
+	w.dups.setPolicy(p)
+}
+
+// A dupTable records the identity of watched paths to find duplicates.
+type dupTable struct {
+	mu     sync.Mutex             // Protects access to the fields below.
+	policy DuplicatePolicy        // Treatment of duplicates
+	files  map[string]os.FileInfo // Map of watched paths (nil under AllowDuplicates)
+	dups   map[string]string      // Map of duplicates to the path whose watch they share
+}
+
+func (t *dupTable) setPolicy(p DuplicatePolicy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.policy = p
+	if p == AllowDuplicates {
+		t.files, t.dups = nil, nil
+	} else if t.files == nil {
+		t.files = make(map[string]os.FileInfo)
+		t.dups = make(map[string]string)
+	}
+}
+
+// add records a path about to be watched. It returns the watched path
+// whose watch the path shares, if any, or a *DuplicateRootError if the
+// duplicate is refused.
+func (t *dupTable) add(path string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.files == nil {
+		return "", nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		// Let the backend report it
+		return "", nil
+	}
+	if primary, found := t.dups[path]; found {
+		return primary, nil
+	}
+	for existing, other := range t.files {
+		if existing == path || t.dups[existing] != "" || !os.SameFile(fi, other) {
+			continue
+		}
+		if t.policy == RefuseDuplicates {
+			return "", &DuplicateRootError{Path: path, Existing: existing}
+		}
+		t.files[path] = fi
+		t.dups[path] = existing
+		return existing, nil
+	}
+	t.files[path] = fi
+	return "", nil
+}
+
+// remove forgets a removed path. It reports whether the path shared the
+// watch of another, and otherwise the duplicate that takes over its watch.
+func (t *dupTable) remove(path string) (shared bool, promoted string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.files == nil {
+		return false, ""
+	}
+	delete(t.files, path)
+	if _, found := t.dups[path]; found {
+		delete(t.dups, path)
+		return true, ""
+	}
+	var others []string
+	for dup, primary := range t.dups {
+		if primary == path {
+			others = append(others, dup)
+		}
+	}
+	if len(others) == 0 {
+		return false, ""
+	}
+	sort.Strings(others)
+	promoted = others[0]
+	delete(t.dups, promoted)
+	for _, dup := range others[1:] {
+		t.dups[dup] = promoted
+	}
+	return false, promoted
+}
@@ -0,0 +1,114 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build freebsd openbsd netbsd darwin linux
+
+package fsnotify
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFsnotifyRefuseDuplicates(t *testing.T) {
+	// Create directory to watch and a symlinked root of it
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watchedDir := filepath.Join(testDir, "dir")
+	aliasDir := filepath.Join(testDir, "alias")
+	if err := os.Mkdir(watchedDir, 0777); err != nil {
+		t.Fatalf("creating test directory failed: %s", err)
+	}
+	if err := os.Symlink(watchedDir, aliasDir); err != nil {
+		t.Fatalf("creating symlink failed: %s", err)
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetDuplicatePolicy(RefuseDuplicates)
+
+	addWatch(t, watcher, watchedDir)
+	err := watcher.Watch(aliasDir)
+	var dupErr *DuplicateRootError
+	if !errors.As(err, &dupErr) {
+		t.Fatalf("watching a duplicate returned %v, want a *DuplicateRootError", err)
+	}
+	if dupErr.Path != aliasDir || dupErr.Existing != watchedDir {
+		t.Fatalf("duplicate error names %s and %s, want %s and %s", dupErr.Path, dupErr.Existing, aliasDir, watchedDir)
+	}
+}
+
+func TestFsnotifyDedupDuplicates(t *testing.T) {
+	// Create directory to watch and a symlinked root of it
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watchedDir := filepath.Join(testDir, "dir")
+	aliasDir := filepath.Join(testDir, "alias")
+	if err := os.Mkdir(watchedDir, 0777); err != nil {
+		t.Fatalf("creating test directory failed: %s", err)
+	}
+	if err := os.Symlink(watchedDir, aliasDir); err != nil {
+		t.Fatalf("creating symlink failed: %s", err)
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetDuplicatePolicy(DedupDuplicates)
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	var watchedReceived, aliasReceived counter
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			if !event.IsCreate() {
+				continue
+			}
+			switch filepath.Dir(event.Name) {
+			case watchedDir:
+				watchedReceived.increment()
+			case aliasDir:
+				aliasReceived.increment()
+			}
+		}
+	}()
+
+	addWatch(t, watcher, watchedDir)
+	addWatch(t, watcher, aliasDir)
+
+	create := func(name string) {
+		f, err := os.OpenFile(filepath.Join(watchedDir, name), os.O_WRONLY|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+		f.Close()
+	}
+
+	create("TestFsnotifyDedupDuplicates.first")
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if watchedReceived.value() != 1 || aliasReceived.value() != 0 {
+		t.Fatalf("incorrect number of create events received after 500 ms (%d, %d vs %d, %d)", watchedReceived.value(), aliasReceived.value(), 1, 0)
+	}
+
+	// The duplicate takes over when the first path is removed
+	if err := watcher.RemoveWatch(watchedDir); err != nil {
+		t.Fatalf("removing watch failed: %s", err)
+	}
+	create("TestFsnotifyDedupDuplicates.second")
+	time.Sleep(500 * time.Millisecond)
+	if watchedReceived.value() != 1 || aliasReceived.value() != 1 {
+		t.Fatalf("incorrect number of create events received after removing the first path (%d, %d vs %d, %d)", watchedReceived.value(), aliasReceived.value(), 1, 1)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"path/filepath"
+	"runtime/pprof"
+	"sync"
+)
+
+// SetFairness queues events per watch root, the topmost watched directory
+// above them, and delivers the events of each root in turn, so that a root
+// changing heavily, such as a build output directory, does not hold up the
+// events of quieter roots behind its own. Events of the same root keep
+// their order.
+//
+// Up to perRoot events are queued for each root; when a root has more, its
+// queued events are replaced by an overflow event naming it (see
+// IsOverflow and RescanRoots). Zero, the default, delivers events in the
+// order the system reports them. Fairness cannot be disabled once events
+// were queued; later calls only change perRoot. On Windows, where events of
+// the system are delivered as they are read, only the events of change
+// journals and polling are queued.
+func (w *Watcher) SetFairness(perRoot int) {
+	w.fair.mu.Lock()
+	if perRoot > 0 || !w.fair.started {
+		w.fair.limit = perRoot
+	}
+	w.fair.mu.Unlock()
+}
+
+// A fairQueue holds the events of each watch root until they are
+// delivered in turn.
+type fairQueue struct {
+	mu      sync.Mutex              // Protects access to the fields below.
+	cond    *sync.Cond              // Signaled when an event is queued or the intake ends
+	limit   int                     // Events queued per root (zero if disabled)
+	started bool                    // Set once events are queued
+	closed  bool                    // Set when the internal chan is closed
+	lanes   map[string][]*FileEvent // Events queued for each root (key: root)
+	turns   []string                // Roots with queued events, in turn order
+}
+
+func (q *fairQueue) enabled() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.limit > 0
+}
+
+// start queues ev, then the events of in on a goroutine of their own, so
+// that events keep being queued while others are delivered.
+func (q *fairQueue) start(w *Watcher, ev *FileEvent, in chan *FileEvent) {
+	q.mu.Lock()
+	q.started = true
+	q.cond = sync.NewCond(&q.mu)
+	q.lanes = make(map[string][]*FileEvent)
+	q.mu.Unlock()
+	w.scans.forget(q.push(w.laneOf(ev), ev))
+	go func() {
+		pprof.SetGoroutineLabels(eventsContext)
+		for ev := range in {
+			w.scans.forget(q.push(w.laneOf(ev), ev))
+		}
+		q.mu.Lock()
+		q.closed = true
+		q.mu.Unlock()
+		q.cond.Broadcast()
+	}()
+}
+
+// push queues ev for root, replacing the events of a full root by an
+// overflow event. It returns the events replaced.
+func (q *fairQueue) push(root string, ev *FileEvent) (dropped []*FileEvent) {
+	q.mu.Lock()
+	lane, found := q.lanes[root]
+	if !found {
+		q.turns = append(q.turns, root)
+	}
+	if len(lane) >= q.limit && !ev.overflow {
+		dropped = lane
+		lane = []*FileEvent{{overflow: true, rescan: []string{root}}}
+	}
+	q.lanes[root] = append(lane, ev)
+	q.mu.Unlock()
+	q.cond.Signal()
+	return dropped
+}
+
+// next returns the next event of the root whose turn it is, waiting for
+// one. It reports false once the internal chan is closed and every event
+// was returned.
+func (q *fairQueue) next() (*FileEvent, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.turns) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.turns) == 0 {
+		return nil, false
+	}
+	root := q.turns[0]
+	q.turns = q.turns[1:]
+	lane := q.lanes[root]
+	ev := lane[0]
+	if len(lane) > 1 {
+		q.lanes[root] = lane[1:]
+		q.turns = append(q.turns, root)
+	} else {
+		delete(q.lanes, root)
+	}
+	return ev, true
+}
+
+// laneOf returns the watch root an event is queued for: the topmost
+// watched directory above it, or its own name if none is watched.
+func (w *Watcher) laneOf(ev *FileEvent) string {
+	if ev.overflow || ev.Name == "" {
+		return ""
+	}
+	w.fsnmut.Lock()
+	defer w.fsnmut.Unlock()
+	root := ev.Name
+	for name := ev.Name; ; {
+		if _, found := w.handlers[name]; found {
+			root = name
+		}
+		dir := filepath.Dir(name)
+		if dir == name {
+			return root
+		}
+		name = dir
+	}
+}
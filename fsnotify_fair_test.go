@@ -0,0 +1,86 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/howeyc/fsnotify/fsnotifytest"
+)
+
+func TestFsnotifyFairness(t *testing.T) {
+	if !nativeEvents || nativeTrees {
+		t.Skip("events of the system are not queued")
+	}
+	// Create a noisy and a quiet directory to watch
+	noisyDir := tempMkdir(t)
+	defer os.RemoveAll(noisyDir)
+	quietDir := tempMkdir(t)
+	defer os.RemoveAll(quietDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetFairness(1000)
+	addWatch(t, watcher, noisyDir)
+	addWatch(t, watcher, quietDir)
+
+	fsnotifytest.MakeBurst(t, noisyDir, 100)
+	time.Sleep(200 * time.Millisecond)
+	testFile := filepath.Join(quietDir, "TestFsnotifyFairness.testfile")
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	// The quiet directory gets its turn right after the event in flight
+	// and the next one of the noisy directory
+	for i := 0; i < 3; i++ {
+		select {
+		case ev := <-watcher.Event:
+			t.Logf("event received: %s", ev)
+			if ev.Name == testFile {
+				return
+			}
+		case <-time.After(500 * time.Millisecond):
+			t.Fatal("no event received after 500 ms")
+		}
+	}
+	t.Fatal("event of the quiet directory held up behind the noisy one")
+}
+
+func TestFsnotifyFairnessOverflow(t *testing.T) {
+	if !nativeEvents || nativeTrees {
+		t.Skip("events of the system are not queued")
+	}
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetFairness(10)
+	addWatch(t, watcher, testDir)
+
+	fsnotifytest.MakeBurst(t, testDir, 50)
+	time.Sleep(200 * time.Millisecond)
+
+	for {
+		select {
+		case ev := <-watcher.Event:
+			if ev.IsOverflow() {
+				if roots := ev.RescanRoots(); len(roots) != 1 || roots[0] != testDir {
+					t.Fatalf("overflow with rescan roots %q, expected %q", roots, testDir)
+				}
+				return
+			}
+		case <-time.After(500 * time.Millisecond):
+			t.Fatal("no overflow event received for a full queue")
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// A Broker distributes the events of a watcher to several consumers, each
+// with its own filter and buffer. A consumer that falls behind only loses
+// its own events, never stalling the others.
+type Broker struct {
+	w         *Watcher
+	mu        sync.Mutex // Protects access to consumers and closed.
+	consumers []*Consumer
+	closed    bool // Set when the Event channel of the watcher is closed
+}
+
+// A Consumer receives the events of a Broker that pass its filter.
+type Consumer struct {
+	Event   chan *FileEvent
+	b       *Broker
+	filter  func(ev *FileEvent) bool
+	dropped uint64 // Events dropped while the buffer was full (atomic)
+}
+
+// Fanout returns the Broker of the Event channel, which it takes over:
+// from then on, events are received from consumers of the broker. Errors
+// are still reported on the Error channel. Each call returns the same
+// broker.
+func (w *Watcher) Fanout() *Broker {
+	w.fsnmut.Lock()
+	defer w.fsnmut.Unlock()
+	if w.broker == nil {
+		w.broker = &Broker{w: w}
+		go w.broker.run(w.Event)
+	}
+	return w.broker
+}
+
+// Subscribe adds a consumer receiving the events for which filter returns
+// true, or all events if it is nil. Up to buffer events are queued for the
+// consumer; further events are dropped until it catches up.
+func (b *Broker) Subscribe(filter func(ev *FileEvent) bool, buffer int) *Consumer {
+	c := &Consumer{Event: make(chan *FileEvent, buffer), b: b, filter: filter}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(c.Event)
+		return c
+	}
+	b.consumers = append(b.consumers, c)
+	return c
+}
+
+func (b *Broker) run(events chan *FileEvent) {
+	for ev := range events {
+		b.mu.Lock()
+		for _, c := range b.consumers {
+			if c.filter != nil && !c.filter(ev) {
+				continue
+			}
+			select {
+			case c.Event <- ev:
+			default:
+				atomic.AddUint64(&c.dropped, 1)
+				b.w.loseEvent(ev)
+			}
+		}
+		b.mu.Unlock()
+	}
+	b.mu.Lock()
+	b.closed = true
+	for _, c := range b.consumers {
+		close(c.Event)
+	}
+	b.consumers = nil
+	b.mu.Unlock()
+}
+
+// Dropped returns the number of events dropped because the consumer was
+// behind.
+func (c *Consumer) Dropped() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// Close removes the consumer from its broker and closes its Event channel.
+func (c *Consumer) Close() {
+	b := c.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, other := range b.consumers {
+		if other == c {
+			b.consumers = append(b.consumers[:i], b.consumers[i+1:]...)
+			close(c.Event)
+			return
+		}
+	}
+}
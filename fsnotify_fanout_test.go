@@ -0,0 +1,68 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFsnotifyFanout(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	b := watcher.Fanout()
+	if watcher.Fanout() != b {
+		t.Fatal("Fanout() returned a different broker on the second call")
+	}
+	creates := b.Subscribe(func(ev *FileEvent) bool { return ev.IsCreate() }, 100)
+	// Never read, so it falls behind after one event
+	slow := b.Subscribe(nil, 1)
+
+	var createReceived counter
+	go func() {
+		for event := range creates.Event {
+			if !event.IsCreate() {
+				t.Errorf("event not passing the filter received: %s", event)
+			}
+			createReceived.increment()
+		}
+	}()
+
+	addWatch(t, watcher, testDir)
+
+	for i := 0; i < 3; i++ {
+		f, err := os.OpenFile(filepath.Join(testDir, fmt.Sprintf("TestFsnotifyFanout.%d", i)), os.O_WRONLY|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+		f.Close()
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	if createReceived.value() != 3 {
+		t.Fatalf("incorrect number of create events received after 500 ms (%d vs %d)", createReceived.value(), 3)
+	}
+	if slow.Dropped() == 0 {
+		t.Fatal("slow consumer did not report dropped events")
+	}
+	if creates.Dropped() != 0 {
+		t.Fatalf("consumer keeping up reported dropped events (%d)", creates.Dropped())
+	}
+	slow.Close()
+}
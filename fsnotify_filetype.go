@@ -0,0 +1,64 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"os"
+	"sync"
+)
+
+// FileTypes returns middleware that delivers only the events of files of
+// the given types: type bits of os.FileMode such as os.ModeSocket,
+// os.ModeNamedPipe or os.ModeDir, or zero for regular files. The type is
+// looked up as the event is delivered. Files deleted or renamed away by
+// then are of the type last seen in an event passed, or a directory if
+// the event says so (see IsDir); others of them are dropped.
+func FileTypes(types ...os.FileMode) Middleware {
+	f := &typeFilter{types: types, seen: make(map[string]os.FileMode)}
+	return func(next EventHandler) EventHandler {
+		return EventHandlerFunc(func(ev *FileEvent) {
+			if f.pass(ev) {
+				next.HandleEvent(ev)
+			}
+		})
+	}
+}
+
+type typeFilter struct {
+	types []os.FileMode
+	mu    sync.Mutex             // Protects access to seen.
+	seen  map[string]os.FileMode // Types of the files passed (key: event name)
+}
+
+// pass reports whether the file of ev is of one of the types.
+func (f *typeFilter) pass(ev *FileEvent) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	typ, known := f.seen[ev.Name]
+	if fi, err := os.Lstat(ev.Name); err == nil {
+		typ, known = fi.Mode()&os.ModeType, true
+	} else if !known && ev.IsDir() {
+		typ, known = os.ModeDir, true
+	}
+	if !known || !f.matches(typ) {
+		delete(f.seen, ev.Name)
+		return false
+	}
+	if ev.IsDelete() || (ev.IsRename() && !ev.movedTo()) {
+		delete(f.seen, ev.Name)
+	} else {
+		f.seen[ev.Name] = typ
+	}
+	return true
+}
+
+func (f *typeFilter) matches(typ os.FileMode) bool {
+	for _, t := range f.types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
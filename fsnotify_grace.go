@@ -0,0 +1,81 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"sync"
+	"time"
+)
+
+// DeleteGrace returns middleware that holds delete events for the grace
+// period d. If the file is created again within it, as tools like sed -i
+// and some editors do, a single modify event is delivered instead, whose
+// Change is ReplacedInode and whose Parts are the delete and create
+// events. Otherwise the delete is delivered when the grace period ends.
+func DeleteGrace(d time.Duration) Middleware {
+	g := &deleteGrace{d: d, pending: make(map[string]*heldDelete)}
+	return func(next EventHandler) EventHandler {
+		return EventHandlerFunc(func(ev *FileEvent) {
+			g.handle(ev, next)
+		})
+	}
+}
+
+type deleteGrace struct {
+	d       time.Duration
+	mu      sync.Mutex             // Protects access to pending.
+	pending map[string]*heldDelete // Held deletes (key: event name)
+}
+
+// A heldDelete is a delete event held for the grace period.
+type heldDelete struct {
+	ev    *FileEvent
+	timer *time.Timer
+}
+
+func (g *deleteGrace) handle(ev *FileEvent, next EventHandler) {
+	switch {
+	case ev.IsDelete():
+		name := ev.Name
+		g.mu.Lock()
+		if h, found := g.pending[name]; found {
+			h.timer.Stop()
+		}
+		h := &heldDelete{ev: ev}
+		h.timer = time.AfterFunc(g.d, func() {
+			g.mu.Lock()
+			if g.pending[name] != h {
+				g.mu.Unlock()
+				return
+			}
+			delete(g.pending, name)
+			g.mu.Unlock()
+			next.HandleEvent(ev)
+		})
+		g.pending[name] = h
+		g.mu.Unlock()
+	case ev.IsCreate():
+		g.mu.Lock()
+		h, found := g.pending[ev.Name]
+		if found {
+			h.timer.Stop()
+			delete(g.pending, ev.Name)
+		}
+		g.mu.Unlock()
+		if found {
+			replaced := newFileEvent(ev.Name, FSN_MODIFY)
+			replaced.replaced = true
+			replaced.dir = ev.dir
+			replaced.stamp = ev.stamp
+			replaced.ctx = ev.ctx
+			replaced.parts = []*FileEvent{h.ev, ev}
+			next.HandleEvent(replaced)
+			return
+		}
+		next.HandleEvent(ev)
+	default:
+		next.HandleEvent(ev)
+	}
+}
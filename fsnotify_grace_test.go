@@ -0,0 +1,86 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFsnotifyDeleteGrace(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	testFile := filepath.Join(testDir, "TestFsnotifyDeleteGrace.testfile")
+	testFileDeleted := filepath.Join(testDir, "TestFsnotifyDeleteGrace.deleted")
+	for _, name := range []string{testFile, testFileDeleted} {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+		f.Close()
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.Use(DeleteGrace(100 * time.Millisecond))
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	var replacedReceived, partsReceived, deleteReceived, otherDeleteReceived counter
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			switch {
+			case event.Name == testFile && event.IsDelete():
+				deleteReceived.increment()
+			case event.Name == testFile && event.Change() == ReplacedInode:
+				replacedReceived.increment()
+				if parts := event.Parts(); len(parts) == 2 && parts[0].IsDelete() && parts[1].IsCreate() {
+					partsReceived.increment()
+				}
+			case event.Name == testFileDeleted && event.IsDelete():
+				otherDeleteReceived.increment()
+			}
+		}
+	}()
+
+	addWatch(t, watcher, testDir)
+
+	// Delete and recreate, as sed -i does
+	if err := os.Remove(testFile); err != nil {
+		t.Fatalf("removing test file failed: %s", err)
+	}
+	f, err := os.OpenFile(testFile, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatalf("recreating test file failed: %s", err)
+	}
+	f.Close()
+	if err := os.Remove(testFileDeleted); err != nil {
+		t.Fatalf("removing test file failed: %s", err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	if deleteReceived.value() != 0 {
+		t.Fatalf("delete of a recreated file received (%d)", deleteReceived.value())
+	}
+	if replacedReceived.value() != 1 {
+		t.Fatalf("incorrect number of replace events received after 500 ms (%d vs %d)", replacedReceived.value(), 1)
+	}
+	if partsReceived.value() != 1 {
+		t.Fatal("replace event does not report the delete and create events as its parts")
+	}
+	if otherDeleteReceived.value() != 1 {
+		t.Fatalf("incorrect number of delete events received after 500 ms (%d vs %d)", otherDeleteReceived.value(), 1)
+	}
+}
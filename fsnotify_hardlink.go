@@ -0,0 +1,99 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// SetHardlinkTracking enables reporting a modification of a file under
+// every watched name of the file, not only the name it was written through.
+// Backends watch directory entries rather than files, so without it a write
+// through one hard link is not seen by the watch of another. Enable it
+// before adding watches so the existing files are known.
+//
+// Each modification is compared against every known file, so tracking is
+// best kept to small trees.
+func (w *Watcher) SetHardlinkTracking(enable bool) {
+	w.links.enable(enable)
+}
+
+// A linkTable records the watched files, so that events can be mapped onto
+// all the names of a file.
+type linkTable struct {
+	mu    sync.Mutex             // Protects access to files.
+	files map[string]os.FileInfo // Map of known files (nil unless hardlink tracking is enabled)
+}
+
+func (t *linkTable) enable(enable bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !enable {
+		t.files = nil
+	} else if t.files == nil {
+		t.files = make(map[string]os.FileInfo)
+	}
+}
+
+// snapshot records a newly watched file, or the files in a newly watched
+// directory.
+func (t *linkTable) snapshot(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.files == nil {
+		return
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if !fi.IsDir() {
+		t.files[path] = fi
+		return
+	}
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return
+	}
+	for _, fi := range files {
+		if fi.Mode().IsRegular() {
+			t.files[filepath.Join(path, fi.Name())] = fi
+		}
+	}
+}
+
+// update records the file an event refers to and, for modifications,
+// returns the other known names of the file.
+func (t *linkTable) update(ev *FileEvent) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.files == nil {
+		return nil
+	}
+	if ev.IsDelete() || ev.IsRename() {
+		delete(t.files, ev.Name)
+		return nil
+	}
+	fi, err := os.Stat(ev.Name)
+	if err != nil || !fi.Mode().IsRegular() {
+		return nil
+	}
+	t.files[ev.Name] = fi
+	if !ev.IsModify() {
+		return nil
+	}
+	var names []string
+	for name, other := range t.files {
+		if name != ev.Name && os.SameFile(fi, other) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
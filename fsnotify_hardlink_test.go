@@ -0,0 +1,69 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFsnotifyHardlinkTracking(t *testing.T) {
+	// Create directories to watch
+	testDirA := tempMkdir(t)
+	defer os.RemoveAll(testDirA)
+	testDirB := tempMkdir(t)
+	defer os.RemoveAll(testDirB)
+
+	testFile := filepath.Join(testDirA, "TestFsnotifyHardlinkTracking.testfile")
+	testLink := filepath.Join(testDirB, "TestFsnotifyHardlinkTracking.testlink")
+	f, err := os.OpenFile(testFile, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	f.Close()
+	if err := os.Link(testFile, testLink); err != nil {
+		t.Skipf("hard links not supported: %s", err)
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetHardlinkTracking(true)
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	var linkReceived counter
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			if event.Name == filepath.Clean(testLink) && event.IsModify() {
+				linkReceived.increment()
+			}
+		}
+	}()
+
+	addWatch(t, watcher, testDirA)
+	addWatch(t, watcher, testDirB)
+
+	// Write through the name in the other directory
+	f, err = os.OpenFile(testFile, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("reopening test file failed: %s", err)
+	}
+	f.WriteString("data")
+	f.Sync()
+	f.Close()
+
+	time.Sleep(500 * time.Millisecond)
+	if linkReceived.value() == 0 {
+		t.Fatal("fsnotify modify events have not been received for the hard link after 500 ms")
+	}
+}
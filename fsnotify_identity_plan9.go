@@ -0,0 +1,23 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileIdentity returns the server and qid path of the file at path.
+func fileIdentity(path string) (dev, ino uint64, ok bool) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, false
+	}
+	d, ok := fi.Sys().(*syscall.Dir)
+	if !ok {
+		return 0, 0, false
+	}
+	return uint64(d.Type)<<32 | uint64(d.Dev), d.Qid.Path, true
+}
@@ -0,0 +1,124 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CommonJunk lists the names of version control metadata, dependency
+// trees, build output and caches that recursive watchers rarely want.
+var CommonJunk = []string{"node_modules", ".git", ".hg", ".svn", "target", "vendor", "__pycache__", ".DS_Store"}
+
+// SetIgnoredNames ignores the files and directories with the given base
+// names, such as CommonJunk, below the watched paths: WatchTree does not
+// descend into them and no events are delivered for them or anything they
+// contain. The watched paths themselves are never ignored.
+func (w *Watcher) SetIgnoredNames(names []string) {
+	w.fsnmut.Lock()
+	w.ignored = append([]string(nil), names...)
+	w.fsnmut.Unlock()
+}
+
+// isIgnored reports whether name, or one of its directories below the
+// nearest watched path, has an ignored base name.
+func (w *Watcher) isIgnored(name string) bool {
+	w.fsnmut.Lock()
+	defer w.fsnmut.Unlock()
+	if len(w.ignored) == 0 {
+		return false
+	}
+	for {
+		if _, found := w.handlers[name]; found {
+			return false
+		}
+		dir := filepath.Dir(name)
+		if dir == name {
+			return false
+		}
+		base := filepath.Base(name)
+		for _, ignored := range w.ignored {
+			if base == ignored {
+				return true
+			}
+		}
+		name = dir
+	}
+}
+
+// ignoreSettle is how long IgnorePath keeps ignoring a path once released,
+// for the events of the changes made meanwhile still to come.
+const ignoreSettle = 100 * time.Millisecond
+
+// IgnorePath ignores the events on path, and on anything below it if it
+// is a directory, until the returned function is called; as in
+//
+//	unignore := w.IgnorePath(path)
+//	defer unignore()
+//	// rewrite path
+//
+// so that the application is not told about its own changes. The events
+// still to come for the changes made meanwhile are ignored too, for a
+// short while after the call. Scopes nest: a path is ignored until all its
+// scopes are released. Calling the returned function again does nothing.
+func (w *Watcher) IgnorePath(path string) (unignore func()) {
+	if resolved, err := w.rootPath(path); err == nil {
+		path = resolved
+	} else {
+		path = w.rootPathLexical(path)
+	}
+	path = filepath.Clean(path)
+	w.suppressed.add(path)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			time.AfterFunc(ignoreSettle, func() { w.suppressed.remove(path) })
+		})
+	}
+}
+
+// A suppressTable records the paths ignored by IgnorePath.
+type suppressTable struct {
+	mu    sync.Mutex     // Protects access to paths.
+	paths map[string]int // Map of ignored paths to the number of their scopes
+}
+
+func (t *suppressTable) add(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.paths == nil {
+		t.paths = make(map[string]int)
+	}
+	t.paths[path]++
+}
+
+func (t *suppressTable) remove(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.paths[path]--; t.paths[path] <= 0 {
+		delete(t.paths, path)
+	}
+}
+
+// covers reports whether name, or one of its directories, is ignored.
+func (t *suppressTable) covers(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.paths) == 0 {
+		return false
+	}
+	for {
+		if t.paths[name] > 0 {
+			return true
+		}
+		dir := filepath.Dir(name)
+		if dir == name {
+			return false
+		}
+		name = dir
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFsnotifyIgnoredNames(t *testing.T) {
+	// Create directory tree to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	for _, dir := range []string{"src", "node_modules/pkg"} {
+		if err := os.MkdirAll(filepath.Join(testDir, dir), 0777); err != nil {
+			t.Fatalf("creating test directory failed: %s", err)
+		}
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetIgnoredNames(CommonJunk)
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	testFile := filepath.Join(testDir, "src", "TestFsnotifyIgnoredNames.testfile")
+	var createReceived, junkReceived counter
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			if event.Name == testFile {
+				createReceived.increment()
+			} else {
+				junkReceived.increment()
+			}
+		}
+	}()
+
+	if err := watcher.WatchTree(testDir, nil); err != nil {
+		t.Fatalf("watching tree %q failed: %s", testDir, err)
+	}
+	for _, path := range watcher.watchedPaths() {
+		if filepath.Base(path) == "node_modules" || filepath.Base(path) == "pkg" {
+			t.Fatalf("ignored directory %s was watched", path)
+		}
+	}
+
+	for _, name := range []string{
+		testFile,
+		filepath.Join(testDir, "src", ".DS_Store"),
+		filepath.Join(testDir, "node_modules", "TestFsnotifyIgnoredNames.testfile"),
+	} {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+		f.Close()
+	}
+	if err := os.Mkdir(filepath.Join(testDir, ".git"), 0777); err != nil {
+		t.Fatalf("creating test directory failed: %s", err)
+	}
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if createReceived.value() == 0 {
+		t.Fatalf("no events received for a file that is not ignored")
+	}
+	if junkReceived.value() != 0 {
+		t.Fatalf("events received for ignored names (%d)", junkReceived.value())
+	}
+}
+
+func TestFsnotifyIgnorePath(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+	subDir := filepath.Join(testDir, "sub")
+	if err := os.Mkdir(subDir, 0777); err != nil {
+		t.Fatalf("creating test directory failed: %s", err)
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	if err := watcher.WatchTree(testDir, nil); err != nil {
+		t.Fatalf("watching tree %q failed: %s", testDir, err)
+	}
+
+	var mu sync.Mutex
+	received := make(map[string]bool)
+	go func() {
+		for event := range watcher.Event {
+			mu.Lock()
+			received[filepath.Base(event.Name)] = true
+			mu.Unlock()
+		}
+	}()
+	create := func(dir, name string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0666); err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+	}
+
+	// Nested scopes on a directory ignore the files below it only
+	outer := watcher.IgnorePath(subDir)
+	inner := watcher.IgnorePath(subDir)
+	create(subDir, "both")
+	create(testDir, "outside")
+	inner()
+	inner()
+	time.Sleep(2 * ignoreSettle)
+	create(subDir, "outer")
+	time.Sleep(2 * ignoreSettle)
+	outer()
+	time.Sleep(2 * ignoreSettle)
+	create(subDir, "released")
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	for name, want := range map[string]bool{"both": false, "outside": true, "outer": false, "released": true} {
+		if received[name] != want {
+			t.Errorf("events received for %s: %v, expected %v", name, received[name], want)
+		}
+	}
+}
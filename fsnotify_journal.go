@@ -0,0 +1,56 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"errors"
+	"path/filepath"
+)
+
+// ErrNoJournal is returned by WatchJournal where no change journal can be
+// read: on platforms other than Windows, and on volumes other than NTFS
+// volumes with an active change journal.
+var ErrNoJournal = errors.New("fsnotify: no change journal")
+
+// A JournalCursor is a position in the change journal of an NTFS volume.
+// Saved when a program stops, it lets WatchJournal report the changes
+// made until it runs again.
+type JournalCursor struct {
+	Journal uint64 // Identifier of the journal, recreated with a new one
+	USN     int64  // Update sequence number of the next record to read
+}
+
+// WatchJournal watches every file below path, typically the root of a
+// large volume, by reading the NTFS change journal (USN journal) of its
+// volume. Unlike ReadDirectoryChangesW, the journal keeps every change
+// until read, and a single reader covers the whole volume.
+//
+// Reading starts at cursor, as returned by JournalCursor; the zero cursor
+// starts at the changes made from now on. If the journal no longer holds
+// the records at cursor, an overflow event asks to rescan path (see
+// IsOverflow).
+//
+// Reading the journal needs administrator rights; elsewhere it returns
+// ErrNoJournal.
+func (w *Watcher) WatchJournal(path string, cursor JournalCursor) error {
+	path, err := w.checkPath(path)
+	if err != nil {
+		return err
+	}
+	path = filepath.Clean(path)
+	return w.addPath(path, FSN_ALL, nil, func(path string) error {
+		return w.watchJournal(path, cursor)
+	})
+}
+
+// JournalCursor returns the position up to which the journal watched for
+// path has been read, to resume from with WatchJournal.
+func (w *Watcher) JournalCursor(path string) (JournalCursor, error) {
+	path, err := w.rootPath(path)
+	if err != nil {
+		return JournalCursor{}, err
+	}
+	return w.journalCursor(filepath.Clean(path))
+}
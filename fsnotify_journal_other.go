@@ -0,0 +1,16 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !windows
+
+package fsnotify
+
+// The change journal is NTFS only.
+func (w *Watcher) watchJournal(path string, cursor JournalCursor) error {
+	return ErrNoJournal
+}
+
+func (w *Watcher) journalCursor(path string) (JournalCursor, error) {
+	return JournalCursor{}, ErrNoJournal
+}
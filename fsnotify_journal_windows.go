@@ -0,0 +1,439 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build windows
+
+package fsnotify
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	// Control codes of the change journal (from <winioctl.h>)
+	sys_FSCTL_QUERY_USN_JOURNAL = 0x000900f4
+	sys_FSCTL_READ_USN_JOURNAL  = 0x000900bb
+
+	// Reasons of journal records (from <winioctl.h>)
+	sys_USN_REASON_DATA_OVERWRITE    = 0x00000001
+	sys_USN_REASON_DATA_EXTEND       = 0x00000002
+	sys_USN_REASON_DATA_TRUNCATION   = 0x00000004
+	sys_USN_REASON_FILE_CREATE       = 0x00000100
+	sys_USN_REASON_FILE_DELETE       = 0x00000200
+	sys_USN_REASON_EA_CHANGE         = 0x00000400
+	sys_USN_REASON_SECURITY_CHANGE   = 0x00000800
+	sys_USN_REASON_RENAME_OLD_NAME   = 0x00001000
+	sys_USN_REASON_RENAME_NEW_NAME   = 0x00002000
+	sys_USN_REASON_BASIC_INFO_CHANGE = 0x00008000
+	sys_USN_REASON_CLOSE             = 0x80000000
+
+	// Errors of volumes without a journal
+	sys_ERROR_INVALID_FUNCTION   = 1
+	sys_ERROR_JOURNAL_NOT_ACTIVE = 1179
+
+	// Offsets in USN_RECORD_V2
+	usnRecordTimeStamp  = 32
+	usnRecordReason     = 40
+	usnRecordAttributes = 52
+	usnRecordName       = 56
+	sizeofUsnRecord     = 60
+
+	// Wait between reads of the journal once read up to its end
+	journalWaitTime = 100 * time.Millisecond
+
+	// maxJournalDirs is the number of directory paths remembered, to name
+	// records in directories deleted before they are read.
+	maxJournalDirs = 4096
+)
+
+// usnJournalData is USN_JOURNAL_DATA_V0.
+type usnJournalData struct {
+	id              uint64
+	firstUsn        int64
+	nextUsn         int64
+	lowestValidUsn  int64
+	maxUsn          int64
+	maximumSize     uint64
+	allocationDelta uint64
+}
+
+// readUsnJournalData is READ_USN_JOURNAL_DATA_V0.
+type readUsnJournalData struct {
+	startUsn          int64
+	reasonMask        uint32
+	returnOnlyOnClose uint32
+	timeout           uint64
+	bytesToWaitFor    uint64
+	id                uint64
+}
+
+// fileIDDescriptor is FILE_ID_DESCRIPTOR with a FileIdType file id.
+type fileIDDescriptor struct {
+	size   uint32
+	typ    uint32
+	fileID uint64
+	pad    uint64
+}
+
+var (
+	procOpenFileById              = syscall.NewLazyDLL("kernel32.dll").NewProc("OpenFileById")
+	procGetFinalPathNameByHandleW = syscall.NewLazyDLL("kernel32.dll").NewProc("GetFinalPathNameByHandleW")
+)
+
+// A journalTable records the paths watched through change journals.
+type journalTable struct {
+	mu       sync.Mutex               // Protects access to journals.
+	journals map[string]*journalWatch // Map of watched paths to their journal readers
+}
+
+// A journalWatch reads the change journal of a volume, reporting the
+// changes below root.
+type journalWatch struct {
+	root    string
+	long    string            // root with long names, as records are named
+	volume  syscall.Handle    // Handle of the volume
+	id      uint64            // Identifier of the journal
+	mu      sync.Mutex        // Protects access to next.
+	next    int64             // USN of the next record to read
+	dirs    map[uint64]string // Map of directory file ids to their paths
+	reasons map[uint64]uint32 // Map of open file ids to the reasons reported
+	stop    chan bool         // Closed to stop reading
+	done    chan bool         // Closed when reading has stopped
+}
+
+// watchJournal watches the files below path through the change journal
+// of its volume, starting at cursor.
+func (w *Watcher) watchJournal(path string, cursor JournalCursor) error {
+	vol := filepath.VolumeName(path)
+	if len(vol) != 2 || vol[1] != ':' {
+		// Not a drive letter, such as a network share
+		return ErrNoJournal
+	}
+	// The reader of the journal and its buffer
+	if err := w.budget.reserve(path, budgetCost{goroutines: 1, memory: subtreeBufSize}); err != nil {
+		return err
+	}
+	volume, err := syscall.CreateFile(syscall.StringToUTF16Ptr(`\\.\`+vol), syscall.GENERIC_READ,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE, nil, syscall.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return os.NewSyscallError("CreateFile", err)
+	}
+	var data usnJournalData
+	var n uint32
+	err = syscall.DeviceIoControl(volume, sys_FSCTL_QUERY_USN_JOURNAL, nil, 0,
+		(*byte)(unsafe.Pointer(&data)), uint32(unsafe.Sizeof(data)), &n, nil)
+	if err != nil {
+		syscall.CloseHandle(volume)
+		if err == syscall.Errno(sys_ERROR_JOURNAL_NOT_ACTIVE) || err == syscall.Errno(sys_ERROR_INVALID_FUNCTION) {
+			return ErrNoJournal
+		}
+		return os.NewSyscallError("DeviceIoControl", err)
+	}
+
+	j := &journalWatch{
+		root:    path,
+		long:    longPathName(path),
+		volume:  volume,
+		id:      data.id,
+		next:    data.nextUsn,
+		dirs:    make(map[uint64]string),
+		reasons: make(map[uint64]uint32),
+		stop:    make(chan bool),
+		done:    make(chan bool),
+	}
+	lost := false
+	if cursor != (JournalCursor{}) {
+		// Resume at cursor, unless the journal was recreated or dropped
+		// the records since
+		switch {
+		case cursor.Journal != data.id:
+			lost = true
+		case cursor.USN < data.lowestValidUsn:
+			lost = true
+			j.next = data.lowestValidUsn
+		default:
+			j.next = cursor.USN
+		}
+	}
+
+	w.journals.mu.Lock()
+	if w.journals.journals == nil {
+		w.journals.journals = make(map[string]*journalWatch)
+	}
+	old := w.journals.journals[path]
+	w.journals.journals[path] = j
+	w.journals.mu.Unlock()
+	if old != nil {
+		old.close()
+	}
+	go w.readJournal(j, lost)
+	return nil
+}
+
+// remove stops reading the journal for path. It reports whether path was
+// watched through a journal.
+func (t *journalTable) remove(path string) bool {
+	t.mu.Lock()
+	j, found := t.journals[path]
+	delete(t.journals, path)
+	t.mu.Unlock()
+	if found {
+		j.close()
+	}
+	return found
+}
+
+// close stops all journal readers, before the watcher is closed.
+func (t *journalTable) close() {
+	t.mu.Lock()
+	journals := t.journals
+	t.journals = nil
+	t.mu.Unlock()
+	for _, j := range journals {
+		j.close()
+	}
+}
+
+func (j *journalWatch) close() {
+	close(j.stop)
+	<-j.done
+	syscall.CloseHandle(j.volume)
+}
+
+func (w *Watcher) journalCursor(path string) (JournalCursor, error) {
+	w.journals.mu.Lock()
+	j, found := w.journals.journals[path]
+	w.journals.mu.Unlock()
+	if !found {
+		return JournalCursor{}, ErrNoJournal
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return JournalCursor{Journal: j.id, USN: j.next}, nil
+}
+
+// readJournal sends the events of the journal of j below its root until
+// it is closed. If lost is set, records were lost before it started.
+func (w *Watcher) readJournal(j *journalWatch, lost bool) {
+	defer close(j.done)
+	if lost {
+		select {
+		case w.internalEvent <- &FileEvent{mask: sys_FS_Q_OVERFLOW, overflow: true, rescan: []string{j.root}}:
+		case <-j.stop:
+			return
+		}
+	}
+	buf := make([]byte, subtreeBufSize)
+	for {
+		select {
+		case <-j.stop:
+			return
+		default:
+		}
+		j.mu.Lock()
+		rd := readUsnJournalData{startUsn: j.next, reasonMask: 0xffffffff, id: j.id}
+		j.mu.Unlock()
+		var n uint32
+		err := syscall.DeviceIoControl(j.volume, sys_FSCTL_READ_USN_JOURNAL, (*byte)(unsafe.Pointer(&rd)), uint32(unsafe.Sizeof(rd)),
+			&buf[0], uint32(len(buf)), &n, nil)
+		if err != nil {
+			// Queued behind the events of the journal if events are ordered
+			errs, queue := w.Error, w.internalEvent
+			if w.order.stream() == nil {
+				queue = nil
+			} else {
+				errs = nil
+			}
+			err = os.NewSyscallError("DeviceIoControl", err)
+			select {
+			case errs <- err:
+			case queue <- &FileEvent{err: err}:
+			case <-j.stop:
+			}
+			return
+		}
+		if n > 8 {
+			// The records follow the USN to read next
+			next := int64(binary.LittleEndian.Uint64(buf))
+			for offset := 8; offset+sizeofUsnRecord <= int(n); {
+				recordLen := int(binary.LittleEndian.Uint32(buf[offset:]))
+				if recordLen < sizeofUsnRecord || offset+recordLen > int(n) {
+					break
+				}
+				if !w.sendJournalRecord(j, buf[offset:offset+recordLen]) {
+					return
+				}
+				offset += recordLen
+			}
+			j.mu.Lock()
+			j.next = next
+			j.mu.Unlock()
+			continue
+		}
+
+		// Read up to the end of the journal
+		select {
+		case <-time.After(journalWaitTime):
+		case <-j.stop:
+			return
+		}
+	}
+}
+
+// sendJournalRecord queues the event of a USN_RECORD_V2 if it lies below
+// the root of j. It returns false if j was closed meanwhile.
+func (w *Watcher) sendJournalRecord(j *journalWatch, record []byte) bool {
+	if binary.LittleEndian.Uint16(record[4:]) != 2 {
+		return true
+	}
+	fileID := binary.LittleEndian.Uint64(record[8:])
+	parentID := binary.LittleEndian.Uint64(record[16:])
+	stamp := binary.LittleEndian.Uint64(record[usnRecordTimeStamp:])
+	reason := binary.LittleEndian.Uint32(record[usnRecordReason:])
+	attributes := binary.LittleEndian.Uint32(record[usnRecordAttributes:])
+	nameLen := int(binary.LittleEndian.Uint16(record[usnRecordName:]))
+	nameOffset := int(binary.LittleEndian.Uint16(record[usnRecordName+2:]))
+	if nameOffset+nameLen > len(record) {
+		return true
+	}
+	name16 := make([]uint16, nameLen/2)
+	for i := range name16 {
+		name16[i] = binary.LittleEndian.Uint16(record[nameOffset+2*i:])
+	}
+	dir, ok := j.dirPath(parentID)
+	if !ok {
+		return true
+	}
+	name := strings.TrimSuffix(dir, `\`) + `\` + syscall.UTF16ToString(name16)
+	if attributes&syscall.FILE_ATTRIBUTE_DIRECTORY != 0 {
+		// Renamed directories are named after their latest record
+		j.remember(fileID, name)
+	}
+
+	// Reasons accumulate in the records of a file until it is closed;
+	// report those not reported yet
+	fresh := reason &^ j.reasons[fileID]
+	if reason&sys_USN_REASON_CLOSE != 0 {
+		delete(j.reasons, fileID)
+	} else {
+		j.reasons[fileID] = reason
+	}
+	mask := journalMask(fresh)
+	if mask == 0 || !pathBelow(name, j.long) {
+		return true
+	}
+	// Name the event after the watched path
+	name = strings.TrimSuffix(j.root, `\`) + name[len(strings.TrimSuffix(j.long, `\`)):]
+
+	// Inherit fsnFlags from the watched root
+	w.fsnmut.Lock()
+	if _, found := w.fsnFlags[name]; !found {
+		flags, found := w.fsnFlags[j.root]
+		if !found {
+			w.fsnmut.Unlock()
+			return true
+		}
+		w.fsnFlags[name] = flags
+	}
+	w.fsnmut.Unlock()
+	select {
+	case w.internalEvent <- &FileEvent{mask: mask, Name: name, dir: attributes&syscall.FILE_ATTRIBUTE_DIRECTORY != 0, stamp: filetime(stamp)}:
+		return true
+	case <-j.stop:
+		return false
+	}
+}
+
+// journalMask returns the event mask of the reasons of a journal record.
+func journalMask(reason uint32) uint32 {
+	var mask uint32
+	if reason&sys_USN_REASON_FILE_CREATE != 0 {
+		mask |= sys_FS_CREATE
+	}
+	if reason&sys_USN_REASON_FILE_DELETE != 0 {
+		mask |= sys_FS_DELETE
+	}
+	if reason&(sys_USN_REASON_DATA_OVERWRITE|sys_USN_REASON_DATA_EXTEND|sys_USN_REASON_DATA_TRUNCATION) != 0 {
+		mask |= sys_FS_MODIFY
+	}
+	if reason&(sys_USN_REASON_BASIC_INFO_CHANGE|sys_USN_REASON_SECURITY_CHANGE|sys_USN_REASON_EA_CHANGE) != 0 {
+		mask |= sys_FS_ATTRIB
+	}
+	if reason&sys_USN_REASON_RENAME_OLD_NAME != 0 {
+		mask |= sys_FS_MOVED_FROM
+	}
+	if reason&sys_USN_REASON_RENAME_NEW_NAME != 0 {
+		mask |= sys_FS_MOVED_TO
+	}
+	return mask
+}
+
+// pathBelow reports whether name is root or below it, ignoring case as
+// NTFS does.
+func pathBelow(name, root string) bool {
+	root = strings.TrimSuffix(root, `\`)
+	if len(name) < len(root) || !strings.EqualFold(name[:len(root)], root) {
+		return false
+	}
+	return len(name) == len(root) || name[len(root)] == '\\'
+}
+
+// longPathName returns path with long names in place of short (8.3)
+// names, or path if it cannot be told.
+func longPathName(path string) string {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return path
+	}
+	buf := make([]uint16, maxPathLen)
+	n, err := syscall.GetLongPathName(p, &buf[0], uint32(len(buf)))
+	if err != nil || int(n) > len(buf) {
+		return path
+	}
+	return syscall.UTF16ToString(buf[:n])
+}
+
+// remember records the path of the directory with the file id.
+func (j *journalWatch) remember(fileID uint64, path string) {
+	if len(j.dirs) >= maxJournalDirs {
+		j.dirs = make(map[uint64]string)
+	}
+	j.dirs[fileID] = path
+}
+
+// dirPath returns the path of the directory with the file id, or the path
+// it last had if it has been deleted.
+func (j *journalWatch) dirPath(fileID uint64) (string, bool) {
+	if path, found := j.dirs[fileID]; found {
+		return path, true
+	}
+	desc := fileIDDescriptor{size: uint32(unsafe.Sizeof(fileIDDescriptor{})), fileID: fileID}
+	h, _, _ := procOpenFileById.Call(uintptr(j.volume), uintptr(unsafe.Pointer(&desc)), 0,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, 0, syscall.FILE_FLAG_BACKUP_SEMANTICS)
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		return "", false
+	}
+	defer syscall.CloseHandle(syscall.Handle(h))
+	buf := make([]uint16, maxPathLen)
+	n, _, _ := procGetFinalPathNameByHandleW.Call(h, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0)
+	if n == 0 || int(n) > len(buf) {
+		return "", false
+	}
+	path := strings.TrimPrefix(syscall.UTF16ToString(buf[:n]), `\\?\`)
+	j.remember(fileID, path)
+	return path, true
+}
+
+// filetime returns the time of a FILETIME, as change journals record.
+func filetime(ft uint64) time.Time {
+	t := syscall.Filetime{LowDateTime: uint32(ft), HighDateTime: uint32(ft >> 32)}
+	return time.Unix(0, t.Nanoseconds())
+}
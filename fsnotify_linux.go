@@ -7,12 +7,19 @@
 package fsnotify
 
 import (
+	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
@@ -57,9 +64,29 @@ const (
 )
 
 type FileEvent struct {
-	mask   uint32 // Mask of events
-	cookie uint32 // Unique cookie associating related events (for rename(2))
-	Name   string // File name (optional)
+	mask        uint32          // Mask of events
+	cookie      uint32          // Unique cookie associating related events (for rename(2))
+	Name        string          // File name (optional)
+	prevSize    int64           // Size of the file before a modification
+	size        int64           // Size of the file after a modification
+	sized       bool            // Set if prevSize and size are known
+	replaced    bool            // Set if a different file took the place of the file
+	xattr       bool            // Set if the extended attributes of the file changed
+	delta       *ContentDelta   // Content before and after a modification (see SetContentTracking)
+	retarget    string          // New target of a watched symlink (see WatchSymlink)
+	movedFrom   string          // Source of a probable move (see SetMoveCorrelation)
+	overflow    bool            // Set on events reporting that events were dropped (see IsOverflow)
+	rescan      []string        // Watched paths affected by an overflow (see RescanRoots)
+	locked      bool            // Set if the file was still locked when delivered (see LockWait)
+	placeholder bool            // Set if the file was a cloud placeholder when delivered (see IsPlaceholder)
+	dir         bool            // Set if the event refers to a directory (see IsDir)
+	stamp       time.Time       // When the event was observed (see Time)
+	proc        *Process        // Process that caused the event (see SetProcessTracking)
+	move        MoveDirection   // Direction of a paired rename (see SetRenamePairing)
+	ops         uint32          // Notifications the system does not report (see FSN_USER)
+	parts       []*FileEvent    // Events combined by the event (see Parts)
+	err         error           // Error queued in order with the events (see Ordered)
+	ctx         context.Context // Context of the watch that delivered the event
 }
 
 // IsCreate reports whether the FileEvent was triggered by a creation
@@ -68,8 +95,9 @@ func (e *FileEvent) IsCreate() bool {
 }
 
 // IsDelete reports whether the FileEvent was triggered by a delete
+// or by the filesystem containing the watched file being unmounted
 func (e *FileEvent) IsDelete() bool {
-	return (e.mask&sys_IN_DELETE_SELF) == sys_IN_DELETE_SELF || (e.mask&sys_IN_DELETE) == sys_IN_DELETE
+	return (e.mask&sys_IN_DELETE_SELF) == sys_IN_DELETE_SELF || (e.mask&sys_IN_DELETE) == sys_IN_DELETE || (e.mask&sys_IN_UNMOUNT) == sys_IN_UNMOUNT
 }
 
 // IsModify reports whether the FileEvent was triggered by a file modification or attribute change
@@ -82,32 +110,115 @@ func (e *FileEvent) IsRename() bool {
 	return ((e.mask&sys_IN_MOVE_SELF) == sys_IN_MOVE_SELF || (e.mask&sys_IN_MOVED_FROM) == sys_IN_MOVED_FROM)
 }
 
+// movedTo reports whether the event names the file of a rename under its
+// new name.
+func (e *FileEvent) movedTo() bool { return e.mask&sys_IN_MOVED_TO == sys_IN_MOVED_TO }
+
 // IsAttrib reports whether the FileEvent was triggered by a change in the file metadata.
 func (e *FileEvent) IsAttrib() bool {
 	return (e.mask & sys_IN_ATTRIB) == sys_IN_ATTRIB
 }
 
+// isWrite reports whether the FileEvent was triggered by a change of the
+// file content, rather than its metadata.
+func (e *FileEvent) isWrite() bool { return e.mask&sys_IN_MODIFY == sys_IN_MODIFY }
+
+// RawMask returns the inotify mask of the event (IN_CREATE etc.), for the
+// cases the predicates do not cover. Events of WatchMount carry the
+// inotify counterparts of their fanotify flags, and events made up by the
+// watcher those of their notifications.
+func (e *FileEvent) RawMask() uint32 { return e.mask }
+
+// Cookie returns the cookie inotify associates the halves of a rename
+// with, or zero.
+func (e *FileEvent) Cookie() uint32 { return e.cookie }
+
+// newFileEvent returns a synthetic event for name, as if it had been
+// triggered by the given notifications (FSN_CREATE etc.)
+func newFileEvent(name string, flags uint32) *FileEvent {
+	e := &FileEvent{Name: name}
+	if flags&FSN_CREATE == FSN_CREATE {
+		e.mask |= sys_IN_CREATE
+	}
+	if flags&FSN_MODIFY == FSN_MODIFY {
+		e.mask |= sys_IN_MODIFY
+	}
+	if flags&FSN_DELETE == FSN_DELETE {
+		e.mask |= sys_IN_DELETE_SELF
+	}
+	if flags&FSN_RENAME == FSN_RENAME {
+		e.mask |= sys_IN_MOVE_SELF
+	}
+	return e
+}
+
 type watch struct {
 	wd    uint32 // Watch descriptor (as returned by the inotify_add_watch() syscall)
 	flags uint32 // inotify flags of this watch (see inotify(7) for the list of valid flags)
 }
 
 type Watcher struct {
-	mu            sync.Mutex        // Map access
-	fd            int               // File descriptor (as returned by the inotify_init() syscall)
-	watches       map[string]*watch // Map of inotify watches (key: path)
-	fsnFlags      map[string]uint32 // Map of watched files to flags used for filter
-	fsnmut        sync.Mutex        // Protects access to fsnFlags.
-	paths         map[int]string    // Map of watched paths (key: watch descriptor)
-	Error         chan error        // Errors are sent on this channel
-	internalEvent chan *FileEvent   // Events are queued on this channel
-	Event         chan *FileEvent   // Events are returned on this channel
-	done          chan bool         // Channel for sending a "quit message" to the reader goroutine
-	isClosed      bool              // Set to true when Close() is first called
+	mu            sync.Mutex                   // Map access
+	fd            int                          // File descriptor (as returned by the inotify_init() syscall)
+	watches       map[string]*watch            // Map of inotify watches (key: path)
+	fsnFlags      map[string]uint32            // Map of watched files to flags used for filter
+	handlers      map[string]EventHandler      // Map of watched files to event handlers (nil for the Event channel)
+	middleware    []Middleware                 // Middleware wrapping event delivery (see Use)
+	policy        *PathPolicy                  // Policy validating watched paths (see SetPathPolicy)
+	root          string                       // Base directory watched paths are resolved in (see SetRoot)
+	rootBeneath   bool                         // Set if paths leading out of root are rejected (see SetRootBeneath)
+	broker        *Broker                      // Broker of the Event channel (see Fanout)
+	ignored       []string                     // Base names of files to ignore (see SetIgnoredNames)
+	treeDepth     int                          // Levels of directories watched below trees (see SetTreeDepth)
+	links         linkTable                    // Known files, for events on hard links (see SetHardlinkTracking)
+	contents      contentCache                 // Cached contents of small files (see SetContentTracking)
+	recent        recentBuffer                 // Recently delivered events (see SetRecent)
+	dups          dupTable                     // Identities of watched paths (see SetDuplicatePolicy)
+	symlinks      symlinkTable                 // Watched symlinks (see WatchSymlink)
+	pending       pendingTable                 // Watches of paths that do not exist yet (see SetPendingWatches)
+	order         orderTable                   // Ordered stream of events and errors (see Ordered)
+	coop          coopQueue                    // Events between calls of Poll (see NewCooperativeWatcher)
+	moves         moveTable                    // Known files, to pair cross-device moves (see SetMoveCorrelation)
+	scans         scanTable                    // Known files, to rescan after sleep (see SetResumeRescan)
+	trees         treeTable                    // Roots of tree watches, to extend to directories moved in (see SetMoveInScan)
+	polls         pollTable                    // Paths watched by polling (see SetPolling)
+	mounts        mountTable                   // File systems watched with fanotify (see WatchMount)
+	renames       renameTable                  // Renames waiting for their pair (see SetRenamePairing)
+	drain         drainState                   // Events in flight on Close (see SetDrainOnClose)
+	activity      activityTable                // Watched paths of the latest events (see RescanRoots)
+	fair          fairQueue                    // Events queued per watch root (see SetFairness)
+	consistency   consistencyTable             // Watched paths with lost events (see SetConsistencyTracking)
+	steps         stepTable                    // Time spent in the steps of delivery (see SetStepTiming)
+	suppressed    suppressTable                // Paths the application is changing (see IgnorePath)
+	mock          *mockBackend                 // Recorded watches of a MockWatcher (nil otherwise)
+	budget        budgetTable                  // Resources of the watches (see SetBudget)
+	fsnmut        sync.Mutex                   // Protects access to fsnFlags, handlers, middleware, policy, root, broker, ignored and treeDepth.
+	paths         map[int]string               // Map of watched paths (key: watch descriptor)
+	movedDirs     map[uint32]string            // Watched directories moved away, used by the reader goroutine only (key: cookie)
+	stats         map[string]os.FileInfo       // Map of last known file information (nil unless size tracking is enabled)
+	xattrs        map[string][sha256.Size]byte // Map of hashes of extended attributes (nil unless xattr tracking is enabled)
+	smut          sync.Mutex                   // Protects access to stats and xattrs.
+	Error         chan error                   // Errors are sent on this channel
+	internalEvent chan *FileEvent              // Events are queued on this channel
+	Event         chan *FileEvent              // Events are returned on this channel
+	done          chan bool                    // Channel for sending a "quit message" to the reader goroutine
+	isClosed      bool                         // Set to true when Close() is first called
 }
 
 // NewWatcher creates and returns a new inotify instance using inotify_init(2)
 func NewWatcher() (*Watcher, error) {
+	w, err := newInotify()
+	if err != nil {
+		return nil, err
+	}
+	go w.readEvents()
+	go w.purgeEvents()
+	return w, nil
+}
+
+// newInotify returns a watcher on a new inotify instance, without starting
+// its goroutines.
+func newInotify() (*Watcher, error) {
 	fd, errno := syscall.InotifyInit()
 	if fd == -1 {
 		return nil, os.NewSyscallError("inotify_init", errno)
@@ -116,15 +227,14 @@ func NewWatcher() (*Watcher, error) {
 		fd:            fd,
 		watches:       make(map[string]*watch),
 		fsnFlags:      make(map[string]uint32),
+		handlers:      make(map[string]EventHandler),
 		paths:         make(map[int]string),
+		movedDirs:     make(map[uint32]string),
 		internalEvent: make(chan *FileEvent),
 		Event:         make(chan *FileEvent),
 		Error:         make(chan error),
 		done:          make(chan bool, 1),
 	}
-
-	go w.readEvents()
-	go w.purgeEvents()
 	return w, nil
 }
 
@@ -132,14 +242,39 @@ func NewWatcher() (*Watcher, error) {
 // It sends a message to the reader goroutine to quit and removes all watches
 // associated with the inotify instance
 func (w *Watcher) Close() error {
+	w.mu.Lock()
 	if w.isClosed {
+		w.mu.Unlock()
 		return nil
 	}
 	w.isClosed = true
-
-	// Remove all watches
+	var paths []string
 	for path := range w.watches {
-		w.RemoveWatch(path)
+		paths = append(paths, path)
+	}
+	w.mu.Unlock()
+	w.drain.close()
+	w.symlinks.close()
+	w.pending.close()
+	w.scans.close()
+	w.polls.close()
+	w.mounts.close()
+	w.renames.close()
+
+	// Remove all watches, keeping their flags and handlers for the events
+	// still in flight
+	for _, path := range paths {
+		w.removeWatch(path)
+	}
+
+	if w.coop.enabled {
+		// No reader goroutine; events not polled yet are dropped
+		syscall.Close(w.fd)
+		close(w.internalEvent)
+		close(w.Event)
+		close(w.Error)
+		w.order.close()
+		return nil
 	}
 
 	// Send "quit" message to the reader goroutine
@@ -162,8 +297,22 @@ func (w *Watcher) addWatch(path string, flags uint32) error {
 		watchEntry.flags |= flags
 		flags |= syscall.IN_MASK_ADD
 	}
-	wd, errno := syscall.InotifyAddWatch(w.fd, path, flags)
+	// In a root, watch the file through a descriptor opened in the root
+	// just now, so that a symlink swapped into path after it was resolved
+	// cannot lead the watch out of the root
+	target, addFlags := path, flags
+	if fd, err := w.openInRoot(path, flags&syscall.IN_DONT_FOLLOW != 0); err == nil {
+		defer syscall.Close(fd)
+		target = fmt.Sprintf("/proc/self/fd/%d", fd)
+		addFlags &^= syscall.IN_DONT_FOLLOW
+	} else if err != errNoKernelResolve {
+		return err
+	}
+	wd, errno := syscall.InotifyAddWatch(w.fd, target, addFlags)
 	if wd == -1 {
+		if errno == syscall.EACCES {
+			return macError("inotify_add_watch", path, errno)
+		}
 		return errno
 	}
 
@@ -177,11 +326,51 @@ func (w *Watcher) addWatch(path string, flags uint32) error {
 
 // Watch adds path to the watched file set, watching all events.
 func (w *Watcher) watch(path string) error {
-	return w.addWatch(path, sys_AGNOSTIC_EVENTS)
+	flags := sys_AGNOSTIC_EVENTS
+	if p := w.pathPolicy(); p != nil && p.NoFollow {
+		flags |= syscall.IN_DONT_FOLLOW
+	}
+	if err := w.addWatch(path, flags); err != nil {
+		return err
+	}
+	w.snapshotSizes(path)
+	w.snapshotXattrs(path)
+	return nil
+}
+
+// Magic numbers of network file systems (see statfs(2)), where inotify
+// misses the changes made through other machines.
+var remoteFSMagics = map[uint32]bool{
+	0x6969:     true, // nfs
+	0xFF534D42: true, // cifs
+	0xFE534D42: true, // smb2
+	0x517B:     true, // smb
+	0x65735546: true, // fuse
+	0x01021997: true, // 9p
+	0x786F4256: true, // vboxsf
+	0x00C36400: true, // ceph
+}
+
+// isRemoteFS reports whether path is on a network file system.
+func isRemoteFS(path string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false
+	}
+	return remoteFSMagics[uint32(st.Type)]
+}
+
+// watchTree watches each directory of the tree of path. inotify reports the
+// entries of a watched directory, so files need no watches of their own.
+func (w *Watcher) watchTree(path string, skip []string, depth int, h EventHandler, progress func(dirs int)) error {
+	return w.watchTreeWalk(path, skip, depth, h, progress)
 }
 
 // RemoveWatch removes path from the watched file set.
 func (w *Watcher) removeWatch(path string) error {
+	if w.mounts.remove(path) {
+		return nil
+	}
 	w.mu.Lock()
 	defer w.mu.Unlock()
 	watch, ok := w.watches[path]
@@ -196,19 +385,54 @@ func (w *Watcher) removeWatch(path string) error {
 	return nil
 }
 
+// inotifyWatchCost estimates the kernel memory of an inotify watch and the
+// inode it keeps in memory.
+const inotifyWatchCost = 1 << 10
+
+// watchCost estimates the resources of an inotify watch of path (see
+// SetBudget).
+func watchCost(path string) budgetCost {
+	return budgetCost{memory: inotifyWatchCost}
+}
+
+// Initial size of the buffer for reading events, for a maximum of 4096 raw
+// events without names
+const readBufferSize = syscall.SizeofInotifyEvent * 4096
+
+// queuedBytes returns the number of bytes of events waiting to be read from
+// the inotify file descriptor, as reported by FIONREAD.
+func (w *Watcher) queuedBytes() int {
+	var queued int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(w.fd), syscall.TIOCINQ, uintptr(unsafe.Pointer(&queued)))
+	if errno != 0 {
+		return 0
+	}
+	return int(queued)
+}
+
 // readEvents reads from the inotify file descriptor, converts the
 // received events into Event objects and sends them via the Event channel
 func (w *Watcher) readEvents() {
 	var (
-		buf   [syscall.SizeofInotifyEvent * 4096]byte // Buffer for a maximum of 4096 raw events
-		n     int                                     // Number of bytes read with read()
-		errno error                                   // Syscall errno
+		buf   = make([]byte, readBufferSize) // Buffer for raw events, grown to fit bursts
+		n     int                            // Number of bytes read with read()
+		errno error                          // Syscall errno
 	)
 
 	for {
 		// See if there is a message on the "done" channel
 		select {
 		case <-w.done:
+			// Deliver the events queued before Close, unless dropping
+			// what is in flight
+			if queued := w.queuedBytes(); queued > 0 && !w.drain.dropping() {
+				if queued > len(buf) {
+					buf = make([]byte, queued)
+				}
+				if n, _ = syscall.Read(w.fd, buf); n >= syscall.SizeofInotifyEvent {
+					w.sendEvents(buf[:n])
+				}
+			}
 			syscall.Close(w.fd)
 			close(w.internalEvent)
 			close(w.Error)
@@ -216,7 +440,12 @@ func (w *Watcher) readEvents() {
 		default:
 		}
 
-		n, errno = syscall.Read(w.fd, buf[:])
+		// Grow the buffer to read everything already queued at once
+		if queued := w.queuedBytes(); queued > len(buf) {
+			buf = make([]byte, queued)
+		}
+
+		n, errno = syscall.Read(w.fd, buf)
 
 		// If EOF is received
 		if n == 0 {
@@ -227,58 +456,120 @@ func (w *Watcher) readEvents() {
 		}
 
 		if n < 0 {
-			w.Error <- os.NewSyscallError("read", errno)
+			w.sendError(os.NewSyscallError("read", errno))
 			continue
 		}
 		if n < syscall.SizeofInotifyEvent {
-			w.Error <- errors.New("inotify: short read in readEvents()")
+			w.sendError(errors.New("inotify: short read in readEvents()"))
 			continue
 		}
 
-		var offset uint32 = 0
-		// We don't know how many events we just read into the buffer
-		// While the offset points to at least one whole event...
-		for offset <= uint32(n-syscall.SizeofInotifyEvent) {
-			// Point "raw" to the event in the buffer
-			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
-			event := new(FileEvent)
-			event.mask = uint32(raw.Mask)
-			event.cookie = uint32(raw.Cookie)
-			nameLen := uint32(raw.Len)
-			// If the event happened to the watched directory or the watched file, the kernel
-			// doesn't append the filename to the event, but we would like to always fill the
-			// the "Name" field with a valid filename. We retrieve the path of the watch from
-			// the "paths" map.
-			w.mu.Lock()
-			event.Name = w.paths[int(raw.Wd)]
-			w.mu.Unlock()
-			watchedName := event.Name
-			if nameLen > 0 {
-				// Point "bytes" at the first byte of the filename
-				bytes := (*[syscall.PathMax]byte)(unsafe.Pointer(&buf[offset+syscall.SizeofInotifyEvent]))
-				// The filename is padded with NUL bytes. TrimRight() gets rid of those.
-				event.Name += "/" + strings.TrimRight(string(bytes[0:nameLen]), "\000")
+		w.sendEvents(buf[:n])
+	}
+}
+
+// sendEvents converts the raw events read into buf into Event objects and
+// queues them for delivery.
+func (w *Watcher) sendEvents(buf []byte) {
+	stamp := time.Now()
+	var offset uint32 = 0
+	// We don't know how many events we just read into the buffer
+	// While the offset points to at least one whole event...
+	for offset <= uint32(len(buf)-syscall.SizeofInotifyEvent) {
+		// Copy the event out of the buffer; syscall.InotifyEvent is padded
+		// past the header, beyond the end of a buffer sized to the queue
+		var raw syscall.InotifyEvent
+		copy((*[syscall.SizeofInotifyEvent]byte)(unsafe.Pointer(&raw))[:], buf[offset:])
+		mask := uint32(raw.Mask)
+		nameLen := uint32(raw.Len)
+		// If the event happened to the watched directory or the watched file, the kernel
+		// doesn't append the filename to the event, but we would like to always fill the
+		// the "Name" field with a valid filename. We retrieve the path of the watch from
+		// the "paths" map.
+		w.mu.Lock()
+		watchedName := w.paths[int(raw.Wd)]
+		w.mu.Unlock()
+		name := watchedName
+		if nameLen > 0 {
+			// Slice "bytes" to the filename; the kernel only returns whole
+			// events, so it always lies within what was read
+			start := offset + syscall.SizeofInotifyEvent
+			bytes := buf[start : start+nameLen]
+			// The filename is padded with NUL bytes. TrimRight() gets rid of those.
+			name += "/" + strings.TrimRight(string(bytes), "\000")
+		}
+
+		// The queue overflowed; the roots affected are told from the
+		// events before
+		if mask&sys_IN_Q_OVERFLOW == sys_IN_Q_OVERFLOW {
+			w.queue(&FileEvent{mask: mask, overflow: true, stamp: stamp})
+			offset += syscall.SizeofInotifyEvent + nameLen
+			continue
+		}
+
+		// Follow watched directories renamed within the watched ones
+		w.remapMove(mask, uint32(raw.Cookie), name)
+
+		// Get FSNotify flags (inherit from directory watch)
+		w.fsnmut.Lock()
+		fsnFlags, fsnFound := w.fsnFlags[name]
+		if !fsnFound {
+			if fsnFlags, fsnFound = w.fsnFlags[watchedName]; !fsnFound {
+				fsnFlags = FSN_ALL
 			}
+		}
+		w.fsnmut.Unlock()
+
+		// Pair renames whatever the flags, delivering the first half of
+		// a pair completed here before the second, or with it
+		move, from := w.renames.note(w, mask, uint32(raw.Cookie))
+		if from != nil && !w.renames.composing() {
+			w.queue(from)
+			from = nil
+		}
 
-			// Send the events that are not ignored on the events channel
-			if !event.ignoreLinux() {
-				// Setup FSNotify flags (inherit from directory watch)
+		// Drop events the user did not ask for here, before they are
+		// allocated, checked against the file system and queued
+		if probe := (FileEvent{mask: mask, Name: name}); !probe.matchesFlags(fsnFlags) {
+			w.rewatch(&probe)
+			if probe.IsDelete() {
 				w.fsnmut.Lock()
-				if _, fsnFound := w.fsnFlags[event.Name]; !fsnFound {
-					if fsnFlags, watchFound := w.fsnFlags[watchedName]; watchFound {
-						w.fsnFlags[event.Name] = fsnFlags
-					} else {
-						w.fsnFlags[event.Name] = FSN_ALL
-					}
-				}
+				delete(w.fsnFlags, name)
+				delete(w.handlers, name)
 				w.fsnmut.Unlock()
+			}
+			if from != nil {
+				w.queue(from)
+			}
+			offset += syscall.SizeofInotifyEvent + nameLen
+			continue
+		}
+
+		event := &FileEvent{mask: mask, cookie: uint32(raw.Cookie), Name: name, dir: mask&sys_IN_ISDIR == sys_IN_ISDIR, move: move, stamp: stamp}
 
-				w.internalEvent <- event
+		// Send the events that are not ignored on the events channel
+		if !event.ignoreLinux() {
+			w.updateSize(event)
+			w.updateXattrs(event)
+
+			// Setup FSNotify flags
+			w.fsnmut.Lock()
+			if _, fsnFound := w.fsnFlags[name]; !fsnFound {
+				w.fsnFlags[name] = fsnFlags
 			}
+			w.fsnmut.Unlock()
 
-			// Move to the next event in the buffer
-			offset += syscall.SizeofInotifyEvent + nameLen
+			if from != nil {
+				w.queue(compose(event, from, event))
+			} else if move != MovedAway || !w.renames.hold(event) {
+				w.queue(event)
+			}
+		} else if from != nil {
+			w.queue(from)
 		}
+
+		// Move to the next event in the buffer
+		offset += syscall.SizeofInotifyEvent + nameLen
 	}
 }
 
@@ -302,3 +593,279 @@ func (e *FileEvent) ignoreLinux() bool {
 	}
 	return false
 }
+
+func (w *Watcher) setSizeTracking(enable bool) {
+	w.smut.Lock()
+	defer w.smut.Unlock()
+	if !enable {
+		w.stats = nil
+	} else if w.stats == nil {
+		w.stats = make(map[string]os.FileInfo)
+	}
+}
+
+// snapshotSizes records the file information of a newly watched file, or of
+// the files in a newly watched directory, so that the first modification has
+// a previous state to report.
+func (w *Watcher) snapshotSizes(path string) {
+	w.smut.Lock()
+	defer w.smut.Unlock()
+	if w.stats == nil {
+		return
+	}
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return
+	}
+	if !fi.IsDir() {
+		w.stats[path] = fi
+		return
+	}
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return
+	}
+	for _, fi := range files {
+		if !fi.IsDir() {
+			// Same form as the event names built in readEvents
+			w.stats[path+"/"+fi.Name()] = fi
+		}
+	}
+}
+
+// updateSize records the current file information of the file an event
+// refers to and, for modifications, fills in the size before and after the
+// event. A create over a name whose file is still recorded (inotify reports
+// no delete for the target of a rename) marks the file as replaced.
+func (w *Watcher) updateSize(event *FileEvent) {
+	w.smut.Lock()
+	defer w.smut.Unlock()
+	if w.stats == nil {
+		return
+	}
+	if event.IsDelete() || event.IsRename() {
+		delete(w.stats, event.Name)
+		return
+	}
+	fi, err := os.Lstat(event.Name)
+	if err != nil || fi.IsDir() {
+		return
+	}
+	prev, found := w.stats[event.Name]
+	w.stats[event.Name] = fi
+	if !found {
+		return
+	}
+	if event.IsCreate() && !os.SameFile(prev, fi) {
+		event.replaced = true
+	} else if !event.IsModify() {
+		return
+	}
+	event.prevSize = prev.Size()
+	event.size = fi.Size()
+	event.sized = true
+}
+
+// Scan budgets have no effect on Linux, which reports created files
+// directly.
+func (w *Watcher) setScanBudget(budget time.Duration) {}
+
+func (w *Watcher) setXattrTracking(enable bool) {
+	w.smut.Lock()
+	defer w.smut.Unlock()
+	if !enable {
+		w.xattrs = nil
+	} else if w.xattrs == nil {
+		w.xattrs = make(map[string][sha256.Size]byte)
+	}
+}
+
+// snapshotXattrs records the extended attributes of a newly watched file,
+// or of the files in a newly watched directory.
+func (w *Watcher) snapshotXattrs(path string) {
+	w.smut.Lock()
+	defer w.smut.Unlock()
+	if w.xattrs == nil {
+		return
+	}
+	if hash, err := xattrHash(path); err == nil {
+		w.xattrs[path] = hash
+	}
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return
+	}
+	for _, fi := range files {
+		name := path + "/" + fi.Name()
+		if hash, err := xattrHash(name); err == nil {
+			w.xattrs[name] = hash
+		}
+	}
+}
+
+// updateXattrs records the extended attributes of the file an event refers
+// to and marks attribute changes that changed them.
+func (w *Watcher) updateXattrs(event *FileEvent) {
+	w.smut.Lock()
+	defer w.smut.Unlock()
+	if w.xattrs == nil {
+		return
+	}
+	if event.IsDelete() || event.IsRename() {
+		delete(w.xattrs, event.Name)
+		return
+	}
+	if !event.IsCreate() && !event.IsAttrib() {
+		return
+	}
+	hash, err := xattrHash(event.Name)
+	if err != nil {
+		return
+	}
+	prev, found := w.xattrs[event.Name]
+	w.xattrs[event.Name] = hash
+	if found && event.IsAttrib() && prev != hash {
+		event.xattr = true
+	}
+}
+
+// xattrHash returns a hash of the names and values of the extended
+// attributes of the file at path.
+func xattrHash(path string) ([sha256.Size]byte, error) {
+	var hash [sha256.Size]byte
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil {
+		return hash, err
+	}
+	list := make([]byte, size)
+	if size, err = syscall.Listxattr(path, list); err != nil {
+		return hash, err
+	}
+	names := strings.Split(strings.TrimRight(string(list[:size]), "\000"), "\000")
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		size, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			return hash, err
+		}
+		value := make([]byte, size)
+		if size, err = syscall.Getxattr(path, name, value); err != nil {
+			return hash, err
+		}
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write(value[:size])
+		h.Write([]byte{0})
+	}
+	copy(hash[:], h.Sum(nil))
+	return hash, nil
+}
+
+const (
+	sys_O_PATH          = 0x200000
+	sys_RESOLVE_BENEATH = 0x08
+	sys_RESOLVE_IN_ROOT = 0x10
+	sys_SYS_OPENAT2     = 437 // Not offset as on mips
+)
+
+// openHow is struct open_how of openat2(2).
+type openHow struct {
+	flags   uint64
+	mode    uint64
+	resolve uint64
+}
+
+// resolveInRootKernel resolves path in root with openat2(2) and
+// RESOLVE_IN_ROOT, or RESOLVE_BENEATH if beneath, reading the result back
+// from /proc. It returns errNoKernelResolve on kernels before 5.6.
+func resolveInRootKernel(root, path string, beneath bool) (string, error) {
+	fd, err := openInRootKernel(root, path, beneath, 0)
+	if err != nil {
+		return "", err
+	}
+	defer syscall.Close(fd)
+	resolved, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd))
+	if err != nil {
+		return "", errNoKernelResolve
+	}
+	return resolved, nil
+}
+
+// openInRootKernel opens path in root as an O_PATH file descriptor, as
+// resolveInRootKernel resolves it, adding flags to those of the open.
+func openInRootKernel(root, path string, beneath bool, flags int) (int, error) {
+	if strings.HasPrefix(runtime.GOARCH, "mips") {
+		return -1, errNoKernelResolve
+	}
+	rootfd, err := syscall.Open(root, sys_O_PATH|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, &os.PathError{Op: "open", Path: root, Err: err}
+	}
+	defer syscall.Close(rootfd)
+	how := openHow{flags: uint64(sys_O_PATH | syscall.O_CLOEXEC | flags), resolve: sys_RESOLVE_IN_ROOT}
+	if beneath {
+		// Absolute paths are relative to root all the same
+		path = strings.TrimLeft(path, "/")
+		how.resolve = sys_RESOLVE_BENEATH
+	}
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return -1, err
+	}
+	fd, _, errno := syscall.Syscall6(sys_SYS_OPENAT2, uintptr(rootfd), uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&how)), unsafe.Sizeof(how), 0, 0)
+	switch errno {
+	case 0:
+		return int(fd), nil
+	case syscall.ENOSYS, syscall.EPERM:
+		// EPERM comes from seccomp filters that predate openat2
+		return -1, errNoKernelResolve
+	case syscall.EXDEV:
+		if beneath {
+			return -1, &os.PathError{Op: "openat2", Path: path, Err: ErrOutsideRoot}
+		}
+	}
+	return -1, &os.PathError{Op: "openat2", Path: path, Err: errno}
+}
+
+// openInRoot opens a path resolved in the root of the watcher, if it has
+// one, as an O_PATH file descriptor, resolving it anew in the root. It
+// returns errNoKernelResolve if there is no root or openat2 is missing.
+func (w *Watcher) openInRoot(path string, nofollow bool) (int, error) {
+	w.fsnmut.Lock()
+	root, beneath := w.root, w.rootBeneath
+	w.fsnmut.Unlock()
+	if root == "" {
+		return -1, errNoKernelResolve
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return -1, &os.PathError{Op: "watch", Path: path, Err: ErrOutsideRoot}
+	}
+	flags := 0
+	if nofollow {
+		flags = syscall.O_NOFOLLOW
+	}
+	return openInRootKernel(root, rel, beneath, flags)
+}
+
+// macError explains an EACCES for path as a MACError when file permissions
+// allow reading it, so that a security module must have denied it.
+func macError(op, path string, err error) error {
+	if syscall.Access(path, 4 /* R_OK */) != nil {
+		return err
+	}
+	e := &MACError{Op: op, Path: path, Err: err}
+	if enforce, rerr := ioutil.ReadFile("/sys/fs/selinux/enforce"); rerr == nil && strings.TrimSpace(string(enforce)) == "1" {
+		e.Module = "SELinux"
+	} else if enabled, rerr := ioutil.ReadFile("/sys/module/apparmor/parameters/enabled"); rerr == nil && strings.TrimSpace(string(enabled)) == "Y" {
+		e.Module = "AppArmor"
+	}
+	if label, rerr := ioutil.ReadFile("/proc/self/attr/current"); rerr == nil {
+		e.Context = strings.TrimRight(string(label), "\x00\n")
+	}
+	return e
+}
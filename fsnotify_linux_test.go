@@ -0,0 +1,808 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package fsnotify
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/howeyc/fsnotify/fsnotifytest"
+)
+
+func TestInotifyQueuedBytes(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	// A bare inotify instance, so nothing reads the events
+	fd, err := syscall.InotifyInit()
+	if err != nil {
+		t.Fatalf("inotify_init failed: %s", err)
+	}
+	defer syscall.Close(fd)
+	if _, err := syscall.InotifyAddWatch(fd, testDir, sys_AGNOSTIC_EVENTS); err != nil {
+		t.Fatalf("inotify_add_watch failed: %s", err)
+	}
+	w := &Watcher{fd: fd}
+
+	if queued := w.queuedBytes(); queued != 0 {
+		t.Fatalf("%d bytes queued before any event", queued)
+	}
+	fsnotifytest.MakeBurst(t, testDir, 10000)
+	if queued := w.queuedBytes(); queued <= readBufferSize {
+		t.Fatalf("burst queued %d bytes, expected more than the initial buffer (%d)", queued, readBufferSize)
+	}
+}
+
+func TestInotifyBurst(t *testing.T) {
+	// More events than fit in the initial read buffer
+	const burst = 10000
+
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	addWatch(t, watcher, testDir)
+
+	var createReceived counter
+	go func() {
+		for event := range watcher.Event {
+			if event.IsCreate() {
+				createReceived.increment()
+			}
+		}
+	}()
+
+	fsnotifytest.MakeBurst(t, testDir, burst)
+
+	for deadline := time.Now().Add(5 * time.Second); createReceived.value() < burst && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if createReceived.value() != burst {
+		t.Fatalf("incorrect number of create events received after 5 s (%d vs %d)", createReceived.value(), burst)
+	}
+}
+
+func TestInotifyReplacedInode(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	testFile := filepath.Join(testDir, "TestInotifyReplacedInode.testfile")
+	if err := ioutil.WriteFile(testFile, []byte("data"), 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetSizeTracking(true)
+
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	events := make(chan *FileEvent, 10)
+	go func() {
+		for event := range watcher.Event {
+			if event.Name == testFile && event.IsCreate() {
+				events <- event
+			}
+		}
+	}()
+
+	addWatch(t, watcher, testDir)
+
+	// Atomic save: write a temporary file and rename it over the original
+	tmpFile := testFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, []byte("new data"), 0666); err != nil {
+		t.Fatalf("creating temporary file failed: %s", err)
+	}
+	if err := os.Rename(tmpFile, testFile); err != nil {
+		t.Fatalf("renaming temporary file failed: %s", err)
+	}
+
+	select {
+	case event := <-events:
+		if c := event.Change(); c != ReplacedInode {
+			t.Fatalf("incorrect change reported (%s vs %s)", c, ReplacedInode)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("fsnotify create events have not received after 500 ms")
+	}
+}
+
+func TestInotifyXattrChange(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	testFile := filepath.Join(testDir, "TestInotifyXattrChange.testfile")
+	if err := ioutil.WriteFile(testFile, []byte("data"), 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	if err := syscall.Setxattr(testFile, "user.fsnotify", []byte("a"), 0); err != nil {
+		t.Skipf("extended attributes not supported: %s", err)
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetXattrTracking(true)
+
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	events := make(chan *FileEvent, 10)
+	go func() {
+		for event := range watcher.Event {
+			if event.Name == testFile && event.IsAttrib() {
+				events <- event
+			}
+		}
+	}()
+
+	addWatch(t, watcher, testDir)
+
+	// A mode change is not an xattr change
+	if err := os.Chmod(testFile, 0600); err != nil {
+		t.Fatalf("chmod failed: %s", err)
+	}
+	select {
+	case event := <-events:
+		if event.IsXattrChange() {
+			t.Fatal("chmod reported as an xattr change")
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("fsnotify attrib events have not received after 500 ms")
+	}
+
+	if err := syscall.Setxattr(testFile, "user.fsnotify", []byte("b"), 0); err != nil {
+		t.Fatalf("setting extended attribute failed: %s", err)
+	}
+	select {
+	case event := <-events:
+		if !event.IsXattrChange() {
+			t.Fatal("setxattr not reported as an xattr change")
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("fsnotify attrib events have not received after 500 ms")
+	}
+}
+
+// inotify reports the children of a watched directory, so a tree needs one
+// watch per directory and none for its files.
+func TestInotifyWatchTreeWatchCount(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	dirs := []string{"a", "a/b", "a/b/c", "d"}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(testDir, dir), 0777); err != nil {
+			t.Fatalf("creating test directory failed: %s", err)
+		}
+		fsnotifytest.MakeBurst(t, filepath.Join(testDir, dir), 5)
+	}
+	fsnotifytest.MakeBurst(t, testDir, 5)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	if err := watcher.WatchTree(testDir, nil); err != nil {
+		t.Fatalf("watching tree %q failed: %s", testDir, err)
+	}
+
+	watcher.mu.Lock()
+	watches := len(watcher.watches)
+	watcher.mu.Unlock()
+	if want := len(dirs) + 1; watches != want {
+		t.Fatalf("incorrect number of watches for a tree of %d directories (%d vs %d)", want, watches, want)
+	}
+}
+
+func TestFanotifyWatchMount(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+	otherDir := tempMkdir(t)
+	defer os.RemoveAll(otherDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	go func() {
+		for err := range watcher.Error {
+			t.Errorf("error received: %s", err)
+		}
+	}()
+	if err := watcher.WatchMount(testDir); err != nil {
+		t.Fatalf("watcher.WatchMount(%q) failed: %s", testDir, err)
+	}
+	watcher.mounts.mu.Lock()
+	_, fanotify := watcher.mounts.mounts[testDir]
+	watcher.mounts.mu.Unlock()
+	if !fanotify {
+		t.Skip("fanotify not available")
+	}
+
+	var createReceived, deleteReceived, otherReceived counter
+	newDir := filepath.Join(testDir, "a", "b")
+	testFile := filepath.Join(newDir, "TestFanotifyWatchMount.testfile")
+	go func() {
+		for event := range watcher.Event {
+			switch {
+			case event.Name == testFile && event.IsCreate():
+				createReceived.increment()
+			case event.Name == testFile && event.IsDelete():
+				deleteReceived.increment()
+			case !strings.HasPrefix(event.Name, testDir+"/"):
+				otherReceived.increment()
+			}
+		}
+	}()
+
+	// Directories created after the watch are watched too
+	if err := os.MkdirAll(newDir, 0777); err != nil {
+		t.Fatalf("creating test directory failed: %s", err)
+	}
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(otherDir, "outside"), nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	os.Remove(testFile)
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if cv := createReceived.value(); cv != 1 {
+		t.Fatalf("incorrect number of create events received after 500 ms (%d vs %d)", cv, 1)
+	}
+	if dv := deleteReceived.value(); dv != 1 {
+		t.Fatalf("incorrect number of delete events received after 500 ms (%d vs %d)", dv, 1)
+	}
+	if ov := otherReceived.value(); ov != 0 {
+		t.Fatalf("%d events received from outside the watched directory", ov)
+	}
+
+	if err := watcher.RemoveWatch(testDir); err != nil {
+		t.Fatalf("removing mount watch failed: %s", err)
+	}
+}
+
+func TestFanotifyCloseUnread(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	go func() {
+		for range watcher.Error {
+		}
+	}()
+	if err := watcher.WatchMount(testDir); err != nil {
+		t.Fatalf("watcher.WatchMount(%q) failed: %s", testDir, err)
+	}
+	watcher.mounts.mu.Lock()
+	_, fanotify := watcher.mounts.mounts[testDir]
+	watcher.mounts.mu.Unlock()
+	if !fanotify {
+		watcher.Close()
+		t.Skip("fanotify not available")
+	}
+
+	// Nobody reads the events of the files
+	for i := 0; i < 100; i++ {
+		if err := ioutil.WriteFile(filepath.Join(testDir, fmt.Sprintf("file%d.testfile", i)), nil, 0666); err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- watcher.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close blocked on events nobody reads")
+	}
+}
+
+func TestInotifyOverflowRescanRoots(t *testing.T) {
+	data, err := ioutil.ReadFile("/proc/sys/fs/inotify/max_queued_events")
+	if err != nil {
+		t.Skipf("cannot read inotify queue limit: %s", err)
+	}
+	queued, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || queued > 65536 {
+		t.Skip("inotify queue too long to overflow")
+	}
+
+	busyDir := tempMkdir(t)
+	defer os.RemoveAll(busyDir)
+	idleDir := tempMkdir(t)
+	defer os.RemoveAll(idleDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	go func() {
+		for range watcher.Error {
+		}
+	}()
+	addWatch(t, watcher, busyDir)
+	addWatch(t, watcher, idleDir)
+
+	// Overflow the queue while the Event channel is not read
+	fsnotifytest.MakeBurst(t, busyDir, queued+1000)
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case ev := <-watcher.Event:
+			if !ev.IsOverflow() {
+				continue
+			}
+			if roots := ev.RescanRoots(); len(roots) != 1 || roots[0] != busyDir {
+				t.Fatalf("overflow reports roots %q to rescan, expected %q", roots, busyDir)
+			}
+			return
+		case <-timeout:
+			t.Fatal("no overflow event received after 10 seconds")
+		}
+	}
+}
+
+func TestFanotifyProcessTracking(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetProcessTracking(true)
+	if err := watcher.WatchMount(testDir); err != nil {
+		t.Fatalf("watcher.WatchMount(%q) failed: %s", testDir, err)
+	}
+	watcher.mounts.mu.Lock()
+	_, fanotify := watcher.mounts.mounts[testDir]
+	watcher.mounts.mu.Unlock()
+	if !fanotify {
+		t.Skip("fanotify not available")
+	}
+
+	testFile := filepath.Join(testDir, "TestFanotifyProcessTracking.testfile")
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	select {
+	case ev := <-watcher.Event:
+		p, ok := ev.Process()
+		if !ok {
+			t.Fatalf("no process reported for %s", ev)
+		}
+		if p.PID != os.Getpid() || p.UID != os.Geteuid() {
+			t.Fatalf("process %+v reported, expected PID %d and UID %d", p, os.Getpid(), os.Geteuid())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+}
+
+func TestInotifyRenamePairing(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+	otherDir := tempMkdir(t)
+	defer os.RemoveAll(otherDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetRenamePairing(100 * time.Millisecond)
+	addWatch(t, watcher, testDir)
+
+	testFile := filepath.Join(testDir, "TestInotifyRenamePairing.testfile")
+	movedFile := filepath.Join(testDir, "TestInotifyRenamePairing.moved")
+	outsideFile := filepath.Join(otherDir, "TestInotifyRenamePairing.outside")
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	expect := func(name string, want MoveDirection) {
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case ev := <-watcher.Event:
+				if ev.Name != name || ev.IsModify() {
+					continue
+				}
+				if got := ev.Move(); got != want {
+					t.Fatalf("%s moved %s, expected %s", ev, got, want)
+				}
+				return
+			case <-timeout:
+				t.Fatalf("no event received for %q", name)
+			}
+		}
+	}
+	expect(testFile, MoveUnknown)
+
+	if err := os.Rename(testFile, movedFile); err != nil {
+		t.Fatalf("renaming test file failed: %s", err)
+	}
+	expect(testFile, MovedWithin)
+	expect(movedFile, MovedWithin)
+
+	// Held for the timeout, as the pair never arrives
+	if err := os.Rename(movedFile, outsideFile); err != nil {
+		t.Fatalf("renaming test file failed: %s", err)
+	}
+	expect(movedFile, MovedAway)
+
+	if err := os.Rename(outsideFile, testFile); err != nil {
+		t.Fatalf("renaming test file failed: %s", err)
+	}
+	expect(testFile, MovedIn)
+}
+
+func TestInotifyCompositeRename(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetRenamePairing(100 * time.Millisecond)
+	watcher.SetCompositeEvents(true)
+	addWatch(t, watcher, testDir)
+
+	testFile := filepath.Join(testDir, "TestInotifyCompositeRename.testfile")
+	movedFile := filepath.Join(testDir, "TestInotifyCompositeRename.moved")
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	if err := os.Rename(testFile, movedFile); err != nil {
+		t.Fatalf("renaming test file failed: %s", err)
+	}
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case ev := <-watcher.Event:
+			t.Logf("event received: %s", ev)
+			if ev.Name == testFile && ev.IsRename() {
+				t.Fatalf("half of a composite rename delivered on its own: %s", ev)
+			}
+			if ev.Name != movedFile {
+				continue
+			}
+			if !ev.IsCreate() || ev.Move() != MovedWithin {
+				t.Fatalf("composite rename %s moved %s, expected a create moved %s", ev, ev.Move(), MovedWithin)
+			}
+			parts := ev.Parts()
+			if len(parts) != 2 || parts[0].Name != testFile || !parts[0].IsRename() || parts[1].Name != movedFile || !parts[1].IsCreate() {
+				t.Fatalf("composite rename has parts %v, expected the rename of %q and the create of %q", parts, testFile, movedFile)
+			}
+			if ev.OldPath() != testFile || ev.NewPath() != movedFile {
+				t.Fatalf("composite rename from %q to %q, expected from %q to %q", ev.OldPath(), ev.NewPath(), testFile, movedFile)
+			}
+			return
+		case <-timeout:
+			t.Fatalf("no event received for %q", movedFile)
+		}
+	}
+}
+
+func TestInotifyRenamePaths(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	addWatch(t, watcher, testDir)
+
+	testFile := filepath.Join(testDir, "TestInotifyRenamePaths.testfile")
+	movedFile := filepath.Join(testDir, "TestInotifyRenamePaths.moved")
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	if err := os.Rename(testFile, movedFile); err != nil {
+		t.Fatalf("renaming test file failed: %s", err)
+	}
+
+	// Unpaired, each half only knows its own name
+	var sawOld, sawNew bool
+	timeout := time.After(time.Second)
+	for !sawOld || !sawNew {
+		select {
+		case ev := <-watcher.Event:
+			switch {
+			case ev.IsRename():
+				if ev.OldPath() != testFile || ev.NewPath() != "" {
+					t.Fatalf("%s renamed from %q to %q, expected from %q to \"\"", ev, ev.OldPath(), ev.NewPath(), testFile)
+				}
+				sawOld = true
+			case ev.Name == movedFile:
+				if ev.OldPath() != "" || ev.NewPath() != movedFile {
+					t.Fatalf("%s renamed from %q to %q, expected from \"\" to %q", ev, ev.OldPath(), ev.NewPath(), movedFile)
+				}
+				sawNew = true
+			case ev.OldPath() != "" || ev.NewPath() != "":
+				t.Fatalf("%s renamed from %q to %q, expected no names", ev, ev.OldPath(), ev.NewPath())
+			}
+		case <-timeout:
+			t.Fatal("no rename events received")
+		}
+	}
+}
+
+func TestInotifyIsDirDeleted(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+	testSubDir := filepath.Join(testDir, "sub")
+	if err := os.Mkdir(testSubDir, 0777); err != nil {
+		t.Fatalf("failed to create test sub-directory: %s", err)
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	addWatch(t, watcher, testDir)
+
+	// Gone by the time the event is read, yet still known as a directory
+	if err := os.Remove(testSubDir); err != nil {
+		t.Fatalf("removing test sub-directory failed: %s", err)
+	}
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case ev := <-watcher.Event:
+			if ev.Name != testSubDir || !ev.IsDelete() {
+				continue
+			}
+			if !ev.IsDir() {
+				t.Fatalf("%s not reported as a directory", ev)
+			}
+			return
+		case <-timeout:
+			t.Fatalf("no delete event received for %q", testSubDir)
+		}
+	}
+}
+
+func TestInotifyRemoveWatchTree(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+	for _, dir := range []string{"a/b/c", "d"} {
+		if err := os.MkdirAll(filepath.Join(testDir, dir), 0777); err != nil {
+			t.Fatalf("creating test directory failed: %s", err)
+		}
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	if err := watcher.WatchTree(testDir, nil); err != nil {
+		t.Fatalf("watching tree %q failed: %s", testDir, err)
+	}
+	if err := watcher.RemoveWatchTree(testDir); err != nil {
+		t.Fatalf("removing tree %q failed: %s", testDir, err)
+	}
+	watcher.mu.Lock()
+	watches := len(watcher.watches)
+	watcher.mu.Unlock()
+	if watches != 0 {
+		t.Fatalf("%d inotify watches left after removing the tree", watches)
+	}
+}
+
+func TestInotifyRenameRemap(t *testing.T) {
+	// Create directory tree to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	if err := os.MkdirAll(filepath.Join(testDir, "a", "b"), 0777); err != nil {
+		t.Fatalf("creating test directory failed: %s", err)
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	testFile := filepath.Join(testDir, "c", "b", "TestInotifyRenameRemap.testfile")
+	var createReceived, staleReceived counter
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			switch {
+			case event.Name == testFile && event.IsCreate():
+				createReceived.increment()
+			case strings.HasPrefix(event.Name, filepath.Join(testDir, "a")+"/"):
+				staleReceived.increment()
+			}
+		}
+	}()
+
+	if err := watcher.WatchTree(testDir, nil); err != nil {
+		t.Fatalf("watching tree %q failed: %s", testDir, err)
+	}
+	if err := os.Rename(filepath.Join(testDir, "a"), filepath.Join(testDir, "c")); err != nil {
+		t.Fatalf("renaming test directory failed: %s", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if createReceived.value() != 1 {
+		t.Fatalf("incorrect number of create events received under the new name after 500 ms (%d vs %d)", createReceived.value(), 1)
+	}
+	if staleReceived.value() != 0 {
+		t.Fatalf("events received under the old name (%d)", staleReceived.value())
+	}
+	want := []string{testDir, filepath.Join(testDir, "c"), filepath.Join(testDir, "c", "b")}
+	if paths := watcher.watchedPaths(); !reflect.DeepEqual(paths, want) {
+		t.Fatalf("watched paths after the rename: %q, expected %q", paths, want)
+	}
+}
+
+func TestInotifyCooperative(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	before := runtime.NumGoroutine()
+	watcher, err := NewCooperativeWatcher()
+	if err != nil {
+		t.Fatalf("NewCooperativeWatcher() failed: %s", err)
+	}
+	defer watcher.Close()
+	addWatch(t, watcher, testDir)
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("cooperative watcher started %d goroutines", after-before)
+	}
+
+	testFile := filepath.Join(testDir, "TestInotifyCooperative.testfile")
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+
+	// Nothing is delivered until polled
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		notices, err := watcher.Poll(context.Background())
+		if err != nil {
+			t.Fatalf("watcher.Poll() failed: %s", err)
+		}
+		for _, n := range notices {
+			if n.Err != nil {
+				t.Fatalf("error received: %s", n.Err)
+			}
+			if n.Event.Name == testFile && n.Event.IsCreate() {
+				watcher.Close()
+				if _, err := watcher.Poll(context.Background()); err == nil {
+					t.Fatal("watcher.Poll() succeeded once closed")
+				}
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no create event polled for %q", testFile)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestInotifyCooperativePending(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher, err := NewCooperativeWatcher()
+	if err != nil {
+		t.Fatalf("NewCooperativeWatcher() failed: %s", err)
+	}
+	watcher.SetPendingWatches(true)
+	first := filepath.Join(testDir, "TestInotifyCooperativePending.first")
+	second := filepath.Join(testDir, "TestInotifyCooperativePending.second")
+	for _, name := range []string{first, second} {
+		if err := watcher.Watch(name); err != nil {
+			t.Fatalf("watcher.Watch(%q) failed: %s", name, err)
+		}
+	}
+
+	// The create event of a promoted watch is picked up by Poll
+	if err := ioutil.WriteFile(first, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		notices, err := watcher.Poll(context.Background())
+		if err != nil {
+			t.Fatalf("watcher.Poll() failed: %s", err)
+		}
+		var created bool
+		for _, n := range notices {
+			if n.Err != nil {
+				t.Fatalf("error received: %s", n.Err)
+			}
+			created = created || n.Event.Name == first && n.Event.IsCreate()
+		}
+		if created {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no create event polled for %q", first)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Close does not wait for a Poll to take the event of another
+	if err := ioutil.WriteFile(second, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	closed := make(chan bool)
+	go func() {
+		watcher.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close of a cooperative watcher with a promoted pending watch did not return")
+	}
+}
+
+func TestInotifyRawMaskCookie(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	addWatch(t, watcher, testDir)
+
+	testFile := filepath.Join(testDir, "TestInotifyRawMaskCookie.testfile")
+	movedFile := filepath.Join(testDir, "TestInotifyRawMaskCookie.moved")
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	if err := os.Rename(testFile, movedFile); err != nil {
+		t.Fatalf("renaming test file failed: %s", err)
+	}
+
+	// The halves of the rename share their cookie
+	var from, to *FileEvent
+	timeout := time.After(time.Second)
+	for from == nil || to == nil {
+		select {
+		case ev := <-watcher.Event:
+			switch {
+			case ev.RawMask()&syscall.IN_MOVED_FROM != 0:
+				from = ev
+			case ev.RawMask()&syscall.IN_MOVED_TO != 0:
+				to = ev
+			}
+		case <-timeout:
+			t.Fatal("no rename events received")
+		}
+	}
+	if from.Name != testFile || to.Name != movedFile {
+		t.Fatalf("rename from %q to %q, expected from %q to %q", from.Name, to.Name, testFile, movedFile)
+	}
+	if from.Cookie() == 0 || from.Cookie() != to.Cookie() {
+		t.Fatalf("rename halves with cookies %d and %d, expected the same non-zero cookie", from.Cookie(), to.Cookie())
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"sync"
+	"time"
+)
+
+// IsLocked reports whether the file was still held by a writer when the
+// event was delivered, after the retries of LockWait.
+func (e *FileEvent) IsLocked() bool {
+	return e.locked
+}
+
+// LockWait returns middleware that holds create and modify events while
+// another process has the file open for writing, so that handlers do not
+// hit sharing violations opening it. The file is probed again every
+// interval, at most retries times; the event is then delivered anyway,
+// marked by IsLocked. Further create and modify events on a held file are
+// merged into the held event.
+//
+// Only Windows denies access to files open for writing; elsewhere files
+// never count as locked and events are not held.
+func LockWait(interval time.Duration, retries int) Middleware {
+	return lockWaitProbe(interval, retries, fileLocked)
+}
+
+// lockWaitProbe returns LockWait middleware probing files with locked.
+func lockWaitProbe(interval time.Duration, retries int, locked func(path string) bool) Middleware {
+	l := &lockWait{interval: interval, retries: retries, locked: locked, pending: make(map[string]*heldEvent)}
+	return func(next EventHandler) EventHandler {
+		return EventHandlerFunc(func(ev *FileEvent) {
+			l.handle(ev, next)
+		})
+	}
+}
+
+type lockWait struct {
+	interval time.Duration
+	retries  int
+	locked   func(path string) bool
+	mu       sync.Mutex            // Protects access to pending.
+	pending  map[string]*heldEvent // Held events (key: event name)
+}
+
+// A heldEvent is an event held while its file is locked.
+type heldEvent struct {
+	ev    *FileEvent
+	next  EventHandler
+	tries int
+	timer *time.Timer
+}
+
+func (l *lockWait) handle(ev *FileEvent, next EventHandler) {
+	l.mu.Lock()
+	h, held := l.pending[ev.Name]
+	if !ev.IsCreate() && !ev.IsModify() {
+		// Deliver the held event first, keeping the order of events
+		if held {
+			h.timer.Stop()
+			delete(l.pending, ev.Name)
+		}
+		l.mu.Unlock()
+		if held {
+			h.next.HandleEvent(h.ev)
+		}
+		next.HandleEvent(ev)
+		return
+	}
+	if held {
+		l.mu.Unlock()
+		return
+	}
+	if !l.locked(ev.Name) {
+		l.mu.Unlock()
+		next.HandleEvent(ev)
+		return
+	}
+	h = &heldEvent{ev: ev, next: next}
+	l.pending[ev.Name] = h
+	h.timer = time.AfterFunc(l.interval, func() { l.retry(h) })
+	l.mu.Unlock()
+}
+
+// retry delivers a held event once its file is unlocked or out of
+// retries, or probes it again later.
+func (l *lockWait) retry(h *heldEvent) {
+	locked := l.locked(h.ev.Name)
+	l.mu.Lock()
+	if l.pending[h.ev.Name] != h {
+		// Delivered already
+		l.mu.Unlock()
+		return
+	}
+	if h.tries++; locked && h.tries < l.retries {
+		h.timer.Reset(l.interval)
+		l.mu.Unlock()
+		return
+	}
+	delete(l.pending, h.ev.Name)
+	l.mu.Unlock()
+	h.ev.locked = locked
+	h.next.HandleEvent(h.ev)
+}
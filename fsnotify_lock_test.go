@@ -0,0 +1,72 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockWait(t *testing.T) {
+	var mu sync.Mutex
+	locked := map[string]bool{"written": true, "stuck": true}
+	probe := func(path string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return locked[path]
+	}
+	events := make(chan *FileEvent, 10)
+	h := lockWaitProbe(10*time.Millisecond, 5, probe)(EventHandlerFunc(func(ev *FileEvent) {
+		events <- ev
+	}))
+
+	// Unlocked files are not held
+	h.HandleEvent(newFileEvent("free", FSN_MODIFY))
+	if ev := <-events; ev.Name != "free" || ev.IsLocked() {
+		t.Fatalf("received %q (locked %v), expected %q unlocked", ev.Name, ev.IsLocked(), "free")
+	}
+
+	// Held until unlocked, merging later modifications
+	h.HandleEvent(newFileEvent("written", FSN_CREATE))
+	h.HandleEvent(newFileEvent("written", FSN_MODIFY))
+	h.HandleEvent(newFileEvent("stuck", FSN_MODIFY))
+	select {
+	case ev := <-events:
+		t.Fatalf("received %q while locked", ev.Name)
+	case <-time.After(20 * time.Millisecond):
+	}
+	mu.Lock()
+	locked["written"] = false
+	mu.Unlock()
+	if ev := <-events; ev.Name != "written" || !ev.IsCreate() || ev.IsLocked() {
+		t.Fatalf("received %q (create %v, locked %v), expected the create of %q unlocked", ev.Name, ev.IsCreate(), ev.IsLocked(), "written")
+	}
+
+	// Delivered anyway once out of retries
+	select {
+	case ev := <-events:
+		if ev.Name != "stuck" || !ev.IsLocked() {
+			t.Fatalf("received %q (locked %v), expected %q locked", ev.Name, ev.IsLocked(), "stuck")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("locked file never delivered")
+	}
+
+	// Other events deliver the held event first
+	h.HandleEvent(newFileEvent("stuck", FSN_MODIFY))
+	h.HandleEvent(newFileEvent("stuck", FSN_DELETE))
+	if ev := <-events; !ev.IsModify() {
+		t.Fatal("delete delivered before the held modification")
+	}
+	if ev := <-events; !ev.IsDelete() {
+		t.Fatal("delete not delivered")
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("received %q twice", ev.Name)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
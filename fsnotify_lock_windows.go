@@ -0,0 +1,30 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build windows
+
+package fsnotify
+
+import "syscall"
+
+const sys_ERROR_SHARING_VIOLATION = 32
+
+// fileLocked reports whether path is open for writing by another handle,
+// by opening it for reading while denying writes. Placeholders, which
+// opening may download, are not being written here.
+func fileLocked(path string) bool {
+	if isPlaceholder(path) {
+		return false
+	}
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return false
+	}
+	h, err := syscall.CreateFile(p, syscall.GENERIC_READ, syscall.FILE_SHARE_READ, nil, syscall.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return err == syscall.Errno(sys_ERROR_SHARING_VIOLATION)
+	}
+	syscall.CloseHandle(h)
+	return false
+}
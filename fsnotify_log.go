@@ -0,0 +1,172 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// A LogAppend reports data appended to a log file.
+type LogAppend struct {
+	Name    string // Path of the file
+	Offset  int64  // Offset of the new data
+	Size    int64  // Number of new bytes available from Offset
+	Rotated bool   // Set if the data starts over, in a new or truncated file
+}
+
+// A LogWatcher watches directories of append-only log files and reports
+// the data appended to them, keeping the offset read up to in each file.
+// Appends to a file not yet received are merged, so a slow reader gets
+// fewer, larger appends rather than falling behind.
+type LogWatcher struct {
+	Append chan *LogAppend // Appends are returned on this channel
+	Error  chan error      // Errors are sent on this channel
+
+	w       *Watcher
+	mu      sync.Mutex            // Protects access to files, renamed, pending and order.
+	files   map[string]logFile    // Map of log files (key: path)
+	renamed []logFile             // Files recently renamed, to find under their new names
+	pending map[string]*LogAppend // Map of appends not yet received (key: path)
+	order   []string              // Names of the pending appends, oldest first
+	wake    chan bool             // Signals new pending appends
+	done    chan bool             // Closed by Close
+	once    sync.Once
+}
+
+// A logFile is a log file and the offset reported up to.
+type logFile struct {
+	fi     os.FileInfo
+	offset int64
+}
+
+// maxRenamedLogs is the number of renamed files remembered.
+const maxRenamedLogs = 16
+
+// NewLogWatcher returns a LogWatcher with no directories watched.
+func NewLogWatcher() (*LogWatcher, error) {
+	w, err := NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	l := &LogWatcher{
+		Append:  make(chan *LogAppend),
+		Error:   w.Error,
+		w:       w,
+		files:   make(map[string]logFile),
+		pending: make(map[string]*LogAppend),
+		wake:    make(chan bool, 1),
+		done:    make(chan bool),
+	}
+	go l.sendAppends()
+	return l, nil
+}
+
+// Watch watches the log files in dir. Existing files are read from their
+// current end, and files created later from their start. A file rotated by
+// renaming it within the watched directories continues under its new name.
+func (l *LogWatcher) Watch(dir string) error {
+	if files, err := ioutil.ReadDir(dir); err == nil {
+		l.mu.Lock()
+		for _, fi := range files {
+			if fi.Mode().IsRegular() {
+				l.files[filepath.Join(dir, fi.Name())] = logFile{fi: fi, offset: fi.Size()}
+			}
+		}
+		l.mu.Unlock()
+	}
+	return l.w.WatchHandler(dir, FSN_CREATE|FSN_MODIFY|FSN_RENAME|FSN_DELETE, EventHandlerFunc(l.handleEvent))
+}
+
+// Close stops watching. Appends not yet received are dropped.
+func (l *LogWatcher) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return l.w.Close()
+}
+
+func (l *LogWatcher) handleEvent(ev *FileEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ev.IsDelete() || ev.IsRename() {
+		// Rotated away or removed; a new file may take the name
+		if f, found := l.files[ev.Name]; found && ev.IsRename() {
+			if l.renamed = append(l.renamed, f); len(l.renamed) > maxRenamedLogs {
+				l.renamed = l.renamed[1:]
+			}
+		}
+		delete(l.files, ev.Name)
+		return
+	}
+	fi, err := os.Stat(ev.Name)
+	if err != nil || !fi.Mode().IsRegular() {
+		return
+	}
+	f, known := l.files[ev.Name]
+	if ev.IsCreate() {
+		// A file renamed within the watched directories continues where
+		// it was read up to; any other file starts over
+		f, known = logFile{}, false
+		for i, r := range l.renamed {
+			if os.SameFile(r.fi, fi) {
+				f, known = r, true
+				l.renamed = append(l.renamed[:i], l.renamed[i+1:]...)
+				break
+			}
+		}
+	}
+	a := &LogAppend{Name: ev.Name, Offset: f.offset, Size: fi.Size() - f.offset}
+	if !known || fi.Size() < f.offset {
+		a.Offset, a.Size, a.Rotated = 0, fi.Size(), true
+	}
+	l.files[ev.Name] = logFile{fi: fi, offset: fi.Size()}
+	if a.Size == 0 && !a.Rotated {
+		return
+	}
+
+	if p, found := l.pending[ev.Name]; found {
+		if a.Rotated {
+			*p = *a
+		} else {
+			p.Size += a.Size
+		}
+		return
+	}
+	l.pending[ev.Name] = a
+	l.order = append(l.order, ev.Name)
+	select {
+	case l.wake <- true:
+	default:
+	}
+}
+
+// sendAppends delivers the pending appends until Close.
+func (l *LogWatcher) sendAppends() {
+	for {
+		select {
+		case <-l.wake:
+		case <-l.done:
+			return
+		}
+		for {
+			l.mu.Lock()
+			if len(l.order) == 0 {
+				l.mu.Unlock()
+				break
+			}
+			name := l.order[0]
+			l.order = l.order[1:]
+			a := l.pending[name]
+			delete(l.pending, name)
+			l.mu.Unlock()
+			select {
+			case l.Append <- a:
+			case <-l.done:
+				return
+			}
+		}
+	}
+}
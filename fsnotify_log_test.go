@@ -0,0 +1,90 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogWatcherAppends(t *testing.T) {
+	// Create directory with a log to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	logFile := filepath.Join(testDir, "app.log")
+	if err := ioutil.WriteFile(logFile, []byte("old line\n"), 0666); err != nil {
+		t.Fatalf("writing test file failed: %s", err)
+	}
+
+	l, err := NewLogWatcher()
+	if err != nil {
+		t.Fatalf("NewLogWatcher() failed: %s", err)
+	}
+	defer l.Close()
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range l.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	if err := l.Watch(testDir); err != nil {
+		t.Fatalf("watching %q failed: %s", testDir, err)
+	}
+
+	f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		t.Fatalf("opening test file failed: %s", err)
+	}
+	for i := 0; i < 10; i++ {
+		f.WriteString("new line\n")
+		f.Sync()
+	}
+	f.Close()
+
+	// Appends not yet received are merged, so let them pile up
+	time.Sleep(500 * time.Millisecond)
+	var offset, size int64
+	for size < 90 {
+		select {
+		case a := <-l.Append:
+			t.Logf("append received: %+v", *a)
+			if size == 0 {
+				offset = a.Offset
+			}
+			if a.Name != logFile || a.Offset != offset+size || a.Rotated {
+				t.Fatalf("append %+v does not follow offset %d", *a, offset+size)
+			}
+			size += a.Size
+		case <-time.After(500 * time.Millisecond):
+			t.Fatalf("appends stopped at %d of %d bytes", size, 90)
+		}
+	}
+	if offset != int64(len("old line\n")) || size != 90 {
+		t.Fatalf("appends cover %d bytes from %d, want %d from %d", size, offset, 90, len("old line\n"))
+	}
+
+	// Rotation: the log is renamed away and a new one starts over
+	if err := os.Rename(logFile, logFile+".1"); err != nil {
+		t.Fatalf("rotating test file failed: %s", err)
+	}
+	if err := ioutil.WriteFile(logFile, []byte("first\n"), 0666); err != nil {
+		t.Fatalf("writing test file failed: %s", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	select {
+	case a := <-l.Append:
+		if a.Name != logFile || a.Offset != 0 || !a.Rotated {
+			t.Fatalf("append after rotation is %+v, want a rotated append at 0", *a)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("no append received after rotation")
+	}
+}
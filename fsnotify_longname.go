@@ -0,0 +1,15 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+// SetLongNames resolves the short (8.3) names Windows reports for files
+// created or changed through them, such as PROGRA~1, to their long names
+// before delivering events, so that events match the names watched. Names
+// are cached, to resolve those of files deleted or renamed since. The
+// watched paths themselves are kept as given. Other platforms have no
+// short names.
+func (w *Watcher) SetLongNames(enable bool) {
+	w.setLongNames(enable)
+}
@@ -0,0 +1,83 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build windows
+
+package fsnotify
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// maxLongNames is the number of long names remembered.
+const maxLongNames = 4096
+
+func (w *Watcher) setLongNames(enable bool) {
+	w.longNames.mu.Lock()
+	w.longNames.enabled = enable
+	w.longNames.names = nil
+	w.longNames.mu.Unlock()
+}
+
+// A longNameCache resolves short names to long names.
+type longNameCache struct {
+	mu      sync.Mutex        // Protects access to enabled and names.
+	enabled bool              // Set if short names are resolved (see SetLongNames)
+	names   map[string]string // Map of paths ending in a short name to the long name
+}
+
+// resolve returns name, relative to the watched directory dir, with the
+// short names in it replaced by long names.
+func (c *longNameCache) resolve(dir, name string) string {
+	if !strings.Contains(name, "~") {
+		return name
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.enabled {
+		return name
+	}
+	parts := strings.Split(name, `\`)
+	for i, part := range parts {
+		if !strings.Contains(part, "~") {
+			continue
+		}
+		path := dir + `\` + strings.Join(parts[:i+1], `\`)
+		long, found := c.names[path]
+		if !found {
+			long = longName(path)
+			if long == "" {
+				// Gone, and never seen
+				continue
+			}
+			if len(c.names) >= maxLongNames {
+				c.names = nil
+			}
+			if c.names == nil {
+				c.names = make(map[string]string)
+			}
+			c.names[path] = long
+		}
+		parts[i] = long
+	}
+	return strings.Join(parts, `\`)
+}
+
+// longName returns the long name of the last element of path, or "" if it
+// cannot be told.
+func longName(path string) string {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return ""
+	}
+	buf := make([]uint16, maxPathLen)
+	n, err := syscall.GetLongPathName(p, &buf[0], uint32(len(buf)))
+	if err != nil || int(n) > len(buf) {
+		return ""
+	}
+	return filepath.Base(syscall.UTF16ToString(buf[:n]))
+}
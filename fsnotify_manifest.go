@@ -0,0 +1,168 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A ManifestWatcher watches the files listed in a manifest file and
+// follows changes to the manifest itself.
+//
+// The manifest lists one file per line. Blank lines and lines starting
+// with '#' are ignored, and relative paths are relative to the directory
+// of the manifest. Files are watched through their parent directories, so
+// events keep arriving after a file is deleted and recreated (eg. by
+// logrotate or an atomic save).
+type ManifestWatcher struct {
+	Event    chan *FileEvent // Events for the listed files are returned on this channel
+	Error    chan error      // Errors are sent on this channel
+	manifest string          // Path of the manifest
+	w        *Watcher        // Watcher for the parent directories
+	mu       sync.Mutex      // Protects access to files and dirs.
+	files    map[string]bool // Set of listed files (cleaned paths)
+	dirs     map[string]bool // Set of watched directories
+}
+
+// WatchManifest reads the manifest at path and watches each file it lists.
+// When the manifest changes, it is read again and the watched set is
+// adjusted.
+func WatchManifest(path string) (*ManifestWatcher, error) {
+	w, err := NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	m := &ManifestWatcher{
+		Event:    make(chan *FileEvent),
+		Error:    make(chan error),
+		manifest: filepath.Clean(path),
+		w:        w,
+		files:    make(map[string]bool),
+		dirs:     make(map[string]bool),
+	}
+	if err := m.reload(); err != nil {
+		w.Close()
+		return nil, err
+	}
+	go m.readEvents()
+	return m, nil
+}
+
+// Files returns the files currently listed in the manifest.
+func (m *ManifestWatcher) Files() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	files := make([]string, 0, len(m.files))
+	for file := range m.files {
+		files = append(files, file)
+	}
+	return files
+}
+
+// Close stops watching the manifest and the files it lists.
+func (m *ManifestWatcher) Close() error {
+	return m.w.Close()
+}
+
+// readManifest returns the cleaned paths listed in the manifest.
+func readManifest(manifest string) (map[string]bool, error) {
+	f, err := os.Open(manifest)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	files := make(map[string]bool)
+	base := filepath.Dir(manifest)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(base, line)
+		}
+		files[filepath.Clean(line)] = true
+	}
+	return files, scanner.Err()
+}
+
+// reload reads the manifest and watches the directories of the files it
+// lists, removing watches on directories that are no longer needed.
+func (m *ManifestWatcher) reload() error {
+	files, err := readManifest(m.manifest)
+	if err != nil {
+		return err
+	}
+
+	dirs := map[string]bool{filepath.Dir(m.manifest): true}
+	for file := range files {
+		dirs[filepath.Dir(file)] = true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files = files
+	var firstErr error
+	for dir := range dirs {
+		if m.dirs[dir] {
+			continue
+		}
+		if err := m.w.Watch(dir); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		m.dirs[dir] = true
+	}
+	for dir := range m.dirs {
+		if !dirs[dir] {
+			m.w.RemoveWatch(dir)
+			delete(m.dirs, dir)
+		}
+	}
+	return firstErr
+}
+
+// readEvents forwards events for the listed files and reloads the
+// manifest when it changes.
+func (m *ManifestWatcher) readEvents() {
+	events, errs := m.w.Event, m.w.Error
+	for events != nil || errs != nil {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			name := filepath.Clean(ev.Name)
+			if name == m.manifest && (ev.IsCreate() || ev.IsModify()) {
+				if err := m.reload(); err != nil {
+					m.Error <- err
+				}
+			}
+			m.mu.Lock()
+			listed := m.files[name]
+			m.mu.Unlock()
+			if listed {
+				m.Event <- ev
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			m.Error <- err
+		}
+	}
+	close(m.Event)
+	close(m.Error)
+}
@@ -0,0 +1,103 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFsnotifyWatchManifest(t *testing.T) {
+	// Create directory with the manifest and the listed files
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	testFileA := filepath.Join(testDir, "TestFsnotifyManifestA.testfile")
+	testFileB := filepath.Join(testDir, "TestFsnotifyManifestB.testfile")
+	manifest := filepath.Join(testDir, "manifest")
+	for _, name := range []string{testFileA, testFileB} {
+		if err := ioutil.WriteFile(name, []byte("data"), 0666); err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+	}
+	if err := ioutil.WriteFile(manifest, []byte("# comment\nTestFsnotifyManifestA.testfile\n"), 0666); err != nil {
+		t.Fatalf("creating manifest failed: %s", err)
+	}
+
+	watcher, err := WatchManifest(manifest)
+	if err != nil {
+		t.Fatalf("WatchManifest(%q) failed: %s", manifest, err)
+	}
+	defer watcher.Close()
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	var aReceived, bReceived counter
+	go func() {
+		for event := range watcher.Event {
+			switch event.Name {
+			case filepath.Clean(testFileA):
+				aReceived.increment()
+			case filepath.Clean(testFileB):
+				bReceived.increment()
+			default:
+				t.Logf("unexpected event received: %s", event)
+			}
+		}
+	}()
+
+	// Only the listed file is reported, even after it is replaced
+	if err := ioutil.WriteFile(testFileB, []byte("more data"), 0666); err != nil {
+		t.Fatalf("writing test file failed: %s", err)
+	}
+	if err := os.Remove(testFileA); err != nil {
+		t.Fatalf("removing test file failed: %s", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := ioutil.WriteFile(testFileA, []byte("more data"), 0666); err != nil {
+		t.Fatalf("writing test file failed: %s", err)
+	}
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if aReceived.value() < 2 {
+		t.Fatalf("did not receive events for the listed file after it was replaced (%d)", aReceived.value())
+	}
+	if bReceived.value() != 0 {
+		t.Fatalf("received events for a file not listed in the manifest (%d)", bReceived.value())
+	}
+
+	// Changing the manifest changes the watched set
+	if err := ioutil.WriteFile(manifest, []byte(testFileB+"\n"), 0666); err != nil {
+		t.Fatalf("rewriting manifest failed: %s", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	files := watcher.Files()
+	if len(files) != 1 || files[0] != filepath.Clean(testFileB) {
+		t.Fatalf("manifest was not reloaded, watching %v", files)
+	}
+	aReceived.reset()
+	if err := ioutil.WriteFile(testFileB, []byte("data"), 0666); err != nil {
+		t.Fatalf("writing test file failed: %s", err)
+	}
+	if err := ioutil.WriteFile(testFileA, []byte("data"), 0666); err != nil {
+		t.Fatalf("writing test file failed: %s", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if bReceived.value() == 0 {
+		t.Fatal("did not receive events for the newly listed file after 500 ms")
+	}
+	if aReceived.value() != 0 {
+		t.Fatalf("received events for a file removed from the manifest (%d)", aReceived.value())
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// A MockWatcher is a Watcher whose watches are only recorded, for testing
+// the handling of events without touching the file system. Events and
+// errors are injected instead, and reach the Event and Error channels, the
+// handlers and the middleware of the watcher as those of the file system
+// would: events for paths not watched, or not selected by the flags of
+// their watch, are dropped.
+type MockWatcher struct {
+	*Watcher
+}
+
+// A MockCall is a call of Watch or RemoveWatch recorded by a MockWatcher.
+type MockCall struct {
+	Op   string // "Watch" or "RemoveWatch"
+	Path string // Path as passed to the backend, after SetRoot resolved it
+}
+
+// NewMockWatcher creates and returns a new mock watcher. Watch, WatchFlags
+// and the like record their paths rather than watching them, so the paths
+// need not exist; WatchTree still walks the tree but on Windows.
+func NewMockWatcher() (*MockWatcher, error) {
+	w, err := NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w.mock = &mockBackend{watched: make(map[string]bool), errs: make(map[string]error)}
+	return &MockWatcher{w}, nil
+}
+
+// Inject delivers an event for name, as if triggered by the given
+// notifications (FSN_CREATE etc.) It returns once the event is queued for
+// delivery, and must not be called after Close.
+func (m *MockWatcher) Inject(name string, flags uint32) {
+	m.internalEvent <- newFileEvent(name, flags)
+}
+
+// InjectError sends err on the Error channel, or on the ordered stream
+// behind the events injected before it (see Ordered). It must not be
+// called after Close.
+func (m *MockWatcher) InjectError(err error) {
+	m.sendError(err)
+}
+
+// SetWatchError makes later watches of path fail with err, or succeed
+// again if err is nil.
+func (m *MockWatcher) SetWatchError(path string, err error) {
+	b := m.mock
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		delete(b.errs, path)
+		return
+	}
+	b.errs[path] = err
+}
+
+// Watched returns the watched paths, sorted.
+func (m *MockWatcher) Watched() []string {
+	b := m.mock
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	paths := make([]string, 0, len(b.watched))
+	for path := range b.watched {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Calls returns the calls of Watch and RemoveWatch so far, in order. Calls
+// for duplicates of watched paths (see SetDuplicatePolicy) do not reach
+// the backend and are not recorded.
+func (m *MockWatcher) Calls() []MockCall {
+	b := m.mock
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]MockCall(nil), b.calls...)
+}
+
+// A mockBackend records the watches of a MockWatcher.
+type mockBackend struct {
+	mu      sync.Mutex       // Protects access to the fields below.
+	watched map[string]bool  // Set of watched paths
+	errs    map[string]error // Map of paths to the errors of watching them (see SetWatchError)
+	calls   []MockCall       // Calls so far
+}
+
+func (b *mockBackend) watch(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, MockCall{Op: "Watch", Path: path})
+	if err := b.errs[path]; err != nil {
+		return err
+	}
+	b.watched[path] = true
+	return nil
+}
+
+func (b *mockBackend) removeWatch(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, MockCall{Op: "RemoveWatch", Path: path})
+	if !b.watched[path] {
+		return errors.New(fmt.Sprintf("can't remove non-existent mock watch for: %s", path))
+	}
+	delete(b.watched, path)
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMockWatcher(t *testing.T) {
+	watcher, err := NewMockWatcher()
+	if err != nil {
+		t.Fatalf("NewMockWatcher() failed: %s", err)
+	}
+	defer watcher.Close()
+
+	// The paths need not exist
+	dir := filepath.Join("no", "such", "dir")
+	file := filepath.Join(dir, "file")
+	if err := watcher.WatchFlags(dir, FSN_CREATE); err != nil {
+		t.Fatalf("watcher.WatchFlags(%q) failed: %s", dir, err)
+	}
+	failed := errors.New("no space left on device")
+	watcher.SetWatchError("other", failed)
+	if err := watcher.Watch("other"); err != failed {
+		t.Fatalf("watcher.Watch(\"other\") returned %v, expected %v", err, failed)
+	}
+	if got, want := watcher.Watched(), []string{dir}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("watched %q, expected %q", got, want)
+	}
+
+	// Modifies are not selected by the flags of the watch
+	go func() {
+		watcher.Inject(file, FSN_MODIFY)
+		watcher.Inject(file, FSN_CREATE)
+		watcher.InjectError(failed)
+	}()
+	select {
+	case ev := <-watcher.Event:
+		if ev.Name != file || !ev.IsCreate() {
+			t.Fatalf("received %s, expected a create of %q", ev, file)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+	select {
+	case err := <-watcher.Error:
+		if err != failed {
+			t.Fatalf("received error %v, expected %v", err, failed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no error received")
+	}
+
+	if err := watcher.RemoveWatch(dir); err != nil {
+		t.Fatalf("watcher.RemoveWatch(%q) failed: %s", dir, err)
+	}
+	if err := watcher.RemoveWatch(dir); err == nil {
+		t.Fatalf("removing %q twice succeeded", dir)
+	}
+	want := []MockCall{{"Watch", dir}, {"Watch", "other"}, {"RemoveWatch", dir}, {"RemoveWatch", dir}}
+	if got := watcher.Calls(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("calls %v, expected %v", got, want)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"errors"
+	"path/filepath"
+)
+
+// errNoFanotify is returned by watchMount when fanotify is not available.
+var errNoFanotify = errors.New("fsnotify: fanotify not available")
+
+// WatchMount watches every file below path, typically the mount point of a
+// large file system. On Linux this is a single fanotify mark on the file
+// system, rather than an inotify watch per directory, so it is not bound by
+// the inotify limits and directories created later are watched too.
+//
+// fanotify needs CAP_SYS_ADMIN and Linux 5.9 or later; without them, and on
+// other platforms, WatchMount falls back to WatchTree(path, nil), limited
+// by SetTreeDepth.
+func (w *Watcher) WatchMount(path string) error {
+	path, err := w.checkPath(path)
+	if err != nil {
+		return err
+	}
+	path = filepath.Clean(path)
+	if err := w.addPath(path, FSN_ALL, nil, w.watchMount); err != errNoFanotify {
+		return err
+	}
+	return w.addTree(path, nil, nil, nil)
+}
@@ -0,0 +1,319 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package fsnotify
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	// Flags for fanotify_init() and fanotify_mark(); not in the syscall package
+	sys_FAN_CLOEXEC          = 0x1
+	sys_FAN_NONBLOCK         = 0x2
+	sys_FAN_REPORT_DFID_NAME = 0x400 | 0x800 // FAN_REPORT_DIR_FID | FAN_REPORT_NAME
+	sys_FAN_MARK_ADD         = 0x1
+	sys_FAN_MARK_FILESYSTEM  = 0x100
+
+	// Events, with the values of their inotify counterparts
+	sys_FAN_EVENTS = syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+		syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+	sys_FAN_ONDIR = syscall.IN_ISDIR
+
+	// Types of the information records following an event
+	sys_FAN_EVENT_INFO_TYPE_DFID_NAME = 2
+	sys_FAN_EVENT_INFO_TYPE_DFID      = 3
+
+	// Sizes of struct fanotify_event_metadata, the header of information
+	// records with the fsid, and struct file_handle without f_handle
+	sizeofFanotifyEvent = 24
+	sizeofFanotifyInfo  = 4 + 8
+	sizeofFileHandle    = 8
+
+	// maxMountDirs is the number of directory handles remembered, to name
+	// events in directories deleted before they are read.
+	maxMountDirs = 4096
+)
+
+// sysOpenByHandleAt are the numbers of open_by_handle_at(), which predates
+// the common numbering of system calls, on the architectures supported.
+var sysOpenByHandleAt = map[string]uintptr{
+	"386":     342,
+	"amd64":   304,
+	"arm":     371,
+	"arm64":   265,
+	"loong64": 265,
+	"ppc64":   346,
+	"ppc64le": 346,
+	"riscv64": 265,
+	"s390x":   336,
+}
+
+// A mountTable records the file systems watched with fanotify.
+type mountTable struct {
+	mu     sync.Mutex             // Protects access to mounts and procs.
+	mounts map[string]*mountWatch // Map of watched paths to their fanotify instances
+	procs  bool                   // Set if the processes causing events are reported (see SetProcessTracking)
+}
+
+// A mountWatch is the fanotify instance watching the files below a path.
+type mountWatch struct {
+	root string
+	f    *os.File          // fanotify file descriptor, closed to stop reading
+	dir  int               // File descriptor of root, to open handles with
+	dirs map[string]string // Map of directory handles to their paths
+	stop chan bool         // Closed to stop reading
+	done chan bool         // Closed when reading has stopped
+}
+
+// watchMount watches the file system of path with fanotify, reporting the
+// events below path.
+func (w *Watcher) watchMount(path string) error {
+	if _, found := sysOpenByHandleAt[runtime.GOARCH]; !found {
+		return errNoFanotify
+	}
+	// The reader of the mount and its buffer
+	if err := w.budget.reserve(path, budgetCost{goroutines: 1, memory: mountBufSize}); err != nil {
+		return err
+	}
+	fd, _, errno := syscall.Syscall(syscall.SYS_FANOTIFY_INIT, sys_FAN_CLOEXEC|sys_FAN_NONBLOCK|sys_FAN_REPORT_DFID_NAME,
+		syscall.O_RDONLY|syscall.O_LARGEFILE, 0)
+	if errno != 0 {
+		return fanotifyError("fanotify_init", errno)
+	}
+	dir, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		syscall.Close(int(fd))
+		return err
+	}
+	// Mark the file system of the directory open as dir
+	if errno := fanotifyMark(fd, sys_FAN_MARK_ADD|sys_FAN_MARK_FILESYSTEM, sys_FAN_EVENTS|sys_FAN_ONDIR, dir); errno != 0 {
+		syscall.Close(dir)
+		syscall.Close(int(fd))
+		return fanotifyError("fanotify_mark", errno)
+	}
+
+	m := &mountWatch{
+		root: path,
+		f:    os.NewFile(fd, "fanotify"), // Non-blocking, so Close interrupts Read
+		dir:  dir,
+		dirs: make(map[string]string),
+		stop: make(chan bool),
+		done: make(chan bool),
+	}
+	w.mounts.mu.Lock()
+	if w.mounts.mounts == nil {
+		w.mounts.mounts = make(map[string]*mountWatch)
+	}
+	old := w.mounts.mounts[path]
+	w.mounts.mounts[path] = m
+	w.mounts.mu.Unlock()
+	if old != nil {
+		old.close()
+	}
+	go w.readMount(m)
+	return nil
+}
+
+func (w *Watcher) setProcessTracking(enable bool) {
+	w.mounts.mu.Lock()
+	w.mounts.procs = enable
+	w.mounts.mu.Unlock()
+}
+
+// procUID returns the effective user ID of the process pid, or -1 if it
+// has exited.
+func procUID(pid int) int {
+	status, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/status")
+	if err != nil {
+		return -1
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		// Real, effective, saved and file system user IDs
+		if fields := strings.Fields(line); len(fields) >= 3 && fields[0] == "Uid:" {
+			if uid, err := strconv.Atoi(fields[2]); err == nil {
+				return uid
+			}
+		}
+	}
+	return -1
+}
+
+// fanotifyMark calls fanotify_mark() without a path, relative to dirfd.
+// The 64-bit mask takes two arguments on 32-bit architectures.
+func fanotifyMark(fd uintptr, flags uint, mask uint64, dirfd int) syscall.Errno {
+	var errno syscall.Errno
+	if unsafe.Sizeof(uintptr(0)) == 4 {
+		// The supported 32-bit architectures are little endian
+		_, _, errno = syscall.Syscall6(syscall.SYS_FANOTIFY_MARK, fd, uintptr(flags), uintptr(mask), uintptr(mask>>32),
+			uintptr(dirfd), 0)
+	} else {
+		_, _, errno = syscall.Syscall6(syscall.SYS_FANOTIFY_MARK, fd, uintptr(flags), uintptr(mask), uintptr(dirfd), 0, 0)
+	}
+	return errno
+}
+
+// fanotifyError returns errNoFanotify if the error means fanotify cannot
+// be used here, for lack of privileges or kernel support.
+func fanotifyError(call string, errno syscall.Errno) error {
+	switch errno {
+	case syscall.EPERM, syscall.ENOSYS, syscall.EINVAL, syscall.ENODEV, syscall.EXDEV, syscall.EOPNOTSUPP:
+		return errNoFanotify
+	}
+	return os.NewSyscallError(call, errno)
+}
+
+// remove stops watching path with fanotify. It reports whether path was
+// watched with fanotify.
+func (t *mountTable) remove(path string) bool {
+	t.mu.Lock()
+	m, found := t.mounts[path]
+	delete(t.mounts, path)
+	t.mu.Unlock()
+	if found {
+		m.close()
+	}
+	return found
+}
+
+// close stops all fanotify instances, before the watcher is closed.
+func (t *mountTable) close() {
+	t.mu.Lock()
+	mounts := t.mounts
+	t.mounts = nil
+	t.mu.Unlock()
+	for _, m := range mounts {
+		m.close()
+	}
+}
+
+func (m *mountWatch) close() {
+	close(m.stop)
+	m.f.Close()
+	<-m.done
+	syscall.Close(m.dir)
+}
+
+// mountBufSize is the size of the buffer for reading fanotify events.
+const mountBufSize = 64 * 1024
+
+// readMount sends the events of m below its root until it is closed.
+func (w *Watcher) readMount(m *mountWatch) {
+	defer close(m.done)
+	buf := make([]byte, mountBufSize)
+	for {
+		n, err := m.f.Read(buf)
+		if err != nil {
+			select {
+			case <-m.stop:
+			default:
+				w.sendError(err)
+			}
+			return
+		}
+		stamp := time.Now()
+		for offset := 0; offset+sizeofFanotifyEvent <= n; {
+			eventLen := int(binary.LittleEndian.Uint32(buf[offset:]))
+			if eventLen < sizeofFanotifyEvent || offset+eventLen > n {
+				break
+			}
+			w.sendMountEvent(m, buf[offset:offset+eventLen], stamp)
+			offset += eventLen
+		}
+	}
+}
+
+// sendMountEvent queues the raw fanotify event, read at stamp, if it lies
+// below the root of m.
+func (w *Watcher) sendMountEvent(m *mountWatch, raw []byte, stamp time.Time) {
+	mask := uint32(*(*uint64)(unsafe.Pointer(&raw[8])))
+	metadataLen := int(*(*uint16)(unsafe.Pointer(&raw[6])))
+	if metadataLen < sizeofFanotifyEvent || metadataLen+sizeofFanotifyInfo+sizeofFileHandle > len(raw) {
+		return
+	}
+	info := raw[metadataLen:]
+	infoType := info[0]
+	if infoType != sys_FAN_EVENT_INFO_TYPE_DFID_NAME && infoType != sys_FAN_EVENT_INFO_TYPE_DFID {
+		return
+	}
+	handle := info[sizeofFanotifyInfo:]
+	handleLen := sizeofFileHandle + int(*(*uint32)(unsafe.Pointer(&handle[0])))
+	if handleLen > len(handle) {
+		return
+	}
+	dir, ok := m.dirPath(handle[:handleLen])
+	if !ok {
+		return
+	}
+	name := dir
+	if infoType == sys_FAN_EVENT_INFO_TYPE_DFID_NAME {
+		// The name follows the handle, NUL terminated
+		base := handle[handleLen:]
+		if i := strings.IndexByte(string(base), 0); i >= 0 {
+			base = base[:i]
+		}
+		if len(base) > 0 && string(base) != "." {
+			name = strings.TrimSuffix(dir, "/") + "/" + string(base)
+		}
+	}
+	if name != m.root && !strings.HasPrefix(name, strings.TrimSuffix(m.root, "/")+"/") {
+		return
+	}
+
+	event := &FileEvent{mask: mask, Name: name, dir: mask&sys_FAN_ONDIR == sys_FAN_ONDIR, stamp: stamp}
+	if event.ignoreLinux() {
+		return
+	}
+	w.mounts.mu.Lock()
+	procs := w.mounts.procs
+	w.mounts.mu.Unlock()
+	if procs {
+		pid := int(*(*int32)(unsafe.Pointer(&raw[20])))
+		event.proc = &Process{PID: pid, UID: procUID(pid)}
+	}
+	// Inherit fsnFlags from the watched root
+	w.fsnmut.Lock()
+	if _, found := w.fsnFlags[name]; !found {
+		flags, found := w.fsnFlags[m.root]
+		if !found {
+			w.fsnmut.Unlock()
+			return
+		}
+		w.fsnFlags[name] = flags
+	}
+	w.fsnmut.Unlock()
+	w.queueStop(event, m.stop)
+}
+
+// dirPath returns the path of the directory with the file handle, or the
+// path it last had if it has been deleted.
+func (m *mountWatch) dirPath(handle []byte) (string, bool) {
+	fd, _, errno := syscall.Syscall(sysOpenByHandleAt[runtime.GOARCH], uintptr(m.dir), uintptr(unsafe.Pointer(&handle[0])),
+		syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC)
+	if errno != 0 {
+		path, found := m.dirs[string(handle)]
+		return path, found
+	}
+	path, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(int(fd)))
+	syscall.Close(int(fd))
+	if err != nil {
+		return "", false
+	}
+	if len(m.dirs) >= maxMountDirs {
+		m.dirs = make(map[string]string)
+	}
+	m.dirs[string(handle)] = path
+	return path, true
+}
@@ -0,0 +1,15 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package fsnotify
+
+// fanotify is Linux only; WatchMount watches the tree instead.
+func (w *Watcher) watchMount(path string) error {
+	return errNoFanotify
+}
+
+// Only fanotify reports the processes causing events.
+func (w *Watcher) setProcessTracking(enable bool) {}
@@ -0,0 +1,192 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// moveHashSize is the size of the head of a file hashed to identify it.
+const moveHashSize = 4096
+
+// SetMoveCorrelation enables pairing a file deleted in one place with a
+// file of the same size, modification time and leading content created in
+// another within window, as when a file is moved across file systems by
+// copying and deleting it. After the second event of a pair, a probable
+// move event is delivered for the new name (see FileEvent.ProbableMove).
+// A window of zero disables it.
+//
+// Enable it before adding watches so the existing files are known. Each
+// known file is read up to its first 4 KiB when it is seen.
+func (w *Watcher) SetMoveCorrelation(window time.Duration) {
+	w.moves.setWindow(window)
+}
+
+// ProbableMove reports whether the event pairs a deleted and a created
+// file that are probably the same file moved, and returns the name it was
+// moved from. The event is named after the created file.
+func (e *FileEvent) ProbableMove() (from string, ok bool) {
+	return e.movedFrom, e.movedFrom != ""
+}
+
+// A fileSignature identifies the content of a file without keeping it.
+type fileSignature struct {
+	size    int64
+	modTime time.Time
+	head    [sha256.Size]byte // Hash of the first moveHashSize bytes
+}
+
+func signFile(name string) (fileSignature, bool) {
+	if isPlaceholder(name) {
+		// Reading it would download it
+		return fileSignature{}, false
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return fileSignature{}, false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return fileSignature{}, false
+	}
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, moveHashSize); err != nil && err != io.EOF {
+		return fileSignature{}, false
+	}
+	sig := fileSignature{size: fi.Size(), modTime: fi.ModTime()}
+	copy(sig.head[:], h.Sum(nil))
+	return sig, true
+}
+
+func (s fileSignature) equal(o fileSignature) bool {
+	return s.size == o.size && s.modTime.Equal(o.modTime) && bytes.Equal(s.head[:], o.head[:])
+}
+
+// A moveCandidate is a file created or deleted recently.
+type moveCandidate struct {
+	sig fileSignature
+	at  time.Time
+}
+
+// A moveTable records the known files and the recent creations and
+// deletions, to pair them into probable moves.
+type moveTable struct {
+	mu      sync.Mutex               // Protects access to the fields below.
+	window  time.Duration            // Longest time between the events of a pair (zero when disabled)
+	files   map[string]fileSignature // Map of known files (key: path)
+	created map[string]moveCandidate // Map of recently created files (key: path)
+	deleted map[string]moveCandidate // Map of recently deleted files (key: path)
+}
+
+func (t *moveTable) setWindow(window time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.window = window
+	if window <= 0 {
+		t.files, t.created, t.deleted = nil, nil, nil
+	} else if t.files == nil {
+		t.files = make(map[string]fileSignature)
+		t.created = make(map[string]moveCandidate)
+		t.deleted = make(map[string]moveCandidate)
+	}
+}
+
+// snapshot records a newly watched file, or the files in a newly watched
+// directory.
+func (t *moveTable) snapshot(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.files == nil {
+		return
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	names := []string{path}
+	if fi.IsDir() {
+		files, err := ioutil.ReadDir(path)
+		if err != nil {
+			return
+		}
+		names = names[:0]
+		for _, fi := range files {
+			names = append(names, filepath.Join(path, fi.Name()))
+		}
+	}
+	for _, name := range names {
+		if sig, ok := signFile(name); ok {
+			t.files[name] = sig
+		}
+	}
+}
+
+// update records the file an event refers to. If the event completes a
+// probable move, it returns the event reporting the move.
+func (t *moveTable) update(ev *FileEvent) *FileEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.files == nil {
+		return nil
+	}
+	now := time.Now()
+	for name, c := range t.created {
+		if now.Sub(c.at) > t.window {
+			delete(t.created, name)
+		}
+	}
+	for name, c := range t.deleted {
+		if now.Sub(c.at) > t.window {
+			delete(t.deleted, name)
+		}
+	}
+
+	if ev.IsDelete() || ev.IsRename() {
+		sig, found := t.files[ev.Name]
+		delete(t.files, ev.Name)
+		delete(t.created, ev.Name)
+		if !found {
+			return nil
+		}
+		for name, c := range t.created {
+			if name != ev.Name && c.sig.equal(sig) {
+				delete(t.created, name)
+				return &FileEvent{Name: name, movedFrom: ev.Name, stamp: ev.stamp}
+			}
+		}
+		t.deleted[ev.Name] = moveCandidate{sig: sig, at: now}
+		return nil
+	}
+
+	if !ev.IsCreate() && !ev.IsModify() {
+		return nil
+	}
+	sig, ok := signFile(ev.Name)
+	if !ok {
+		return nil
+	}
+	t.files[ev.Name] = sig
+	// A copy is written after its creation; keep its signature current
+	if _, found := t.created[ev.Name]; !ev.IsCreate() && !found {
+		return nil
+	}
+	for name, c := range t.deleted {
+		if name != ev.Name && c.sig.equal(sig) {
+			delete(t.deleted, name)
+			delete(t.created, ev.Name)
+			return &FileEvent{Name: ev.Name, movedFrom: name, stamp: ev.stamp}
+		}
+	}
+	t.created[ev.Name] = moveCandidate{sig: sig, at: now}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFsnotifyMoveCorrelation(t *testing.T) {
+	// Create two directories to watch, standing for two file systems
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	srcDir := filepath.Join(testDir, "src")
+	dstDir := filepath.Join(testDir, "dst")
+	for _, dir := range []string{srcDir, dstDir} {
+		if err := os.Mkdir(dir, 0777); err != nil {
+			t.Fatalf("creating test directory failed: %s", err)
+		}
+	}
+	srcFile := filepath.Join(srcDir, "TestFsnotifyMoveCorrelation.testfile")
+	otherFile := filepath.Join(srcDir, "TestFsnotifyMoveCorrelation.other")
+	dstFile := filepath.Join(dstDir, "TestFsnotifyMoveCorrelation.testfile")
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, name := range []string{srcFile, otherFile} {
+		if err := ioutil.WriteFile(name, []byte("content of "+filepath.Base(name)), 0666); err != nil {
+			t.Fatalf("writing test file failed: %s", err)
+		}
+		if err := os.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatalf("setting times of test file failed: %s", err)
+		}
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetMoveCorrelation(time.Second)
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	var moveReceived counter
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			if from, ok := event.ProbableMove(); ok {
+				if event.Name != dstFile || from != srcFile {
+					t.Errorf("probable move from %s to %s, want from %s to %s", from, event.Name, srcFile, dstFile)
+				}
+				moveReceived.increment()
+			}
+		}
+	}()
+
+	addWatch(t, watcher, srcDir)
+	addWatch(t, watcher, dstDir)
+
+	// Move across "file systems" as mv does: copy, keep the times, delete
+	data, err := ioutil.ReadFile(srcFile)
+	if err != nil {
+		t.Fatalf("reading test file failed: %s", err)
+	}
+	if err := ioutil.WriteFile(dstFile, data, 0666); err != nil {
+		t.Fatalf("writing test file failed: %s", err)
+	}
+	if err := os.Chtimes(dstFile, mtime, mtime); err != nil {
+		t.Fatalf("setting times of test file failed: %s", err)
+	}
+	if err := os.Remove(srcFile); err != nil {
+		t.Fatalf("removing test file failed: %s", err)
+	}
+	// A file that was not copied is not paired
+	if err := os.Remove(otherFile); err != nil {
+		t.Fatalf("removing test file failed: %s", err)
+	}
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if moveReceived.value() != 1 {
+		t.Fatalf("incorrect number of probable move events received after 500 ms (%d vs %d)", moveReceived.value(), 1)
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+// NormalizeNames returns middleware that rewrites the name of every event
+// with normalize before it is delivered, so that handlers, patterns and
+// dedup keys see names in one form. It is meant for Unicode normalization:
+// macOS reports names in NFD while most software stores NFC. This package
+// carries no Unicode tables, so pass a normalizer such as the NFC.String
+// method of golang.org/x/text/unicode/norm:
+//
+//	if runtime.GOOS == "darwin" {
+//		w.Use(fsnotify.NormalizeNames(norm.NFC.String))
+//	}
+//
+// NormalizeNames(filepath.ToSlash) delivers slash-separated names on
+// Windows too, as configurations written for several platforms expect.
+func NormalizeNames(normalize func(name string) string) Middleware {
+	return func(next EventHandler) EventHandler {
+		return EventHandlerFunc(func(ev *FileEvent) {
+			ev.Name = normalize(ev.Name)
+			next.HandleEvent(ev)
+		})
+	}
+}
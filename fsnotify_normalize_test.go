@@ -0,0 +1,24 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeNames(t *testing.T) {
+	// Stands in for a real NFC normalizer on a single character
+	nfc := strings.NewReplacer("e\u0301", "\u00e9").Replace
+
+	var got string
+	h := NormalizeNames(nfc)(EventHandlerFunc(func(ev *FileEvent) {
+		got = ev.Name
+	}))
+	h.HandleEvent(&FileEvent{Name: "/tmp/caf" + "é"})
+	if want := "/tmp/caf\u00e9"; got != want {
+		t.Fatalf("incorrect name delivered (%q vs %q)", got, want)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The bits of the flags above FSN_ALL select notifications the system does
+// not report, carried by the same FileEvent values. FSN_USER and the bits
+// above it are for notifications defined by applications, such as "the
+// tree settled" (see UserOp); the package never sets them. The bits
+// between FSN_RENAME and FSN_USER are reserved for the package, such as the
+// Chmod bit of Op; they select nothing as flags.
+const (
+	FSN_USER     = 1 << 16                // Lowest user-defined notification
+	FSN_USER_ALL = (1<<userOps - 1) << 16 // All user-defined notifications
+)
+
+// userOps is the number of user-defined notifications.
+const userOps = 16
+
+// UserOp returns the user-defined notification n, from 0 to 15.
+func UserOp(n uint) uint32 {
+	if n >= userOps {
+		panic(fmt.Sprintf("fsnotify: user-defined notification %d out of range", n))
+	}
+	return FSN_USER << n
+}
+
+// NewEvent returns an event for name with the notifications of flags,
+// which may include user-defined ones (see UserOp). Reserved bits are
+// ignored.
+func NewEvent(name string, flags uint32) *FileEvent {
+	ev := newFileEvent(name, flags&FSN_ALL)
+	ev.ops = flags & FSN_USER_ALL
+	return ev
+}
+
+// Emit delivers ev as if the system reported it: to the handler of its
+// name, through middleware, or on the Event channel. Events with
+// user-defined notifications are delivered whatever the flags of the
+// watch. Emit returns an error after Close, or if Close is called before
+// the event is taken.
+func (w *Watcher) Emit(ev *FileEvent) error {
+	stop, err := w.drain.enter()
+	if err != nil {
+		return err
+	}
+	defer w.drain.exit()
+	if !w.queueStop(ev, stop) {
+		return errWatcherClosed
+	}
+	return nil
+}
+
+// An Op is a set of the kinds of change an event reports, for handling
+// events with a switch or a mask rather than a chain of predicates. The
+// bits of Create, Write, Remove and Rename are those of FSN_CREATE,
+// FSN_MODIFY, FSN_DELETE and FSN_RENAME, user-defined notifications keep
+// their bits (see UserOp), and Chmod takes the lowest reserved bit.
+type Op uint32
+
+const (
+	Create Op = FSN_CREATE // See IsCreate
+	Write  Op = FSN_MODIFY // Change of the content
+	Remove Op = FSN_DELETE // See IsDelete
+	Rename Op = FSN_RENAME // See IsRename
+	Chmod  Op = 1 << 4     // Change of the metadata (see IsAttrib)
+)
+
+var opNames = []struct {
+	op   Op
+	name string
+}{
+	{Create, "CREATE"},
+	{Write, "WRITE"},
+	{Remove, "REMOVE"},
+	{Rename, "RENAME"},
+	{Chmod, "CHMOD"},
+}
+
+// Has reports whether op includes all of other.
+func (op Op) Has(other Op) bool {
+	return op&other == other
+}
+
+// String formats op in the form "CREATE|WRITE|...", user-defined
+// notifications as "USER0" and so on.
+func (op Op) String() string {
+	var names []string
+	for _, n := range opNames {
+		if op&n.op != 0 {
+			names = append(names, n.name)
+		}
+	}
+	for n := uint(0); n < userOps; n++ {
+		if op&Op(UserOp(n)) != 0 {
+			names = append(names, fmt.Sprintf("USER%d", n))
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// Op returns the kinds of change the event reports, with its user-defined
+// notifications. IsModify holds for both Write and Chmod, which IsAttrib
+// holds for alone.
+func (e *FileEvent) Op() Op {
+	op := Op(e.ops)
+	if e.IsCreate() {
+		op |= Create
+	}
+	if e.isWrite() {
+		op |= Write
+	}
+	if e.IsDelete() {
+		op |= Remove
+	}
+	if e.IsRename() {
+		op |= Rename
+	}
+	if e.IsAttrib() {
+		op |= Chmod
+	}
+	return op
+}
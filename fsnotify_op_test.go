@@ -0,0 +1,98 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUserOp(t *testing.T) {
+	settled := UserOp(3)
+	ev := NewEvent("/src/main.go", FSN_MODIFY|settled)
+	if !ev.IsModify() || ev.IsCreate() {
+		t.Fatalf("event %s lost its system notifications", ev)
+	}
+	if op := ev.Op(); op != Write|Op(settled) {
+		t.Fatalf("Op() = %s, want %s", op, Write|Op(settled))
+	}
+	if !strings.Contains(ev.String(), "USER3") {
+		t.Fatalf("String() = %s, want USER3", ev)
+	}
+	if !ev.matchesFlags(settled) || ev.matchesFlags(UserOp(4)) {
+		t.Fatal("user-defined notifications not selected by their flags")
+	}
+}
+
+func TestFsnotifyEmit(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	if err := watcher.WatchFlags(testDir, FSN_CREATE); err != nil {
+		t.Fatalf("watching %q failed: %s", testDir, err)
+	}
+
+	name := filepath.Join(testDir, "TestFsnotifyEmit.testfile")
+	if err := watcher.Emit(NewEvent(name, UserOp(0))); err != nil {
+		t.Fatalf("watcher.Emit() failed: %s", err)
+	}
+	select {
+	case ev := <-watcher.Event:
+		if ev.Name != name || ev.Op() != Op(UserOp(0)) {
+			t.Fatalf("event received %s, expected USER0 on %q", ev, name)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("emitted event not received after 500 ms")
+	}
+
+	// Nobody reads the Event channel while Close is called
+	emitted := make(chan error, 1)
+	go func() { emitted <- watcher.Emit(NewEvent(name, UserOp(0))) }()
+	go func() { emitted <- watcher.Emit(NewEvent(name, UserOp(1))) }()
+	time.Sleep(50 * time.Millisecond)
+	watcher.Close()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-emitted:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Emit blocked after Close")
+		}
+	}
+	if err := watcher.Emit(NewEvent(name, UserOp(0))); err == nil {
+		t.Fatal("watcher.Emit() after Close succeeded")
+	}
+}
+
+func TestOp(t *testing.T) {
+	ev := NewEvent("/src/main.go", FSN_CREATE|FSN_MODIFY|UserOp(3))
+	op := ev.Op()
+	if !op.Has(Create|Write) || op&(Remove|Rename|Chmod) != 0 {
+		t.Fatalf("Op() = %s, want CREATE|WRITE|USER3", op)
+	}
+	if s := op.String(); s != "CREATE|WRITE|USER3" {
+		t.Fatalf("String() = %q, want %q", s, "CREATE|WRITE|USER3")
+	}
+	if op := NewEvent("/src/old.go", FSN_DELETE).Op(); op != Remove {
+		t.Fatalf("Op() = %s, want REMOVE", op)
+	}
+
+	// Chmod takes a reserved bit, which no flags select or NewEvent keeps
+	if Chmod&(FSN_ALL|FSN_USER_ALL) != 0 {
+		t.Fatalf("Chmod %#x collides with the notification flags", uint32(Chmod))
+	}
+	ev = NewEvent("/src/main.go", uint32(Chmod|Create))
+	if op := ev.Op(); op != Create {
+		t.Fatalf("Op() of an event made with the Chmod bit = %s, want CREATE", op)
+	}
+	if ev.matchesFlags(uint32(Chmod)) {
+		t.Fatal("Chmod bit selects events as flags")
+	}
+}
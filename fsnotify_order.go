@@ -0,0 +1,95 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import "sync"
+
+// A Notice is an event or an error of the ordered stream of a watcher (see
+// Ordered).
+type Notice struct {
+	Event *FileEvent // Event, or nil for an error
+	Err   error      // Error, if Event is nil
+}
+
+// Ordered returns a single channel on which the events and the errors of
+// the watcher are delivered in the order they occurred, for consumers
+// whose correctness depends on their interleaving, such as replication
+// logs. Read separately from Event and Error, an error may be observed
+// before the events that preceded it.
+//
+// From the first call on, events and errors are no longer sent on Event
+// and Error. The channel is closed when the watcher is closed. Call it
+// before adding watches; errors and events already in flight may still be
+// sent on Error and Event.
+func (w *Watcher) Ordered() <-chan Notice {
+	w.order.mu.Lock()
+	defer w.order.mu.Unlock()
+	if w.order.ch == nil {
+		w.order.ch = make(chan Notice)
+	}
+	return w.order.ch
+}
+
+// An orderTable holds the ordered stream of a watcher.
+type orderTable struct {
+	mu sync.Mutex  // Protects access to ch.
+	ch chan Notice // Ordered stream (nil until Ordered is called)
+}
+
+func (t *orderTable) stream() chan Notice {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ch
+}
+
+// close closes the ordered stream, if any, once the events are delivered.
+func (t *orderTable) close() {
+	if ch := t.stream(); ch != nil {
+		close(ch)
+	}
+}
+
+// emit sends ev on the ordered stream, or on the Event channel.
+func (w *Watcher) emit(ev *FileEvent) {
+	if w.coop.enabled {
+		w.coop.deliver(Notice{Event: ev})
+		return
+	}
+	if ch := w.order.stream(); ch != nil {
+		ch <- Notice{Event: ev}
+		return
+	}
+	w.Event <- ev
+}
+
+// deliverError sends err on the ordered stream, or on the Error channel.
+// It is for the goroutines that deliver events themselves.
+func (w *Watcher) deliverError(err error) {
+	if w.coop.enabled {
+		w.coop.deliver(Notice{Err: err})
+		return
+	}
+	if ch := w.order.stream(); ch != nil {
+		ch <- Notice{Err: err}
+		return
+	}
+	w.Error <- err
+}
+
+// sendError sends err on the Error channel or, if events are ordered,
+// queues it behind the events already queued on the internal channel. It
+// is for the goroutines that queue events, and must not be called by the
+// goroutine delivering them.
+func (w *Watcher) sendError(err error) {
+	if w.coop.enabled {
+		w.coop.push(&FileEvent{err: err})
+		return
+	}
+	if w.order.stream() != nil {
+		w.internalEvent <- &FileEvent{err: err}
+		return
+	}
+	w.Error <- err
+}
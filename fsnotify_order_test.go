@@ -0,0 +1,72 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFsnotifyOrdered(t *testing.T) {
+	watcher, err := NewMockWatcher()
+	if err != nil {
+		t.Fatalf("NewMockWatcher() failed: %s", err)
+	}
+	defer watcher.Close()
+
+	ordered := watcher.Ordered()
+	if err := watcher.Watch("dir"); err != nil {
+		t.Fatalf("watcher.Watch(\"dir\") failed: %s", err)
+	}
+	failed := errors.New("no space left on device")
+	go func() {
+		watcher.Inject("dir/before", FSN_CREATE)
+		watcher.InjectError(failed)
+		watcher.Inject("dir/after", FSN_CREATE)
+	}()
+
+	for _, want := range []Notice{{Event: &FileEvent{Name: "dir/before"}}, {Err: failed}, {Event: &FileEvent{Name: "dir/after"}}} {
+		select {
+		case n := <-ordered:
+			switch {
+			case want.Err != nil && n.Err != want.Err:
+				t.Fatalf("received %+v, expected error %v", n, want.Err)
+			case want.Event != nil && (n.Event == nil || n.Event.Name != want.Event.Name):
+				t.Fatalf("received %+v, expected an event for %q", n, want.Event.Name)
+			}
+		case ev := <-watcher.Event:
+			t.Fatalf("event %s received on the Event channel", ev)
+		case err := <-watcher.Error:
+			t.Fatalf("error %v received on the Error channel", err)
+		case <-time.After(time.Second):
+			t.Fatal("nothing received on the ordered stream")
+		}
+	}
+}
+
+func TestFsnotifyOrderedClose(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	ordered := watcher.Ordered()
+	addWatch(t, watcher, testDir)
+	watcher.Close()
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-ordered:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("ordered stream not closed after Close")
+		}
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux,!windows,!freebsd,!openbsd,!netbsd,!dragonfly,!darwin,!solaris
+
+package fsnotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The platform offers no file system notifications, so all watches are
+// served by polling (see SetPolling).
+const nativeEvents = false
+
+// pollWatchCost estimates the memory of the snapshot of a polled file.
+const pollWatchCost = 256
+
+// watchCost estimates the resources of polling path (see SetBudget): the
+// snapshot of it and, for a directory, of each of its files.
+func watchCost(path string) budgetCost {
+	return budgetCost{memory: int64(1+countEntries(path)) * pollWatchCost}
+}
+
+type FileEvent struct {
+	mask        uint32          // Mask of events (FSN_CREATE etc.)
+	Name        string          // File name (optional)
+	prevSize    int64           // Size of the file before a modification
+	size        int64           // Size of the file after a modification
+	sized       bool            // Set if prevSize and size are known (not tracked by polling)
+	replaced    bool            // Set if a different file took the place of the file (not tracked by polling)
+	xattr       bool            // Set if the extended attributes of the file changed (not tracked by polling)
+	delta       *ContentDelta   // Content before and after a modification (see SetContentTracking)
+	retarget    string          // New target of a watched symlink (see WatchSymlink)
+	movedFrom   string          // Source of a probable move (see SetMoveCorrelation)
+	overflow    bool            // Set on events reporting that events were dropped (see IsOverflow)
+	rescan      []string        // Watched paths affected by an overflow (see RescanRoots)
+	locked      bool            // Set if the file was still locked when delivered (see LockWait)
+	placeholder bool            // Set if the file was a cloud placeholder when delivered (see IsPlaceholder)
+	dir         bool            // Set if the event refers to a directory (see IsDir)
+	stamp       time.Time       // When the event was observed (see Time)
+	proc        *Process        // Process that caused the event (see SetProcessTracking)
+	move        MoveDirection   // Direction of a paired rename (see SetRenamePairing)
+	ops         uint32          // Notifications the system does not report (see FSN_USER)
+	parts       []*FileEvent    // Events combined by the event (see Parts)
+	err         error           // Error queued in order with the events (see Ordered)
+	ctx         context.Context // Context of the watch that delivered the event
+}
+
+// IsCreate reports whether the FileEvent was triggered by a creation
+func (e *FileEvent) IsCreate() bool { return (e.mask & FSN_CREATE) == FSN_CREATE }
+
+// IsDelete reports whether the FileEvent was triggered by a delete
+func (e *FileEvent) IsDelete() bool { return (e.mask & FSN_DELETE) == FSN_DELETE }
+
+// IsModify reports whether the FileEvent was triggered by a file modification
+func (e *FileEvent) IsModify() bool { return (e.mask & FSN_MODIFY) == FSN_MODIFY }
+
+// IsRename reports whether the FileEvent was triggered by a change name
+func (e *FileEvent) IsRename() bool { return (e.mask & FSN_RENAME) == FSN_RENAME }
+
+// movedTo reports whether the event names the file of a rename under its
+// new name; polling only reports the old name.
+func (e *FileEvent) movedTo() bool { return false }
+
+// IsAttrib reports whether the FileEvent was triggered by a change in the
+// file metadata. Polling does not tell such changes apart.
+func (e *FileEvent) IsAttrib() bool { return false }
+
+// isWrite reports whether the FileEvent was triggered by a change of the
+// file content, rather than its metadata.
+func (e *FileEvent) isWrite() bool { return e.IsModify() }
+
+// RawMask returns the notifications of the event (FSN_CREATE etc.); there
+// is no system mask behind polling.
+func (e *FileEvent) RawMask() uint32 { return e.mask }
+
+// Cookie returns zero; polling does not associate the halves of a rename.
+func (e *FileEvent) Cookie() uint32 { return 0 }
+
+// newFileEvent returns a synthetic event for name, as if it had been
+// triggered by the given notifications (FSN_CREATE etc.)
+func newFileEvent(name string, flags uint32) *FileEvent {
+	return &FileEvent{Name: name, mask: flags & FSN_ALL}
+}
+
+type Watcher struct {
+	mu            sync.Mutex              // Mutex for the Watcher itself.
+	fsnFlags      map[string]uint32       // Map of watched files to flags used for filter
+	handlers      map[string]EventHandler // Map of watched files to event handlers (nil for the Event channel)
+	middleware    []Middleware            // Middleware wrapping event delivery (see Use)
+	policy        *PathPolicy             // Policy validating watched paths (see SetPathPolicy)
+	root          string                  // Base directory watched paths are resolved in (see SetRoot)
+	rootBeneath   bool                    // Set if paths leading out of root are rejected (see SetRootBeneath)
+	broker        *Broker                 // Broker of the Event channel (see Fanout)
+	ignored       []string                // Base names of files to ignore (see SetIgnoredNames)
+	treeDepth     int                     // Levels of directories watched below trees (see SetTreeDepth)
+	links         linkTable               // Known files, for events on hard links (see SetHardlinkTracking)
+	contents      contentCache            // Cached contents of small files (see SetContentTracking)
+	recent        recentBuffer            // Recently delivered events (see SetRecent)
+	dups          dupTable                // Identities of watched paths (see SetDuplicatePolicy)
+	symlinks      symlinkTable            // Watched symlinks (see WatchSymlink)
+	pending       pendingTable            // Watches of paths that do not exist yet (see SetPendingWatches)
+	order         orderTable              // Ordered stream of events and errors (see Ordered)
+	coop          coopQueue               // Events between calls of Poll (see NewCooperativeWatcher)
+	moves         moveTable               // Known files, to pair cross-device moves (see SetMoveCorrelation)
+	scans         scanTable               // Known files, to rescan after sleep (see SetResumeRescan)
+	trees         treeTable               // Roots of tree watches, to extend to directories moved in (see SetMoveInScan)
+	polls         pollTable               // Polled paths, which all watched paths are
+	drain         drainState              // Events in flight on Close (see SetDrainOnClose)
+	activity      activityTable           // Watched paths of the latest events (see RescanRoots)
+	fair          fairQueue               // Events queued per watch root (see SetFairness)
+	consistency   consistencyTable        // Watched paths with lost events (see SetConsistencyTracking)
+	steps         stepTable               // Time spent in the steps of delivery (see SetStepTiming)
+	suppressed    suppressTable           // Paths the application is changing (see IgnorePath)
+	mock          *mockBackend            // Recorded watches of a MockWatcher (nil otherwise)
+	budget        budgetTable             // Resources of the watches (see SetBudget)
+	fsnmut        sync.Mutex              // Protects access to fsnFlags, handlers, middleware, policy, root, broker, ignored and treeDepth.
+	Error         chan error              // Errors are sent on this channel
+	internalEvent chan *FileEvent         // Events are queued on this channel
+	Event         chan *FileEvent         // Events are returned on this channel
+	isClosed      bool                    // Set to true when Close() is first called
+}
+
+// NewWatcher creates and returns a new watcher, polling every watched path
+// every second. SetPolling changes the interval.
+func NewWatcher() (*Watcher, error) {
+	w := &Watcher{
+		fsnFlags:      make(map[string]uint32),
+		handlers:      make(map[string]EventHandler),
+		internalEvent: make(chan *FileEvent),
+		Event:         make(chan *FileEvent),
+		Error:         make(chan error),
+	}
+	w.polls.setMode(w, PollAlways, 0)
+
+	go w.purgeEvents()
+	return w, nil
+}
+
+// Close stops polling.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	if w.isClosed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.isClosed = true
+	w.mu.Unlock()
+	w.drain.close()
+	w.symlinks.close()
+	w.pending.close()
+	w.scans.close()
+	w.polls.close()
+
+	close(w.internalEvent)
+	close(w.Error)
+	return nil
+}
+
+// Watch adds path to the polled paths, whatever the polling mode.
+func (w *Watcher) watch(path string) error {
+	w.mu.Lock()
+	closed := w.isClosed
+	w.mu.Unlock()
+	if closed {
+		return errors.New("watcher already closed")
+	}
+	return w.polls.add(path)
+}
+
+func (w *Watcher) watchTree(path string, skip []string, depth int, h EventHandler, progress func(dirs int)) error {
+	return w.watchTreeWalk(path, skip, depth, h, progress)
+}
+
+// RemoveWatch removes path from the polled paths.
+func (w *Watcher) removeWatch(path string) error {
+	if !w.polls.remove(path) {
+		return errors.New(fmt.Sprintf("can't remove non-existent polled watch for: %s", path))
+	}
+	return nil
+}
+
+// Size tracking is not supported by polling, which keeps no sizes per
+// event.
+func (w *Watcher) setSizeTracking(enable bool) {}
+
+// Xattr tracking is not supported by polling.
+func (w *Watcher) setXattrTracking(enable bool) {}
+
+// Scan budgets have no effect on polling, which rescans at each interval.
+func (w *Watcher) setScanBudget(budget time.Duration) {}
+
+// isRemoteFS reports whether path is on a network file system. All paths
+// are polled here, so it does not matter.
+func isRemoteFS(path string) bool {
+	return false
+}
+
+// Paths are resolved in a root by resolveInRoot only.
+func resolveInRootKernel(root, path string, beneath bool) (string, error) {
+	return "", errNoKernelResolve
+}
@@ -0,0 +1,42 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux,!windows,!freebsd,!openbsd,!netbsd,!dragonfly,!darwin,!solaris
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPolledWithoutNativeEvents(t *testing.T) {
+	if NativeEvents() {
+		t.Fatal("NativeEvents() is true without a backend")
+	}
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	// Polled even if asked not to
+	watcher.SetPolling(PollNever, 50*time.Millisecond)
+	addWatch(t, watcher, testDir)
+
+	testFile := filepath.Join(testDir, "TestPolledWithoutNativeEvents.testfile")
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	select {
+	case ev := <-watcher.Event:
+		if !ev.IsCreate() || ev.Name != testFile {
+			t.Fatalf("received %s, expected the create of %q", ev, testFile)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no create event received")
+	}
+}
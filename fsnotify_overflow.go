@@ -0,0 +1,131 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// IsOverflow reports whether the event reports that the kernel dropped
+// events, having queued more than it holds. The files below the roots of
+// RescanRoots must then be rescanned for changes.
+func (e *FileEvent) IsOverflow() bool {
+	return e.overflow
+}
+
+// RescanRoots returns the watched paths likely affected by an overflow:
+// those with events queued just before it. If no events tell, all watched
+// paths are returned.
+//
+// The handler of each affected path receives an overflow event named after
+// the path; the Event channel receives one with an empty name, for the
+// affected paths without handlers.
+func (e *FileEvent) RescanRoots() []string {
+	return e.rescan
+}
+
+// overflowHistory is the number of events whose watched paths are kept to
+// tell the paths affected by an overflow.
+const overflowHistory = 4096
+
+// An activityTable records the watched paths of the latest events.
+type activityTable struct {
+	mu    sync.Mutex // Protects access to roots, next and full.
+	roots []string   // Ring of the watched paths of the latest events
+	next  int        // Index of the next entry of roots
+	full  bool       // Set once roots wrapped around
+}
+
+// note records an event on a file below the watched path root.
+func (t *activityTable) note(root string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.roots == nil {
+		t.roots = make([]string, overflowHistory)
+	}
+	t.roots[t.next] = root
+	if t.next++; t.next == len(t.roots) {
+		t.next, t.full = 0, true
+	}
+}
+
+// take returns the distinct watched paths recorded, and forgets them.
+func (t *activityTable) take() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := t.next
+	if t.full {
+		n = len(t.roots)
+	}
+	seen := make(map[string]bool)
+	var roots []string
+	for _, root := range t.roots[:n] {
+		if !seen[root] {
+			seen[root] = true
+			roots = append(roots, root)
+		}
+	}
+	t.next, t.full = 0, false
+	sort.Strings(roots)
+	return roots
+}
+
+// rootOf returns the watched path an event on name belongs to.
+func (w *Watcher) rootOf(name string) (string, bool) {
+	w.fsnmut.Lock()
+	defer w.fsnmut.Unlock()
+	for {
+		if _, found := w.handlers[name]; found {
+			return name, true
+		}
+		dir := filepath.Dir(name)
+		if dir == name {
+			return "", false
+		}
+		name = dir
+	}
+}
+
+// noteActivity records the watched path of an event, or fills in the
+// paths affected by an overflow.
+func (w *Watcher) noteActivity(ev *FileEvent) {
+	if !ev.overflow {
+		if root, found := w.rootOf(ev.Name); found {
+			w.activity.note(root)
+		}
+		return
+	}
+	if ev.rescan == nil {
+		// The backend could not tell; use the latest events
+		ev.rescan = w.activity.take()
+	}
+	if len(ev.rescan) == 0 {
+		ev.rescan = w.watchedPaths()
+	}
+}
+
+// deliverOverflow delivers an overflow event to the handlers of the
+// affected paths, and to the Event channel for those without handlers.
+func (w *Watcher) deliverOverflow(ev *FileEvent, send EventHandlerFunc) {
+	var unhandled []string
+	for _, root := range ev.rescan {
+		if w.handlerFor(root) == nil {
+			unhandled = append(unhandled, root)
+			continue
+		}
+		handled := *ev
+		handled.Name = root
+		handled.rescan = []string{root}
+		w.deliverName(&handled, send)
+	}
+	if len(unhandled) > 0 {
+		overflow := *ev
+		overflow.Name = ""
+		overflow.rescan = unhandled
+		w.deliverName(&overflow, send)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOverflowDeliveredByRoot(t *testing.T) {
+	handledDir := tempMkdir(t)
+	defer os.RemoveAll(handledDir)
+	channelDir := tempMkdir(t)
+	defer os.RemoveAll(channelDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	handled := make(chan *FileEvent, 10)
+	h := EventHandlerFunc(func(ev *FileEvent) {
+		if ev.IsOverflow() {
+			handled <- ev
+		}
+	})
+	if err := watcher.WatchHandler(handledDir, FSN_ALL, h); err != nil {
+		t.Fatalf("watcher.WatchHandler(%q) failed: %s", handledDir, err)
+	}
+	addWatch(t, watcher, channelDir)
+
+	// Activity on both roots, then an overflow the backend could not place
+	for _, dir := range []string{handledDir, channelDir} {
+		if err := ioutil.WriteFile(filepath.Join(dir, "TestOverflowDeliveredByRoot.testfile"), nil, 0666); err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+	}
+	var overflow *FileEvent
+	timeout := time.After(time.Second)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		watcher.internalEvent <- &FileEvent{overflow: true}
+	}()
+	for overflow == nil {
+		select {
+		case ev := <-watcher.Event:
+			if ev.IsOverflow() {
+				overflow = ev
+			}
+		case <-timeout:
+			t.Fatal("no overflow event received on the Event channel")
+		}
+	}
+	if roots := overflow.RescanRoots(); overflow.Name != "" || len(roots) != 1 || roots[0] != channelDir {
+		t.Fatalf("overflow on the Event channel is %q for roots %q, expected %q for %q", overflow.Name, roots, "", channelDir)
+	}
+
+	select {
+	case ev := <-handled:
+		if roots := ev.RescanRoots(); ev.Name != handledDir || len(roots) != 1 || roots[0] != handledDir {
+			t.Fatalf("overflow handled is %q for roots %q, expected %q", ev.Name, roots, handledDir)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no overflow event handled")
+	}
+}
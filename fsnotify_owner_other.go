@@ -0,0 +1,14 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build windows plan9
+
+package fsnotify
+
+import "os"
+
+// The owner of a file is not a user ID here.
+func fileOwner(fi os.FileInfo) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,53 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build freebsd darwin dragonfly
+
+package fsnotify
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// Options for getsockopt(); not in the syscall package
+	sys_SOL_LOCAL       = 0
+	sys_LOCAL_PEERCRED  = 1
+	sys_XUCRED_VERSION  = 0
+	sys_XUCRED_UID_OFFS = 4 // Offset of cr_uid in struct xucred
+)
+
+// peerUID returns the user ID of the process at the other end of a unix
+// socket connection, as it was when the process connected or listened.
+func peerUID(conn net.Conn) (int, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return 0, errNoPeerCred
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	// Room for struct xucred, whose size differs between the systems
+	var xucred [128]byte
+	size := uint32(len(xucred))
+	var errno syscall.Errno
+	err = raw.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, sys_SOL_LOCAL, sys_LOCAL_PEERCRED,
+			uintptr(unsafe.Pointer(&xucred[0])), uintptr(unsafe.Pointer(&size)), 0)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if errno != 0 {
+		return 0, os.NewSyscallError("getsockopt", errno)
+	}
+	if *(*uint32)(unsafe.Pointer(&xucred[0])) != sys_XUCRED_VERSION {
+		return 0, errNoPeerCred
+	}
+	return int(*(*uint32)(unsafe.Pointer(&xucred[sys_XUCRED_UID_OFFS]))), nil
+}
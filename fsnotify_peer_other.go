@@ -0,0 +1,15 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux,!freebsd,!darwin,!dragonfly
+
+package fsnotify
+
+import "net"
+
+// The credentials of the peer of a unix socket are not read here, so the
+// daemon relies on the permissions of its socket alone.
+func peerUID(conn net.Conn) (int, error) {
+	return 0, errNoPeerCred
+}
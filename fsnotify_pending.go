@@ -0,0 +1,275 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// SetPendingWatches lets Watch, WatchFlags and WatchHandler accept paths
+// that do not exist yet, such as a configuration file created later.
+// Instead of failing, the watch waits on the nearest existing directory
+// above the path, moving down as the directories leading to it are
+// created. Once the path appears, it is watched with the flags and handler
+// given and a create event is delivered for it.
+//
+// The path is resolved in the root of the watcher and checked against its
+// policy when it appears; errors doing so, or watching it, are sent on
+// Error. The directories above pending paths are watched by a second
+// watcher, created with the first pending watch. Disabling pending watches
+// does not cancel those already waiting; RemoveWatch does.
+func (w *Watcher) SetPendingWatches(enable bool) {
+	w.pending.mu.Lock()
+	w.pending.enabled = enable
+	w.pending.mu.Unlock()
+}
+
+// A pendingTable holds the watches of paths that do not exist yet.
+type pendingTable struct {
+	mu        sync.Mutex              // Protects access to the fields below.
+	enabled   bool                    // Set if missing paths are watched when they appear
+	resilient bool                    // Set if watched paths deleted are watched again when they reappear
+	dirs      *Watcher                // Watcher of the directories above the paths (nil until a path is pending)
+	paths     map[string]*pendingPath // Pending paths (key: path confined to the root of the watcher)
+	anchors   map[string]int          // Number of pending paths waiting on each watched directory
+	kick      chan bool               // Signaled when paths are added
+	stop      chan bool               // Closed to stop following dirs when it watches nothing
+	done      chan bool               // Closed when the dirs watcher is drained
+}
+
+// A pendingPath is a watch waiting for its path to appear.
+type pendingPath struct {
+	arg     string       // Path as passed to WatchHandler, or as watched before if rewatched
+	rewatch bool         // Set if the path was watched before it was deleted (see SetResilient)
+	flags   uint32       // Notifications to watch for
+	h       EventHandler // Handler of the events, or nil for the Event channel
+	anchor  string       // Nearest existing directory above the path, watched by dirs
+}
+
+// wants reports whether the watch of a path should be pending, given the
+// path checked and the error checking it.
+func (t *pendingTable) wants(checked string, err error) bool {
+	t.mu.Lock()
+	enabled := t.enabled
+	t.mu.Unlock()
+	if !enabled {
+		return false
+	}
+	if err == nil {
+		_, err = os.Lstat(checked)
+	}
+	return os.IsNotExist(err)
+}
+
+// pendingName returns the name a pending watch of path waits for: path
+// confined to the root of the watcher without resolving it.
+func (w *Watcher) pendingName(path string) string {
+	return filepath.Clean(w.rootPathLexical(path))
+}
+
+// add records the pending watch of path, passed as arg, and has the
+// nearest existing directory above it watched. It does not deliver events
+// itself, so the events goroutine may call it.
+func (t *pendingTable) add(w *Watcher, path string, p *pendingPath) error {
+	t.mu.Lock()
+	if t.dirs == nil {
+		dirs, err := NewWatcher()
+		if err != nil {
+			t.mu.Unlock()
+			return err
+		}
+		t.dirs = dirs
+		t.paths = make(map[string]*pendingPath)
+		t.anchors = make(map[string]int)
+		t.kick = make(chan bool, 1)
+		t.stop = make(chan bool)
+		t.done = make(chan bool)
+		go t.follow(w, dirs)
+	}
+	if old, found := t.paths[path]; found {
+		t.unanchor(old.anchor)
+	}
+	t.paths[path] = p
+	t.mu.Unlock()
+	select {
+	case t.kick <- true:
+	default:
+	}
+	return nil
+}
+
+// remove cancels the pending watch of path, reporting whether it was
+// pending.
+func (t *pendingTable) remove(path string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, found := t.paths[path]
+	if !found {
+		return false
+	}
+	delete(t.paths, path)
+	t.unanchor(p.anchor)
+	return true
+}
+
+// unanchor forgets a pending path waiting on anchor, and stops watching
+// anchor when no other waits on it. t.mu must be held.
+func (t *pendingTable) unanchor(anchor string) {
+	if anchor == "" {
+		return
+	}
+	if t.anchors[anchor]--; t.anchors[anchor] > 0 {
+		return
+	}
+	delete(t.anchors, anchor)
+	// The directory may be gone already
+	t.dirs.RemoveWatch(anchor)
+}
+
+// follow advances the pending paths below the directories reporting a
+// change, until dirs is closed or following it is stopped.
+func (t *pendingTable) follow(w *Watcher, dirs *Watcher) {
+	defer close(t.done)
+	events, errs := dirs.Event, dirs.Error
+	for events != nil || errs != nil {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			t.mu.Lock()
+			var paths []string
+			for path, p := range t.paths {
+				if within(path, ev.Name) || p.anchor == ev.Name {
+					paths = append(paths, path)
+				}
+			}
+			t.mu.Unlock()
+			for _, path := range paths {
+				t.advance(w, path)
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			w.sendError(err)
+		case <-t.kick:
+			// The paths added may have appeared before their directories
+			// are watched
+			t.mu.Lock()
+			var paths []string
+			for path, p := range t.paths {
+				if p.anchor == "" {
+					paths = append(paths, path)
+				}
+			}
+			t.mu.Unlock()
+			for _, path := range paths {
+				t.advance(w, path)
+			}
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// advance watches path if it appeared, delivering a create event for it.
+// Otherwise it moves its pending watch to the nearest existing directory
+// above it, which is deeper when directories leading to it were created
+// and higher when its directory was removed.
+func (t *pendingTable) advance(w *Watcher, path string) {
+	t.mu.Lock()
+	p, found := t.paths[path]
+	if !found {
+		t.mu.Unlock()
+		return
+	}
+	if _, err := os.Lstat(path); err == nil {
+		delete(t.paths, path)
+		t.unanchor(p.anchor)
+		t.mu.Unlock()
+		t.promote(w, path, p)
+		return
+	}
+	anchor := filepath.Dir(path)
+	for {
+		if _, err := os.Lstat(anchor); err == nil || filepath.Dir(anchor) == anchor {
+			break
+		}
+		anchor = filepath.Dir(anchor)
+	}
+	if anchor == p.anchor {
+		t.mu.Unlock()
+		return
+	}
+	t.unanchor(p.anchor)
+	p.anchor = ""
+	if t.anchors[anchor] == 0 {
+		if err := t.dirs.WatchFlags(anchor, FSN_CREATE|FSN_DELETE|FSN_RENAME); err != nil {
+			t.mu.Unlock()
+			w.sendError(err)
+			return
+		}
+	}
+	t.anchors[anchor]++
+	p.anchor = anchor
+	t.mu.Unlock()
+
+	// A directory leading to the path created before anchor was watched
+	// is not reported
+	next := path
+	for filepath.Dir(next) != anchor {
+		next = filepath.Dir(next)
+	}
+	if _, err := os.Lstat(next); err == nil {
+		t.advance(w, path)
+	}
+}
+
+// promote watches the path of a pending watch that appeared, and delivers
+// a create event for it. A path watched again is followed by a modify
+// event if it is a file with content.
+func (t *pendingTable) promote(w *Watcher, path string, p *pendingPath) {
+	resolved, err := p.arg, error(nil)
+	if !p.rewatch {
+		resolved, err = w.checkPath(p.arg)
+	} else if policy := w.pathPolicy(); policy != nil {
+		err = policy.validate(resolved)
+	}
+	if err == nil {
+		err = w.addPath(resolved, p.flags, p.h, w.watch)
+	}
+	if err != nil {
+		w.sendError(err)
+		return
+	}
+	created := newFileEvent(resolved, FSN_CREATE)
+	fi, err := os.Stat(resolved)
+	created.dir = err == nil && fi.IsDir()
+	w.queue(created)
+	if p.rewatch && err == nil && fi.Mode().IsRegular() && fi.Size() > 0 {
+		w.queue(newFileEvent(resolved, FSN_MODIFY))
+	}
+}
+
+// close stops waiting for the pending paths. It must be called before the
+// internal event channel of the watcher is closed.
+func (t *pendingTable) close() {
+	t.mu.Lock()
+	dirs, idle := t.dirs, len(t.anchors) == 0
+	t.mu.Unlock()
+	if dirs != nil {
+		dirs.Close()
+		if idle {
+			// Without watches, dirs may never report that it closed
+			close(t.stop)
+		}
+		<-t.done
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFsnotifyPendingWatch(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetPendingWatches(true)
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	testFile := filepath.Join(testDir, "a", "b", "TestFsnotifyPendingWatch.testfile")
+	var createReceived, modifyReceived, otherReceived counter
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			switch {
+			case event.Name == testFile && event.IsCreate():
+				createReceived.increment()
+			case event.Name == testFile && event.IsModify():
+				modifyReceived.increment()
+			default:
+				otherReceived.increment()
+			}
+		}
+	}()
+
+	addWatch(t, watcher, testFile)
+	if paths := watcher.watchedPaths(); len(paths) != 0 {
+		t.Fatalf("pending path watched before it exists: %q", paths)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(testFile), 0777); err != nil {
+		t.Fatalf("creating test directory failed: %s", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if createReceived.value() != 1 {
+		t.Fatalf("incorrect number of create events received after 500 ms (%d vs %d)", createReceived.value(), 1)
+	}
+	if otherReceived.value() != 0 {
+		t.Fatalf("events received for the directories above a pending path (%d)", otherReceived.value())
+	}
+
+	if err := ioutil.WriteFile(testFile, []byte("data"), 0666); err != nil {
+		t.Fatalf("writing test file failed: %s", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if modifyReceived.value() == 0 {
+		t.Fatal("no modify event received for a promoted watch")
+	}
+}
+
+func TestFsnotifyPendingWatchRemove(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	testFile := filepath.Join(testDir, "TestFsnotifyPendingWatchRemove.testfile")
+	if err := watcher.Watch(testFile); err == nil {
+		t.Fatal("watching a missing path succeeded without pending watches")
+	}
+
+	watcher.SetPendingWatches(true)
+	addWatch(t, watcher, testFile)
+	if err := watcher.RemoveWatch(testFile); err != nil {
+		t.Fatalf("removing pending watch failed: %s", err)
+	}
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+
+	select {
+	case ev := <-watcher.Event:
+		t.Fatalf("event received for a removed pending watch: %s", ev)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+// IsPlaceholder reports whether the file was a cloud placeholder when the
+// event was delivered: a file of a sync client such as OneDrive or iCloud
+// Drive whose content is not stored locally and is downloaded when it is
+// read. Sync clients change the attributes of placeholders as they
+// download and evict their content, which is reported as modifications;
+// handlers may want to leave placeholders unread.
+//
+// Placeholders are detected on Windows, by their recall and offline
+// attributes, and on macOS, as dataless files. The watcher does not read
+// them itself, so content tracking, move correlation and LockWait pass
+// them by rather than downloading them.
+func (e *FileEvent) IsPlaceholder() bool {
+	return e.placeholder
+}
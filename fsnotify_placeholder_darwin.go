@@ -0,0 +1,22 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin
+
+package fsnotify
+
+import "syscall"
+
+// Flag of files whose content is not stored locally (sys/stat.h)
+const sys_SF_DATALESS = 0x40000000
+
+// isPlaceholder reports whether name is a dataless file, from its flags,
+// which are read without materializing it.
+func isPlaceholder(name string) bool {
+	var st syscall.Stat_t
+	if err := syscall.Lstat(name, &st); err != nil {
+		return false
+	}
+	return st.Flags&sys_SF_DATALESS != 0
+}
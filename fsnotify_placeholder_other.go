@@ -0,0 +1,12 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !windows,!darwin
+
+package fsnotify
+
+// Cloud placeholders are only told apart on Windows and macOS.
+func isPlaceholder(name string) bool {
+	return false
+}
@@ -0,0 +1,31 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build windows
+
+package fsnotify
+
+import "syscall"
+
+const (
+	sys_FILE_ATTRIBUTE_OFFLINE               = 0x1000
+	sys_FILE_ATTRIBUTE_RECALL_ON_OPEN        = 0x40000
+	sys_FILE_ATTRIBUTE_RECALL_ON_DATA_ACCESS = 0x400000
+
+	sys_FILE_ATTRIBUTE_PLACEHOLDER = sys_FILE_ATTRIBUTE_OFFLINE | sys_FILE_ATTRIBUTE_RECALL_ON_OPEN | sys_FILE_ATTRIBUTE_RECALL_ON_DATA_ACCESS
+)
+
+// isPlaceholder reports whether the content of name is stored remotely,
+// from its attributes, which are read without recalling it.
+func isPlaceholder(name string) bool {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return false
+	}
+	attrs, err := syscall.GetFileAttributes(p)
+	if err != nil {
+		return false
+	}
+	return attrs&sys_FILE_ATTRIBUTE_PLACEHOLDER != 0
+}
@@ -0,0 +1,108 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrPathDenied is returned when watching a path that the policy of the
+// Watcher does not allow (see SetPathPolicy).
+var ErrPathDenied = errors.New("fsnotify: path denied by policy")
+
+// DefaultDenied lists the trees a PathPolicy refuses unless it sets Deny.
+// Watching them leaks information about other processes and devices.
+var DefaultDenied = []string{"/proc", "/sys", "/dev"}
+
+// A PathPolicy restricts the paths a Watcher accepts, for services that
+// watch paths supplied by users.
+type PathPolicy struct {
+	// Root, if set, confines watches to its tree. Paths are resolved
+	// following symlinks, so a symlink cannot lead outside it.
+	Root string
+
+	// Deny lists trees that may not be watched. Nil means DefaultDenied.
+	Deny []string
+
+	// NoFollow refuses paths that are symlinks themselves and, on Linux,
+	// registers watches with IN_DONT_FOLLOW so a symlink swapped in after
+	// the check is not followed either.
+	NoFollow bool
+}
+
+// SetPathPolicy validates all later watches against p. A nil policy
+// accepts any path.
+func (w *Watcher) SetPathPolicy(p *PathPolicy) {
+	w.fsnmut.Lock()
+	w.policy = p
+	w.fsnmut.Unlock()
+}
+
+// pathPolicy returns the policy of the watcher, or nil.
+func (w *Watcher) pathPolicy() *PathPolicy {
+	w.fsnmut.Lock()
+	defer w.fsnmut.Unlock()
+	return w.policy
+}
+
+// validate returns an error wrapping ErrPathDenied if p does not allow
+// watching path.
+func (p *PathPolicy) validate(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if p.NoFollow {
+		fi, err := os.Lstat(abs)
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink == os.ModeSymlink {
+			return fmt.Errorf("%w: %s is a symlink", ErrPathDenied, path)
+		}
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return err
+	}
+	deny := p.Deny
+	if deny == nil {
+		deny = DefaultDenied
+	}
+	for _, dir := range deny {
+		if within(abs, dir) || within(resolved, dir) {
+			return fmt.Errorf("%w: %s is in %s", ErrPathDenied, path, dir)
+		}
+	}
+	if p.Root != "" {
+		root, err := filepath.Abs(p.Root)
+		if err != nil {
+			return err
+		}
+		if root, err = filepath.EvalSymlinks(root); err != nil {
+			return err
+		}
+		if !within(resolved, root) {
+			return fmt.Errorf("%w: %s is outside %s", ErrPathDenied, path, p.Root)
+		}
+	}
+	return nil
+}
+
+// within reports whether path is dir or lies in its tree.
+func within(path, dir string) bool {
+	path, dir = filepath.Clean(path), filepath.Clean(dir)
+	if path == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, dir)
+}
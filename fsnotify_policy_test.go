@@ -0,0 +1,61 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFsnotifyPathPolicy(t *testing.T) {
+	rootDir := tempMkdir(t)
+	defer os.RemoveAll(rootDir)
+	outsideDir := tempMkdir(t)
+	defer os.RemoveAll(outsideDir)
+
+	insideDir := filepath.Join(rootDir, "inside")
+	if err := os.Mkdir(insideDir, 0777); err != nil {
+		t.Fatalf("creating test directory failed: %s", err)
+	}
+	escapeLink := filepath.Join(rootDir, "escape")
+	if err := os.Symlink(outsideDir, escapeLink); err != nil {
+		t.Skipf("symlinks not supported: %s", err)
+	}
+	insideLink := filepath.Join(rootDir, "link")
+	if err := os.Symlink(insideDir, insideLink); err != nil {
+		t.Fatalf("creating symlink failed: %s", err)
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetPathPolicy(&PathPolicy{Root: rootDir})
+
+	if err := watcher.Watch(insideDir); err != nil {
+		t.Fatalf("watching %q inside the root failed: %s", insideDir, err)
+	}
+	if err := watcher.Watch(insideLink); err != nil {
+		t.Fatalf("watching symlink %q inside the root failed: %s", insideLink, err)
+	}
+	if err := watcher.Watch(outsideDir); !errors.Is(err, ErrPathDenied) {
+		t.Fatalf("watching %q outside the root: expected ErrPathDenied, got %v", outsideDir, err)
+	}
+	if err := watcher.Watch(escapeLink); !errors.Is(err, ErrPathDenied) {
+		t.Fatalf("watching symlink %q out of the root: expected ErrPathDenied, got %v", escapeLink, err)
+	}
+
+	watcher.SetPathPolicy(&PathPolicy{Root: rootDir, NoFollow: true})
+	if err := watcher.Watch(insideLink); !errors.Is(err, ErrPathDenied) {
+		t.Fatalf("watching symlink %q with NoFollow: expected ErrPathDenied, got %v", insideLink, err)
+	}
+
+	if _, err := os.Stat("/proc"); err == nil {
+		watcher.SetPathPolicy(&PathPolicy{})
+		if err := watcher.Watch("/proc"); !errors.Is(err, ErrPathDenied) {
+			t.Fatalf("watching /proc: expected ErrPathDenied, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A PollMode selects the watches served by polling rather than by kernel
+// notifications (see SetPolling).
+type PollMode int
+
+// defaultPollInterval is the interval of polling if none is given.
+const defaultPollInterval = time.Second
+
+const (
+	PollNever  PollMode = iota // Use kernel notifications only (the default)
+	PollRemote                 // Poll paths on network file systems
+	PollAlways                 // Poll all paths
+)
+
+// SetPolling serves later watches selected by mode by listing and stating
+// their paths every interval instead of by kernel notifications. Kernel
+// notifications miss the changes other machines make on network file
+// systems such as NFS and SMB, which PollRemote detects. Polling reports
+// creates, modifies (a changed size or modification time) and deletes;
+// renames appear as a delete and a create. An interval of zero polls every
+// second.
+func (w *Watcher) SetPolling(mode PollMode, interval time.Duration) {
+	w.polls.setMode(w, mode, interval)
+}
+
+// NativeEvents reports whether the platform has file system notifications.
+// Where it has none, as on js/wasm and plan9, all watches are polled
+// whatever the polling mode.
+func NativeEvents() bool {
+	return nativeEvents
+}
+
+// watchPath adds the kernel watch of path, or polls it.
+func (w *Watcher) watchPath(path string) error {
+	if w.mock != nil {
+		return w.mock.watch(path)
+	}
+	if w.polls.wanted(path) {
+		return w.polls.add(path)
+	}
+	return w.watch(path)
+}
+
+// unwatchPath removes the kernel watch of path, or stops polling it.
+func (w *Watcher) unwatchPath(path string) error {
+	if w.mock != nil {
+		return w.mock.removeWatch(path)
+	}
+	if w.polls.remove(path) {
+		return nil
+	}
+	return w.removeWatch(path)
+}
+
+// A pollTable records the polled paths and their files.
+type pollTable struct {
+	mu     sync.Mutex             // Protects access to the fields below.
+	mode   PollMode               // Watches to poll
+	paths  map[string]bool        // Set of polled paths
+	files  map[string]os.FileInfo // Map of the files of the polled paths (key: path)
+	stop   chan bool              // Closed to stop polling
+	done   chan bool              // Closed when polling has stopped
+	closed bool                   // Set when the watcher is closed
+}
+
+func (t *pollTable) setMode(w *Watcher, mode PollMode, interval time.Duration) {
+	t.stopPolling()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.mode = mode
+	if t.paths == nil {
+		t.paths = make(map[string]bool)
+		t.files = make(map[string]os.FileInfo)
+	}
+	// Once closed, the internal event channel is closed or about to be
+	if t.closed || (mode == PollNever && len(t.paths) == 0 && nativeEvents) {
+		return
+	}
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	t.stop, t.done = make(chan bool), make(chan bool)
+	go t.poll(w, interval, t.stop, t.done)
+}
+
+// wanted reports whether path is to be polled.
+func (t *pollTable) wanted(path string) bool {
+	t.mu.Lock()
+	mode := t.mode
+	t.mu.Unlock()
+	switch mode {
+	case PollAlways:
+		return true
+	case PollRemote:
+		return isRemoteFS(path)
+	}
+	return false
+}
+
+// add starts polling path, recording its current files.
+func (t *pollTable) add(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.paths[path] = true
+	for name, fi := range scanPath(path) {
+		t.files[name] = fi
+	}
+	return nil
+}
+
+// remove stops polling path, reporting whether it was polled.
+func (t *pollTable) remove(path string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.paths[path] {
+		return false
+	}
+	delete(t.paths, path)
+	for name := range t.files {
+		if name == path || filepath.Dir(name) == path {
+			delete(t.files, name)
+		}
+	}
+	return true
+}
+
+func (t *pollTable) poll(w *Watcher, interval time.Duration, stop, done chan bool) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+		for _, ev := range t.changes() {
+			if !w.queueStop(ev, stop) {
+				return
+			}
+		}
+	}
+}
+
+// changes returns the changes to the polled paths since the last poll.
+func (t *pollTable) changes() []*FileEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	paths := make([]string, 0, len(t.paths))
+	for path := range t.paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var events []*FileEvent
+	for _, path := range paths {
+		events = append(events, diffPath(path, t.files)...)
+	}
+	return events
+}
+
+// close stops polling for good. It must be called before the internal
+// event channel of the watcher is closed.
+func (t *pollTable) close() {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	t.stopPolling()
+}
+
+// stopPolling stops the polling goroutine, if any.
+func (t *pollTable) stopPolling() {
+	t.mu.Lock()
+	stop, done := t.stop, t.done
+	t.stop, t.done = nil, nil
+	t.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
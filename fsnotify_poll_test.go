@@ -0,0 +1,115 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFsnotifyPolling(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetPolling(PollAlways, 50*time.Millisecond)
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	testFile := filepath.Join(testDir, "TestFsnotifyPolling.testfile")
+	var createReceived, modifyReceived, deleteReceived counter
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			if event.Name != testFile {
+				t.Errorf("event received for unexpected file %s", event.Name)
+			}
+			switch {
+			case event.IsCreate():
+				createReceived.increment()
+			case event.IsModify():
+				modifyReceived.increment()
+			case event.IsDelete():
+				deleteReceived.increment()
+			}
+		}
+	}()
+
+	addWatch(t, watcher, testDir)
+
+	// Write through a file renamed over the test file, so that no poll
+	// sees it truncated or partly written
+	tmpDir := tempMkdir(t)
+	defer os.RemoveAll(tmpDir)
+	write := func(data string) {
+		tmp := filepath.Join(tmpDir, "TestFsnotifyPolling.tmp")
+		if err := ioutil.WriteFile(tmp, []byte(data), 0666); err != nil {
+			t.Fatalf("writing test file failed: %s", err)
+		}
+		if err := os.Rename(tmp, testFile); err != nil {
+			t.Fatalf("renaming test file failed: %s", err)
+		}
+	}
+
+	write("data")
+	time.Sleep(200 * time.Millisecond)
+	write("more data")
+	time.Sleep(200 * time.Millisecond)
+	if err := os.Remove(testFile); err != nil {
+		t.Fatalf("removing test file failed: %s", err)
+	}
+
+	// Each change is seen by the next poll; wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if createReceived.value() != 1 || modifyReceived.value() != 1 || deleteReceived.value() != 1 {
+		t.Fatalf("incorrect number of create, modify and delete events received after 500 ms (%d, %d, %d vs 1 each)", createReceived.value(), modifyReceived.value(), deleteReceived.value())
+	}
+
+	// Removing the watch stops polling
+	if err := watcher.RemoveWatch(testDir); err != nil {
+		t.Fatalf("removing watch failed: %s", err)
+	}
+	if err := ioutil.WriteFile(testFile, []byte("data"), 0666); err != nil {
+		t.Fatalf("writing test file failed: %s", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if createReceived.value() != 1 {
+		t.Fatalf("events received after removing the watch")
+	}
+}
+
+func TestFsnotifyPollingAfterClose(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	watcher.SetPolling(PollAlways, 10*time.Millisecond)
+	addWatch(t, watcher, testDir)
+	watcher.Close()
+
+	// Polling is not started again once the internal channel is closed
+	watcher.SetPolling(PollAlways, 10*time.Millisecond)
+	if err := ioutil.WriteFile(filepath.Join(testDir, "TestFsnotifyPollingAfterClose.testfile"), nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	watcher.polls.mu.Lock()
+	started := watcher.polls.done != nil
+	watcher.polls.mu.Unlock()
+	if started {
+		t.Fatal("SetPolling after Close started polling")
+	}
+}
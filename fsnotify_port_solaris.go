@@ -0,0 +1,109 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build solaris
+
+package fsnotify
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// The syscall package offers no event ports, so call libc directly, as it
+// does for its own system calls on Solaris.
+
+//go:cgo_import_dynamic libc_port_create port_create "libc.so"
+//go:cgo_import_dynamic libc_port_associate port_associate "libc.so"
+//go:cgo_import_dynamic libc_port_dissociate port_dissociate "libc.so"
+//go:cgo_import_dynamic libc_port_get port_get "libc.so"
+
+//go:linkname procPortCreate libc_port_create
+//go:linkname procPortAssociate libc_port_associate
+//go:linkname procPortDissociate libc_port_dissociate
+//go:linkname procPortGet libc_port_get
+
+var (
+	procPortCreate,
+	procPortAssociate,
+	procPortDissociate,
+	procPortGet uintptr
+)
+
+//go:linkname sysvicall6 syscall.sysvicall6
+func sysvicall6(trap, nargs, a1, a2, a3, a4, a5, a6 uintptr) (r1, r2 uintptr, err syscall.Errno)
+
+const (
+	// Event sources (from <sys/port.h>)
+	sys_PORT_SOURCE_FILE = 7
+
+	// Events (from <sys/port.h>)
+	sys_FILE_ACCESS   = 0x00000001
+	sys_FILE_MODIFIED = 0x00000002
+	sys_FILE_ATTRIB   = 0x00000004
+	sys_FILE_TRUNC    = 0x00100000
+	sys_FILE_NOFOLLOW = 0x10000000
+
+	// Exceptions, always reported (from <sys/port.h>)
+	sys_FILE_DELETE      = 0x00000010
+	sys_FILE_RENAME_TO   = 0x00000020
+	sys_FILE_RENAME_FROM = 0x00000040
+	sys_UNMOUNTED        = 0x20000000
+	sys_MOUNTEDOVER      = 0x40000000
+)
+
+// fileObj is struct file_obj of <sys/port.h>. The port refers to it by
+// address while it is associated, so it must be kept referenced.
+type fileObj struct {
+	atime syscall.Timespec // Times the file had when associated; the port
+	mtime syscall.Timespec // reports an event at once if they differ
+	ctime syscall.Timespec
+	pad   [3]uintptr
+	name  *byte // NUL terminated path
+}
+
+// portEvent is port_event_t of <sys/port.h>.
+type portEvent struct {
+	events int32  // Events detected
+	source uint16 // Event source
+	pad    uint16
+	object uintptr // Address of the fileObj
+	user   uintptr // Value given to port_associate
+}
+
+func portCreate() (int, error) {
+	r, _, errno := sysvicall6(uintptr(unsafe.Pointer(&procPortCreate)), 0, 0, 0, 0, 0, 0, 0)
+	if errno != 0 {
+		return -1, os.NewSyscallError("port_create", errno)
+	}
+	return int(r), nil
+}
+
+func portAssociate(port int, fobj *fileObj, events int, user uintptr) error {
+	_, _, errno := sysvicall6(uintptr(unsafe.Pointer(&procPortAssociate)), 5, uintptr(port), sys_PORT_SOURCE_FILE,
+		uintptr(unsafe.Pointer(fobj)), uintptr(events), user, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func portDissociate(port int, fobj *fileObj) error {
+	_, _, errno := sysvicall6(uintptr(unsafe.Pointer(&procPortDissociate)), 3, uintptr(port), sys_PORT_SOURCE_FILE,
+		uintptr(unsafe.Pointer(fobj)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func portGet(port int, pe *portEvent, timeout *syscall.Timespec) error {
+	_, _, errno := sysvicall6(uintptr(unsafe.Pointer(&procPortGet)), 3, uintptr(port), uintptr(unsafe.Pointer(pe)),
+		uintptr(unsafe.Pointer(timeout)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+// A Process identifies the process that caused an event.
+type Process struct {
+	PID int // Process ID
+	UID int // Effective user ID, or -1 if the process exited before it was known
+}
+
+// SetProcessTracking enables reporting the process that caused each event
+// (see FileEvent.Process), for auditing. Only fanotify reports processes,
+// so it applies to the events of WatchMount on Linux, which needs
+// CAP_SYS_ADMIN; where WatchMount falls back to watching the tree, and on
+// other platforms, events carry no process.
+func (w *Watcher) SetProcessTracking(enable bool) {
+	w.setProcessTracking(enable)
+}
+
+// Process returns the process that caused the event, if it is known (see
+// SetProcessTracking).
+func (e *FileEvent) Process() (p Process, ok bool) {
+	if e.proc == nil {
+		return Process{}, false
+	}
+	return *e.proc, true
+}
@@ -0,0 +1,106 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"sync"
+	"time"
+)
+
+// A RecentEvent is a delivered event and the time it was delivered.
+type RecentEvent struct {
+	Time  time.Time
+	Event *FileEvent
+}
+
+// SetRecent keeps the last size delivered events, for debugging and for
+// late readers wanting a brief history (see Recent). A size of zero
+// disables it and discards the history.
+func (w *Watcher) SetRecent(size int) {
+	w.recent.setSize(size)
+}
+
+// Recent returns up to n of the most recently delivered events, oldest
+// first. It only has history once SetRecent is called.
+func (w *Watcher) Recent(n int) []RecentEvent {
+	return w.recent.last(n)
+}
+
+// A recentBuffer is a ring of the last delivered events.
+type recentBuffer struct {
+	mu     sync.Mutex    // Protects access to events, next and full.
+	events []RecentEvent // Ring of events (nil when disabled)
+	next   int           // Index of the slot written next
+	full   bool          // Set once the ring has wrapped
+}
+
+// recordingHandler records the events that reach it, past any middleware.
+type recordingHandler struct {
+	r *recentBuffer
+	h EventHandler
+}
+
+func (rh recordingHandler) HandleEvent(ev *FileEvent) {
+	rh.r.record(ev)
+	rh.h.HandleEvent(ev)
+}
+
+func (r *recentBuffer) setSize(size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.lastLocked(size)
+	r.events, r.next, r.full = nil, 0, false
+	if size <= 0 {
+		return
+	}
+	r.events = make([]RecentEvent, size)
+	r.next = copy(r.events, old)
+	if r.next == size {
+		r.next, r.full = 0, true
+	}
+}
+
+// record adds an event to the ring, overwriting the oldest once it is full.
+func (r *recentBuffer) record(ev *FileEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.events == nil {
+		return
+	}
+	r.events[r.next] = RecentEvent{Time: time.Now(), Event: ev}
+	if r.next++; r.next == len(r.events) {
+		r.next, r.full = 0, true
+	}
+}
+
+func (r *recentBuffer) last(n int) []RecentEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastLocked(n)
+}
+
+// lastLocked returns a copy of up to n of the last events, oldest first.
+// r.mu must be held.
+func (r *recentBuffer) lastLocked(n int) []RecentEvent {
+	count := r.next
+	if r.full {
+		count = len(r.events)
+	}
+	if n > count {
+		n = count
+	}
+	if n <= 0 {
+		return nil
+	}
+	out := make([]RecentEvent, n)
+	start := r.next - n
+	if start < 0 {
+		start += len(r.events)
+	}
+	// The events may wrap around the end of the ring
+	k := copy(out, r.events[start:])
+	copy(out[k:], r.events)
+	return out
+}
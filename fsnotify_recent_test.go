@@ -0,0 +1,102 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRecentBufferWraps(t *testing.T) {
+	var r recentBuffer
+	r.record(newFileEvent("ignored", FSN_CREATE))
+	if got := r.last(10); len(got) != 0 {
+		t.Fatalf("disabled buffer kept %d events", len(got))
+	}
+
+	r.setSize(3)
+	for i := 0; i < 5; i++ {
+		r.record(newFileEvent(strconv.Itoa(i), FSN_MODIFY))
+	}
+	check := func(n int, want ...string) {
+		got := r.last(n)
+		if len(got) != len(want) {
+			t.Fatalf("last(%d) returned %d events, want %d", n, len(got), len(want))
+		}
+		for i, re := range got {
+			if re.Event.Name != want[i] {
+				t.Errorf("last(%d)[%d] = %q, want %q", n, i, re.Event.Name, want[i])
+			}
+		}
+	}
+	check(10, "2", "3", "4")
+	check(2, "3", "4")
+	check(0)
+
+	// Growing keeps the history
+	r.setSize(4)
+	check(10, "2", "3", "4")
+	r.record(newFileEvent("5", FSN_MODIFY))
+	r.record(newFileEvent("6", FSN_MODIFY))
+	check(10, "3", "4", "5", "6")
+
+	// Shrinking keeps the newest
+	r.setSize(2)
+	check(10, "5", "6")
+}
+
+func TestFsnotifyRecent(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetRecent(2)
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	// Drain the Event channel; the history is kept regardless
+	go func() {
+		for range watcher.Event {
+		}
+	}()
+
+	addWatch(t, watcher, testDir)
+
+	start := time.Now()
+	for _, name := range []string{"a", "b", "c"} {
+		f, err := os.OpenFile(filepath.Join(testDir, name), os.O_WRONLY|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+		f.Close()
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	recent := watcher.Recent(10)
+	if len(recent) != 2 {
+		t.Fatalf("incorrect number of recent events after 500 ms (%d vs %d)", len(recent), 2)
+	}
+	for i, name := range []string{"b", "c"} {
+		re := recent[i]
+		if re.Event.Name != filepath.Join(testDir, name) || !re.Event.IsCreate() {
+			t.Errorf("recent event %d is %s, want the create of %s", i, re.Event, name)
+		}
+		if re.Time.Before(start) {
+			t.Errorf("recent event %d has time %s, before the test started", i, re.Time)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package fsnotify
+
+import "strings"
+
+// maxMovedDirs is the number of watched directories moved away kept until
+// their IN_MOVED_TO. Those moved out of the watched directories never get
+// one, and are forgotten in bulk.
+const maxMovedDirs = 1024
+
+// remapMove follows the renames of watched directories, pairing the
+// IN_MOVED_FROM and IN_MOVED_TO of a directory by their cookie: the
+// watches of the directory and of those below it are moved to the new
+// name, so that their events are named after it.
+func (w *Watcher) remapMove(mask, cookie uint32, name string) {
+	if mask&sys_IN_ISDIR == 0 || cookie == 0 {
+		return
+	}
+	switch {
+	case mask&sys_IN_MOVED_FROM == sys_IN_MOVED_FROM:
+		w.mu.Lock()
+		_, watched := w.watches[name]
+		w.mu.Unlock()
+		if !watched {
+			return
+		}
+		if len(w.movedDirs) >= maxMovedDirs {
+			w.movedDirs = make(map[uint32]string)
+		}
+		w.movedDirs[cookie] = name
+	case mask&sys_IN_MOVED_TO == sys_IN_MOVED_TO:
+		old, found := w.movedDirs[cookie]
+		if !found {
+			return
+		}
+		delete(w.movedDirs, cookie)
+		w.renamePaths(old, name)
+	}
+}
+
+// renamePaths moves the watches of the directory old and of the paths
+// below it to the directory name.
+func (w *Watcher) renamePaths(old, name string) {
+	below := func(path string) bool {
+		return path == old || strings.HasPrefix(path, old+"/")
+	}
+	var moved []string
+
+	w.mu.Lock()
+	for path := range w.watches {
+		if below(path) {
+			moved = append(moved, path)
+		}
+	}
+	for _, path := range moved {
+		to := name + path[len(old):]
+		watch := w.watches[path]
+		delete(w.watches, path)
+		w.watches[to] = watch
+		w.paths[int(watch.wd)] = to
+	}
+	w.mu.Unlock()
+
+	moved = moved[:0]
+	w.fsnmut.Lock()
+	for path := range w.fsnFlags {
+		if below(path) {
+			moved = append(moved, path)
+		}
+	}
+	for _, path := range moved {
+		to := name + path[len(old):]
+		flags, h := w.fsnFlags[path], w.handlers[path]
+		_, handled := w.handlers[path]
+		delete(w.fsnFlags, path)
+		delete(w.handlers, path)
+		w.fsnFlags[to] = flags
+		if handled {
+			w.handlers[to] = h
+		}
+	}
+	w.fsnmut.Unlock()
+	for _, path := range moved {
+		w.budget.move(path, name+path[len(old):])
+	}
+}
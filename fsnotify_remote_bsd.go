@@ -0,0 +1,37 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build freebsd darwin dragonfly
+
+package fsnotify
+
+import "syscall"
+
+// Network file systems, where kqueue misses the changes made through
+// other machines.
+var remoteFSTypes = map[string]bool{
+	"nfs":     true,
+	"smbfs":   true,
+	"afpfs":   true,
+	"webdav":  true,
+	"fusefs":  true,
+	"osxfuse": true,
+	"macfuse": true,
+}
+
+// isRemoteFS reports whether path is on a network file system.
+func isRemoteFS(path string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false
+	}
+	var b []byte
+	for _, c := range st.Fstypename {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	return remoteFSTypes[string(b)]
+}
@@ -0,0 +1,13 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build openbsd netbsd
+
+package fsnotify
+
+// isRemoteFS reports whether path is on a network file system. The file
+// system type is not told apart here, so PollRemote polls nothing.
+func isRemoteFS(path string) bool {
+	return false
+}
@@ -0,0 +1,32 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build solaris
+
+package fsnotify
+
+import "syscall"
+
+// Network file systems, where event ports miss the changes made through
+// other machines.
+var remoteFSTypes = map[string]bool{
+	"nfs":   true,
+	"smbfs": true,
+}
+
+// isRemoteFS reports whether path is on a network file system.
+func isRemoteFS(path string) bool {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return false
+	}
+	var b []byte
+	for _, c := range st.Fstype {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	return remoteFSTypes[string(b)]
+}
@@ -0,0 +1,78 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"fmt"
+	"time"
+)
+
+// A MoveDirection tells where a file moved by a rename went, relative to
+// the watched paths (see SetRenamePairing).
+type MoveDirection int
+
+const (
+	MoveUnknown MoveDirection = iota // Not a move, or not paired
+	MovedWithin                      // Moved between watched directories, or within one
+	MovedAway                        // Moved out of the watched directories
+	MovedIn                          // Moved in from outside the watched directories
+)
+
+var moveDirectionNames = []string{"UNKNOWN", "WITHIN", "AWAY", "IN"}
+
+func (d MoveDirection) String() string {
+	if d < 0 || int(d) >= len(moveDirectionNames) {
+		return fmt.Sprintf("MoveDirection(%d)", int(d))
+	}
+	return moveDirectionNames[d]
+}
+
+// SetRenamePairing pairs the two halves of renames, the rename event for
+// the old name and the create event for the new name, to tell where files
+// went (see FileEvent.Move). A rename event is held until the create event
+// of its pair arrives, or for at most timeout; if none arrives, the file
+// was moved out of the watched directories, and the event is delivered as
+// MovedAway. A create event with no rename event before it was moved in,
+// and is delivered as MovedIn. A timeout of zero stops pairing.
+//
+// Only inotify ties the halves of a rename together, so renames are only
+// paired on Linux.
+func (w *Watcher) SetRenamePairing(timeout time.Duration) {
+	w.setRenamePairing(timeout)
+}
+
+// Move reports where the file of a rename event, or of a create event for
+// a file moved in, went (see SetRenamePairing).
+func (e *FileEvent) Move() MoveDirection {
+	return e.move
+}
+
+// OldPath returns the name the file of a rename or move had before it: the
+// old name of a rename delivered as one event (see SetCompositeEvents), the
+// source of a probable move (see ProbableMove), or the name of a rename
+// event for the old name. It returns "" for other events.
+func (e *FileEvent) OldPath() string {
+	switch {
+	case len(e.parts) == 2 && e.parts[0].IsRename():
+		return e.parts[0].Name
+	case e.movedFrom != "":
+		return e.movedFrom
+	case e.IsRename() && !e.movedTo():
+		return e.Name
+	}
+	return ""
+}
+
+// NewPath returns the name the file of a rename or move has after it: the
+// name of a rename delivered as one event, of a probable move, or of an
+// event for the new name of a rename, which only Linux and Windows report.
+// It returns "" for other events, including rename events for the old
+// name, whose new name is not known unless paired.
+func (e *FileEvent) NewPath() string {
+	if e.movedTo() || e.movedFrom != "" {
+		return e.Name
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package fsnotify
+
+import (
+	"sync"
+	"time"
+)
+
+func (w *Watcher) setRenamePairing(timeout time.Duration) {
+	w.renames.mu.Lock()
+	defer w.renames.mu.Unlock()
+	w.renames.timeout = timeout
+	if w.renames.pending == nil {
+		w.renames.pending = make(map[uint32]*heldRename)
+		w.renames.stop = make(chan bool)
+	}
+}
+
+func (w *Watcher) setCompositeRenames(enable bool) {
+	w.renames.mu.Lock()
+	defer w.renames.mu.Unlock()
+	w.renames.composite = enable
+}
+
+// A renameTable pairs the IN_MOVED_FROM and IN_MOVED_TO events of renames
+// by their cookies.
+type renameTable struct {
+	mu        sync.Mutex             // Protects access to the fields below.
+	timeout   time.Duration          // Time an IN_MOVED_FROM waits for its pair (zero if renames are not paired)
+	composite bool                   // Set if the halves of a pair are delivered as one event
+	pending   map[uint32]*heldRename // Renames waiting for their pair (key: cookie)
+	stop      chan bool              // Closed to stop the timers
+	closed    bool                   // Set once the watcher is closed
+	wg        sync.WaitGroup         // Timers delivering events
+}
+
+// A heldRename is an IN_MOVED_FROM waiting for its IN_MOVED_TO.
+type heldRename struct {
+	ev    *FileEvent // Event held, or nil if the flags of its watch drop it
+	timer *time.Timer
+}
+
+// note records the half of a rename with the given mask and cookie,
+// whether or not its event is delivered, and returns its direction. The
+// IN_MOVED_FROM of an IN_MOVED_TO is returned to be delivered first.
+func (t *renameTable) note(w *Watcher, mask, cookie uint32) (MoveDirection, *FileEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timeout == 0 || t.closed || cookie == 0 {
+		return MoveUnknown, nil
+	}
+	switch {
+	case mask&sys_IN_MOVED_FROM == sys_IN_MOVED_FROM:
+		h := &heldRename{}
+		t.pending[cookie] = h
+		t.wg.Add(1)
+		h.timer = time.AfterFunc(t.timeout, func() { t.expire(w, cookie, h) })
+		return MovedAway, nil
+	case mask&sys_IN_MOVED_TO == sys_IN_MOVED_TO:
+		h, found := t.pending[cookie]
+		if !found {
+			return MovedIn, nil
+		}
+		delete(t.pending, cookie)
+		if h.timer.Stop() {
+			t.wg.Done()
+		}
+		if h.ev != nil {
+			h.ev.move = MovedWithin
+		}
+		return MovedWithin, h.ev
+	}
+	return MoveUnknown, nil
+}
+
+// composing reports whether the halves of a pair are delivered as one
+// event.
+func (t *renameTable) composing() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.composite
+}
+
+// hold holds the event of an IN_MOVED_FROM noted before until its pair
+// arrives, reporting whether it is held.
+func (t *renameTable) hold(ev *FileEvent) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h, found := t.pending[ev.cookie]
+	if !found {
+		return false
+	}
+	h.ev = ev
+	return true
+}
+
+// expire delivers a rename whose pair did not arrive in time as moved away.
+func (t *renameTable) expire(w *Watcher, cookie uint32, h *heldRename) {
+	defer t.wg.Done()
+	t.mu.Lock()
+	if t.pending[cookie] != h {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.pending, cookie)
+	stop := t.stop
+	t.mu.Unlock()
+	if h.ev == nil {
+		return
+	}
+	h.ev.move = MovedAway
+	w.queueStop(h.ev, stop)
+}
+
+// close stops pairing renames, dropping those still held. It must be
+// called before the internal event channel of the watcher is closed.
+func (t *renameTable) close() {
+	t.mu.Lock()
+	if t.closed || t.pending == nil {
+		t.closed = true
+		t.mu.Unlock()
+		return
+	}
+	t.closed = true
+	for cookie, h := range t.pending {
+		if h.timer.Stop() {
+			t.wg.Done()
+		}
+		delete(t.pending, cookie)
+	}
+	close(t.stop)
+	t.mu.Unlock()
+	t.wg.Wait()
+}
@@ -0,0 +1,14 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux,!windows
+
+package fsnotify
+
+import "time"
+
+// Renames are only reported in pairs by inotify and ReadDirectoryChangesW.
+func (w *Watcher) setRenamePairing(timeout time.Duration) {}
+
+func (w *Watcher) setCompositeRenames(enable bool) {}
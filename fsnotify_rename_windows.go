@@ -0,0 +1,58 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build windows
+
+package fsnotify
+
+import (
+	"sync"
+	"time"
+)
+
+// ReadDirectoryChangesW reports the old name of a rename right before the
+// new one, in the same buffer, so renames need no timeout to be paired.
+func (w *Watcher) setRenamePairing(timeout time.Duration) {}
+
+func (w *Watcher) setCompositeRenames(enable bool) {
+	w.renames.mu.Lock()
+	defer w.renames.mu.Unlock()
+	w.renames.composite = enable
+}
+
+// A renameTable combines the old and new names of renames into one event.
+type renameTable struct {
+	mu        sync.Mutex // Protects access to composite.
+	composite bool       // Set if the halves of a rename are delivered as one event
+	held      *FileEvent // Old name waiting for the new one (used by the I/O thread only)
+}
+
+func (t *renameTable) composing() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.composite
+}
+
+// pair returns the event to deliver for ev, combined with the old name
+// held if it is the new name of the same rename, and the old name held
+// otherwise, to be delivered first. An old name is held and nil returned.
+func (t *renameTable) pair(ev *FileEvent) (held, deliver *FileEvent) {
+	held, t.held = t.held, nil
+	switch {
+	case ev.mask&sys_FS_MOVED_FROM != 0 && t.composing():
+		t.held = ev
+		return held, nil
+	case held != nil && ev.mask&sys_FS_MOVED_TO != 0 && ev.cookie == held.cookie:
+		held.move, ev.move = MovedWithin, MovedWithin
+		return nil, compose(ev, held, ev)
+	}
+	return held, ev
+}
+
+// flush returns the old name held, if any, whose new name did not follow.
+func (t *renameTable) flush() *FileEvent {
+	held := t.held
+	t.held = nil
+	return held
+}
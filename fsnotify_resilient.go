@@ -0,0 +1,52 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+// SetResilient keeps watching paths that are deleted or renamed away and
+// later appear again, as when logrotate or an editor replaces a file.
+// Without it, no further events arrive for such a path. The delete or
+// rename event is delivered as usual; the watch then waits for the path as
+// a pending watch does (see SetPendingWatches). When the path reappears,
+// it is watched again with the same flags and handler, and a create event
+// is delivered for it, followed by a modify event if it is a file with
+// content. RemoveWatch stops waiting.
+//
+// The directories of watched trees are not watched again, as the tree
+// watch follows them itself.
+func (w *Watcher) SetResilient(enable bool) {
+	w.pending.mu.Lock()
+	w.pending.resilient = enable
+	w.pending.mu.Unlock()
+}
+
+// rewatch has a watched path that ev deleted or renamed away watched again
+// when it reappears, if watches are resilient. It is called for every
+// event, whether or not the flags of the watch deliver it.
+func (w *Watcher) rewatch(ev *FileEvent) {
+	if !ev.IsDelete() && !ev.IsRename() {
+		return
+	}
+	w.pending.mu.Lock()
+	resilient := w.pending.resilient
+	w.pending.mu.Unlock()
+	if !resilient || w.trees.covers(ev.Name) {
+		return
+	}
+	w.fsnmut.Lock()
+	flags := w.fsnFlags[ev.Name]
+	h, watched := w.handlers[ev.Name]
+	w.fsnmut.Unlock()
+	if !watched {
+		return
+	}
+	if ev.IsRename() {
+		// The watch may have followed the file to its new name
+		w.removePath(ev.Name)
+	}
+	p := &pendingPath{arg: ev.Name, flags: flags, h: h, rewatch: true}
+	if err := w.pending.add(w, ev.Name, p); err != nil {
+		w.deliverError(err)
+	}
+}
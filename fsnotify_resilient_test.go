@@ -0,0 +1,88 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testResilient(t *testing.T, replace func(testFile string)) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	testFile := filepath.Join(testDir, "TestFsnotifyResilient.testfile")
+	if err := ioutil.WriteFile(testFile, []byte("old"), 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetResilient(true)
+
+	var createReceived, modifyReceived counter
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			switch {
+			case event.Name != testFile:
+			case event.IsCreate():
+				createReceived.increment()
+			case event.IsModify():
+				modifyReceived.increment()
+			}
+		}
+	}()
+
+	addWatch(t, watcher, testFile)
+	replace(testFile)
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if createReceived.value() != 1 {
+		t.Fatalf("incorrect number of create events received after 500 ms (%d vs %d)", createReceived.value(), 1)
+	}
+	if modifyReceived.value() == 0 {
+		t.Fatal("no modify event received for a file reappearing with content")
+	}
+
+	modified := modifyReceived.value()
+	if err := ioutil.WriteFile(testFile, []byte("newer"), 0666); err != nil {
+		t.Fatalf("writing test file failed: %s", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if modifyReceived.value() == modified {
+		t.Fatal("no modify event received after the watch was re-established")
+	}
+}
+
+func TestFsnotifyResilientRecreate(t *testing.T) {
+	testResilient(t, func(testFile string) {
+		if err := os.Remove(testFile); err != nil {
+			t.Fatalf("removing test file failed: %s", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		if err := ioutil.WriteFile(testFile, []byte("new"), 0666); err != nil {
+			t.Fatalf("recreating test file failed: %s", err)
+		}
+	})
+}
+
+func TestFsnotifyResilientRotate(t *testing.T) {
+	testResilient(t, func(testFile string) {
+		// As logrotate does
+		if err := os.Rename(testFile, testFile+".1"); err != nil {
+			t.Fatalf("renaming test file failed: %s", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		if err := ioutil.WriteFile(testFile, []byte("new"), 0666); err != nil {
+			t.Fatalf("recreating test file failed: %s", err)
+		}
+	})
+}
@@ -0,0 +1,316 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SetResumeRescan rescans the watched paths (see Rescan) when the system
+// resumes from sleep, during which changes may have gone unreported. Every
+// interval, the time passed on the wall clock is compared with the time
+// passed on the monotonic clock, which stops during sleep. An interval of
+// zero disables it. Enable it before adding watches so the existing files
+// are known.
+func (w *Watcher) SetResumeRescan(interval time.Duration) {
+	w.scans.setInterval(w, interval)
+}
+
+// Rescan compares the watched paths with their state when last seen and
+// delivers events for the differences: a create for a new file, a modify
+// for a file whose size or modification time changed and a delete for a
+// file that is gone. It requires SetResumeRescan, and returns an error
+// after Close.
+func (w *Watcher) Rescan() error {
+	stop, err := w.drain.enter()
+	if err != nil {
+		return err
+	}
+	defer w.drain.exit()
+	w.rescan(stop)
+	return nil
+}
+
+// rescan does the work of Rescan, until stop is closed.
+func (w *Watcher) rescan(stop chan bool) {
+	start := time.Now()
+	paths := w.watchedPaths()
+	for _, ev := range w.scans.diff(paths) {
+		if !w.queueStop(ev, stop) {
+			return
+		}
+	}
+	if w.scans.enabled() {
+		w.consistency.recover(paths, start)
+	}
+}
+
+// slept reports whether the system slept for longer than interval, given
+// the time passed on the monotonic and the wall clock.
+func slept(mono, wall, interval time.Duration) bool {
+	return wall-mono > interval
+}
+
+// A scanTable records the watched files, to find the changes missed while
+// the system slept or events were lost.
+type scanTable struct {
+	mu      sync.Mutex             // Protects access to the fields below.
+	files   map[string]os.FileInfo // Map of known files (nil unless resume rescans are enabled)
+	pending map[string]bool        // Watched paths to rescan for lost events
+	wake    chan bool              // Signaled when paths are pending
+	stop    chan bool              // Closed to stop checking for sleep
+	done    chan bool              // Closed when checking for sleep has stopped
+}
+
+func (t *scanTable) setInterval(w *Watcher, interval time.Duration) {
+	t.close()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if interval <= 0 {
+		t.files = nil
+		return
+	}
+	if t.files == nil {
+		t.files = make(map[string]os.FileInfo)
+	}
+	t.stop, t.done = make(chan bool), make(chan bool)
+	t.wake = make(chan bool, 1)
+	go t.detectSleep(w, interval, t.wake, t.stop, t.done)
+}
+
+// detectSleep rescans the watched paths after sleep, and the paths
+// requested by rescanLost as they are.
+func (t *scanTable) detectSleep(w *Watcher, interval time.Duration, wake, stop, done chan bool) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+		case <-wake:
+			t.rescanPending(w, stop)
+			continue
+		case <-stop:
+			return
+		}
+		now := time.Now()
+		// Round(0) strips the monotonic reading, leaving the wall clock
+		if slept(now.Sub(last), now.Round(0).Sub(last.Round(0)), interval) {
+			w.rescan(stop)
+		}
+		last = now
+	}
+}
+
+func (t *scanTable) enabled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.files != nil
+}
+
+// rescanLost requests a rescan of the watched paths roots, whose events
+// were lost, reporting false if resume rescans are not enabled.
+func (t *scanTable) rescanLost(roots []string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.files == nil || t.wake == nil {
+		return false
+	}
+	if t.pending == nil {
+		t.pending = make(map[string]bool)
+	}
+	for _, root := range roots {
+		t.pending[root] = true
+	}
+	select {
+	case t.wake <- true:
+	default:
+	}
+	return true
+}
+
+// rescanPending rescans the paths requested by rescanLost, until stop is
+// closed.
+func (t *scanTable) rescanPending(w *Watcher, stop chan bool) {
+	t.mu.Lock()
+	var roots []string
+	for root := range t.pending {
+		roots = append(roots, root)
+	}
+	t.pending = nil
+	t.mu.Unlock()
+	sort.Strings(roots)
+	start := time.Now()
+	for _, ev := range t.diff(roots) {
+		if !w.queueStop(ev, stop) {
+			return
+		}
+	}
+	w.consistency.recover(roots, start)
+}
+
+// close stops checking for sleep. It must be called before the internal
+// event channel of the watcher is closed.
+func (t *scanTable) close() {
+	t.mu.Lock()
+	stop, done := t.stop, t.done
+	t.stop, t.done, t.wake = nil, nil, nil
+	t.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// snapshot records a newly watched file, or the files in a newly watched
+// directory.
+func (t *scanTable) snapshot(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.files == nil {
+		return
+	}
+	for name, fi := range scanPath(path) {
+		t.files[name] = fi
+	}
+}
+
+// update records the file an event refers to.
+func (t *scanTable) update(ev *FileEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.files == nil {
+		return
+	}
+	if ev.IsDelete() || ev.IsRename() {
+		delete(t.files, ev.Name)
+		return
+	}
+	if fi, err := os.Stat(ev.Name); err == nil {
+		t.files[ev.Name] = fi
+	}
+}
+
+// forget marks the files of dropped events as not seen in their reported
+// state, so that the rescan of their root reports them again: a file
+// reported created as unknown, others as changed.
+func (t *scanTable) forget(dropped []*FileEvent) {
+	if len(dropped) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.files == nil {
+		return
+	}
+	for _, ev := range dropped {
+		parts := ev.parts
+		if parts == nil {
+			parts = []*FileEvent{ev}
+		}
+		for _, part := range parts {
+			switch {
+			case part.Name == "":
+			case part.IsCreate():
+				delete(t.files, part.Name)
+			default:
+				t.files[part.Name] = lostFile(part.Name)
+			}
+		}
+	}
+}
+
+// diff records the current state of the watched paths and returns the
+// events turning the recorded state into it.
+func (t *scanTable) diff(paths []string) []*FileEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.files == nil {
+		return nil
+	}
+	var events []*FileEvent
+	for _, path := range paths {
+		events = append(events, diffPath(path, t.files)...)
+	}
+	return events
+}
+
+// diffPath updates the files recorded for path, a file or directory, to
+// their current state, returning the events turning one into the other.
+func diffPath(path string, files map[string]os.FileInfo) []*FileEvent {
+	current := scanPath(path)
+	var names []string
+	for name := range current {
+		names = append(names, name)
+	}
+	for name := range files {
+		if _, found := current[name]; !found && (name == path || filepath.Dir(name) == path) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var events []*FileEvent
+	for _, name := range names {
+		fi, found := current[name]
+		old, known := files[name]
+		var ev *FileEvent
+		switch {
+		case !found:
+			delete(files, name)
+			ev = newFileEvent(name, FSN_DELETE)
+			ev.dir = old.IsDir()
+		case !known:
+			files[name] = fi
+			ev = newFileEvent(name, FSN_CREATE)
+			ev.dir = fi.IsDir()
+		case fi.Size() != old.Size() || !fi.ModTime().Equal(old.ModTime()):
+			files[name] = fi
+			ev = newFileEvent(name, FSN_MODIFY)
+			ev.dir = fi.IsDir()
+		default:
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+// A lostFile stands for a file whose state is unknown, differing from any
+// it is found in.
+type lostFile string
+
+func (f lostFile) Name() string       { return filepath.Base(string(f)) }
+func (f lostFile) Size() int64        { return -1 }
+func (f lostFile) Mode() os.FileMode  { return 0 }
+func (f lostFile) ModTime() time.Time { return time.Time{} }
+func (f lostFile) IsDir() bool        { return false }
+func (f lostFile) Sys() interface{}   { return nil }
+
+// scanPath returns the file path, or the files in the directory path.
+func scanPath(path string) map[string]os.FileInfo {
+	files := make(map[string]os.FileInfo)
+	fi, err := os.Stat(path)
+	if err != nil {
+		return files
+	}
+	if !fi.IsDir() {
+		files[path] = fi
+		return files
+	}
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return files
+	}
+	for _, fi := range entries {
+		files[filepath.Join(path, fi.Name())] = fi
+	}
+	return files
+}
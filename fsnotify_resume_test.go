@@ -0,0 +1,146 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSlept(t *testing.T) {
+	tests := []struct {
+		mono, wall time.Duration
+		want       bool
+	}{
+		{time.Second, time.Second, false},
+		{time.Second, time.Second + 10*time.Millisecond, false},
+		{time.Second, time.Hour, true},
+		{time.Second, -time.Hour, false}, // The clock was set back
+	}
+	for _, test := range tests {
+		if got := slept(test.mono, test.wall, time.Second); got != test.want {
+			t.Errorf("slept(%s, %s) = %v, want %v", test.mono, test.wall, got, test.want)
+		}
+	}
+}
+
+func TestFsnotifyRescan(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	created := filepath.Join(testDir, "TestFsnotifyRescan.created")
+	modified := filepath.Join(testDir, "TestFsnotifyRescan.modified")
+	deleted := filepath.Join(testDir, "TestFsnotifyRescan.deleted")
+	for _, name := range []string{created, modified} {
+		if err := ioutil.WriteFile(name, []byte("data"), 0666); err != nil {
+			t.Fatalf("writing test file failed: %s", err)
+		}
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetResumeRescan(time.Minute)
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	var createReceived, modifyReceived, deleteReceived, otherReceived counter
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			switch {
+			case event.Name == created && event.IsCreate():
+				createReceived.increment()
+			case event.Name == modified && event.IsModify():
+				modifyReceived.increment()
+			case event.Name == deleted && event.IsDelete():
+				deleteReceived.increment()
+			default:
+				otherReceived.increment()
+			}
+		}
+	}()
+
+	addWatch(t, watcher, testDir)
+
+	// Pretend the state when last seen was different, as after changes
+	// made while the system slept
+	stale, err := os.Stat(testDir)
+	if err != nil {
+		t.Fatalf("stat of test directory failed: %s", err)
+	}
+	watcher.scans.mu.Lock()
+	delete(watcher.scans.files, created)
+	watcher.scans.files[modified] = stale
+	watcher.scans.files[deleted] = stale
+	watcher.scans.mu.Unlock()
+
+	for i := 0; i < 2; i++ {
+		if err := watcher.Rescan(); err != nil {
+			t.Fatalf("watcher.Rescan() failed: %s", err)
+		}
+	}
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if createReceived.value() != 1 || modifyReceived.value() != 1 || deleteReceived.value() != 1 {
+		t.Fatalf("incorrect number of create, modify and delete events received after 500 ms (%d, %d, %d vs 1 each)", createReceived.value(), modifyReceived.value(), deleteReceived.value())
+	}
+	if otherReceived.value() != 0 {
+		t.Fatalf("unexpected events received (%d)", otherReceived.value())
+	}
+}
+
+func TestFsnotifyRescanClose(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	watcher.SetResumeRescan(time.Hour)
+	go func() {
+		for range watcher.Error {
+		}
+	}()
+	addWatch(t, watcher, testDir)
+
+	// Files unknown to the rescan, whose events nobody reads
+	watcher.scans.mu.Lock()
+	for i := 0; i < 10; i++ {
+		name := filepath.Join(testDir, fmt.Sprintf("file%d.testfile", i))
+		if err := ioutil.WriteFile(name, nil, 0666); err != nil {
+			watcher.scans.mu.Unlock()
+			t.Fatalf("creating test file failed: %s", err)
+		}
+	}
+	watcher.scans.files = make(map[string]os.FileInfo)
+	watcher.scans.mu.Unlock()
+	rescanned := make(chan error, 1)
+	go func() { rescanned <- watcher.Rescan() }()
+	time.Sleep(100 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- watcher.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close blocked on a rescan nobody reads")
+	}
+	if err := <-rescanned; err != nil {
+		t.Fatalf("watcher.Rescan() failed: %s", err)
+	}
+	if err := watcher.Rescan(); err == nil {
+		t.Fatal("watcher.Rescan() after Close succeeded")
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxSymlinks bounds the symlinks followed resolving a path in the root,
+// as the kernel does.
+const maxSymlinks = 40
+
+// ErrOutsideRoot is returned for a path that leads out of the root set by
+// SetRootBeneath.
+var ErrOutsideRoot = errors.New("fsnotify: path leads out of the root")
+
+// SetRoot confines the watcher to the tree of base, as if it were the root
+// directory: later watched paths, relative or absolute, are resolved inside
+// base, and ".." and absolute symlinks are clamped to it. Events name the
+// resolved paths. An empty base removes the restriction.
+//
+// On Linux the kernel resolves paths (openat2 with RESOLVE_IN_ROOT) where
+// available, and the inotify watch is added on the file so resolved, so
+// that a symlink swapped into the path meanwhile has no effect. Elsewhere,
+// and on Linux before 5.6, paths are resolved component by component and
+// watched by name; a symlink swapped into the path between the two can
+// still lead the watch out of base.
+func (w *Watcher) SetRoot(base string) error {
+	return w.setRoot(base, false)
+}
+
+// SetRootBeneath is like SetRoot, but a path that leads out of base
+// through ".." or an absolute symlink is rejected with ErrOutsideRoot,
+// as with RESOLVE_BENEATH, rather than clamped to base.
+func (w *Watcher) SetRootBeneath(base string) error {
+	return w.setRoot(base, true)
+}
+
+func (w *Watcher) setRoot(base string, beneath bool) error {
+	if base != "" {
+		abs, err := filepath.Abs(base)
+		if err != nil {
+			return err
+		}
+		if base, err = filepath.EvalSymlinks(abs); err != nil {
+			return err
+		}
+	}
+	w.fsnmut.Lock()
+	w.root = base
+	w.rootBeneath = beneath && base != ""
+	w.fsnmut.Unlock()
+	return nil
+}
+
+// rootPath resolves path in the root of the watcher, if it has one.
+func (w *Watcher) rootPath(path string) (string, error) {
+	w.fsnmut.Lock()
+	root, beneath := w.root, w.rootBeneath
+	w.fsnmut.Unlock()
+	if root == "" {
+		return path, nil
+	}
+	resolved, err := resolveInRootKernel(root, path, beneath)
+	if err == errNoKernelResolve {
+		resolved, err = resolveInRoot(root, path, beneath)
+	}
+	return resolved, err
+}
+
+// rootPathLexical confines path to the root of the watcher, if it has one,
+// without looking at the file system.
+func (w *Watcher) rootPathLexical(path string) string {
+	w.fsnmut.Lock()
+	root := w.root
+	w.fsnmut.Unlock()
+	if root == "" {
+		return path
+	}
+	return filepath.Join(root, filepath.Clean(string(filepath.Separator)+path))
+}
+
+// errNoKernelResolve is returned where the kernel cannot resolve a path
+// in a root.
+var errNoKernelResolve = errors.New("fsnotify: kernel path resolution not available")
+
+// resolveInRoot resolves path in root component by component, clamping
+// ".." and absolute symlinks to root, or rejecting them if beneath. root
+// must be absolute and free of symlinks.
+func resolveInRoot(root, path string, beneath bool) (string, error) {
+	resolved := root
+	parts := splitPath(path)
+	links := 0
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if resolved != root {
+				resolved = filepath.Dir(resolved)
+			} else if beneath {
+				return "", &os.PathError{Op: "resolve", Path: path, Err: ErrOutsideRoot}
+			}
+			continue
+		}
+		next := filepath.Join(resolved, part)
+		fi, err := os.Lstat(next)
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return "", &os.PathError{Op: "resolve", Path: path, Err: errors.New("too many levels of symbolic links")}
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) || filepath.VolumeName(target) != "" {
+			if beneath {
+				return "", &os.PathError{Op: "resolve", Path: path, Err: ErrOutsideRoot}
+			}
+			resolved = root
+			target = target[len(filepath.VolumeName(target)):]
+		}
+		parts = append(splitPath(target), parts...)
+	}
+	return resolved, nil
+}
+
+func splitPath(path string) []string {
+	return strings.Split(filepath.ToSlash(path), "/")
+}
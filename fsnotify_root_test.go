@@ -0,0 +1,139 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFsnotifySetRoot(t *testing.T) {
+	rootDir := tempMkdir(t)
+	defer os.RemoveAll(rootDir)
+	outsideDir := tempMkdir(t)
+	defer os.RemoveAll(outsideDir)
+
+	subDir := filepath.Join(rootDir, "sub")
+	if err := os.Mkdir(subDir, 0777); err != nil {
+		t.Fatalf("creating test directory failed: %s", err)
+	}
+	// An absolute symlink is resolved inside the root, not on the host
+	if err := os.Symlink(string(filepath.Separator)+"sub", filepath.Join(rootDir, "link")); err != nil {
+		t.Skipf("symlinks not supported: %s", err)
+	}
+	if err := os.Symlink(outsideDir, filepath.Join(rootDir, "escape")); err != nil {
+		t.Fatalf("creating symlink failed: %s", err)
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	if err := watcher.SetRoot(rootDir); err != nil {
+		t.Fatalf("SetRoot(%q) failed: %s", rootDir, err)
+	}
+
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	var createReceived counter
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			if filepath.Base(event.Name) == "TestFsnotifySetRoot.testfile" && event.IsCreate() {
+				createReceived.increment()
+			}
+		}
+	}()
+
+	for _, path := range []string{"link", "../../link"} {
+		if err := watcher.Watch(path); err != nil {
+			t.Fatalf("watching %q in the root failed: %s", path, err)
+		}
+	}
+	// Escaping symlinks resolve to paths in the root that do not exist
+	if err := watcher.Watch("escape"); err == nil {
+		t.Fatal("expected error watching a symlink that leads out of the root")
+	}
+
+	f, err := os.OpenFile(filepath.Join(subDir, "TestFsnotifySetRoot.testfile"), os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	f.Close()
+
+	time.Sleep(500 * time.Millisecond)
+	if createReceived.value() != 1 {
+		t.Fatalf("incorrect number of create events received after 500 ms (%d vs %d)", createReceived.value(), 1)
+	}
+	if err := watcher.RemoveWatch("/link"); err != nil {
+		t.Fatalf("removing watch of %q failed: %s", "/link", err)
+	}
+}
+
+func TestResolveInRoot(t *testing.T) {
+	rootDir := tempMkdir(t)
+	defer os.RemoveAll(rootDir)
+	rootDir, _ = filepath.EvalSymlinks(rootDir)
+
+	subDir := filepath.Join(rootDir, "sub")
+	if err := os.Mkdir(subDir, 0777); err != nil {
+		t.Fatalf("creating test directory failed: %s", err)
+	}
+	if err := os.Symlink("../../../sub", filepath.Join(subDir, "up")); err != nil {
+		t.Skipf("symlinks not supported: %s", err)
+	}
+
+	resolved, err := resolveInRoot(rootDir, "sub/up", false)
+	if err != nil {
+		t.Fatalf("resolveInRoot failed: %s", err)
+	}
+	if resolved != subDir {
+		t.Fatalf("incorrect path resolved (%q vs %q)", resolved, subDir)
+	}
+}
+
+func TestFsnotifySetRootBeneath(t *testing.T) {
+	rootDir := tempMkdir(t)
+	defer os.RemoveAll(rootDir)
+	rootDir, _ = filepath.EvalSymlinks(rootDir)
+
+	subDir := filepath.Join(rootDir, "sub")
+	if err := os.Mkdir(subDir, 0777); err != nil {
+		t.Fatalf("creating test directory failed: %s", err)
+	}
+	if err := os.Symlink("../../../sub", filepath.Join(subDir, "up")); err != nil {
+		t.Skipf("symlinks not supported: %s", err)
+	}
+
+	if _, err := resolveInRoot(rootDir, "sub/up", true); !isOutsideRoot(err) {
+		t.Fatalf("resolveInRoot of an escaping symlink returned %v, want ErrOutsideRoot", err)
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	if err := watcher.SetRootBeneath(rootDir); err != nil {
+		t.Fatalf("SetRootBeneath(%q) failed: %s", rootDir, err)
+	}
+	if err := watcher.Watch("/sub"); err != nil {
+		t.Fatalf("watching %q in the root failed: %s", "/sub", err)
+	}
+	if err := watcher.Watch("sub/up"); !isOutsideRoot(err) {
+		t.Fatalf("watching an escaping symlink returned %v, want ErrOutsideRoot", err)
+	}
+	if err := watcher.Watch("../sub"); !isOutsideRoot(err) {
+		t.Fatalf("watching %q returned %v, want ErrOutsideRoot", "../sub", err)
+	}
+}
+
+func isOutsideRoot(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return err == ErrOutsideRoot
+}
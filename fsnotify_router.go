@@ -0,0 +1,159 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A Router dispatches events to handlers by glob patterns on their names.
+//
+// Patterns use the syntax of path.Match on slash-separated names, where a
+// "**" element matches any number of directories. A pattern that does not
+// start with "/" matches the trailing elements of a name, so "*.go" and
+// "**/*.go" both match every Go file, and "assets/**" matches everything
+// below any directory named assets. Names are matched in slash-separated
+// form without their volume name, so patterns written with "/" match the
+// names of every platform: "/src/*.go" matches C:\src\main.go on Windows.
+type Router struct {
+	mu     sync.RWMutex // Protects access to routes.
+	routes []route
+}
+
+type route struct {
+	elems []string // Pattern split into elements
+	h     EventHandler
+}
+
+// NewRouter returns an empty Router.
+func NewRouter() *Router {
+	return new(Router)
+}
+
+// Handle registers h for events whose names match pattern. An event is
+// dispatched to every matching handler, in the order they were registered.
+// Handle panics if the pattern is malformed.
+func (r *Router) Handle(pattern string, h EventHandler) {
+	elems, err := compilePattern(pattern)
+	if err != nil {
+		panic("fsnotify: malformed pattern " + pattern)
+	}
+	r.mu.Lock()
+	r.routes = append(r.routes, route{elems: elems, h: h})
+	r.mu.Unlock()
+}
+
+// HandleFunc registers f for events whose names match pattern.
+func (r *Router) HandleFunc(pattern string, f func(ev *FileEvent)) {
+	r.Handle(pattern, EventHandlerFunc(f))
+}
+
+// HandleEvent dispatches the event to the handlers of matching patterns.
+func (r *Router) HandleEvent(ev *FileEvent) {
+	name := splitName(ev.Name)
+	r.mu.RLock()
+	routes := r.routes
+	r.mu.RUnlock()
+	for _, rt := range routes {
+		if matchElems(rt.elems, name) {
+			rt.h.HandleEvent(ev)
+		}
+	}
+}
+
+// compilePattern splits a pattern into the elements matched by
+// matchElems, anchoring it at the end of names unless it starts with "/".
+func compilePattern(pattern string) ([]string, error) {
+	elems := splitPattern(pattern)
+	for _, elem := range elems {
+		if _, err := path.Match(elem, ""); err != nil {
+			return nil, err
+		}
+	}
+	if !strings.HasPrefix(pattern, "/") {
+		elems = append([]string{"**"}, elems...)
+	}
+	return elems, nil
+}
+
+func splitPattern(pattern string) []string {
+	var elems []string
+	for _, elem := range strings.Split(pattern, "/") {
+		if elem != "" {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
+
+// splitName splits the name of an event into the elements matched by
+// matchElems, slash-separated and without its volume name.
+func splitName(name string) []string {
+	return splitPattern(filepath.ToSlash(name[len(filepath.VolumeName(name)):]))
+}
+
+// matchElems reports whether the name elements match the pattern elements.
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Try the rest of the pattern at each remaining position
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], name[0]); !matched {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// An ErrorHandler is an EventHandler that also handles the errors of the
+// watcher.
+type ErrorHandler interface {
+	EventHandler
+	HandleError(err error)
+}
+
+// Serve delivers the events of the Event channel to h until ctx is done or
+// the watcher is closed. Errors are passed to h if it is an ErrorHandler;
+// otherwise Serve returns the first error.
+func (w *Watcher) Serve(ctx context.Context, h EventHandler) error {
+	eh, handlesErrors := h.(ErrorHandler)
+	events, errs := w.Event, w.Error
+	for events != nil {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			h.HandleEvent(ev)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			if !handlesErrors {
+				return err
+			}
+			eh.HandleError(err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
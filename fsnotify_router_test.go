@@ -0,0 +1,113 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+var routerTests = []struct {
+	pattern string
+	name    string
+	match   bool
+}{
+	{"*.go", "/src/main.go", true},
+	{"**/*.go", "/src/pkg/main.go", true},
+	{"**/*.go", "/src/main.c", false},
+	{"assets/**", "/src/assets/img/logo.png", true},
+	{"assets/**", "/src/static/logo.png", false},
+	{"/src/*.go", "/src/main.go", true},
+	{"/src/*.go", "/other/src/main.go", false},
+	{"/src/**/main.go", "/src/main.go", true},
+	{"src/*/main.go", "/root/src/cmd/main.go", true},
+}
+
+func TestRouterMatch(t *testing.T) {
+	for _, tt := range routerTests {
+		var matched bool
+		r := NewRouter()
+		r.HandleFunc(tt.pattern, func(ev *FileEvent) { matched = true })
+		r.HandleEvent(&FileEvent{Name: tt.name})
+		if matched != tt.match {
+			t.Errorf("pattern %q on %q: matched = %v, want %v", tt.pattern, tt.name, matched, tt.match)
+		}
+	}
+}
+
+func TestRouterMatchNativeNames(t *testing.T) {
+	for _, tt := range routerTests {
+		// Names as the backend of the platform reports them
+		name := filepath.FromSlash(tt.name)
+		if runtime.GOOS == "windows" {
+			name = `C:` + name
+		}
+		var matched bool
+		r := NewRouter()
+		r.HandleFunc(tt.pattern, func(ev *FileEvent) { matched = true })
+		r.HandleEvent(&FileEvent{Name: name})
+		if matched != tt.match {
+			t.Errorf("pattern %q on %q: matched = %v, want %v", tt.pattern, name, matched, tt.match)
+		}
+	}
+}
+
+func TestFsnotifyServeRouter(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	var goReceived, otherReceived counter
+	r := NewRouter()
+	r.HandleFunc("*.go", func(ev *FileEvent) {
+		if ev.IsCreate() {
+			goReceived.increment()
+		}
+	})
+	r.HandleFunc("*.txt", func(ev *FileEvent) {
+		otherReceived.increment()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- watcher.Serve(ctx, r)
+	}()
+
+	addWatch(t, watcher, testDir)
+
+	for _, name := range []string{"TestFsnotifyServeRouter.go", "TestFsnotifyServeRouter.c"} {
+		f, err := os.OpenFile(filepath.Join(testDir, name), os.O_WRONLY|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+		f.Close()
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	if goReceived.value() != 1 {
+		t.Fatalf("incorrect number of create events routed after 500 ms (%d vs %d)", goReceived.value(), 1)
+	}
+	if otherReceived.value() != 0 {
+		t.Fatalf("events routed to a pattern that does not match (%d)", otherReceived.value())
+	}
+
+	cancel()
+	select {
+	case err := <-served:
+		if err != context.Canceled {
+			t.Fatalf("Serve returned %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Serve did not return after the context was canceled")
+	}
+}
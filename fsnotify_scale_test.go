@@ -0,0 +1,166 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// hugeDirEntries is the number of files in the huge directory of the tests.
+const hugeDirEntries = 5000
+
+// makeFiles creates n empty files in dir.
+func makeFiles(tb testing.TB, dir string, n int) {
+	for i := 0; i < n; i++ {
+		if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("file-%06d", i)), nil, 0666); err != nil {
+			tb.Fatalf("creating test file failed: %s", err)
+		}
+	}
+}
+
+// watchHuge watches dir, skipping the test if it has more files than
+// the watcher may open.
+func watchHuge(tb testing.TB, watcher *Watcher, dir string) {
+	if err := watcher.Watch(dir); err == syscall.EMFILE {
+		tb.Skipf("watching %d files exceeds the file descriptor limit", hugeDirEntries)
+	} else if err != nil {
+		tb.Fatalf("watcher.Watch(%q) failed: %s", dir, err)
+	}
+}
+
+func TestWatchTreeDeepPath(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	// Deep enough for names below the tree to exceed MAX_PATH on Windows
+	elems := []string{testDir}
+	for i := 0; i < 64; i++ {
+		elems = append(elems, fmt.Sprintf("level-%02d", i))
+	}
+	deepDir := filepath.Join(elems...)
+	if err := os.MkdirAll(deepDir, 0777); err != nil {
+		t.Fatalf("creating deep directories failed: %s", err)
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	go func() {
+		for err := range watcher.Error {
+			t.Errorf("error received: %s", err)
+		}
+	}()
+	if err := watcher.WatchTree(testDir, nil); err != nil {
+		t.Fatalf("watcher.WatchTree(%q) failed: %s", testDir, err)
+	}
+
+	testFile := filepath.Join(deepDir, "TestWatchTreeDeepPath.testfile")
+	var createReceived counter
+	go func() {
+		for event := range watcher.Event {
+			if event.Name == testFile && event.IsCreate() {
+				createReceived.increment()
+			}
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if cv := createReceived.value(); cv != 1 {
+		t.Fatalf("incorrect number of create events received after 500 ms (%d vs %d)", cv, 1)
+	}
+}
+
+func TestWatchHugeDirectory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping huge directory in short mode")
+	}
+
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+	makeFiles(t, testDir, hugeDirEntries)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	// Rescans of the directory, where kqueue needs them, take several passes
+	watcher.SetScanBudget(time.Millisecond)
+	go func() {
+		for err := range watcher.Error {
+			t.Errorf("error received: %s", err)
+		}
+	}()
+	watchHuge(t, watcher, testDir)
+
+	var createReceived, otherReceived counter
+	go func() {
+		for event := range watcher.Event {
+			if event.IsCreate() && strings.HasSuffix(event.Name, ".testfile") {
+				createReceived.increment()
+			} else if event.IsCreate() {
+				otherReceived.increment()
+			}
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		testFile := filepath.Join(testDir, fmt.Sprintf("TestWatchHugeDirectory%d.testfile", i))
+		if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+	}
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if cv := createReceived.value(); cv != 3 {
+		t.Fatalf("incorrect number of create events received after 500 ms (%d vs %d)", cv, 3)
+	}
+	if ov := otherReceived.value(); ov != 0 {
+		t.Fatalf("create events received for %d existing files", ov)
+	}
+}
+
+func BenchmarkHugeDirectoryCreate(b *testing.B) {
+	testDir, err := ioutil.TempDir("", "fsnotify")
+	if err != nil {
+		b.Fatalf("failed to create test directory: %s", err)
+	}
+	defer os.RemoveAll(testDir)
+	makeFiles(b, testDir, hugeDirEntries)
+
+	watcher, err := NewWatcher()
+	if err != nil {
+		b.Fatalf("NewWatcher() failed: %s", err)
+	}
+	defer watcher.Close()
+	watchHuge(b, watcher, testDir)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		testFile := filepath.Join(testDir, fmt.Sprintf("BenchmarkHugeDirectoryCreate%d.testfile", i))
+		if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+			b.Fatalf("creating test file failed: %s", err)
+		}
+		// Wait for the create event of the file
+		for ev := range watcher.Event {
+			if ev.Name == testFile && ev.IsCreate() {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// EventSchemaVersion is the version of the portable form of events
+// (see EventRecord).
+const EventSchemaVersion = 1
+
+// An EventRecord is the portable form of a FileEvent, for exchanging
+// events with other programs. It is described by the schemas in the schema
+// directory, event.proto and event.schema.json, and its JSON encoding is
+// the one they define.
+type EventRecord struct {
+	Version int      `json:"version"` // EventSchemaVersion
+	Name    string   `json:"name"`    // Path of the file
+	Ops     []string `json:"ops"`     // Notifications: "CREATE", "MODIFY", "DELETE" or "RENAME"
+}
+
+// recordOps are the notifications of an EventRecord, in schema order.
+var recordOps = []struct {
+	name string
+	flag uint32
+}{
+	{"CREATE", FSN_CREATE},
+	{"MODIFY", FSN_MODIFY},
+	{"DELETE", FSN_DELETE},
+	{"RENAME", FSN_RENAME},
+}
+
+// NewEventRecord returns the portable form of ev.
+func NewEventRecord(ev *FileEvent) EventRecord {
+	r := EventRecord{Version: EventSchemaVersion, Name: ev.Name, Ops: []string{}}
+	flags := eventFlags(ev)
+	for _, op := range recordOps {
+		if flags&op.flag != 0 {
+			r.Ops = append(r.Ops, op.name)
+		}
+	}
+	return r
+}
+
+// FileEvent returns the event r describes. It fails if r is of another
+// version of the schema or has unknown or no notifications.
+func (r EventRecord) FileEvent() (*FileEvent, error) {
+	if r.Version != EventSchemaVersion {
+		return nil, fmt.Errorf("fsnotify: unsupported event schema version %d", r.Version)
+	}
+	var flags uint32
+	for _, name := range r.Ops {
+		found := false
+		for _, op := range recordOps {
+			if op.name == name {
+				flags |= op.flag
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("fsnotify: unknown event op %q", name)
+		}
+	}
+	if flags == 0 {
+		return nil, fmt.Errorf("fsnotify: event for %s has no ops", r.Name)
+	}
+	return newFileEvent(r.Name, flags), nil
+}
+
+// MarshalEvent returns the JSON encoding of the portable form of ev.
+func MarshalEvent(ev *FileEvent) ([]byte, error) {
+	return json.Marshal(NewEventRecord(ev))
+}
+
+// UnmarshalEvent parses the JSON encoding of the portable form of an event.
+func UnmarshalEvent(data []byte) (*FileEvent, error) {
+	var r EventRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return r.FileEvent()
+}
@@ -0,0 +1,93 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestEventRecordRoundTrip(t *testing.T) {
+	for _, flags := range []uint32{FSN_CREATE, FSN_MODIFY, FSN_DELETE, FSN_RENAME, FSN_CREATE | FSN_MODIFY} {
+		ev := newFileEvent("dir/file", flags)
+		data, err := MarshalEvent(ev)
+		if err != nil {
+			t.Fatalf("marshaling %s failed: %s", ev, err)
+		}
+		got, err := UnmarshalEvent(data)
+		if err != nil {
+			t.Fatalf("unmarshaling %s failed: %s", data, err)
+		}
+		if got.Name != ev.Name || eventFlags(got) != eventFlags(ev) {
+			t.Errorf("%s round-tripped as %s", ev, got)
+		}
+	}
+
+	data, _ := MarshalEvent(newFileEvent("a", FSN_CREATE|FSN_MODIFY))
+	if want := `{"version":1,"name":"a","ops":["CREATE","MODIFY"]}`; string(data) != want {
+		t.Errorf("encoded event as %s, want %s", data, want)
+	}
+
+	for _, bad := range []string{
+		`{"version":2,"name":"a","ops":["CREATE"]}`,
+		`{"version":1,"name":"a","ops":["CHMOD"]}`,
+		`{"version":1,"name":"a","ops":[]}`,
+	} {
+		if _, err := UnmarshalEvent([]byte(bad)); err == nil {
+			t.Errorf("unmarshaling %s did not fail", bad)
+		}
+	}
+}
+
+// The JSON Schema must describe the fields and ops of EventRecord.
+func TestEventRecordMatchesSchema(t *testing.T) {
+	data, err := ioutil.ReadFile("schema/event.schema.json")
+	if err != nil {
+		t.Fatalf("reading schema failed: %s", err)
+	}
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+		Required   []string                   `json:"required"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("parsing schema failed: %s", err)
+	}
+
+	var fields []string
+	rt := reflect.TypeOf(EventRecord{})
+	for i := 0; i < rt.NumField(); i++ {
+		fields = append(fields, strings.Split(rt.Field(i).Tag.Get("json"), ",")[0])
+	}
+	var properties []string
+	for name := range schema.Properties {
+		properties = append(properties, name)
+	}
+	sort.Strings(fields)
+	sort.Strings(properties)
+	sort.Strings(schema.Required)
+	if !reflect.DeepEqual(fields, properties) || !reflect.DeepEqual(fields, schema.Required) {
+		t.Fatalf("schema properties %v (required %v) do not match record fields %v", properties, schema.Required, fields)
+	}
+
+	var ops struct {
+		Items struct {
+			Enum []string `json:"enum"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(schema.Properties["ops"], &ops); err != nil {
+		t.Fatalf("parsing ops of schema failed: %s", err)
+	}
+	var names []string
+	for _, op := range recordOps {
+		names = append(names, op.name)
+	}
+	if !reflect.DeepEqual(ops.Items.Enum, names) {
+		t.Fatalf("schema ops %v do not match %v", ops.Items.Enum, names)
+	}
+}
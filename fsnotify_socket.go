@@ -0,0 +1,58 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// AwaitSocket waits until a unix domain socket exists at path, as services
+// create when they are ready to accept connections, or ctx is done. The
+// directories leading to it need not exist yet (see SetPendingWatches).
+// It returns at once if the socket already exists.
+func AwaitSocket(ctx context.Context, path string) error {
+	path = filepath.Clean(path)
+	w, err := NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Keep the channels drained so the watcher can close
+		go func() {
+			for range w.Event {
+			}
+		}()
+		go func() {
+			for range w.Error {
+			}
+		}()
+		w.Close()
+	}()
+	w.SetPendingWatches(true)
+	if err := w.WatchFlags(filepath.Dir(path), FSN_CREATE); err != nil {
+		return err
+	}
+
+	// Look after every event: a socket created along with its directory
+	// may precede the watch of the directory
+	for {
+		if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket == os.ModeSocket {
+			return nil
+		}
+		select {
+		case _, ok := <-w.Event:
+			if !ok {
+				return errors.New("fsnotify: watcher closed while awaiting socket")
+			}
+		case err := <-w.Error:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
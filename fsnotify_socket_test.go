@@ -0,0 +1,105 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !windows
+
+package fsnotify
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAwaitSocket(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	// Neither the socket nor its directory exist yet
+	sockDir := filepath.Join(testDir, "run")
+	sock := filepath.Join(sockDir, "TestAwaitSocket.sock")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- AwaitSocket(ctx, sock)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if err := os.Mkdir(sockDir, 0777); err != nil {
+		t.Fatalf("creating socket directory failed: %s", err)
+	}
+	// A regular file of the name does not end the wait
+	if err := ioutil.WriteFile(sock, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("AwaitSocket(%q) returned %v for a regular file", sock, err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	os.Remove(sock)
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("listening on %q failed: %s", sock, err)
+	}
+	defer l.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("AwaitSocket(%q) failed: %s", sock, err)
+	}
+
+	// Returns at once for an existing socket
+	if err := AwaitSocket(ctx, sock); err != nil {
+		t.Fatalf("AwaitSocket(%q) failed for an existing socket: %s", sock, err)
+	}
+}
+
+func TestAwaitSocketContext(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	sock := filepath.Join(testDir, "TestAwaitSocketContext.sock")
+	if err := AwaitSocket(ctx, sock); err != context.DeadlineExceeded {
+		t.Fatalf("AwaitSocket(%q) returned %v, expected %v", sock, err, context.DeadlineExceeded)
+	}
+}
+
+func TestFileTypes(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	sock := filepath.Join(testDir, "TestFileTypes.sock")
+	testFile := filepath.Join(testDir, "TestFileTypes.testfile")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("listening on %q failed: %s", sock, err)
+	}
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+
+	var got []string
+	h := FileTypes(os.ModeSocket)(EventHandlerFunc(func(ev *FileEvent) {
+		got = append(got, ev.Name)
+	}))
+	h.HandleEvent(newFileEvent(sock, FSN_CREATE))
+	h.HandleEvent(newFileEvent(testFile, FSN_CREATE))
+
+	// The socket is gone, but known from its create
+	l.Close()
+	os.Remove(sock)
+	os.Remove(testFile)
+	h.HandleEvent(newFileEvent(sock, FSN_DELETE))
+	h.HandleEvent(newFileEvent(testFile, FSN_DELETE))
+
+	if len(got) != 2 || got[0] != sock || got[1] != sock {
+		t.Fatalf("delivered events for %q, expected a create and a delete of %q", got, sock)
+	}
+}
@@ -0,0 +1,613 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build solaris
+
+package fsnotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// Watch all events; exceptions (deletes etc.) are always reported
+	sys_FILE_ALLEVENTS = sys_FILE_MODIFIED | sys_FILE_ATTRIB
+
+	// Block for 100 ms on each call to port_get
+	portWaitTime = 100e6
+
+	// Number of directory entries read at a time
+	dirScanPage = 512
+)
+
+// portWatchCost estimates the memory of a file associated with the event
+// port, with its file_obj and the kernel association.
+const portWatchCost = 512
+
+// watchCost estimates the resources of watching path (see SetBudget): an
+// association for it and, for a directory, for each of its files.
+func watchCost(path string) budgetCost {
+	return budgetCost{memory: int64(1+countEntries(path)) * portWatchCost}
+}
+
+type FileEvent struct {
+	mask        uint32          // Mask of events
+	Name        string          // File name (optional)
+	create      bool            // set by fsnotify package if found new file
+	prevSize    int64           // Size of the file before a modification
+	size        int64           // Size of the file after a modification
+	sized       bool            // Set if prevSize and size are known
+	replaced    bool            // Set if a different file took the place of the file (not tracked on Solaris)
+	xattr       bool            // Set if the extended attributes of the file changed (not tracked on Solaris)
+	delta       *ContentDelta   // Content before and after a modification (see SetContentTracking)
+	retarget    string          // New target of a watched symlink (see WatchSymlink)
+	movedFrom   string          // Source of a probable move (see SetMoveCorrelation)
+	overflow    bool            // Set on events reporting that events were dropped (see IsOverflow)
+	rescan      []string        // Watched paths affected by an overflow (see RescanRoots)
+	locked      bool            // Set if the file was still locked when delivered (see LockWait)
+	placeholder bool            // Set if the file was a cloud placeholder when delivered (see IsPlaceholder)
+	dir         bool            // Set if the event refers to a directory (see IsDir)
+	stamp       time.Time       // When the event was observed (see Time)
+	proc        *Process        // Process that caused the event (see SetProcessTracking)
+	move        MoveDirection   // Direction of a paired rename (see SetRenamePairing)
+	ops         uint32          // Notifications the system does not report (see FSN_USER)
+	parts       []*FileEvent    // Events combined by the event (see Parts)
+	err         error           // Error queued in order with the events (see Ordered)
+	ctx         context.Context // Context of the watch that delivered the event
+}
+
+// IsCreate reports whether the FileEvent was triggered by a creation
+func (e *FileEvent) IsCreate() bool { return e.create }
+
+// IsDelete reports whether the FileEvent was triggered by a delete, by
+// another file being renamed over it, or by the file system being
+// unmounted or mounted over
+func (e *FileEvent) IsDelete() bool {
+	return e.mask&(sys_FILE_DELETE|sys_FILE_RENAME_TO|sys_UNMOUNTED|sys_MOUNTEDOVER) != 0
+}
+
+// IsModify reports whether the FileEvent was triggered by a file modification
+func (e *FileEvent) IsModify() bool {
+	return ((e.mask&sys_FILE_MODIFIED) == sys_FILE_MODIFIED || (e.mask&sys_FILE_ATTRIB) == sys_FILE_ATTRIB)
+}
+
+// IsRename reports whether the FileEvent was triggered by a change name
+func (e *FileEvent) IsRename() bool { return (e.mask & sys_FILE_RENAME_FROM) == sys_FILE_RENAME_FROM }
+
+// movedTo reports whether the event names the file of a rename under its
+// new name; event ports only report the old name.
+func (e *FileEvent) movedTo() bool { return false }
+
+// IsAttrib reports whether the FileEvent was triggered by a change in the file metadata.
+func (e *FileEvent) IsAttrib() bool {
+	return (e.mask & sys_FILE_ATTRIB) == sys_FILE_ATTRIB
+}
+
+// isWrite reports whether the FileEvent was triggered by a change of the
+// file content, rather than its metadata.
+func (e *FileEvent) isWrite() bool { return e.mask&sys_FILE_MODIFIED == sys_FILE_MODIFIED }
+
+// RawMask returns the event port flags of the event (FILE_MODIFIED etc.),
+// for the cases the predicates do not cover. Creates are found by
+// rescanning directories and have none.
+func (e *FileEvent) RawMask() uint32 { return e.mask }
+
+// Cookie returns zero; event ports do not associate the halves of a
+// rename.
+func (e *FileEvent) Cookie() uint32 { return 0 }
+
+// newFileEvent returns a synthetic event for name, as if it had been
+// triggered by the given notifications (FSN_CREATE etc.)
+func newFileEvent(name string, flags uint32) *FileEvent {
+	e := &FileEvent{Name: name, create: flags&FSN_CREATE == FSN_CREATE}
+	if flags&FSN_MODIFY == FSN_MODIFY {
+		e.mask |= sys_FILE_MODIFIED
+	}
+	if flags&FSN_DELETE == FSN_DELETE {
+		e.mask |= sys_FILE_DELETE
+	}
+	if flags&FSN_RENAME == FSN_RENAME {
+		e.mask |= sys_FILE_RENAME_FROM
+	}
+	return e
+}
+
+type Watcher struct {
+	mu              sync.Mutex              // Mutex for the Watcher itself.
+	port            int                     // File descriptor (as returned by port_create())
+	watches         map[string]*portWatch   // Map of watches (key: path)
+	paths           map[int]string          // Map of watched paths (key: watch id)
+	nextID          int                     // Id of the latest watch
+	wmut            sync.Mutex              // Protects access to watches, paths, nextID and the watches themselves.
+	fsnFlags        map[string]uint32       // Map of watched files to flags used for filter
+	handlers        map[string]EventHandler // Map of watched files to event handlers (nil for the Event channel)
+	middleware      []Middleware            // Middleware wrapping event delivery (see Use)
+	policy          *PathPolicy             // Policy validating watched paths (see SetPathPolicy)
+	root            string                  // Base directory watched paths are resolved in (see SetRoot)
+	rootBeneath     bool                    // Set if paths leading out of root are rejected (see SetRootBeneath)
+	broker          *Broker                 // Broker of the Event channel (see Fanout)
+	ignored         []string                // Base names of files to ignore (see SetIgnoredNames)
+	treeDepth       int                     // Levels of directories watched below trees (see SetTreeDepth)
+	links           linkTable               // Known files, for events on hard links (see SetHardlinkTracking)
+	contents        contentCache            // Cached contents of small files (see SetContentTracking)
+	recent          recentBuffer            // Recently delivered events (see SetRecent)
+	dups            dupTable                // Identities of watched paths (see SetDuplicatePolicy)
+	symlinks        symlinkTable            // Watched symlinks (see WatchSymlink)
+	pending         pendingTable            // Watches of paths that do not exist yet (see SetPendingWatches)
+	order           orderTable              // Ordered stream of events and errors (see Ordered)
+	coop            coopQueue               // Events between calls of Poll (see NewCooperativeWatcher)
+	moves           moveTable               // Known files, to pair cross-device moves (see SetMoveCorrelation)
+	scans           scanTable               // Known files, to rescan after sleep (see SetResumeRescan)
+	trees           treeTable               // Roots of tree watches, to extend to directories moved in (see SetMoveInScan)
+	polls           pollTable               // Paths watched by polling (see SetPolling)
+	drain           drainState              // Events in flight on Close (see SetDrainOnClose)
+	activity        activityTable           // Watched paths of the latest events (see RescanRoots)
+	fair            fairQueue               // Events queued per watch root (see SetFairness)
+	consistency     consistencyTable        // Watched paths with lost events (see SetConsistencyTracking)
+	steps           stepTable               // Time spent in the steps of delivery (see SetStepTiming)
+	suppressed      suppressTable           // Paths the application is changing (see IgnorePath)
+	mock            *mockBackend            // Recorded watches of a MockWatcher (nil otherwise)
+	budget          budgetTable             // Resources of the watches (see SetBudget)
+	fsnmut          sync.Mutex              // Protects access to fsnFlags, handlers, middleware, policy, root, broker, ignored and treeDepth.
+	fileExists      map[string]bool         // Keep track of if we know this file exists (to stop duplicate create events)
+	femut           sync.Mutex              // Protects access to fileExists.
+	externalWatches map[string]bool         // Map of watches added by user of the library.
+	ewmut           sync.Mutex              // Protects access to externalWatches.
+	Error           chan error              // Errors are sent on this channel
+	internalEvent   chan *FileEvent         // Events are queued on this channel
+	Event           chan *FileEvent         // Events are returned on this channel
+	done            chan bool               // Channel for sending a "quit message" to the reader goroutine
+	isClosed        bool                    // Set to true when Close() is first called
+	trackSizes      bool                    // Set to true to report sizes before and after modifications
+}
+
+// A portWatch is a path associated with the event port. Associations
+// report a single event, so the reader goroutine associates the path
+// again after each.
+type portWatch struct {
+	id       int         // Identifies the watch in events
+	fobj     *fileObj    // Association with the port
+	name     []byte      // NUL terminated path, referred to by fobj
+	fi       os.FileInfo // File information when last associated
+	contents bool        // Set if the entries of a directory are watched
+}
+
+// NewWatcher creates and returns a new watcher instance using an event
+// port (port_create(3C))
+func NewWatcher() (*Watcher, error) {
+	port, err := portCreate()
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		port:            port,
+		watches:         make(map[string]*portWatch),
+		paths:           make(map[int]string),
+		fsnFlags:        make(map[string]uint32),
+		handlers:        make(map[string]EventHandler),
+		fileExists:      make(map[string]bool),
+		externalWatches: make(map[string]bool),
+		internalEvent:   make(chan *FileEvent),
+		Event:           make(chan *FileEvent),
+		Error:           make(chan error),
+		done:            make(chan bool, 1),
+	}
+
+	go w.readEvents()
+	go w.purgeEvents()
+	return w, nil
+}
+
+// Close closes an event port watcher instance
+// It sends a message to the reader goroutine to quit and removes all watches
+// associated with the event port
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	if w.isClosed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.isClosed = true
+	w.mu.Unlock()
+	w.drain.close()
+	w.symlinks.close()
+	w.pending.close()
+	w.scans.close()
+	w.polls.close()
+
+	// Send "quit" message to the reader goroutine
+	w.done <- true
+	w.wmut.Lock()
+	var paths []string
+	for path := range w.watches {
+		paths = append(paths, path)
+	}
+	w.wmut.Unlock()
+	for _, path := range paths {
+		w.removeWatch(path)
+	}
+
+	return nil
+}
+
+// addWatch associates path with the event port. If contents is set and
+// path is a directory, the files in it are watched too.
+func (w *Watcher) addWatch(path string, contents bool) error {
+	w.mu.Lock()
+	if w.isClosed {
+		w.mu.Unlock()
+		return errors.New("event port instance already closed")
+	}
+	w.mu.Unlock()
+
+	w.wmut.Lock()
+	watch, found := w.watches[path]
+	w.wmut.Unlock()
+	if !found {
+		fi, errstat := os.Lstat(path)
+		if errstat != nil {
+			return errstat
+		}
+
+		// don't watch socket
+		if fi.Mode()&os.ModeSocket == os.ModeSocket {
+			return nil
+		}
+
+		// Follow symlinks, as on BSD: there will simply be no file events
+		// for broken symlinks.
+		if fi.Mode()&os.ModeSymlink == os.ModeSymlink {
+			if _, err := os.Stat(path); err != nil {
+				return nil
+			}
+		}
+
+		watch = &portWatch{name: append([]byte(path), 0)}
+		watch.fobj = &fileObj{name: &watch.name[0]}
+		w.wmut.Lock()
+		w.nextID++
+		watch.id = w.nextID
+		err := w.associate(watch)
+		if err == nil {
+			w.watches[path] = watch
+			w.paths[watch.id] = path
+		}
+		w.wmut.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Watch the directory if it has not been watched before.
+	w.wmut.Lock()
+	watchDir := contents && watch.fi.IsDir() && !watch.contents
+	if watchDir {
+		watch.contents = true
+	}
+	w.wmut.Unlock()
+	if watchDir {
+		return w.watchDirectoryFiles(path)
+	}
+	return nil
+}
+
+// associate associates a watch with the event port, recording the times
+// of the file, so that changes made since are reported at once. It is
+// called with wmut held.
+func (w *Watcher) associate(watch *portWatch) error {
+	path := string(watch.name[:len(watch.name)-1])
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+	watch.fobj.atime = st.Atim
+	watch.fobj.mtime = st.Mtim
+	watch.fobj.ctime = st.Ctim
+	if err := portAssociate(w.port, watch.fobj, sys_FILE_ALLEVENTS, uintptr(watch.id)); err != nil {
+		return os.NewSyscallError("port_associate", err)
+	}
+	watch.fi = fi
+	return nil
+}
+
+// Watch adds path to the watched file set, watching all events.
+func (w *Watcher) watch(path string) error {
+	w.ewmut.Lock()
+	w.externalWatches[path] = true
+	w.ewmut.Unlock()
+	return w.addWatch(path, true)
+}
+
+func (w *Watcher) watchTree(path string, skip []string, depth int, h EventHandler, progress func(dirs int)) error {
+	return w.watchTreeWalk(path, skip, depth, h, progress)
+}
+
+// RemoveWatch removes path from the watched file set.
+func (w *Watcher) removeWatch(path string) error {
+	w.wmut.Lock()
+	watch, ok := w.watches[path]
+	if !ok {
+		w.wmut.Unlock()
+		return errors.New(fmt.Sprintf("can't remove non-existent event port watch for: %s", path))
+	}
+	delete(w.watches, path)
+	delete(w.paths, watch.id)
+	// The association is gone already if it reported its event
+	err := portDissociate(w.port, watch.fobj)
+	w.wmut.Unlock()
+	if err != nil && err != syscall.ENOENT {
+		return os.NewSyscallError("port_dissociate", err)
+	}
+
+	// Find all watched paths that are in this directory that are not external.
+	if watch.fi.IsDir() {
+		var pathsToRemove []string
+		w.wmut.Lock()
+		for _, wpath := range w.paths {
+			wdir, _ := filepath.Split(wpath)
+			if filepath.Clean(wdir) == filepath.Clean(path) {
+				w.ewmut.Lock()
+				if !w.externalWatches[wpath] {
+					pathsToRemove = append(pathsToRemove, wpath)
+				}
+				w.ewmut.Unlock()
+			}
+		}
+		w.wmut.Unlock()
+		for _, p := range pathsToRemove {
+			// Since these are internal, not much sense in propagating error
+			// to the user, as that will just confuse them with an error about
+			// a path they did not explicitly watch themselves.
+			w.removeWatch(p)
+		}
+	}
+
+	return nil
+}
+
+// readEvents reads from the event port, converts the received events
+// into Event objects and sends them via the Event channel
+func (w *Watcher) readEvents() {
+	var pe portEvent
+	for {
+		// See if there is a message on the "done" channel
+		var done bool
+		select {
+		case done = <-w.done:
+		default:
+		}
+
+		// If "done" message is received
+		if done {
+			// Send the events queued unless dropping what is in flight
+			for !w.drain.dropping() && portGet(w.port, &pe, &syscall.Timespec{}) == nil {
+				w.handleEvent(pe)
+			}
+			errno := syscall.Close(w.port)
+			if errno != nil {
+				w.sendError(os.NewSyscallError("close", errno))
+			}
+			close(w.internalEvent)
+			close(w.Error)
+			return
+		}
+
+		twait := syscall.NsecToTimespec(portWaitTime)
+		if err := portGet(w.port, &pe, &twait); err != nil {
+			// ETIME is the wait expiring, and EINTR is okay, basically the
+			// call was interrupted before the wait expired.
+			if err != syscall.ETIME && err != syscall.EINTR {
+				w.sendError(os.NewSyscallError("port_get", err))
+			}
+			continue
+		}
+		w.handleEvent(pe)
+	}
+}
+
+// handleEvent sends the event on a watch, and associates the watch again.
+func (w *Watcher) handleEvent(pe portEvent) {
+	if pe.source != sys_PORT_SOURCE_FILE {
+		return
+	}
+	fileEvent := &FileEvent{mask: uint32(pe.events), stamp: time.Now()}
+	w.wmut.Lock()
+	path, found := w.paths[int(pe.user)]
+	watch := w.watches[path]
+	w.wmut.Unlock()
+	if !found {
+		// Removed while the event was queued
+		return
+	}
+	fileEvent.Name = path
+
+	var err error
+	w.wmut.Lock()
+	prev := watch.fi
+	if !fileEvent.IsDelete() && !fileEvent.IsRename() && w.watches[path] == watch {
+		err = w.associate(watch)
+	}
+	fi, watchDir := watch.fi, watch.contents
+	w.wmut.Unlock()
+	fileEvent.dir = fi.IsDir()
+	if os.IsNotExist(err) {
+		// Deleted before it could be associated again
+		fileEvent.mask |= sys_FILE_DELETE
+	} else if err != nil {
+		w.sendError(err)
+	}
+
+	if fi.IsDir() && fileEvent.IsModify() && !fileEvent.IsDelete() {
+		// Directories report the changes of their entries only
+		if watchDir {
+			w.sendDirectoryChangeEvents(path)
+		}
+	} else {
+		if !fi.IsDir() && fileEvent.IsModify() && !fileEvent.IsDelete() {
+			w.updateSize(fileEvent, prev, fi)
+		}
+		// Send the event on the events channel
+		w.internalEvent <- fileEvent
+	}
+
+	if fileEvent.IsRename() || fileEvent.IsDelete() {
+		w.removeWatch(path)
+		w.femut.Lock()
+		delete(w.fileExists, path)
+		w.femut.Unlock()
+	}
+	if fileEvent.IsDelete() {
+		// Look for a file that may have overwritten this
+		// (ie mv f1 f2 will delete f2 then create f2)
+		fileDir := filepath.Dir(path)
+		w.wmut.Lock()
+		_, found := w.watches[fileDir]
+		w.wmut.Unlock()
+		if found {
+			if _, err := os.Lstat(fileDir); !os.IsNotExist(err) {
+				w.sendDirectoryChangeEvents(fileDir)
+			}
+		}
+	}
+}
+
+func (w *Watcher) setSizeTracking(enable bool) {
+	w.mu.Lock()
+	w.trackSizes = enable
+	w.mu.Unlock()
+}
+
+// Xattr tracking is not supported on Solaris, as the syscall package
+// offers no access to extended attributes there.
+func (w *Watcher) setXattrTracking(enable bool) {}
+
+// Scan budgets have no effect on Solaris, where directories are rescanned
+// at once.
+func (w *Watcher) setScanBudget(budget time.Duration) {}
+
+// updateSize fills in the size of a modified file before and after the
+// event, from the file information of the watch before and after it was
+// associated again.
+func (w *Watcher) updateSize(fileEvent *FileEvent, prev, fi os.FileInfo) {
+	w.mu.Lock()
+	trackSizes := w.trackSizes
+	w.mu.Unlock()
+	if !trackSizes || prev == fi {
+		return
+	}
+	fileEvent.prevSize = prev.Size()
+	fileEvent.size = fi.Size()
+	fileEvent.sized = true
+}
+
+func (w *Watcher) watchDirectoryFiles(dirPath string) error {
+	f, err := os.Open(dirPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Read the files a page at a time
+	for {
+		files, err := f.Readdir(dirScanPage)
+		for _, fileInfo := range files {
+			if e := w.watchDirectoryFile(dirPath, fileInfo); e != nil {
+				return e
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// watchDirectoryFile watches a file found in a watched directory.
+func (w *Watcher) watchDirectoryFile(dirPath string, fileInfo os.FileInfo) error {
+	filePath := filepath.Join(dirPath, fileInfo.Name())
+
+	// Inherit fsnFlags from parent directory
+	w.fsnmut.Lock()
+	if flags, found := w.fsnFlags[dirPath]; found {
+		w.fsnFlags[filePath] = flags
+	} else {
+		w.fsnFlags[filePath] = FSN_ALL
+	}
+	w.fsnmut.Unlock()
+
+	// Watch files to mimic linux fsnotify, and directories for their
+	// deletes, keeping the entries watched if the user watches them
+	if e := w.addWatch(filePath, false); e != nil {
+		return e
+	}
+	w.femut.Lock()
+	w.fileExists[filePath] = true
+	w.femut.Unlock()
+	return nil
+}
+
+// sendDirectoryChangeEvents searches the directory for newly created
+// files and sends them over the event channel. This functionality is to
+// have the Solaris version of fsnotify match linux fsnotify which provides
+// a create event for files created in a watched directory.
+func (w *Watcher) sendDirectoryChangeEvents(dirPath string) {
+	f, err := os.Open(dirPath)
+	if err != nil {
+		w.sendError(err)
+		return
+	}
+	defer f.Close()
+
+	for {
+		files, err := f.Readdir(dirScanPage)
+
+		// Search for new files
+		for _, fileInfo := range files {
+			filePath := filepath.Join(dirPath, fileInfo.Name())
+			w.femut.Lock()
+			_, doesExist := w.fileExists[filePath]
+			w.femut.Unlock()
+			if !doesExist {
+				// Inherit fsnFlags from parent directory
+				w.fsnmut.Lock()
+				if flags, found := w.fsnFlags[dirPath]; found {
+					w.fsnFlags[filePath] = flags
+				} else {
+					w.fsnFlags[filePath] = FSN_ALL
+				}
+				w.fsnmut.Unlock()
+
+				// Send create event
+				fileEvent := new(FileEvent)
+				fileEvent.Name = filePath
+				fileEvent.create = true
+				fileEvent.dir = fileInfo.IsDir()
+				w.internalEvent <- fileEvent
+			}
+			w.watchDirectoryFile(dirPath, fileInfo)
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				w.sendError(err)
+			}
+			return
+		}
+	}
+}
+
+// Paths are resolved in a root by resolveInRoot only.
+func resolveInRootKernel(root, path string, beneath bool) (string, error) {
+	return "", errNoKernelResolve
+}
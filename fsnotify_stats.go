@@ -0,0 +1,170 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stats reports the time spent delivering events.
+type Stats struct {
+	Steps []StepStats // Steps of delivery, in the order events go through them
+}
+
+// StepStats reports the time spent in one step of delivering events.
+type StepStats struct {
+	Name   string        // "ignore", "track", the function name of a middleware, or "handler"
+	Events int64         // Events that went through the step
+	Time   time.Duration // Time spent in the step, not counting the steps it calls
+}
+
+// SetStepTiming enables timing the steps events go through before being
+// delivered: matching the ignored names and paths ("ignore"), the
+// bookkeeping of the tracking features ("track"), each middleware, in the
+// order added by Use, and the handler or the Event channel ("handler").
+// Stats reports the times; CPU profiles label the samples of each step
+// with its name, under the label "fsnotify.step".
+//
+// The goroutine delivering events is labelled "fsnotify"="events" in
+// profiles whether or not steps are timed.
+func (w *Watcher) SetStepTiming(enable bool) {
+	w.steps.mu.Lock()
+	w.steps.enabled = enable
+	w.steps.mu.Unlock()
+}
+
+// Stats returns the time spent in each step of delivering events since
+// step timing was enabled (see SetStepTiming).
+func (w *Watcher) Stats() Stats {
+	w.steps.mu.Lock()
+	defer w.steps.mu.Unlock()
+	var ranks []int
+	for rank := range w.steps.steps {
+		ranks = append(ranks, rank)
+	}
+	sort.Ints(ranks)
+	var stats Stats
+	for _, rank := range ranks {
+		stats.Steps = append(stats.Steps, *w.steps.steps[rank])
+	}
+	return stats
+}
+
+// eventsContext labels the goroutine delivering events in profiles.
+var eventsContext = pprof.WithLabels(context.Background(), pprof.Labels("fsnotify", "events"))
+
+// A step is a step of delivering events. Steps are ordered by rank; the
+// middleware added i-th by Use has rank stepMiddleware+i.
+type step struct {
+	rank int
+	name string
+}
+
+var (
+	noStep      = step{rank: -1}
+	ignoreStep  = step{rank: 0, name: "ignore"}
+	trackStep   = step{rank: 1, name: "track"}
+	handlerStep = step{rank: math.MaxInt32, name: "handler"}
+)
+
+const stepMiddleware = 2
+
+// middlewareStep returns the step of the middleware added i-th, named
+// after its function.
+func middlewareStep(i int, mw Middleware) step {
+	name := "middleware"
+	if f := runtime.FuncForPC(reflect.ValueOf(mw).Pointer()); f != nil {
+		name = f.Name()
+	}
+	return step{rank: stepMiddleware + i, name: name}
+}
+
+// A stepTable accumulates the time spent in each step of delivering
+// events.
+type stepTable struct {
+	mu      sync.Mutex         // Protects access to enabled and steps.
+	enabled bool               // Set if steps are timed (see SetStepTiming)
+	steps   map[int]*StepStats // Map of step ranks to their stats
+}
+
+// timer returns a timer for delivering an event, or nil if steps are not
+// timed.
+func (t *stepTable) timer() *stepTimer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.enabled {
+		return nil
+	}
+	return &stepTimer{table: t, cur: noStep}
+}
+
+// add adds d to the time spent in s, counting an event if count is set.
+func (t *stepTable) add(s step, d time.Duration, count bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.steps == nil {
+		t.steps = make(map[int]*StepStats)
+	}
+	stats, found := t.steps[s.rank]
+	if !found {
+		stats = &StepStats{Name: s.name}
+		t.steps[s.rank] = stats
+	}
+	stats.Time += d
+	if count {
+		stats.Events++
+	}
+}
+
+// A stepTimer charges the time of delivering an event to the step
+// running. Its methods do nothing on a nil timer.
+type stepTimer struct {
+	table *stepTable
+	mu    sync.Mutex // Protects access to cur and since.
+	cur   step       // Step running, or noStep
+	since time.Time  // Time cur started running
+}
+
+// enter starts running s, counting an event for it if count is set, and
+// returns the step that was running.
+func (t *stepTimer) enter(s step, count bool) step {
+	if t == nil {
+		return noStep
+	}
+	t.mu.Lock()
+	now := time.Now()
+	prev := t.cur
+	if prev.rank >= 0 {
+		t.table.add(prev, now.Sub(t.since), false)
+	}
+	if s.rank >= 0 && count {
+		t.table.add(s, 0, true)
+	}
+	t.cur, t.since = s, now
+	t.mu.Unlock()
+
+	if s.rank >= 0 {
+		pprof.SetGoroutineLabels(pprof.WithLabels(eventsContext, pprof.Labels("fsnotify.step", s.name)))
+	} else {
+		pprof.SetGoroutineLabels(eventsContext)
+	}
+	return prev
+}
+
+// wrap returns a handler running h as the step s.
+func (t *stepTimer) wrap(s step, h EventHandler) EventHandler {
+	return EventHandlerFunc(func(ev *FileEvent) {
+		prev := t.enter(s, true)
+		h.HandleEvent(ev)
+		t.enter(prev, false)
+	})
+}
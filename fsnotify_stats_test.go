@@ -0,0 +1,62 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStepTiming(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetStepTiming(true)
+
+	slow := func(next EventHandler) EventHandler {
+		return EventHandlerFunc(func(ev *FileEvent) {
+			time.Sleep(20 * time.Millisecond)
+			next.HandleEvent(ev)
+		})
+	}
+	watcher.Use(slow)
+	addWatch(t, watcher, testDir)
+
+	if err := ioutil.WriteFile(filepath.Join(testDir, "TestStepTiming.testfile"), nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	select {
+	case <-watcher.Event:
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+
+	stats := watcher.Stats()
+	var names []string
+	for _, s := range stats.Steps {
+		names = append(names, s.Name)
+	}
+	if len(stats.Steps) != 4 || names[0] != "ignore" || names[1] != "track" || names[3] != "handler" {
+		t.Fatalf("steps are %q, expected ignore, track, the middleware and handler", names)
+	}
+	mw := stats.Steps[2]
+	if !strings.Contains(mw.Name, "TestStepTiming") {
+		t.Fatalf("middleware step is named %q, expected the name of its function", mw.Name)
+	}
+	if mw.Events < 1 || mw.Time < 20*time.Millisecond {
+		t.Fatalf("middleware step took %s for %d events, expected at least 20ms for 1 event", mw.Time, mw.Events)
+	}
+	for _, s := range stats.Steps {
+		if s.Name != mw.Name && s.Time >= 20*time.Millisecond {
+			t.Fatalf("step %q took %s, expected the middleware to be charged for its sleep", s.Name, s.Time)
+		}
+	}
+}
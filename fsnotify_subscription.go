@@ -0,0 +1,167 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"sync"
+	"time"
+)
+
+// A Subscription delivers the events of a watch to a handler, filtered by
+// criteria that can be changed at any time without recreating the watch.
+type Subscription struct {
+	w        *Watcher
+	path     string
+	h        EventHandler
+	mu       sync.Mutex             // Protects access to the fields below.
+	triggers uint32                 // Notifications to deliver (FSN_MODIFY etc.)
+	pattern  []string               // Elements of the pattern names must match (nil for all)
+	debounce time.Duration          // Quiet period before delivering an event
+	pending  map[string]*time.Timer // Timers of debounced events (key: event name)
+	latest   map[string]*FileEvent  // Debounced event, merged with those before (key: event name)
+	closed   bool
+}
+
+// Subscribe watches path and delivers all its events to h until the
+// returned Subscription changes its criteria.
+func (w *Watcher) Subscribe(path string, h EventHandler) (*Subscription, error) {
+	s := newSubscription(w, path, h)
+	if err := w.WatchHandler(path, FSN_ALL, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newSubscription(w *Watcher, path string, h EventHandler) *Subscription {
+	return &Subscription{
+		w:        w,
+		path:     path,
+		h:        h,
+		triggers: FSN_ALL,
+		pending:  make(map[string]*time.Timer),
+		latest:   make(map[string]*FileEvent),
+	}
+}
+
+// SetTriggers selects the notifications to deliver (FSN_MODIFY etc.)
+func (s *Subscription) SetTriggers(flags uint32) {
+	s.mu.Lock()
+	s.triggers = flags
+	s.mu.Unlock()
+}
+
+// SetPattern only delivers events for files whose name matches the
+// pattern, using the syntax of Router: a pattern without "/", such as
+// "*.go", matches the base name, and one with "/", such as "src/*.go",
+// matches slash-separated names on every platform. An empty pattern
+// matches all files.
+func (s *Subscription) SetPattern(pattern string) error {
+	var elems []string
+	if pattern != "" {
+		var err error
+		if elems, err = compilePattern(pattern); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	s.pattern = elems
+	s.mu.Unlock()
+	return nil
+}
+
+// SetDebounce delays delivery until no event happened to a file for d,
+// then delivers only the latest event. Zero delivers events immediately.
+//
+// A file created in the period is still reported as created: later
+// events other than its delete or rename are folded into the create event,
+// as its Parts. A file created and then deleted or renamed away in the
+// same period is not reported at all.
+func (s *Subscription) SetDebounce(d time.Duration) {
+	s.mu.Lock()
+	s.debounce = d
+	s.mu.Unlock()
+}
+
+// Close removes the watch and drops any debounced events.
+func (s *Subscription) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for name, t := range s.pending {
+		t.Stop()
+		delete(s.pending, name)
+		delete(s.latest, name)
+	}
+	s.mu.Unlock()
+	return s.w.RemoveWatch(s.path)
+}
+
+// HandleEvent filters and debounces an event of the watch.
+func (s *Subscription) HandleEvent(ev *FileEvent) {
+	s.mu.Lock()
+	if s.closed || !s.matches(ev) {
+		s.mu.Unlock()
+		return
+	}
+	if s.debounce <= 0 {
+		s.mu.Unlock()
+		s.h.HandleEvent(ev)
+		return
+	}
+	s.debounceEvent(ev)
+	s.mu.Unlock()
+}
+
+// matches reports whether the event meets the triggers and pattern.
+// s.mu must be held.
+func (s *Subscription) matches(ev *FileEvent) bool {
+	if !ev.matchesFlags(s.triggers) {
+		return false
+	}
+	if s.pattern == nil {
+		return true
+	}
+	return matchElems(s.pattern, splitName(ev.Name))
+}
+
+// debounceEvent merges ev into the event debounced for its file and
+// restarts the quiet period. s.mu must be held.
+func (s *Subscription) debounceEvent(ev *FileEvent) {
+	if prev := s.latest[ev.Name]; prev != nil && prev.IsCreate() {
+		if ev.IsDelete() || ev.IsRename() {
+			// The stale timer sees it was removed, if it already fired
+			s.pending[ev.Name].Stop()
+			delete(s.pending, ev.Name)
+			delete(s.latest, ev.Name)
+			return
+		}
+		parts := prev.Parts()
+		if parts == nil {
+			parts = []*FileEvent{prev}
+		}
+		ev = compose(prev, append(parts, ev)...)
+	}
+	s.latest[ev.Name] = ev
+	if t, found := s.pending[ev.Name]; found && t.Stop() {
+		t.Reset(s.debounce)
+		return
+	}
+	// Either nothing is pending or the timer already fired; the stale
+	// timer sees it was replaced and leaves the event to the new one
+	name := ev.Name
+	var t *time.Timer
+	t = time.AfterFunc(s.debounce, func() {
+		s.mu.Lock()
+		if s.pending[name] != t {
+			s.mu.Unlock()
+			return
+		}
+		ev := s.latest[name]
+		delete(s.pending, name)
+		delete(s.latest, name)
+		s.mu.Unlock()
+		s.h.HandleEvent(ev)
+	})
+	s.pending[name] = t
+}
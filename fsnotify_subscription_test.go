@@ -0,0 +1,147 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSubscription(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	var goReceived, txtReceived counter
+	sub, err := watcher.Subscribe(testDir, EventHandlerFunc(func(event *FileEvent) {
+		t.Logf("event handled: %s", event)
+		switch filepath.Ext(event.Name) {
+		case ".go":
+			goReceived.increment()
+		case ".txt":
+			txtReceived.increment()
+		}
+	}))
+	if err != nil {
+		t.Fatalf("watcher.Subscribe(%q) failed: %s", testDir, err)
+	}
+	defer sub.Close()
+
+	writeFile := func(name string, n int) {
+		f, err := os.OpenFile(filepath.Join(testDir, name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			t.Fatalf("writing test file failed: %s", err)
+		}
+		for i := 0; i < n; i++ {
+			f.WriteString("data")
+			f.Sync()
+		}
+		f.Close()
+	}
+
+	// Only creates of .go files
+	if err := sub.SetPattern("*.go"); err != nil {
+		t.Fatalf("SetPattern failed: %s", err)
+	}
+	sub.SetTriggers(FSN_CREATE)
+	writeFile("a.go", 1)
+	writeFile("a.txt", 1)
+	time.Sleep(200 * time.Millisecond)
+	if goReceived.value() != 1 || txtReceived.value() != 0 {
+		t.Fatalf("incorrect events handled with pattern and triggers (%d .go, %d .txt vs 1, 0)", goReceived.value(), txtReceived.value())
+	}
+
+	// Many modifications are debounced into one event
+	goReceived.reset()
+	sub.SetTriggers(FSN_MODIFY)
+	sub.SetDebounce(100 * time.Millisecond)
+	writeFile("a.go", 10)
+	time.Sleep(400 * time.Millisecond)
+	if goReceived.value() != 1 {
+		t.Fatalf("incorrect number of debounced events handled (%d vs %d)", goReceived.value(), 1)
+	}
+
+	if err := sub.SetPattern("["); err == nil {
+		t.Fatal("expected error on malformed pattern, got nil")
+	}
+}
+
+func TestSubscriptionSlashPattern(t *testing.T) {
+	s := newSubscription(nil, "", nil)
+	if err := s.SetPattern("src/*.go"); err != nil {
+		t.Fatalf("SetPattern failed: %s", err)
+	}
+	root := os.TempDir()
+	for _, tt := range []struct {
+		name  string
+		match bool
+	}{
+		{filepath.Join(root, "src", "main.go"), true},
+		{filepath.Join(root, "lib", "main.go"), false},
+		{filepath.Join(root, "src", "main.c"), false},
+	} {
+		if matched := s.matches(newFileEvent(tt.name, FSN_CREATE)); matched != tt.match {
+			t.Errorf("pattern %q on %q: matched = %v, want %v", "src/*.go", tt.name, matched, tt.match)
+		}
+	}
+}
+
+func TestSubscriptionDebounceMerge(t *testing.T) {
+	handled := make(chan *FileEvent, 10)
+	s := newSubscription(nil, "", EventHandlerFunc(func(ev *FileEvent) {
+		handled <- ev
+	}))
+	s.SetDebounce(20 * time.Millisecond)
+
+	root := os.TempDir()
+	created, vanished, deleted := filepath.Join(root, "created"), filepath.Join(root, "vanished"), filepath.Join(root, "deleted")
+	for _, ev := range []*FileEvent{
+		newFileEvent(created, FSN_CREATE),
+		newFileEvent(vanished, FSN_CREATE),
+		newFileEvent(deleted, FSN_MODIFY),
+		newFileEvent(created, FSN_MODIFY),
+		newFileEvent(vanished, FSN_DELETE),
+		newFileEvent(deleted, FSN_DELETE),
+	} {
+		s.HandleEvent(ev)
+	}
+
+	// A create followed by a modify is still a create, a create followed by
+	// a delete is nothing, and the latest event wins otherwise
+	events := make(map[string]*FileEvent)
+	for timeout := time.After(200 * time.Millisecond); ; {
+		select {
+		case ev := <-handled:
+			if events[ev.Name] != nil {
+				t.Fatalf("more than one event handled for %s", ev.Name)
+			}
+			events[ev.Name] = ev
+			continue
+		case <-timeout:
+		}
+		break
+	}
+	if ev := events[created]; ev == nil || !ev.IsCreate() || len(ev.Parts()) != 2 || !ev.Parts()[1].IsModify() {
+		t.Errorf("created and modified file handled as %v, expected a create of a create and a modify", ev)
+	}
+	if ev := events[vanished]; ev != nil {
+		t.Errorf("created and deleted file handled as %s", ev)
+	}
+	if ev := events[deleted]; ev == nil || !ev.IsDelete() {
+		t.Errorf("modified and deleted file handled as %v, expected a delete", ev)
+	}
+}
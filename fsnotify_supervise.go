@@ -0,0 +1,145 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Backoff between attempts to recreate a watcher.
+const (
+	minSuperviseBackoff = 100 * time.Millisecond
+	maxSuperviseBackoff = 30 * time.Second
+)
+
+// A Supervisor keeps a watcher running, recreating it when it dies.
+type Supervisor struct {
+	// Error receives the errors of the watchers and of recreating them.
+	// It is buffered; errors are dropped while it is full.
+	Error chan error
+
+	stop     chan bool
+	done     chan bool
+	once     sync.Once
+	restarts uint64 // Number of times the watcher was recreated (atomic)
+}
+
+// Supervise calls factory to create a watcher, with its watches added, and
+// passes its events to onEvent. If the watcher dies, because its Event
+// channel is closed or its backend reports a broken descriptor, factory is
+// called again until it succeeds. As changes may have been missed, each
+// recovery is followed by a rescan: a modify event for every watched file
+// and every entry of the watched directories.
+func Supervise(factory func() (*Watcher, error), onEvent func(ev *FileEvent)) *Supervisor {
+	s := &Supervisor{
+		Error: make(chan error, 16),
+		stop:  make(chan bool),
+		done:  make(chan bool),
+	}
+	go s.run(factory, onEvent)
+	return s
+}
+
+// Restarts returns the number of times the watcher was recreated.
+func (s *Supervisor) Restarts() int {
+	return int(atomic.LoadUint64(&s.restarts))
+}
+
+// Stop closes the current watcher and stops supervising it.
+func (s *Supervisor) Stop() {
+	s.once.Do(func() { close(s.stop) })
+	<-s.done
+}
+
+func (s *Supervisor) run(factory func() (*Watcher, error), onEvent func(ev *FileEvent)) {
+	defer close(s.done)
+	backoff := minSuperviseBackoff
+	started := false
+	for {
+		w, err := factory()
+		if err != nil {
+			s.reportError(err)
+			select {
+			case <-s.stop:
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > maxSuperviseBackoff {
+				backoff = maxSuperviseBackoff
+			}
+			continue
+		}
+		backoff = minSuperviseBackoff
+		if started {
+			atomic.AddUint64(&s.restarts, 1)
+			rescan(w, onEvent)
+		}
+		started = true
+		stopped := s.serve(w, onEvent)
+		// Keep the channels drained so a dying watcher can close
+		go func() {
+			for range w.Event {
+			}
+		}()
+		go func() {
+			for range w.Error {
+			}
+		}()
+		w.Close()
+		if stopped {
+			return
+		}
+	}
+}
+
+// serve passes the events of w to onEvent until w dies or the supervisor
+// is stopped, reporting which.
+func (s *Supervisor) serve(w *Watcher, onEvent func(ev *FileEvent)) (stopped bool) {
+	for {
+		select {
+		case ev, ok := <-w.Event:
+			if !ok {
+				return false
+			}
+			onEvent(ev)
+		case err, ok := <-w.Error:
+			if !ok {
+				return false
+			}
+			s.reportError(err)
+			if brokenWatcher(err) {
+				return false
+			}
+		case <-s.stop:
+			return true
+		}
+	}
+}
+
+func (s *Supervisor) reportError(err error) {
+	select {
+	case s.Error <- err:
+	default:
+	}
+}
+
+// rescan delivers a modify event for every watched file and every entry of
+// the watched directories of w.
+func rescan(w *Watcher, onEvent func(ev *FileEvent)) {
+	for _, path := range w.watchedPaths() {
+		if files, err := ioutil.ReadDir(path); err == nil {
+			for _, fi := range files {
+				onEvent(newFileEvent(filepath.Join(path, fi.Name()), FSN_MODIFY))
+			}
+		} else if _, err := os.Stat(path); err == nil {
+			onEvent(newFileEvent(path, FSN_MODIFY))
+		}
+	}
+}
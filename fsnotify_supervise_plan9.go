@@ -0,0 +1,12 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build plan9
+
+package fsnotify
+
+// Watchers are polled on Plan 9, which no error breaks.
+func brokenWatcher(err error) bool {
+	return false
+}
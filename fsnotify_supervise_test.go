@@ -0,0 +1,67 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSuperviseRestart(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	testFile := filepath.Join(testDir, "TestSuperviseRestart.testfile")
+	f, err := os.OpenFile(testFile, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	f.Close()
+
+	var (
+		mu       sync.Mutex
+		watchers []*Watcher
+	)
+	factory := func() (*Watcher, error) {
+		w, err := NewWatcher()
+		if err != nil {
+			return nil, err
+		}
+		if err := w.Watch(testDir); err != nil {
+			w.Close()
+			return nil, err
+		}
+		mu.Lock()
+		watchers = append(watchers, w)
+		mu.Unlock()
+		return w, nil
+	}
+
+	var rescanReceived counter
+	s := Supervise(factory, func(ev *FileEvent) {
+		if ev.Name == testFile && ev.IsModify() {
+			rescanReceived.increment()
+		}
+	})
+	defer s.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+	// Kill the first watcher behind the supervisor's back
+	mu.Lock()
+	watchers[0].Close()
+	mu.Unlock()
+
+	time.Sleep(500 * time.Millisecond)
+	if s.Restarts() != 1 {
+		t.Fatalf("incorrect number of restarts after 500 ms (%d vs %d)", s.Restarts(), 1)
+	}
+	if rescanReceived.value() != 1 {
+		t.Fatalf("incorrect number of rescan events received after 500 ms (%d vs %d)", rescanReceived.value(), 1)
+	}
+}
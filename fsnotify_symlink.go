@@ -0,0 +1,126 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// WatchSymlink watches the symlink path like Watch, which watches its
+// target, and follows the link when it is retargeted, as when a "current"
+// link is switched to a new release. The watch then moves to the new target
+// and a retarget event is delivered for path (see FileEvent.Retargeted),
+// whatever the flags of the watch.
+//
+// The directory of the link is watched by a second watcher, created with
+// the first symlink watched.
+func (w *Watcher) WatchSymlink(path string) error {
+	path, err := w.checkPath(path)
+	if err != nil {
+		return err
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	if err := w.addPath(path, FSN_ALL, nil, w.watch); err != nil {
+		return err
+	}
+	return w.symlinks.add(w, path, target)
+}
+
+// Retargeted reports whether the event is the retargeting of a watched
+// symlink, and returns its new target (see WatchSymlink).
+func (e *FileEvent) Retargeted() (target string, ok bool) {
+	return e.retarget, e.retarget != ""
+}
+
+// A symlinkTable follows the targets of watched symlinks.
+type symlinkTable struct {
+	mu      sync.Mutex        // Protects access to the fields below.
+	dirs    *Watcher          // Watcher of the directories of the links (nil until a link is watched)
+	targets map[string]string // Map of watched links to their resolved targets
+	done    chan bool         // Closed when the dirs watcher is drained
+}
+
+// add records a watched link of w and watches its directory.
+func (t *symlinkTable) add(w *Watcher, link, target string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.dirs == nil {
+		dirs, err := NewWatcher()
+		if err != nil {
+			return err
+		}
+		t.dirs = dirs
+		t.targets = make(map[string]string)
+		t.done = make(chan bool)
+		go t.follow(w, dirs)
+	}
+	t.targets[link] = target
+	return t.dirs.Watch(filepath.Dir(link))
+}
+
+// follow moves the watches of the links of w when their directories report
+// a change to them, until dirs is closed.
+func (t *symlinkTable) follow(w *Watcher, dirs *Watcher) {
+	defer close(t.done)
+	events, errs := dirs.Event, dirs.Error
+	for events != nil || errs != nil {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			t.retarget(w, ev.Name)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			w.sendError(err)
+		}
+	}
+}
+
+// retarget moves the watch of link if it now resolves to a new target.
+func (t *symlinkTable) retarget(w *Watcher, link string) {
+	t.mu.Lock()
+	old, found := t.targets[link]
+	t.mu.Unlock()
+	if !found {
+		return
+	}
+	// A link being replaced may be briefly missing; its creation follows
+	target, err := filepath.EvalSymlinks(link)
+	if err != nil || target == old {
+		return
+	}
+	t.mu.Lock()
+	t.targets[link] = target
+	t.mu.Unlock()
+
+	// The old target may be gone already
+	w.removeWatch(link)
+	if err := w.watch(link); err != nil {
+		w.sendError(err)
+		return
+	}
+	w.queue(&FileEvent{Name: link, retarget: target})
+}
+
+// close stops following the links. It must be called before the internal
+// event channel of the watcher is closed.
+func (t *symlinkTable) close() {
+	t.mu.Lock()
+	dirs := t.dirs
+	t.mu.Unlock()
+	if dirs != nil {
+		dirs.Close()
+		<-t.done
+	}
+}
@@ -72,3 +72,83 @@ func TestFsnotifyFakeSymlink(t *testing.T) {
 	t.Log("calling Close()")
 	watcher.Close()
 }
+
+func TestFsnotifyWatchSymlinkRetarget(t *testing.T) {
+	// Create two releases and a "current" link to the first
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	v1 := filepath.Join(testDir, "v1")
+	v2 := filepath.Join(testDir, "v2")
+	for _, dir := range []string{v1, v2} {
+		if err := os.Mkdir(dir, 0777); err != nil {
+			t.Fatalf("creating test directory failed: %s", err)
+		}
+	}
+	current := filepath.Join(testDir, "current")
+	if err := os.Symlink(v1, current); err != nil {
+		t.Fatalf("creating symlink failed: %s", err)
+	}
+	resolvedV2, err := filepath.EvalSymlinks(v2)
+	if err != nil {
+		t.Fatalf("resolving %s failed: %s", v2, err)
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	testFile := filepath.Join(current, "TestFsnotifyWatchSymlinkRetarget.testfile")
+	var retargetReceived, createReceived counter
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			if target, ok := event.Retargeted(); ok {
+				if event.Name != current || target != resolvedV2 {
+					t.Errorf("retarget of %s to %s, want %s to %s", event.Name, target, current, resolvedV2)
+				}
+				retargetReceived.increment()
+			} else if event.Name == testFile && event.IsCreate() {
+				createReceived.increment()
+			}
+		}
+	}()
+
+	if err := watcher.WatchSymlink(current); err != nil {
+		t.Fatalf("watching symlink %q failed: %s", current, err)
+	}
+
+	// Switch the link atomically, as deployment tools do
+	next := filepath.Join(testDir, "current.next")
+	if err := os.Symlink(v2, next); err != nil {
+		t.Fatalf("creating symlink failed: %s", err)
+	}
+	if err := os.Rename(next, current); err != nil {
+		t.Fatalf("switching symlink failed: %s", err)
+	}
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if retargetReceived.value() != 1 {
+		t.Fatalf("incorrect number of retarget events received after 500 ms (%d vs %d)", retargetReceived.value(), 1)
+	}
+
+	// Changes in the new target are seen, and those in the old one are not
+	for _, dir := range []string{v1, v2} {
+		f, err := os.OpenFile(filepath.Join(dir, filepath.Base(testFile)), os.O_WRONLY|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+		f.Close()
+	}
+	time.Sleep(500 * time.Millisecond)
+	if createReceived.value() != 1 {
+		t.Fatalf("incorrect number of create events received after retarget (%d vs %d)", createReceived.value(), 1)
+	}
+}
@@ -5,7 +5,7 @@
 package fsnotify
 
 import (
-	"io/ioutil"
+	"context"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -13,6 +13,8 @@ import (
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/howeyc/fsnotify/fsnotifytest"
 )
 
 // An atomic counter
@@ -34,11 +36,7 @@ func (c *counter) reset() {
 
 // tempMkdir makes a temporary directory
 func tempMkdir(t *testing.T) string {
-	dir, err := ioutil.TempDir("", "fsnotify")
-	if err != nil {
-		t.Fatalf("failed to create test directory: %s", err)
-	}
-	return dir
+	return fsnotifytest.NewTestTree(t)
 }
 
 // newWatcher initializes an fsnotify Watcher instance.
@@ -976,6 +974,307 @@ func TestFsnotifyAttrib(t *testing.T) {
 	os.Remove(testFile)
 }
 
+func TestFsnotifyWatchFlags(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	testFile := filepath.Join(testDir, "TestFsnotifyWatchFlags.testfile")
+
+	var deleteReceived, otherReceived counter
+	go func() {
+		for event := range watcher.Event {
+			if event.Name == filepath.Clean(testFile) && event.IsDelete() {
+				deleteReceived.increment()
+			} else {
+				otherReceived.increment()
+			}
+		}
+	}()
+
+	if err := watcher.WatchFlags(testDir, FSN_DELETE); err != nil {
+		t.Fatalf("watcher.WatchFlags(%q) failed: %s", testDir, err)
+	}
+
+	// Only the delete is selected
+	f, err := os.OpenFile(testFile, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	for i := 0; i < 100; i++ {
+		f.WriteString("data")
+	}
+	f.Close()
+	time.Sleep(50 * time.Millisecond)
+	os.Remove(testFile)
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if deleteReceived.value() != 1 {
+		t.Fatalf("incorrect number of delete events received after 500 ms (%d vs %d)", deleteReceived.value(), 1)
+	}
+	if otherReceived.value() != 0 {
+		t.Fatalf("received %d events that were not selected", otherReceived.value())
+	}
+}
+
+func TestFsnotifyWatchHandler(t *testing.T) {
+	// Create directories to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+	testDirHandled := tempMkdir(t)
+	defer os.RemoveAll(testDirHandled)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	testFile := filepath.Join(testDir, "TestFsnotifyWatchHandler.testfile")
+	testFileHandled := filepath.Join(testDirHandled, "TestFsnotifyWatchHandler.testfile")
+
+	// Count the events delivered to the channel and to the handler
+	var channelReceived, handlerReceived counter
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			if event.Name == filepath.Clean(testFile) && event.IsCreate() {
+				channelReceived.increment()
+			} else {
+				t.Logf("unexpected event received: %s", event)
+			}
+		}
+	}()
+	handler := EventHandlerFunc(func(event *FileEvent) {
+		t.Logf("event handled: %s", event)
+		if event.Name == filepath.Clean(testFileHandled) && event.IsCreate() {
+			handlerReceived.increment()
+		} else {
+			t.Logf("unexpected event handled: %s", event)
+		}
+	})
+
+	addWatch(t, watcher, testDir)
+	if err := watcher.WatchHandler(testDirHandled, FSN_CREATE, handler); err != nil {
+		t.Fatalf("watcher.WatchHandler(%q) failed: %s", testDirHandled, err)
+	}
+
+	for _, name := range []string{testFile, testFileHandled} {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+		f.Close()
+	}
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if channelReceived.value() != 1 {
+		t.Fatalf("incorrect number of create events received after 500 ms (%d vs %d)", channelReceived.value(), 1)
+	}
+	if handlerReceived.value() != 1 {
+		t.Fatalf("incorrect number of create events handled after 500 ms (%d vs %d)", handlerReceived.value(), 1)
+	}
+}
+
+func TestFsnotifyWatchHandlerContext(t *testing.T) {
+	// Create directories to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+	testDirCanceled := tempMkdir(t)
+	defer os.RemoveAll(testDirCanceled)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	type tenantKey struct{}
+	var handledReceived, canceledReceived counter
+	ctx := context.WithValue(context.Background(), tenantKey{}, "tenant")
+	handler := EventHandlerFunc(func(event *FileEvent) {
+		if event.Context().Value(tenantKey{}) == "tenant" {
+			handledReceived.increment()
+		}
+	})
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	canceledHandler := EventHandlerFunc(func(event *FileEvent) {
+		canceledReceived.increment()
+	})
+
+	if err := watcher.WatchHandlerContext(ctx, testDir, FSN_CREATE, handler); err != nil {
+		t.Fatalf("watcher.WatchHandlerContext(%q) failed: %s", testDir, err)
+	}
+	if err := watcher.WatchHandlerContext(canceledCtx, testDirCanceled, FSN_CREATE, canceledHandler); err != nil {
+		t.Fatalf("watcher.WatchHandlerContext(%q) failed: %s", testDirCanceled, err)
+	}
+	cancel()
+
+	for _, dir := range []string{testDir, testDirCanceled} {
+		f, err := os.OpenFile(filepath.Join(dir, "TestFsnotifyWatchHandlerContext.testfile"), os.O_WRONLY|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+		f.Close()
+	}
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if handledReceived.value() != 1 {
+		t.Fatalf("incorrect number of create events handled with context after 500 ms (%d vs %d)", handledReceived.value(), 1)
+	}
+	if canceledReceived.value() != 0 {
+		t.Fatalf("events were handled after the context was canceled (%d)", canceledReceived.value())
+	}
+}
+
+func TestFsnotifyMiddleware(t *testing.T) {
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	testFile := filepath.Join(testDir, "TestFsnotifyMiddleware.testfile")
+	testFileDropped := filepath.Join(testDir, "TestFsnotifyMiddleware.dropped")
+
+	// The first middleware counts every event, the second drops some
+	var seenReceived, eventsReceived counter
+	watcher.Use(func(next EventHandler) EventHandler {
+		return EventHandlerFunc(func(event *FileEvent) {
+			seenReceived.increment()
+			next.HandleEvent(event)
+		})
+	}, func(next EventHandler) EventHandler {
+		return EventHandlerFunc(func(event *FileEvent) {
+			if filepath.Ext(event.Name) != ".dropped" {
+				next.HandleEvent(event)
+			}
+		})
+	})
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			if event.Name != filepath.Clean(testFile) {
+				t.Errorf("unexpected event received: %s", event)
+			}
+			eventsReceived.increment()
+		}
+	}()
+
+	addWatch(t, watcher, testDir)
+
+	for _, name := range []string{testFile, testFileDropped} {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+		f.Close()
+	}
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if seenReceived.value() != 2 {
+		t.Fatalf("incorrect number of events seen by middleware after 500 ms (%d vs %d)", seenReceived.value(), 2)
+	}
+	if eventsReceived.value() != 1 {
+		t.Fatalf("incorrect number of events received after 500 ms (%d vs %d)", eventsReceived.value(), 1)
+	}
+}
+
+func TestFsnotifySizeChange(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("size tracking is not supported on Windows.")
+	}
+
+	// Create directory to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetSizeTracking(true)
+
+	// Create a file before watching directory
+	testFile := filepath.Join(testDir, "TestFsnotifySizeChange.testfile")
+	f, err := os.OpenFile(testFile, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	f.WriteString("data")
+	f.Close()
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	events := make(chan *FileEvent, 10)
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			if event.Name == filepath.Clean(testFile) && event.IsModify() {
+				events <- event
+			}
+		}
+	}()
+
+	addWatch(t, watcher, testDir)
+
+	f, err = os.OpenFile(testFile, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("reopening test file failed: %s", err)
+	}
+	f.WriteString("more data")
+	f.Close()
+
+	select {
+	case event := <-events:
+		before, after, ok := event.SizeChange()
+		if !ok {
+			t.Fatal("modify event did not report a size change")
+		}
+		if before != 4 || after != 13 {
+			t.Fatalf("incorrect size change reported (%d -> %d vs 4 -> 13)", before, after)
+		}
+		if c := event.Change(); c != Appended {
+			t.Fatalf("incorrect change reported (%s vs %s)", c, Appended)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("fsnotify modify events have not received after 500 ms")
+	}
+}
+
 func TestFsnotifyClose(t *testing.T) {
 	watcher := newWatcher(t)
 	watcher.Close()
@@ -0,0 +1,17 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import "time"
+
+// Time returns when the event was observed: when it was read from the
+// system, or for the events the watcher makes up itself, such as those of
+// rescans and polling, when it was found or delivered. Events of change
+// journals carry the time the journal recorded instead (see WatchJournal).
+// Events read together may share the time they were read; against the time
+// of delivery, it measures the latency of the watcher.
+func (e *FileEvent) Time() time.Time {
+	return e.stamp
+}
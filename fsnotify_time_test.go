@@ -0,0 +1,67 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFsnotifyEventTime(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	addWatch(t, watcher, testDir)
+
+	testFile := filepath.Join(testDir, "TestFsnotifyEventTime.testfile")
+	before := time.Now()
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-watcher.Event:
+			if ev.Name != testFile {
+				continue
+			}
+			if at := ev.Time(); at.Before(before) || at.After(time.Now()) {
+				t.Fatalf("%s observed at %s, expected between %s and its delivery", ev, at, before)
+			}
+			return
+		case <-timeout:
+			t.Fatalf("no event received for %q", testFile)
+		}
+	}
+}
+
+func TestMockWatcherEventTime(t *testing.T) {
+	watcher, err := NewMockWatcher()
+	if err != nil {
+		t.Fatalf("NewMockWatcher() failed: %s", err)
+	}
+	defer watcher.Close()
+	dir := filepath.Join("no", "such", "dir")
+	if err := watcher.Watch(dir); err != nil {
+		t.Fatalf("watcher.Watch(%q) failed: %s", dir, err)
+	}
+
+	// Made up events are observed as they are delivered
+	before := time.Now()
+	go watcher.Inject(filepath.Join(dir, "file"), FSN_CREATE)
+	select {
+	case ev := <-watcher.Event:
+		if ev.Time().Before(before) {
+			t.Fatalf("%s observed at %s, expected after %s", ev, ev.Time(), before)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+}
@@ -0,0 +1,556 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VolumeSkip lists system directories worth skipping when watching a whole
+// Windows volume with WatchTree.
+var VolumeSkip = []string{"System Volume Information", "$Recycle.Bin", "pagefile.sys", "hiberfil.sys", "swapfile.sys"}
+
+// WatchTree watches the directory path and all directories below it,
+// except the trees listed in skip, given relative to path.
+//
+// On Windows this is a single watch of the whole tree, which suits whole
+// volumes such as D:\ (see VolumeSkip). Elsewhere each directory found at
+// the time of the call is watched individually; directories created later
+// are not added, unless SetMoveInScan is enabled.
+func (w *Watcher) WatchTree(path string, skip []string) error {
+	path, err := w.checkPath(path)
+	if err != nil {
+		return err
+	}
+	return w.addTree(filepath.Clean(path), skip, nil, nil)
+}
+
+// A TreeProgress reports the progress of watching a tree with
+// WatchTreeProgress.
+type TreeProgress struct {
+	Dirs int   // Number of directories watched so far
+	Done bool  // Set on the last report, once the walk is over
+	Err  error // Error that ended the walk, on the last report
+}
+
+// WatchTreeProgress is like WatchTree, but watches the tree in the
+// background, so that a large tree does not hold up the caller. Events of
+// directories not yet watched are missed. The returned channel reports the
+// number of directories watched so far, dropping reports the receiver is
+// not ready for, then a last report with Done set, and is closed.
+func (w *Watcher) WatchTreeProgress(path string, skip []string) <-chan TreeProgress {
+	c := make(chan TreeProgress, 1)
+	go func() {
+		defer close(c)
+		dirs := 0
+		report := func(n int) {
+			dirs = n
+			select {
+			case c <- TreeProgress{Dirs: n}:
+			default:
+			}
+		}
+		path, err := w.checkPath(path)
+		if err == nil {
+			err = w.addTree(filepath.Clean(path), skip, nil, report)
+		}
+		// Make room for the last report
+		select {
+		case <-c:
+		default:
+		}
+		c <- TreeProgress{Dirs: dirs, Done: true, Err: err}
+	}()
+	return c
+}
+
+// addTree watches the tree of path, delivering its events to h, and
+// records its root. If progress is not nil, it is called with the number
+// of directories watched so far as they are watched.
+func (w *Watcher) addTree(path string, skip []string, h EventHandler, progress func(dirs int)) error {
+	depth := w.treeDepthLimit()
+	// Recorded first, for the walk to honor its excluded directories
+	w.trees.add(path, treeRoot{skip: skip, depth: depth, exclude: w.trees.excludes(), h: h})
+	if err := w.watchTree(path, skip, depth, h, progress); err != nil {
+		w.trees.remove(path)
+		return err
+	}
+	return nil
+}
+
+// SetTreeExcludes excludes the directories matching any of the patterns
+// from later tree watches (see WatchTree), such as node_modules, vendor or
+// build output: they are not watched, neither when the tree is watched nor
+// when they appear later (see SetMoveInScan), and no events are delivered
+// for anything they contain. The event of an excluded directory itself is
+// still delivered. Patterns use the syntax of Router, matched against the
+// path of directories relative to the root of the tree: "node_modules"
+// matches a directory of that name at any depth, "/build" only the one at
+// the root. Unlike SetIgnoredNames, files are not excluded.
+func (w *Watcher) SetTreeExcludes(patterns []string) error {
+	var exclude [][]string
+	for _, pattern := range patterns {
+		elems, err := compilePattern(pattern)
+		if err != nil {
+			return err
+		}
+		exclude = append(exclude, elems)
+	}
+	w.trees.mu.Lock()
+	w.trees.exclude = exclude
+	w.trees.mu.Unlock()
+	return nil
+}
+
+// SetTreeDepth limits later tree watches (see WatchTree) to path and the
+// directories at most depth levels below it: with a depth of 1, path and
+// its subdirectories are watched, and so the files in them, but not the
+// directories below those. On Windows, where a tree is a single watch, the
+// events of deeper directories are dropped instead. Zero, the default,
+// watches whole trees.
+func (w *Watcher) SetTreeDepth(depth int) {
+	w.fsnmut.Lock()
+	w.treeDepth = depth
+	w.fsnmut.Unlock()
+}
+
+func (w *Watcher) treeDepthLimit() int {
+	w.fsnmut.Lock()
+	defer w.fsnmut.Unlock()
+	return w.treeDepth
+}
+
+// tooDeep reports whether the directory rel, relative to the root of a
+// tree, lies more than depth levels below it. A depth of zero is no limit.
+func tooDeep(rel string, depth int) bool {
+	if depth <= 0 || rel == "." {
+		return false
+	}
+	return strings.Count(filepath.ToSlash(rel), "/")+1 > depth
+}
+
+// RemoveWatchTree removes the watches of the tree path watched with
+// WatchTree, WatchTreeHandler or WatchMount: the watch on path and, where
+// each directory is watched individually, those on the directories below
+// it, so that long-running programs do not leak watches as trees come and
+// go. Every watch is removed even if removing one fails; the first error
+// is returned.
+func (w *Watcher) RemoveWatchTree(path string) error {
+	if resolved, err := w.rootPath(path); err == nil {
+		path = resolved
+	} else {
+		path = w.rootPathLexical(path)
+	}
+	path = filepath.Clean(path)
+	prefix := strings.TrimSuffix(path, string(filepath.Separator)) + string(filepath.Separator)
+	var tree []string
+	for _, p := range w.watchedPaths() {
+		if p == path || strings.HasPrefix(p, prefix) {
+			tree = append(tree, p)
+		}
+	}
+	if len(tree) == 0 {
+		// Let the backend report it
+		return w.removePath(path)
+	}
+	var first error
+	// Deepest first, as watchedPaths is sorted
+	for i := len(tree) - 1; i >= 0; i-- {
+		if err := w.removePath(tree[i]); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// SetMoveInScan enables announcing the contents of directories moved or
+// created into watched trees (see WatchTree), for which the system only
+// reports the directory itself. After the create event of such a
+// directory, a create event is delivered for every file and directory in
+// it, and where each directory of a tree is watched individually, its
+// directories are watched too, with the skip list and depth of the tree.
+// A file created in the directory just as it is scanned may be reported
+// twice.
+func (w *Watcher) SetMoveInScan(enable bool) {
+	w.trees.mu.Lock()
+	w.trees.scan = enable
+	w.trees.mu.Unlock()
+}
+
+// A treeTable records the roots of tree watches.
+type treeTable struct {
+	mu      sync.Mutex          // Protects access to the fields below.
+	scan    bool                // Set if directories moved in are scanned (see SetMoveInScan)
+	exclude [][]string          // Patterns of directories excluded from later trees (see SetTreeExcludes)
+	roots   map[string]treeRoot // Map of the roots of tree watches to how they are watched
+}
+
+// A treeRoot records how a tree is watched.
+type treeRoot struct {
+	skip    []string
+	depth   int
+	exclude [][]string
+	h       EventHandler
+}
+
+func (t *treeTable) add(path string, r treeRoot) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.roots == nil {
+		t.roots = make(map[string]treeRoot)
+	}
+	t.roots[path] = r
+}
+
+func (t *treeTable) remove(path string) {
+	t.mu.Lock()
+	delete(t.roots, path)
+	t.mu.Unlock()
+}
+
+func (t *treeTable) excludes() [][]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.exclude
+}
+
+// excluded reports whether dir is, or lies below, a directory excluded
+// from a tree containing it.
+func (t *treeTable) excluded(dir string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for root, r := range t.roots {
+		if len(r.exclude) == 0 {
+			continue
+		}
+		if rel, err := filepath.Rel(root, dir); err == nil && rel != "." && !strings.HasPrefix(rel, "..") && excludedRel(rel, r.exclude) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludedRel reports whether the directory rel, relative to the root of a
+// tree, or one of the directories above it matches an excluded pattern.
+func excludedRel(rel string, exclude [][]string) bool {
+	elems := splitPattern(filepath.ToSlash(rel))
+	for i := 1; i <= len(elems); i++ {
+		for _, pattern := range exclude {
+			if matchElems(pattern, elems[:i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// covers reports whether name is the root of a watched tree or lies in
+// one.
+func (t *treeTable) covers(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for root := range t.roots {
+		if within(name, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// rootOf returns the deepest root of a tree containing name, if name is
+// below it and directories moved in are scanned.
+func (t *treeTable) rootOf(name string) (string, treeRoot, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.scan {
+		return "", treeRoot{}, false
+	}
+	var best string
+	for root := range t.roots {
+		if len(root) > len(best) && strings.HasPrefix(name, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator)) {
+			best = root
+		}
+	}
+	r, found := t.roots[best]
+	return best, r, found
+}
+
+// scanMovedIn delivers create events for the contents of a directory
+// created in a tree, watching its directories as its tree is watched.
+func (w *Watcher) scanMovedIn(ev *FileEvent, send EventHandlerFunc) {
+	root, r, found := w.trees.rootOf(ev.Name)
+	if !found {
+		return
+	}
+	if fi, err := os.Lstat(ev.Name); err != nil || !fi.IsDir() {
+		return
+	}
+	filepath.Walk(ev.Name, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			// Gone already
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || w.isIgnored(path) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if path != ev.Name {
+			// Files in directories beyond the depth are not reported
+			if tooDeep(filepath.Dir(rel), r.depth) {
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			created := newFileEvent(path, FSN_CREATE)
+			created.dir = fi.IsDir()
+			created.stamp = time.Now()
+			w.deliverName(created, send)
+		}
+		if !fi.IsDir() {
+			return nil
+		}
+		if skipped(rel, r.skip) || tooDeep(rel, r.depth) || excludedRel(rel, r.exclude) {
+			return filepath.SkipDir
+		}
+		if !nativeTrees {
+			w.addPath(path, FSN_ALL, r.h, w.watch)
+		}
+		return nil
+	})
+}
+
+// TreeOptions are the criteria for delivering the events of part of a tree
+// watched with WatchTreeHandler.
+type TreeOptions struct {
+	Triggers uint32        // Notifications to deliver (FSN_MODIFY etc.; zero for all)
+	Pattern  string        // Pattern the name must match, as in Subscription.SetPattern
+	Debounce time.Duration // Quiet period before delivering an event, as in Subscription.SetDebounce
+}
+
+// WatchTreeHandler is like WatchTree, but delivers the events to h,
+// filtered by opts. Below the subdirectories keyed in overrides, given
+// relative to path, their own options apply instead; the deepest one wins.
+func (w *Watcher) WatchTreeHandler(path string, skip []string, opts TreeOptions, overrides map[string]TreeOptions, h EventHandler) error {
+	path, err := w.checkPath(path)
+	if err != nil {
+		return err
+	}
+	path = filepath.Clean(path)
+	th := &treeHandler{root: path, subs: make(map[string]*Subscription)}
+	if th.def, err = th.subscription(w, opts, h); err != nil {
+		return err
+	}
+	for rel, o := range overrides {
+		rel = strings.Trim(filepath.ToSlash(filepath.Clean(rel)), "/")
+		if th.subs[rel], err = th.subscription(w, o, h); err != nil {
+			return err
+		}
+	}
+	return w.addTree(path, skip, th, nil)
+}
+
+// A treeHandler passes the events of a tree to the subscription of the
+// part of the tree they belong to.
+type treeHandler struct {
+	root string
+	def  *Subscription            // Subscription outside the overrides
+	subs map[string]*Subscription // Subscriptions of the overrides (key: slash-separated path relative to root)
+}
+
+func (th *treeHandler) subscription(w *Watcher, opts TreeOptions, h EventHandler) (*Subscription, error) {
+	s := newSubscription(w, th.root, h)
+	if opts.Triggers != 0 {
+		s.SetTriggers(opts.Triggers)
+	}
+	if err := s.SetPattern(opts.Pattern); err != nil {
+		return nil, err
+	}
+	s.SetDebounce(opts.Debounce)
+	return s, nil
+}
+
+func (th *treeHandler) HandleEvent(ev *FileEvent) {
+	s := th.def
+	if rel, err := filepath.Rel(th.root, ev.Name); err == nil {
+		rel = filepath.ToSlash(rel)
+		best := -1
+		for prefix, sub := range th.subs {
+			if len(prefix) > best && (rel == prefix || strings.HasPrefix(rel, prefix+"/")) {
+				s, best = sub, len(prefix)
+			}
+		}
+	}
+	s.HandleEvent(ev)
+}
+
+// treeWorkers is the number of directories of a tree read and watched at
+// once by watchTreeWalk.
+const treeWorkers = 16
+
+// watchTreeWalk watches every directory of the tree of root individually,
+// down to depth levels below it, delivering their events to h. The root is
+// watched first, so its events are delivered while the directories below
+// it are read and watched by a pool of workers. progress, if not nil, is
+// called after each directory is watched. If watching a directory fails,
+// the directories the walk watched are unwatched again, so that the tree
+// is watched in full or not at all, and the error is returned.
+func (w *Watcher) watchTreeWalk(root string, skip []string, depth int, h EventHandler, progress func(dirs int)) error {
+	fi, err := os.Lstat(root)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return nil
+	}
+	watched := w.watching(root)
+	if err := w.addPath(root, FSN_ALL, h, w.watch); err != nil {
+		if !watched {
+			// Drop what addPath recorded before failing
+			w.removePath(root)
+		}
+		return err
+	}
+	t := &treeWalk{queue: []string{root}, dirs: 1, progress: progress}
+	if !watched {
+		t.added = []string{root}
+	}
+	t.cond = sync.NewCond(&t.mu)
+	if progress != nil {
+		progress(1)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < treeWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dir, ok := t.next(); ok; dir, ok = t.next() {
+				t.done(w.watchTreeDir(t, root, dir, skip, depth, h))
+			}
+		}()
+	}
+	wg.Wait()
+	if t.err != nil {
+		// Deepest first
+		sort.Strings(t.added)
+		for i := len(t.added) - 1; i >= 0; i-- {
+			w.removePath(t.added[i])
+		}
+	}
+	return t.err
+}
+
+// A treeWalk is the queue of directories of a tree still to be read.
+type treeWalk struct {
+	mu       sync.Mutex     // Protects access to the fields below.
+	cond     *sync.Cond     // Signaled when the queue grows or the walk ends
+	queue    []string       // Watched directories whose subdirectories are to be watched
+	busy     int            // Number of directories being read
+	err      error          // First error, which ends the walk
+	dirs     int            // Number of directories watched
+	progress func(dirs int) // Called as directories are watched (nil for none)
+	added    []string       // Directories not watched before the walk
+}
+
+// next returns the next directory to read, waiting for one while others
+// are read. It reports false once the walk is over.
+func (t *treeWalk) next() (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for len(t.queue) == 0 && t.busy > 0 && t.err == nil {
+		t.cond.Wait()
+	}
+	if len(t.queue) == 0 || t.err != nil {
+		t.cond.Broadcast()
+		return "", false
+	}
+	dir := t.queue[len(t.queue)-1]
+	t.queue = t.queue[:len(t.queue)-1]
+	t.busy++
+	return dir, true
+}
+
+// push queues the watched directory dir to be read, reporting progress in
+// order. added is set if dir was not watched before the walk.
+func (t *treeWalk) push(dir string, added bool) {
+	t.mu.Lock()
+	t.queue = append(t.queue, dir)
+	if added {
+		t.added = append(t.added, dir)
+	}
+	t.dirs++
+	if t.progress != nil {
+		t.progress(t.dirs)
+	}
+	t.mu.Unlock()
+	t.cond.Signal()
+}
+
+// done ends the reading of a directory, ending the walk on err.
+func (t *treeWalk) done(err error) {
+	t.mu.Lock()
+	t.busy--
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+	t.mu.Unlock()
+	t.cond.Broadcast()
+}
+
+// watchTreeDir watches the subdirectories of dir in the tree of root,
+// queuing them to be read in turn.
+func (w *Watcher) watchTreeDir(t *treeWalk, root, dir string, skip []string, depth int, h EventHandler) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range files {
+		if !fi.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, fi.Name())
+		if rel, err := filepath.Rel(root, path); err == nil && (skipped(rel, skip) || tooDeep(rel, depth)) {
+			continue
+		}
+		if w.isIgnored(path) || w.trees.excluded(path) {
+			continue
+		}
+		watched := w.watching(path)
+		if err := w.addPath(path, FSN_ALL, h, w.watch); err != nil {
+			if !watched {
+				// Drop what addPath recorded before failing
+				t.mu.Lock()
+				t.added = append(t.added, path)
+				t.mu.Unlock()
+			}
+			return err
+		}
+		t.push(path, !watched)
+	}
+	return nil
+}
+
+// skipped reports whether the path rel, relative to the root of a tree,
+// lies in one of the skipped trees. Names are compared ignoring case, as
+// on Windows volumes.
+func skipped(rel string, skip []string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, s := range skip {
+		s = strings.TrimSuffix(filepath.ToSlash(s), "/")
+		if strings.EqualFold(rel, s) || (len(rel) > len(s) && strings.EqualFold(rel[:len(s)+1], s+"/")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,452 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFsnotifyWatchTree(t *testing.T) {
+	// Create directory tree to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	for _, dir := range []string{"a/b", "skipped/c"} {
+		if err := os.MkdirAll(filepath.Join(testDir, dir), 0777); err != nil {
+			t.Fatalf("creating test directory failed: %s", err)
+		}
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	testFile := filepath.Join(testDir, "a", "b", "TestFsnotifyWatchTree.testfile")
+	testFileSkipped := filepath.Join(testDir, "skipped", "c", "TestFsnotifyWatchTree.testfile")
+	var createReceived, skippedReceived counter
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			switch {
+			case event.Name == testFile && event.IsCreate():
+				createReceived.increment()
+			case event.Name == testFileSkipped:
+				skippedReceived.increment()
+			}
+		}
+	}()
+
+	if err := watcher.WatchTree(testDir, []string{"SKIPPED"}); err != nil {
+		t.Fatalf("watching tree %q failed: %s", testDir, err)
+	}
+
+	for _, name := range []string{testFile, testFileSkipped} {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+		f.Close()
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	if createReceived.value() != 1 {
+		t.Fatalf("incorrect number of create events received after 500 ms (%d vs %d)", createReceived.value(), 1)
+	}
+	if skippedReceived.value() != 0 {
+		t.Fatalf("events received for a skipped tree (%d)", skippedReceived.value())
+	}
+}
+
+func TestFsnotifyWatchTreeHandlerOverrides(t *testing.T) {
+	// Create directory tree to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	for _, dir := range []string{"src/pkg", "assets"} {
+		if err := os.MkdirAll(filepath.Join(testDir, dir), 0777); err != nil {
+			t.Fatalf("creating test directory failed: %s", err)
+		}
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	// Receive errors on the error channel on a separate goroutine
+	go func() {
+		for err := range watcher.Error {
+			t.Fatalf("error received: %s", err)
+		}
+	}()
+
+	testFileGo := filepath.Join(testDir, "src", "pkg", "main.go")
+	testFileText := filepath.Join(testDir, "src", "pkg", "notes.txt")
+	testFileAsset := filepath.Join(testDir, "assets", "logo.png")
+	var goReceived, textReceived, assetReceived counter
+	h := EventHandlerFunc(func(event *FileEvent) {
+		t.Logf("event received: %s", event)
+		switch event.Name {
+		case testFileGo:
+			goReceived.increment()
+		case testFileText:
+			textReceived.increment()
+		case testFileAsset:
+			assetReceived.increment()
+		}
+	})
+
+	overrides := map[string]TreeOptions{
+		"src": {Pattern: "*.go", Debounce: 200 * time.Millisecond},
+	}
+	if err := watcher.WatchTreeHandler(testDir, nil, TreeOptions{Triggers: FSN_CREATE}, overrides, h); err != nil {
+		t.Fatalf("watching tree %q failed: %s", testDir, err)
+	}
+
+	for _, name := range []string{testFileGo, testFileText, testFileAsset} {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+		f.WriteString("data")
+		f.Sync()
+		f.Close()
+	}
+
+	// The assets are only filtered by trigger; the sources are debounced
+	time.Sleep(100 * time.Millisecond)
+	if assetReceived.value() != 1 {
+		t.Fatalf("incorrect number of asset events received after 100 ms (%d vs %d)", assetReceived.value(), 1)
+	}
+	if goReceived.value() != 0 {
+		t.Fatalf("source events received before the debounce period (%d)", goReceived.value())
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	if goReceived.value() != 1 {
+		t.Fatalf("incorrect number of source events received after 600 ms (%d vs %d)", goReceived.value(), 1)
+	}
+	if textReceived.value() != 0 {
+		t.Fatalf("events received for a file not matching the pattern (%d)", textReceived.value())
+	}
+}
+
+func TestFsnotifyRemoveWatchTree(t *testing.T) {
+	// Create directory tree to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	for _, dir := range []string{"a/b", "c"} {
+		if err := os.MkdirAll(filepath.Join(testDir, dir), 0777); err != nil {
+			t.Fatalf("creating test directory failed: %s", err)
+		}
+	}
+	otherDir := tempMkdir(t)
+	defer os.RemoveAll(otherDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	if err := watcher.WatchTree(testDir, nil); err != nil {
+		t.Fatalf("watching tree %q failed: %s", testDir, err)
+	}
+	addWatch(t, watcher, otherDir)
+	if err := watcher.RemoveWatchTree(testDir); err != nil {
+		t.Fatalf("removing tree %q failed: %s", testDir, err)
+	}
+	if paths := watcher.watchedPaths(); len(paths) != 1 || paths[0] != otherDir {
+		t.Fatalf("watched paths after removing the tree: %q, expected %q", paths, otherDir)
+	}
+	if err := watcher.RemoveWatchTree(testDir); err == nil {
+		t.Fatalf("removing tree %q twice succeeded", testDir)
+	}
+}
+
+func TestFsnotifyWatchTreeDepth(t *testing.T) {
+	// Create directory tree to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	if err := os.MkdirAll(filepath.Join(testDir, "a", "b", "c"), 0777); err != nil {
+		t.Fatalf("creating test directory failed: %s", err)
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetTreeDepth(1)
+
+	testFile := filepath.Join(testDir, "a", "TestFsnotifyWatchTreeDepth.testfile")
+	testFileDeep := filepath.Join(testDir, "a", "b", "TestFsnotifyWatchTreeDepth.testfile")
+	var createReceived, deepReceived counter
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			switch event.Name {
+			case testFile:
+				createReceived.increment()
+			case testFileDeep:
+				deepReceived.increment()
+			}
+		}
+	}()
+
+	if err := watcher.WatchTree(testDir, nil); err != nil {
+		t.Fatalf("watching tree %q failed: %s", testDir, err)
+	}
+	for _, path := range watcher.watchedPaths() {
+		if rel, _ := filepath.Rel(testDir, path); tooDeep(rel, 1) {
+			t.Fatalf("directory %s below the depth was watched", path)
+		}
+	}
+
+	for _, name := range []string{testFile, testFileDeep} {
+		if err := ioutil.WriteFile(name, nil, 0666); err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+	}
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if createReceived.value() == 0 {
+		t.Fatal("no event received for a file within the depth")
+	}
+	if deepReceived.value() != 0 {
+		t.Fatalf("events received for a file below the depth (%d)", deepReceived.value())
+	}
+}
+
+func TestFsnotifyMoveInScan(t *testing.T) {
+	// Create directory tree to watch, and a tree to move into it
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+	otherDir := tempMkdir(t)
+	defer os.RemoveAll(otherDir)
+
+	movedDir := filepath.Join(otherDir, "moved")
+	if err := os.MkdirAll(filepath.Join(movedDir, "sub"), 0777); err != nil {
+		t.Fatalf("creating test directory failed: %s", err)
+	}
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(movedDir, name), nil, 0666); err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetMoveInScan(true)
+
+	created := make(map[string]bool)
+	var mu sync.Mutex
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			if event.IsCreate() {
+				mu.Lock()
+				created[event.Name] = true
+				mu.Unlock()
+			}
+		}
+	}()
+
+	if err := watcher.WatchTree(testDir, nil); err != nil {
+		t.Fatalf("watching tree %q failed: %s", testDir, err)
+	}
+	if err := os.Rename(movedDir, filepath.Join(testDir, "moved")); err != nil {
+		t.Fatalf("moving test directory failed: %s", err)
+	}
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	mu.Lock()
+	for _, name := range []string{"moved/a.txt", "moved/sub", "moved/sub/b.txt"} {
+		if path := filepath.Join(testDir, filepath.FromSlash(name)); !created[path] {
+			t.Errorf("no create event received for %s", path)
+		}
+	}
+	mu.Unlock()
+
+	// The directories moved in are watched like the rest of the tree
+	testFile := filepath.Join(testDir, "moved", "sub", "c.txt")
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if !created[testFile] {
+		t.Fatalf("no create event received for %s", testFile)
+	}
+}
+
+func TestFsnotifyWatchTreeWide(t *testing.T) {
+	if nativeTrees {
+		t.Skip("trees are a single watch")
+	}
+	// Create a tree wider than the pool of workers reading it
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	want := []string{testDir}
+	for i := 0; i < 3*treeWorkers; i++ {
+		for _, dir := range []string{fmt.Sprintf("d%d", i), fmt.Sprintf("d%d/sub", i)} {
+			want = append(want, filepath.Join(testDir, filepath.FromSlash(dir)))
+		}
+		if err := os.MkdirAll(want[len(want)-1], 0777); err != nil {
+			t.Fatalf("creating test directory failed: %s", err)
+		}
+	}
+	sort.Strings(want)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	if err := watcher.WatchTree(testDir, nil); err != nil {
+		t.Fatalf("watching tree %q failed: %s", testDir, err)
+	}
+	if got := watcher.watchedPaths(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("watched %d directories, expected %d", len(got), len(want))
+	}
+}
+
+func TestFsnotifyWatchTreeProgress(t *testing.T) {
+	// Create directory tree to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	for _, dir := range []string{"a/b", "c"} {
+		if err := os.MkdirAll(filepath.Join(testDir, dir), 0777); err != nil {
+			t.Fatalf("creating test directory failed: %s", err)
+		}
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	want := 4
+	if nativeTrees {
+		want = 1
+	}
+	var last TreeProgress
+	for p := range watcher.WatchTreeProgress(testDir, nil) {
+		if last.Done {
+			t.Fatalf("report %+v after the last one", p)
+		}
+		if p.Dirs < last.Dirs {
+			t.Fatalf("directories watched went down from %d to %d", last.Dirs, p.Dirs)
+		}
+		last = p
+	}
+	if !last.Done || last.Err != nil || last.Dirs != want {
+		t.Fatalf("last report %+v, expected %d directories done", last, want)
+	}
+	if len(watcher.watchedPaths()) != want {
+		t.Fatalf("watched %d directories, expected %d", len(watcher.watchedPaths()), want)
+	}
+
+	last = <-watcher.WatchTreeProgress(filepath.Join(testDir, "missing"), nil)
+	if !last.Done || last.Err == nil {
+		t.Fatalf("report for a missing tree %+v, expected an error", last)
+	}
+}
+
+func TestFsnotifyWatchTreeRollback(t *testing.T) {
+	if nativeTrees {
+		t.Skip("trees are a single watch")
+	}
+	// Create directory tree to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	for _, dir := range []string{"a/b", "c/d"} {
+		if err := os.MkdirAll(filepath.Join(testDir, dir), 0777); err != nil {
+			t.Fatalf("creating test directory failed: %s", err)
+		}
+	}
+	watchedDir := filepath.Join(testDir, "c")
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	addWatch(t, watcher, watchedDir)
+
+	// Leave room for two more directories, failing the walk midway
+	watcher.SetBudget(Budget{MaxMemory: watcher.BudgetUsage().MaxMemory + 2*watchCost(testDir).memory})
+	err := watcher.WatchTree(testDir, nil)
+	if _, ok := err.(*BudgetError); !ok {
+		t.Fatalf("watching tree beyond the budget returned %v, expected a BudgetError", err)
+	}
+	if paths := watcher.watchedPaths(); len(paths) != 1 || paths[0] != watchedDir {
+		t.Fatalf("watched paths after a failed tree watch: %q, expected %q", paths, watchedDir)
+	}
+}
+
+func TestFsnotifyWatchTreeExcludes(t *testing.T) {
+	// Create directory tree to watch
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	for _, dir := range []string{"src/node_modules/pkg", "src/build", "build/out"} {
+		if err := os.MkdirAll(filepath.Join(testDir, filepath.FromSlash(dir)), 0777); err != nil {
+			t.Fatalf("creating test directory failed: %s", err)
+		}
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	if err := watcher.SetTreeExcludes([]string{"node_modules", "/build"}); err != nil {
+		t.Fatalf("setting excluded directories failed: %s", err)
+	}
+
+	testFile := filepath.Join(testDir, "src", "build", "TestFsnotifyWatchTreeExcludes.testfile")
+	testFileExcluded := filepath.Join(testDir, "src", "node_modules", "pkg", "TestFsnotifyWatchTreeExcludes.testfile")
+	var createReceived, excludedReceived counter
+	go func() {
+		for event := range watcher.Event {
+			t.Logf("event received: %s", event)
+			switch event.Name {
+			case testFile:
+				createReceived.increment()
+			case testFileExcluded:
+				excludedReceived.increment()
+			}
+		}
+	}()
+
+	if err := watcher.WatchTree(testDir, nil); err != nil {
+		t.Fatalf("watching tree %q failed: %s", testDir, err)
+	}
+	if !nativeTrees {
+		want := []string{testDir, filepath.Join(testDir, "src"), filepath.Join(testDir, "src", "build")}
+		if paths := watcher.watchedPaths(); !reflect.DeepEqual(paths, want) {
+			t.Fatalf("watched paths %q, expected %q", paths, want)
+		}
+	}
+
+	for _, name := range []string{testFile, testFileExcluded} {
+		if err := ioutil.WriteFile(name, nil, 0666); err != nil {
+			t.Fatalf("creating test file failed: %s", err)
+		}
+	}
+
+	// We expect this event to be received almost immediately, but let's wait 500 ms to be sure
+	time.Sleep(500 * time.Millisecond)
+	if createReceived.value() == 0 {
+		t.Fatal("no event received for a file outside the excluded directories")
+	}
+	if excludedReceived.value() != 0 {
+		t.Fatalf("events received for a file in an excluded directory (%d)", excludedReceived.value())
+	}
+}
@@ -0,0 +1,10 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !windows
+
+package fsnotify
+
+// Each directory of a tree is watched individually (see watchTreeWalk).
+const nativeTrees = false
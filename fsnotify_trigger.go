@@ -0,0 +1,164 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Trigger selects the events with one of its notifications on a name
+// matching its pattern.
+type Trigger struct {
+	Flags   uint32 // Notifications (FSN_MODIFY etc.)
+	Pattern string // Name pattern as for Router; empty matches all names
+	elems   []string
+}
+
+// A TriggerSet selects the events selected by any of its triggers.
+//
+// Its textual form, as parsed by ParseTriggers, lists the triggers
+// separated by ";". Each is a comma-separated list of notifications
+// (create, modify, delete, rename or all), optionally followed by ":" and a
+// pattern:
+//
+//	create,modify:*.go;delete:**/*.tmp
+//
+// An empty TriggerSet selects no events, so its Filter drops them all.
+// ParseTriggers rejects a list without triggers, such as ""; "all"
+// selects all events.
+//
+// A *TriggerSet is a flag.Value, so it can be set from the command line.
+type TriggerSet []Trigger
+
+var triggerNames = []struct {
+	name string
+	flag uint32
+}{
+	{"create", FSN_CREATE},
+	{"modify", FSN_MODIFY},
+	{"delete", FSN_DELETE},
+	{"rename", FSN_RENAME},
+	{"all", FSN_ALL},
+}
+
+// ParseTriggers parses the textual form of a TriggerSet.
+func ParseTriggers(s string) (TriggerSet, error) {
+	var ts TriggerSet
+	for _, rule := range strings.Split(s, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		ops, pattern := rule, ""
+		if i := strings.Index(rule, ":"); i >= 0 {
+			ops, pattern = rule[:i], strings.TrimSpace(rule[i+1:])
+		}
+		t := Trigger{Pattern: pattern}
+		for _, op := range strings.Split(ops, ",") {
+			op = strings.ToLower(strings.TrimSpace(op))
+			flag := uint32(0)
+			for _, n := range triggerNames {
+				if n.name == op {
+					flag = n.flag
+				}
+			}
+			if flag == 0 {
+				return nil, fmt.Errorf("fsnotify: unknown notification %q in trigger %q", op, rule)
+			}
+			t.Flags |= flag
+		}
+		if pattern != "" {
+			elems, err := compilePattern(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("fsnotify: malformed pattern in trigger %q: %v", rule, err)
+			}
+			t.elems = elems
+		}
+		ts = append(ts, t)
+	}
+	if len(ts) == 0 {
+		return nil, fmt.Errorf("fsnotify: no triggers in %q", s)
+	}
+	return ts, nil
+}
+
+// Match reports whether the trigger selects ev.
+func (t Trigger) Match(ev *FileEvent) bool {
+	if !ev.matchesFlags(t.Flags) {
+		return false
+	}
+	if t.Pattern == "" {
+		return true
+	}
+	elems := t.elems
+	if elems == nil {
+		// Built as a literal rather than parsed
+		var err error
+		if elems, err = compilePattern(t.Pattern); err != nil {
+			return false
+		}
+	}
+	return matchElems(elems, splitName(ev.Name))
+}
+
+// String returns the textual form of the trigger.
+func (t Trigger) String() string {
+	var ops []string
+	if t.Flags&FSN_ALL == FSN_ALL {
+		ops = []string{"all"}
+	} else {
+		for _, n := range triggerNames[:4] {
+			if t.Flags&n.flag != 0 {
+				ops = append(ops, n.name)
+			}
+		}
+	}
+	s := strings.Join(ops, ",")
+	if t.Pattern != "" {
+		s += ":" + t.Pattern
+	}
+	return s
+}
+
+// Match reports whether any trigger of ts selects ev.
+func (ts TriggerSet) Match(ev *FileEvent) bool {
+	for _, t := range ts {
+		if t.Match(ev) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns middleware dropping the events ts does not select.
+func (ts TriggerSet) Filter() Middleware {
+	return func(next EventHandler) EventHandler {
+		return EventHandlerFunc(func(ev *FileEvent) {
+			if ts.Match(ev) {
+				next.HandleEvent(ev)
+			}
+		})
+	}
+}
+
+// String returns the textual form of ts.
+func (ts TriggerSet) String() string {
+	rules := make([]string, len(ts))
+	for i, t := range ts {
+		rules[i] = t.String()
+	}
+	return strings.Join(rules, ";")
+}
+
+// Set parses s and appends its triggers to ts, for use with flag.Var.
+func (ts *TriggerSet) Set(s string) error {
+	parsed, err := ParseTriggers(s)
+	if err != nil {
+		return err
+	}
+	*ts = append(*ts, parsed...)
+	return nil
+}
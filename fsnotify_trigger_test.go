@@ -0,0 +1,66 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestParseTriggers(t *testing.T) {
+	ts, err := ParseTriggers("create,modify:*.go; delete:**/*.tmp;rename")
+	if err != nil {
+		t.Fatalf("parsing triggers failed: %s", err)
+	}
+	if want := "create,modify:*.go;delete:**/*.tmp;rename"; ts.String() != want {
+		t.Errorf("triggers formatted as %q, want %q", ts.String(), want)
+	}
+
+	tests := []struct {
+		name  string
+		flags uint32
+		want  bool
+	}{
+		{"src/main.go", FSN_CREATE, true},
+		{"src/main.go", FSN_MODIFY, true},
+		{"src/main.go", FSN_DELETE, false},
+		{"build/x/y.tmp", FSN_DELETE, true},
+		{"build/x/y.tmp", FSN_CREATE, false},
+		{"anything", FSN_RENAME, true},
+	}
+	for _, test := range tests {
+		ev := newFileEvent(test.name, test.flags)
+		if got := ts.Match(ev); got != test.want {
+			t.Errorf("triggers matched %s: %v, want %v", ev, got, test.want)
+		}
+	}
+
+	for _, bad := range []string{"chmod:*.go", "create:[", ":*.go", "", " ; "} {
+		if _, err := ParseTriggers(bad); err == nil {
+			t.Errorf("parsing %q did not fail", bad)
+		}
+	}
+}
+
+func TestTriggerSetFlag(t *testing.T) {
+	var ts TriggerSet
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&ts, "on", "triggers")
+	if err := fs.Parse([]string{"-on", "all:*.go", "-on", "delete"}); err != nil {
+		t.Fatalf("parsing flags failed: %s", err)
+	}
+	if want := "all:*.go;delete"; ts.String() != want {
+		t.Errorf("flag value is %q, want %q", ts.String(), want)
+	}
+
+	var got []string
+	h := ts.Filter()(EventHandlerFunc(func(ev *FileEvent) { got = append(got, ev.Name) }))
+	h.HandleEvent(newFileEvent("a.go", FSN_MODIFY))
+	h.HandleEvent(newFileEvent("a.txt", FSN_MODIFY))
+	h.HandleEvent(newFileEvent("a.txt", FSN_DELETE))
+	if len(got) != 2 || got[0] != "a.go" || got[1] != "a.txt" {
+		t.Errorf("filter passed %v, want [a.go a.txt]", got)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// userConfigSettle is how long the configuration directory must be quiet
+// before it is compared with its previous contents.
+const userConfigSettle = 100 * time.Millisecond
+
+// UserConfigDir returns the configuration directory of the application
+// appName in the configuration directory of the user: $XDG_CONFIG_HOME or
+// ~/.config on Unix, %AppData% on Windows, ~/Library/Application Support
+// on macOS and $home/lib on Plan 9.
+func UserConfigDir(appName string) (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, appName), nil
+}
+
+// A UserConfigWatcher watches the files of the configuration directory of
+// an application (see WatchUserConfig).
+//
+// Editors and configuration libraries seldom write files in place: they
+// write a temporary file and rename it over the file, or delete the file
+// and create it again. Rather than the events of these steps, a
+// UserConfigWatcher compares the directory with its previous contents once
+// it has been quiet for a moment, and sends a create, modify or delete
+// event for each file created, changed or removed since. Files written
+// with the same content again are not reported, nor are temporary files
+// gone by then.
+type UserConfigWatcher struct {
+	Event  chan *FileEvent              // Events for the files are returned on this channel
+	Error  chan error                   // Errors are sent on this channel
+	dir    string                       // Path of the watched directory
+	w      *Watcher                     // Watcher for the directory
+	hashes map[string][sha256.Size]byte // Content hashes of the files (key: path)
+}
+
+// WatchUserConfig watches the configuration directory of the application
+// appName (see UserConfigDir), creating it if needed.
+func WatchUserConfig(appName string) (*UserConfigWatcher, error) {
+	dir, err := UserConfigDir(appName)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	w, err := NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	c := &UserConfigWatcher{
+		Event:  make(chan *FileEvent),
+		Error:  make(chan error),
+		dir:    dir,
+		w:      w,
+		hashes: make(map[string][sha256.Size]byte),
+	}
+	c.changes()
+	if err := w.Watch(dir); err != nil {
+		w.Close()
+		return nil, err
+	}
+	go c.readEvents()
+	return c, nil
+}
+
+// Dir returns the path of the watched directory.
+func (c *UserConfigWatcher) Dir() string {
+	return c.dir
+}
+
+// Close stops watching the directory.
+func (c *UserConfigWatcher) Close() error {
+	return c.w.Close()
+}
+
+// changes hashes the content of the files in the directory and returns
+// events for those created, changed or removed since the last call.
+func (c *UserConfigWatcher) changes() []*FileEvent {
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return nil
+	}
+
+	var events []*FileEvent
+	seen := make(map[string]bool)
+	for _, fi := range files {
+		if fi.IsDir() {
+			continue
+		}
+		path := filepath.Join(c.dir, fi.Name())
+		// ReadFile follows symlinks, as applications reading the file do
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		seen[path] = true
+		hash := sha256.Sum256(data)
+		prev, found := c.hashes[path]
+		switch {
+		case !found:
+			events = append(events, newFileEvent(path, FSN_CREATE))
+		case prev != hash:
+			events = append(events, newFileEvent(path, FSN_MODIFY))
+		}
+		c.hashes[path] = hash
+	}
+	var removed []string
+	for path := range c.hashes {
+		if !seen[path] {
+			removed = append(removed, path)
+		}
+	}
+	sort.Strings(removed)
+	for _, path := range removed {
+		delete(c.hashes, path)
+		events = append(events, newFileEvent(path, FSN_DELETE))
+	}
+	return events
+}
+
+// readEvents compares the directory with its previous contents once its
+// events settle, and sends the changes.
+func (c *UserConfigWatcher) readEvents() {
+	var settle <-chan time.Time
+	events, errs := c.w.Event, c.w.Error
+	for events != nil || errs != nil {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			settle = time.After(userConfigSettle)
+		case <-settle:
+			settle = nil
+			for _, ev := range c.changes() {
+				c.Event <- ev
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			c.Error <- err
+		}
+	}
+	close(c.Event)
+	close(c.Error)
+}
@@ -0,0 +1,81 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWatchUserConfig(t *testing.T) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		t.Skipf("the configuration directory of the user is not set by $XDG_CONFIG_HOME on %s", runtime.GOOS)
+	}
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", testDir)
+
+	configFile := filepath.Join(testDir, "testapp", "config.toml")
+	if err := os.MkdirAll(filepath.Dir(configFile), 0700); err != nil {
+		t.Fatalf("creating test directory failed: %s", err)
+	}
+	if err := ioutil.WriteFile(configFile, []byte("a = 1"), 0666); err != nil {
+		t.Fatalf("creating config file failed: %s", err)
+	}
+
+	watcher, err := WatchUserConfig("testapp")
+	if err != nil {
+		t.Fatalf("WatchUserConfig() failed: %s", err)
+	}
+	defer watcher.Close()
+	if dir := watcher.Dir(); dir != filepath.Dir(configFile) {
+		t.Fatalf("watching %q, expected %q", dir, filepath.Dir(configFile))
+	}
+	go func() {
+		for err := range watcher.Error {
+			t.Errorf("error received: %s", err)
+		}
+	}()
+
+	expect := func(what string, want func(ev *FileEvent) bool) {
+		select {
+		case ev := <-watcher.Event:
+			if !want(ev) {
+				t.Fatalf("received %s, expected %s", ev, what)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event received, expected %s", what)
+		}
+	}
+
+	// Atomic save: a temporary file renamed over the file
+	tmpFile := configFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, []byte("a = 2"), 0666); err != nil {
+		t.Fatalf("writing temporary file failed: %s", err)
+	}
+	if err := os.Rename(tmpFile, configFile); err != nil {
+		t.Fatalf("renaming temporary file failed: %s", err)
+	}
+	expect("a modify of the config file", func(ev *FileEvent) bool {
+		return ev.Name == configFile && ev.IsModify()
+	})
+
+	// Saving the same content again is no change
+	if err := ioutil.WriteFile(configFile, []byte("a = 2"), 0666); err != nil {
+		t.Fatalf("writing config file failed: %s", err)
+	}
+	if err := os.Remove(configFile); err != nil {
+		t.Fatalf("removing config file failed: %s", err)
+	}
+	expect("a delete of the config file", func(ev *FileEvent) bool {
+		return ev.Name == configFile && ev.IsDelete()
+	})
+}
@@ -7,13 +7,16 @@
 package fsnotify
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
@@ -49,9 +52,29 @@ const (
 // Event is the type of the notification messages
 // received on the watcher's Event channel.
 type FileEvent struct {
-	mask   uint32 // Mask of events
-	cookie uint32 // Unique cookie associating related events (for rename)
-	Name   string // File name (optional)
+	mask        uint32          // Mask of events
+	cookie      uint32          // Unique cookie associating related events (for rename)
+	Name        string          // File name (optional)
+	prevSize    int64           // Size of the file before a modification (not tracked on Windows)
+	size        int64           // Size of the file after a modification (not tracked on Windows)
+	sized       bool            // Set if prevSize and size are known
+	replaced    bool            // Set if a different file took the place of the file (not tracked on Windows)
+	xattr       bool            // Set if the extended attributes of the file changed (not tracked on Windows)
+	delta       *ContentDelta   // Content before and after a modification (see SetContentTracking)
+	retarget    string          // New target of a watched symlink (see WatchSymlink)
+	movedFrom   string          // Source of a probable move (see SetMoveCorrelation)
+	overflow    bool            // Set on events reporting that events were dropped (see IsOverflow)
+	rescan      []string        // Watched paths affected by an overflow (see RescanRoots)
+	locked      bool            // Set if the file was still locked when delivered (see LockWait)
+	placeholder bool            // Set if the file was a cloud placeholder when delivered (see IsPlaceholder)
+	dir         bool            // Set if the event refers to a directory (see IsDir)
+	stamp       time.Time       // When the event was observed (see Time)
+	proc        *Process        // Process that caused the event (see SetProcessTracking)
+	move        MoveDirection   // Direction of a paired rename (see SetRenamePairing)
+	ops         uint32          // Notifications the system does not report (see FSN_USER)
+	parts       []*FileEvent    // Events combined by the event (see Parts)
+	err         error           // Error queued in order with the events (see Ordered)
+	ctx         context.Context // Context of the watch that delivered the event
 }
 
 // IsCreate reports whether the FileEvent was triggered by a creation
@@ -72,24 +95,66 @@ func (e *FileEvent) IsRename() bool {
 	return ((e.mask&sys_FS_MOVE) == sys_FS_MOVE || (e.mask&sys_FS_MOVE_SELF) == sys_FS_MOVE_SELF || (e.mask&sys_FS_MOVED_FROM) == sys_FS_MOVED_FROM || (e.mask&sys_FS_MOVED_TO) == sys_FS_MOVED_TO)
 }
 
+// movedTo reports whether the event names the file of a rename under its
+// new name.
+func (e *FileEvent) movedTo() bool { return e.mask&sys_FS_MOVED_TO == sys_FS_MOVED_TO }
+
 // IsAttrib reports whether the FileEvent was triggered by a change in the file metadata.
 func (e *FileEvent) IsAttrib() bool {
 	return (e.mask & sys_FS_ATTRIB) == sys_FS_ATTRIB
 }
 
+// isWrite reports whether the FileEvent was triggered by a change of the
+// file content, rather than its metadata.
+func (e *FileEvent) isWrite() bool { return e.mask&sys_FS_MODIFY == sys_FS_MODIFY }
+
+// RawMask returns the mask of the event, for the cases the predicates do
+// not cover. Windows reports actions rather than masks; each is given the
+// value of its inotify counterpart, FILE_ACTION_ADDED that of IN_CREATE
+// (0x100), FILE_ACTION_RENAMED_OLD_NAME that of IN_MOVED_FROM (0x40) and
+// so on.
+func (e *FileEvent) RawMask() uint32 { return e.mask }
+
+// Cookie returns the cookie associating the halves of a rename, numbered
+// by the watcher as Windows reports them one after the other, or zero.
+func (e *FileEvent) Cookie() uint32 { return e.cookie }
+
+// newFileEvent returns a synthetic event for name, as if it had been
+// triggered by the given notifications (FSN_CREATE etc.)
+func newFileEvent(name string, flags uint32) *FileEvent {
+	e := &FileEvent{Name: name}
+	if flags&FSN_CREATE == FSN_CREATE {
+		e.mask |= sys_FS_CREATE
+	}
+	if flags&FSN_MODIFY == FSN_MODIFY {
+		e.mask |= sys_FS_MODIFY
+	}
+	if flags&FSN_DELETE == FSN_DELETE {
+		e.mask |= sys_FS_DELETE
+	}
+	if flags&FSN_RENAME == FSN_RENAME {
+		e.mask |= sys_FS_MOVE_SELF
+	}
+	return e
+}
+
 const (
 	opAddWatch = iota
+	opAddTree
 	opRemoveWatch
 )
 
 const (
 	provisional uint64 = 1 << (32 + iota)
+	subtree            // Directory is watched with its whole subtree
 )
 
 type input struct {
 	op    int
 	path  string
 	flags uint32
+	skip  []string // Trees not reported below a subtree watch (opAddTree)
+	depth int      // Levels of directories reported below a subtree watch (opAddTree; zero for all)
 	reply chan error
 }
 
@@ -106,7 +171,28 @@ type watch struct {
 	mask   uint64            // Directory itself is being watched with these notify flags
 	names  map[string]uint64 // Map of names being watched and their notify flags
 	rename string            // Remembers the old name while renaming a file
-	buf    [4096]byte
+	skip   []string          // Trees not reported below a subtree watch
+	depth  int               // Levels of directories reported below a subtree watch (zero for all)
+	buf    []byte            // Buffer of ReadDirectoryChanges
+}
+
+// Sizes of the buffers of ReadDirectoryChanges. A subtree watch gets the
+// largest buffer allowed for network shares, as changes across a tree fill
+// a small one before they are read.
+const (
+	watchBufSize   = 4096
+	subtreeBufSize = 64 * 1024
+)
+
+// maxPathLen is the length limit of paths in UTF-16 code units, with the
+// \\?\ prefix that lifts MAX_PATH.
+const maxPathLen = 32767
+
+// watchCost estimates the resources of watching path (see SetBudget): the
+// buffer of its directory. Subtree watches reserve the rest of their larger
+// buffer when they are added.
+func watchCost(path string) budgetCost {
+	return budgetCost{memory: watchBufSize}
 }
 
 type indexMap map[uint64]*watch
@@ -115,16 +201,47 @@ type watchMap map[uint32]indexMap
 // A Watcher waits for and receives event notifications
 // for a specific set of files and directories.
 type Watcher struct {
-	mu            sync.Mutex        // Map access
-	port          syscall.Handle    // Handle to completion port
-	watches       watchMap          // Map of watches (key: i-number)
-	fsnFlags      map[string]uint32 // Map of watched files to flags used for filter
-	fsnmut        sync.Mutex        // Protects access to fsnFlags.
-	input         chan *input       // Inputs to the reader are sent on this channel
-	internalEvent chan *FileEvent   // Events are queued on this channel
-	Event         chan *FileEvent   // Events are returned on this channel
-	Error         chan error        // Errors are sent on this channel
-	isClosed      bool              // Set to true when Close() is first called
+	mu            sync.Mutex              // Map access
+	port          syscall.Handle          // Handle to completion port
+	watches       watchMap                // Map of watches (key: i-number)
+	fsnFlags      map[string]uint32       // Map of watched files to flags used for filter
+	handlers      map[string]EventHandler // Map of watched files to event handlers (nil for the Event channel)
+	middleware    []Middleware            // Middleware wrapping event delivery (see Use)
+	policy        *PathPolicy             // Policy validating watched paths (see SetPathPolicy)
+	root          string                  // Base directory watched paths are resolved in (see SetRoot)
+	rootBeneath   bool                    // Set if paths leading out of root are rejected (see SetRootBeneath)
+	broker        *Broker                 // Broker of the Event channel (see Fanout)
+	ignored       []string                // Base names of files to ignore (see SetIgnoredNames)
+	treeDepth     int                     // Levels of directories watched below trees (see SetTreeDepth)
+	links         linkTable               // Known files, for events on hard links (see SetHardlinkTracking)
+	contents      contentCache            // Cached contents of small files (see SetContentTracking)
+	recent        recentBuffer            // Recently delivered events (see SetRecent)
+	dups          dupTable                // Identities of watched paths (see SetDuplicatePolicy)
+	symlinks      symlinkTable            // Watched symlinks (see WatchSymlink)
+	pending       pendingTable            // Watches of paths that do not exist yet (see SetPendingWatches)
+	renames       renameTable             // Old names of renames waiting for the new ones (see SetCompositeEvents)
+	order         orderTable              // Ordered stream of events and errors (see Ordered)
+	coop          coopQueue               // Events between calls of Poll (see NewCooperativeWatcher)
+	moves         moveTable               // Known files, to pair cross-device moves (see SetMoveCorrelation)
+	scans         scanTable               // Known files, to rescan after sleep (see SetResumeRescan)
+	trees         treeTable               // Roots of tree watches, to extend to directories moved in (see SetMoveInScan)
+	polls         pollTable               // Paths watched by polling (see SetPolling)
+	drain         drainState              // Events in flight on Close (see SetDrainOnClose)
+	activity      activityTable           // Watched paths of the latest events (see RescanRoots)
+	fair          fairQueue               // Events queued per watch root (see SetFairness)
+	consistency   consistencyTable        // Watched paths with lost events (see SetConsistencyTracking)
+	steps         stepTable               // Time spent in the steps of delivery (see SetStepTiming)
+	suppressed    suppressTable           // Paths the application is changing (see IgnorePath)
+	mock          *mockBackend            // Recorded watches of a MockWatcher (nil otherwise)
+	budget        budgetTable             // Resources of the watches (see SetBudget)
+	journals      journalTable            // Paths watched through change journals (see WatchJournal)
+	longNames     longNameCache           // Long names of short names (see SetLongNames)
+	fsnmut        sync.Mutex              // Protects access to fsnFlags, handlers, middleware, policy, root, broker, ignored and treeDepth.
+	input         chan *input             // Inputs to the reader are sent on this channel
+	internalEvent chan *FileEvent         // Events are queued on this channel
+	Event         chan *FileEvent         // Events are returned on this channel
+	Error         chan error              // Errors are sent on this channel
+	isClosed      bool                    // Set to true when Close() is first called
 	quit          chan chan<- error
 	cookie        uint32
 }
@@ -139,6 +256,7 @@ func NewWatcher() (*Watcher, error) {
 		port:          port,
 		watches:       make(watchMap),
 		fsnFlags:      make(map[string]uint32),
+		handlers:      make(map[string]EventHandler),
 		input:         make(chan *input, 1),
 		Event:         make(chan *FileEvent, 50),
 		internalEvent: make(chan *FileEvent),
@@ -158,6 +276,12 @@ func (w *Watcher) Close() error {
 		return nil
 	}
 	w.isClosed = true
+	w.drain.close()
+	w.symlinks.close()
+	w.pending.close()
+	w.scans.close()
+	w.polls.close()
+	w.journals.close()
 
 	// Send "quit" message to the reader goroutine
 	ch := make(chan error)
@@ -191,8 +315,69 @@ func (w *Watcher) watch(path string) error {
 	return w.AddWatch(path, sys_FS_ALL_EVENTS)
 }
 
+var procGetDriveType = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDriveTypeW")
+
+const sys_DRIVE_REMOTE = 4
+
+// isRemoteFS reports whether path is on a network share or a mapped
+// network drive.
+func isRemoteFS(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	vol := filepath.VolumeName(abs)
+	if strings.HasPrefix(vol, `\\`) {
+		return true
+	}
+	root, err := syscall.UTF16PtrFromString(vol + `\`)
+	if err != nil {
+		return false
+	}
+	kind, _, _ := procGetDriveType.Call(uintptr(unsafe.Pointer(root)))
+	return kind == sys_DRIVE_REMOTE
+}
+
+// A tree is a single watch, which covers directories moved in.
+const nativeTrees = true
+
+// watchTree adds a single watch of the directory path and its subtree,
+// delivering its events to h. Events deeper than depth are dropped. The
+// whole tree is watched at once, so progress is reported once.
+func (w *Watcher) watchTree(path string, skip []string, depth int, h EventHandler, progress func(dirs int)) error {
+	if w.isClosed {
+		return errors.New("watcher already closed")
+	}
+	err := w.addPath(path, FSN_ALL, h, func(path string) error {
+		// The rest of the larger buffer of a subtree watch
+		if err := w.budget.reserve(path, budgetCost{memory: subtreeBufSize - watchBufSize}); err != nil {
+			return err
+		}
+		in := &input{
+			op:    opAddTree,
+			path:  path,
+			flags: sys_FS_ALL_EVENTS,
+			skip:  skip,
+			depth: depth,
+			reply: make(chan error),
+		}
+		w.input <- in
+		if err := w.wakeupReader(); err != nil {
+			return err
+		}
+		return <-in.reply
+	})
+	if err == nil && progress != nil {
+		progress(1)
+	}
+	return err
+}
+
 // RemoveWatch removes path from the watched file set.
 func (w *Watcher) removeWatch(path string) error {
+	if w.journals.remove(path) {
+		return nil
+	}
 	in := &input{
 		op:    opRemoveWatch,
 		path:  filepath.Clean(path),
@@ -205,6 +390,17 @@ func (w *Watcher) removeWatch(path string) error {
 	return <-in.reply
 }
 
+// Size tracking is not supported on Windows, which does not keep
+// file information for watched names.
+func (w *Watcher) setSizeTracking(enable bool) {}
+
+// Scan budgets have no effect on Windows, which reports created files
+// directly.
+func (w *Watcher) setScanBudget(budget time.Duration) {}
+
+// Xattr tracking is not supported on Windows.
+func (w *Watcher) setXattrTracking(enable bool) {}
+
 func (w *Watcher) wakeupReader() error {
 	e := syscall.PostQueuedCompletionStatus(w.port, 0, 0, nil)
 	if e != nil {
@@ -268,7 +464,7 @@ func (m watchMap) set(ino *inode, watch *watch) {
 }
 
 // Must run within the I/O thread.
-func (w *Watcher) addWatch(pathname string, flags uint64) error {
+func (w *Watcher) addWatch(pathname string, flags uint64, skip []string, depth int) error {
 	dir, err := getDir(pathname)
 	if err != nil {
 		return err
@@ -276,6 +472,9 @@ func (w *Watcher) addWatch(pathname string, flags uint64) error {
 	if flags&sys_FS_ONLYDIR != 0 && pathname != dir {
 		return nil
 	}
+	if flags&subtree != 0 && pathname != dir {
+		return fmt.Errorf("can't watch the subtree of a file: %s", pathname)
+	}
 	ino, err := getIno(dir)
 	if err != nil {
 		return err
@@ -292,6 +491,10 @@ func (w *Watcher) addWatch(pathname string, flags uint64) error {
 			ino:   ino,
 			path:  dir,
 			names: make(map[string]uint64),
+			buf:   make([]byte, watchBufSize),
+		}
+		if flags&subtree != 0 {
+			watchEntry.buf = make([]byte, subtreeBufSize)
 		}
 		w.mu.Lock()
 		w.watches.set(ino, watchEntry)
@@ -302,6 +505,10 @@ func (w *Watcher) addWatch(pathname string, flags uint64) error {
 	}
 	if pathname == dir {
 		watchEntry.mask |= flags
+		if flags&subtree != 0 {
+			watchEntry.skip = skip
+			watchEntry.depth = depth
+		}
 	} else {
 		watchEntry.names[filepath.Base(pathname)] |= flags
 	}
@@ -333,11 +540,11 @@ func (w *Watcher) remWatch(pathname string) error {
 		return fmt.Errorf("can't remove non-existent watch for: %s", pathname)
 	}
 	if pathname == dir {
-		w.sendEvent(watch.path, watch.mask&sys_FS_IGNORED)
+		w.sendEvent(watch.path, watch.mask&sys_FS_IGNORED, true)
 		watch.mask = 0
 	} else {
 		name := filepath.Base(pathname)
-		w.sendEvent(watch.path+"\\"+name, watch.names[name]&sys_FS_IGNORED)
+		w.sendEvent(watch.path+"\\"+name, watch.names[name]&sys_FS_IGNORED, false)
 		delete(watch.names, name)
 	}
 	return w.startRead(watch)
@@ -347,13 +554,13 @@ func (w *Watcher) remWatch(pathname string) error {
 func (w *Watcher) deleteWatch(watch *watch) {
 	for name, mask := range watch.names {
 		if mask&provisional == 0 {
-			w.sendEvent(watch.path+"\\"+name, mask&sys_FS_IGNORED)
+			w.sendEvent(watch.path+"\\"+name, mask&sys_FS_IGNORED, false)
 		}
 		delete(watch.names, name)
 	}
 	if watch.mask != 0 {
 		if watch.mask&provisional == 0 {
-			w.sendEvent(watch.path, watch.mask&sys_FS_IGNORED)
+			w.sendEvent(watch.path, watch.mask&sys_FS_IGNORED, true)
 		}
 		watch.mask = 0
 	}
@@ -362,7 +569,7 @@ func (w *Watcher) deleteWatch(watch *watch) {
 // Must run within the I/O thread.
 func (w *Watcher) startRead(watch *watch) error {
 	if e := syscall.CancelIo(watch.ino.handle); e != nil {
-		w.Error <- os.NewSyscallError("CancelIo", e)
+		w.deliverError(os.NewSyscallError("CancelIo", e))
 		w.deleteWatch(watch)
 	}
 	mask := toWindowsFlags(watch.mask)
@@ -371,7 +578,7 @@ func (w *Watcher) startRead(watch *watch) error {
 	}
 	if mask == 0 {
 		if e := syscall.CloseHandle(watch.ino.handle); e != nil {
-			w.Error <- os.NewSyscallError("CloseHandle", e)
+			w.deliverError(os.NewSyscallError("CloseHandle", e))
 		}
 		w.mu.Lock()
 		delete(w.watches[watch.ino.volume], watch.ino.index)
@@ -379,12 +586,12 @@ func (w *Watcher) startRead(watch *watch) error {
 		return nil
 	}
 	e := syscall.ReadDirectoryChanges(watch.ino.handle, &watch.buf[0],
-		uint32(unsafe.Sizeof(watch.buf)), false, mask, nil, &watch.ov, 0)
+		uint32(len(watch.buf)), watch.mask&subtree != 0, mask, nil, &watch.ov, 0)
 	if e != nil {
 		err := os.NewSyscallError("ReadDirectoryChanges", e)
 		if e == syscall.ERROR_ACCESS_DENIED && watch.mask&provisional == 0 {
 			// Watched directory was probably removed
-			if w.sendEvent(watch.path, watch.mask&sys_FS_DELETE_SELF) {
+			if w.sendEvent(watch.path, watch.mask&sys_FS_DELETE_SELF, true) {
 				if watch.mask&sys_FS_ONESHOT != 0 {
 					watch.mask = 0
 				}
@@ -438,7 +645,9 @@ func (w *Watcher) readEvents() {
 			case in := <-w.input:
 				switch in.op {
 				case opAddWatch:
-					in.reply <- w.addWatch(in.path, uint64(in.flags))
+					in.reply <- w.addWatch(in.path, uint64(in.flags), nil, 0)
+				case opAddTree:
+					in.reply <- w.addWatch(in.path, uint64(in.flags)|subtree, in.skip, in.depth)
 				case opRemoveWatch:
 					in.reply <- w.remWatch(in.path)
 				}
@@ -450,16 +659,16 @@ func (w *Watcher) readEvents() {
 		switch e {
 		case sys_ERROR_MORE_DATA:
 			if watch == nil {
-				w.Error <- errors.New("ERROR_MORE_DATA has unexpectedly null lpOverlapped buffer")
+				w.deliverError(errors.New("ERROR_MORE_DATA has unexpectedly null lpOverlapped buffer"))
 			} else {
 				// The i/o succeeded but the buffer is full.
 				// In theory we should be building up a full packet.
 				// In practice we can get away with just carrying on.
-				n = uint32(unsafe.Sizeof(watch.buf))
+				n = uint32(len(watch.buf))
 			}
 		case syscall.ERROR_ACCESS_DENIED:
 			// Watched directory was probably removed
-			w.sendEvent(watch.path, watch.mask&sys_FS_DELETE_SELF)
+			w.sendEvent(watch.path, watch.mask&sys_FS_DELETE_SELF, true)
 			w.deleteWatch(watch)
 			w.startRead(watch)
 			continue
@@ -467,7 +676,7 @@ func (w *Watcher) readEvents() {
 			// CancelIo was called on this handle
 			continue
 		default:
-			w.Error <- os.NewSyscallError("GetQueuedCompletionPort", e)
+			w.deliverError(os.NewSyscallError("GetQueuedCompletionPort", e))
 			continue
 		case nil:
 		}
@@ -475,16 +684,27 @@ func (w *Watcher) readEvents() {
 		var offset uint32
 		for {
 			if n == 0 {
-				w.internalEvent <- &FileEvent{mask: sys_FS_Q_OVERFLOW}
-				w.Error <- errors.New("short read in readEvents()")
+				w.internalEvent <- &FileEvent{mask: sys_FS_Q_OVERFLOW, overflow: true, rescan: []string{watch.path}}
+				w.deliverError(errors.New("short read in readEvents()"))
 				break
 			}
 
 			// Point "raw" to the event in the buffer
 			raw := (*syscall.FileNotifyInformation)(unsafe.Pointer(&watch.buf[offset]))
-			buf := (*[syscall.MAX_PATH]uint16)(unsafe.Pointer(&raw.FileName))
-			name := syscall.UTF16ToString(buf[:raw.FileNameLength/2])
+			// Names below a subtree watch may be longer than MAX_PATH
+			buf := (*[maxPathLen]uint16)(unsafe.Pointer(&raw.FileName))
+			name := w.longNames.resolve(watch.path, syscall.UTF16ToString(buf[:raw.FileNameLength/2]))
 			fullname := watch.path + "\\" + name
+			if watch.mask&subtree != 0 && (skipped(name, watch.skip) || tooDeep(filepath.Dir(name), watch.depth)) {
+				if raw.NextEntryOffset == 0 {
+					break
+				}
+				if offset += raw.NextEntryOffset; offset >= n {
+					w.deliverError(errors.New("Windows system assumed buffer larger than it is, events have likely been missed."))
+					break
+				}
+				continue
+			}
 
 			var mask uint64
 			switch raw.Action {
@@ -503,7 +723,7 @@ func (w *Watcher) readEvents() {
 			}
 
 			sendNameEvent := func() {
-				if w.sendEvent(fullname, watch.names[name]&mask) {
+				if w.sendEvent(fullname, watch.names[name]&mask, false) {
 					if watch.names[name]&sys_FS_ONESHOT != 0 {
 						delete(watch.names, name)
 					}
@@ -513,10 +733,11 @@ func (w *Watcher) readEvents() {
 				sendNameEvent()
 			}
 			if raw.Action == syscall.FILE_ACTION_REMOVED {
-				w.sendEvent(fullname, watch.names[name]&sys_FS_IGNORED)
+				w.sendEvent(fullname, watch.names[name]&sys_FS_IGNORED, false)
 				delete(watch.names, name)
 			}
-			if w.sendEvent(fullname, watch.mask&toFSnotifyFlags(raw.Action)) {
+			entryMask := watch.mask & toFSnotifyFlags(raw.Action)
+			if w.sendEvent(fullname, entryMask, entryMask != 0 && isDirEntry(fullname, raw.Action)) {
 				if watch.mask&sys_FS_ONESHOT != 0 {
 					watch.mask = 0
 				}
@@ -534,36 +755,72 @@ func (w *Watcher) readEvents() {
 
 			// Error!
 			if offset >= n {
-				w.Error <- errors.New("Windows system assumed buffer larger than it is, events have likely been missed.")
+				w.deliverError(errors.New("Windows system assumed buffer larger than it is, events have likely been missed."))
 				break
 			}
 		}
 
+		if held := w.renames.flush(); held != nil {
+			w.deliverEvent(held)
+		}
 		if err := w.startRead(watch); err != nil {
-			w.Error <- err
+			w.deliverError(err)
 		}
 	}
 }
 
-func (w *Watcher) sendEvent(name string, mask uint64) bool {
+// isDirEntry reports whether the entry of a watched directory an action
+// names is a directory. Entries removed or renamed away are gone and
+// reported as files.
+func isDirEntry(name string, action uint32) bool {
+	if action == syscall.FILE_ACTION_REMOVED || action == syscall.FILE_ACTION_RENAMED_OLD_NAME {
+		return false
+	}
+	fi, err := os.Lstat(name)
+	return err == nil && fi.IsDir()
+}
+
+// sendEvent delivers an event for name, a directory if dir is set, unless
+// mask is zero.
+func (w *Watcher) sendEvent(name string, mask uint64, dir bool) bool {
 	if mask == 0 {
 		return false
 	}
-	event := &FileEvent{mask: uint32(mask), Name: name}
+	event := &FileEvent{mask: uint32(mask), Name: name, dir: dir, stamp: time.Now()}
 	if mask&sys_FS_MOVE != 0 {
 		if mask&sys_FS_MOVED_FROM != 0 {
 			w.cookie++
 		}
 		event.cookie = w.cookie
 	}
-	select {
-	case ch := <-w.quit:
-		w.quit <- ch
-	case w.Event <- event:
+	held, event := w.renames.pair(event)
+	if held != nil {
+		w.deliverEvent(held)
+	}
+	if event != nil {
+		w.deliverEvent(event)
 	}
 	return true
 }
 
+// deliverEvent delivers an event of the system from the I/O thread.
+func (w *Watcher) deliverEvent(event *FileEvent) {
+	events, ordered := w.Event, w.order.stream()
+	if ordered != nil {
+		events = nil
+	}
+	w.deliver(event, func(ev *FileEvent) {
+		select {
+		case ch := <-w.quit:
+			// Closing; deliver it once the I/O thread is done
+			w.quit <- ch
+			w.drain.hold(ev)
+		case events <- ev:
+		case ordered <- Notice{Event: ev}:
+		}
+	})
+}
+
 func toWindowsFlags(mask uint64) uint32 {
 	var m uint32
 	if mask&sys_FS_ACCESS != 0 {
@@ -596,3 +853,8 @@ func toFSnotifyFlags(action uint32) uint64 {
 	}
 	return 0
 }
+
+// Paths are resolved in a root by resolveInRoot only.
+func resolveInRootKernel(root, path string, beneath bool) (string, error) {
+	return "", errNoKernelResolve
+}
@@ -0,0 +1,252 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build windows
+
+package fsnotify
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// watchDirectories creates and watches n directories under dir.
+func watchDirectories(tb testing.TB, watcher *Watcher, dir string, n int) {
+	for i := 0; i < n; i++ {
+		sub := filepath.Join(dir, fmt.Sprintf("dir%05d", i))
+		if err := os.Mkdir(sub, 0755); err != nil {
+			tb.Fatalf("creating test directory failed: %s", err)
+		}
+		if err := watcher.Watch(sub); err != nil {
+			tb.Fatalf("watcher.Watch(%q) failed: %s", sub, err)
+		}
+	}
+}
+
+func TestWatchDirectoriesGoroutines(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+
+	// All directories share the completion port and its I/O thread
+	before := runtime.NumGoroutine()
+	watchDirectories(t, watcher, testDir, 500)
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("watching 500 directories started %d goroutines", after-before)
+	}
+}
+
+func BenchmarkWatchDirectories(b *testing.B) {
+	testDir, err := ioutil.TempDir("", "fsnotify")
+	if err != nil {
+		b.Fatalf("failed to create test directory: %s", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	watcher, err := NewWatcher()
+	if err != nil {
+		b.Fatalf("NewWatcher() failed: %s", err)
+	}
+	defer watcher.Close()
+
+	var before, after runtime.MemStats
+	goroutines := runtime.NumGoroutine()
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	watchDirectories(b, watcher, testDir, b.N)
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/float64(b.N), "heap-B/watch")
+	b.ReportMetric(float64(runtime.NumGoroutine()-goroutines), "goroutines")
+}
+
+func TestWatchJournalResume(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	if err := watcher.WatchJournal(testDir, JournalCursor{}); err != nil {
+		watcher.Close()
+		t.Skipf("no change journal for %q: %s", testDir, err)
+	}
+	cursor, err := watcher.JournalCursor(testDir)
+	if err != nil {
+		t.Fatalf("watcher.JournalCursor(%q) failed: %s", testDir, err)
+	}
+	watcher.Close()
+
+	// Created while not watching, reported on resuming
+	testFile := filepath.Join(testDir, "TestWatchJournalResume.testfile")
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+
+	watcher = newWatcher(t)
+	defer watcher.Close()
+	if err := watcher.WatchJournal(testDir, cursor); err != nil {
+		t.Fatalf("watcher.WatchJournal(%q) failed: %s", testDir, err)
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-watcher.Event:
+			if ev.IsCreate() && strings.EqualFold(ev.Name, testFile) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("no create event received for %q", testFile)
+		}
+	}
+}
+
+func TestFileLocked(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	testFile := filepath.Join(testDir, "TestFileLocked.testfile")
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	if fileLocked(testFile) {
+		t.Fatalf("%q locked while closed", testFile)
+	}
+	// Open for writing as editors do, sharing reads
+	h, err := syscall.CreateFile(syscall.StringToUTF16Ptr(testFile), syscall.GENERIC_WRITE, syscall.FILE_SHARE_READ,
+		nil, syscall.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		t.Fatalf("opening test file failed: %s", err)
+	}
+	if !fileLocked(testFile) {
+		t.Fatalf("%q not locked while open for writing", testFile)
+	}
+	syscall.CloseHandle(h)
+	if fileLocked(testFile) {
+		t.Fatalf("%q locked once closed", testFile)
+	}
+}
+
+func TestWatcherLongNames(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	testFile := filepath.Join(testDir, "TestWatcherLongNames.testfile")
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	buf := make([]uint16, syscall.MAX_PATH)
+	n, err := syscall.GetShortPathName(syscall.StringToUTF16Ptr(testFile), &buf[0], uint32(len(buf)))
+	if err != nil {
+		t.Fatalf("GetShortPathName(%q) failed: %s", testFile, err)
+	}
+	shortName := filepath.Base(syscall.UTF16ToString(buf[:n]))
+	if shortName == filepath.Base(testFile) {
+		t.Skip("no short names on the volume of the temporary directory")
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetLongNames(true)
+	addWatch(t, watcher, testDir)
+
+	// Write through the short name, which is reported as such
+	if err := ioutil.WriteFile(filepath.Join(testDir, shortName), []byte("data"), 0666); err != nil {
+		t.Fatalf("writing test file failed: %s", err)
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-watcher.Event:
+			if strings.EqualFold(ev.Name, testFile) {
+				return
+			}
+			if strings.EqualFold(filepath.Base(ev.Name), shortName) {
+				t.Fatalf("event for short name %q, expected %q", ev.Name, testFile)
+			}
+		case <-timeout:
+			t.Fatalf("no event received for %q", testFile)
+		}
+	}
+}
+
+func TestWatcherPlaceholder(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	testFile := filepath.Join(testDir, "TestWatcherPlaceholder.testfile")
+	if err := ioutil.WriteFile(testFile, []byte("data"), 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	if isPlaceholder(testFile) {
+		t.Fatalf("%q is a placeholder before it is marked offline", testFile)
+	}
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	addWatch(t, watcher, testDir)
+
+	// Sync clients mark evicted files offline, among other attributes
+	p := syscall.StringToUTF16Ptr(testFile)
+	if err := syscall.SetFileAttributes(p, sys_FILE_ATTRIBUTE_OFFLINE); err != nil {
+		t.Skipf("marking %q offline failed: %s", testFile, err)
+	}
+	defer syscall.SetFileAttributes(p, syscall.FILE_ATTRIBUTE_NORMAL)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-watcher.Event:
+			if ev.Name == testFile && ev.IsPlaceholder() {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("no event received for placeholder %q", testFile)
+		}
+	}
+}
+
+func TestWatcherCompositeRename(t *testing.T) {
+	testDir := tempMkdir(t)
+	defer os.RemoveAll(testDir)
+
+	watcher := newWatcher(t)
+	defer watcher.Close()
+	watcher.SetCompositeEvents(true)
+	addWatch(t, watcher, testDir)
+
+	testFile := filepath.Join(testDir, "TestWatcherCompositeRename.testfile")
+	movedFile := filepath.Join(testDir, "TestWatcherCompositeRename.moved")
+	if err := ioutil.WriteFile(testFile, nil, 0666); err != nil {
+		t.Fatalf("creating test file failed: %s", err)
+	}
+	if err := os.Rename(testFile, movedFile); err != nil {
+		t.Fatalf("renaming test file failed: %s", err)
+	}
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case ev := <-watcher.Event:
+			if ev.Name == testFile && ev.IsRename() {
+				t.Fatalf("half of a composite rename delivered on its own: %s", ev)
+			}
+			if ev.Name != movedFile || !ev.IsRename() {
+				continue
+			}
+			if len(ev.Parts()) != 2 || ev.OldPath() != testFile || ev.NewPath() != movedFile {
+				t.Fatalf("composite rename from %q to %q with parts %v, expected from %q to %q", ev.OldPath(), ev.NewPath(), ev.Parts(), testFile, movedFile)
+			}
+			return
+		case <-timeout:
+			t.Fatalf("no event received for %q", movedFile)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package fsnotifytest provides helpers for tests of watchers: temporary
+// directory trees to watch and bursts of changes to report.
+//
+//	func TestReload(t *testing.T) {
+//		dir := fsnotifytest.NewTestTree(t, "conf.d")
+//		defer os.RemoveAll(dir)
+//		...
+//		fsnotifytest.MakeBurst(t, filepath.Join(dir, "conf.d"), 100)
+//	}
+//
+// Each tree is a new directory under the temporary directory of the
+// system, so tests using them may run in parallel.
+package fsnotifytest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// NewTestTree creates a temporary directory holding the given directories,
+// slash-separated paths relative to it, and returns its path. The caller
+// removes it when done.
+func NewTestTree(tb testing.TB, dirs ...string) string {
+	tb.Helper()
+	root, err := ioutil.TempDir("", "fsnotify")
+	if err != nil {
+		tb.Fatalf("failed to create test directory: %s", err)
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, filepath.FromSlash(dir)), 0777); err != nil {
+			os.RemoveAll(root)
+			tb.Fatalf("creating test directory failed: %s", err)
+		}
+	}
+	return root
+}
+
+// MakeBurst creates n empty files in dir as fast as it can, named burst00000
+// and on, and returns their paths.
+func MakeBurst(tb testing.TB, dir string, n int) []string {
+	tb.Helper()
+	names := make([]string, n)
+	for i := range names {
+		names[i] = filepath.Join(dir, fmt.Sprintf("burst%05d", i))
+		f, err := os.OpenFile(names[i], os.O_WRONLY|os.O_CREATE, 0666)
+		if err != nil {
+			tb.Fatalf("creating test file failed: %s", err)
+		}
+		f.Close()
+	}
+	return names
+}
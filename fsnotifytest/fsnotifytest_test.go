@@ -0,0 +1,36 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsnotifytest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewTestTree(t *testing.T) {
+	root := NewTestTree(t, "a/b", "c")
+	defer os.RemoveAll(root)
+	other := NewTestTree(t)
+	defer os.RemoveAll(other)
+	if root == other {
+		t.Fatalf("two test trees share %q", root)
+	}
+	for _, dir := range []string{"a", filepath.Join("a", "b"), "c"} {
+		if fi, err := os.Stat(filepath.Join(root, dir)); err != nil || !fi.IsDir() {
+			t.Fatalf("directory %q not created: %v", dir, err)
+		}
+	}
+
+	names := MakeBurst(t, filepath.Join(root, "c"), 10)
+	files, err := ioutil.ReadDir(filepath.Join(root, "c"))
+	if err != nil {
+		t.Fatalf("reading test directory failed: %s", err)
+	}
+	if len(names) != 10 || len(files) != 10 {
+		t.Fatalf("burst created %d files, returned %d names, expected %d", len(files), len(names), 10)
+	}
+}